@@ -3,8 +3,12 @@ package config
 import (
 	_ "embed"
 	"fmt"
+	"log"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 //go:embed version
@@ -13,6 +17,20 @@ var version string
 //go:embed name
 var name string
 
+// set at build time with -ldflags "-X x-ui/config.buildVersion=..."
+var (
+	buildVersion string
+	buildCommit  string
+	buildTime    string
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
 type LogLevel string
 
 const (
@@ -22,11 +40,37 @@ const (
 	Error LogLevel = "error"
 )
 
+// invalidEnvWarned remembers the env variables already warned about, so a bad value is logged once
+var invalidEnvWarned sync.Map
+
+func warnInvalidEnv(key string, value string, reason interface{}) {
+	if _, warned := invalidEnvWarned.LoadOrStore(key+"="+value, true); !warned {
+		log.Printf("ignore invalid %v %q: %v", key, value, reason)
+	}
+}
+
 func GetVersion() string {
 	return strings.TrimSpace(version)
 }
 
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   buildVersion,
+		Commit:    buildCommit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+	}
+	if info.Version == "" {
+		info.Version = GetVersion()
+	}
+	return info
+}
+
+// GetName returns the panel name, XUI_NAME overrides the built in one
 func GetName() string {
+	if envName := strings.TrimSpace(os.Getenv("XUI_NAME")); envName != "" {
+		return envName
+	}
 	return strings.TrimSpace(name)
 }
 
@@ -34,17 +78,60 @@ func GetLogLevel() LogLevel {
 	if IsDebug() {
 		return Debug
 	}
-	logLevel := os.Getenv("XUI_LOG_LEVEL")
-	if logLevel == "" {
+	logLevel := LogLevel(strings.ToLower(os.Getenv("XUI_LOG_LEVEL")))
+	switch logLevel {
+	case "":
+		return Info
+	case Debug, Info, Warn, Error:
+		return logLevel
+	default:
+		warnInvalidEnv("XUI_LOG_LEVEL", string(logLevel), "must be debug, info, warn or error")
 		return Info
 	}
-	return LogLevel(logLevel)
 }
 
 func IsDebug() bool {
-	return os.Getenv("XUI_DEBUG") == "true"
+	value := os.Getenv("XUI_DEBUG")
+	if value == "" {
+		return false
+	}
+	debug, err := strconv.ParseBool(value)
+	if err != nil {
+		warnInvalidEnv("XUI_DEBUG", value, "must be a bool")
+		return false
+	}
+	return debug
+}
+
+// GetMasterKey returns the key settings secrets are encrypted with, from XUI_MASTER_KEY
+// or the file XUI_MASTER_KEY_FILE points to, nil if neither is set
+func GetMasterKey() ([]byte, error) {
+	if key := os.Getenv("XUI_MASTER_KEY"); key != "" {
+		return []byte(key), nil
+	}
+	keyFile := os.Getenv("XUI_MASTER_KEY_FILE")
+	if keyFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, fmt.Errorf("master key file %v is empty", keyFile)
+	}
+	return []byte(key), nil
 }
 
+func GetDataDir() string {
+	return fmt.Sprintf("/etc/%s", GetName())
+}
+
+// GetDBPath returns the database path, XUI_DB_PATH overrides the one in the data dir
 func GetDBPath() string {
-	return fmt.Sprintf("/etc/%s/%s.db", GetName(), GetName())
+	if dbPath := os.Getenv("XUI_DB_PATH"); dbPath != "" {
+		return dbPath
+	}
+	return fmt.Sprintf("%s/%s.db", GetDataDir(), GetName())
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGetBuildInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		commit  string
+		time    string
+		want    BuildInfo
+	}{
+		{"injected", "1.2.3", "abc1234", "2024-01-02T03:04:05Z", BuildInfo{Version: "1.2.3", Commit: "abc1234", BuildTime: "2024-01-02T03:04:05Z", GoVersion: runtime.Version()}},
+		{"not injected", "", "", "", BuildInfo{Version: GetVersion(), GoVersion: runtime.Version()}},
+		{"only the commit injected", "", "abc1234", "", BuildInfo{Version: GetVersion(), Commit: "abc1234", GoVersion: runtime.Version()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldVersion, oldCommit, oldTime := buildVersion, buildCommit, buildTime
+			defer func() { buildVersion, buildCommit, buildTime = oldVersion, oldCommit, oldTime }()
+			buildVersion, buildCommit, buildTime = tt.version, tt.commit, tt.time
+
+			if got := GetBuildInfo(); got != tt.want {
+				t.Errorf("GetBuildInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	name := GetName()
+	defaultDBPath := "/etc/" + name + "/" + name + ".db"
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantName     string
+		wantDBPath   string
+		wantLevel    LogLevel
+		wantDebug    bool
+		wantWarnings int
+	}{
+		{"no overrides", nil, name, defaultDBPath, Info, false, 0},
+		{"name", map[string]string{"XUI_NAME": "panel"}, "panel", "/etc/panel/panel.db", Info, false, 0},
+		{"db path wins over the name", map[string]string{"XUI_NAME": "panel", "XUI_DB_PATH": "/data/x-ui.db"}, "panel", "/data/x-ui.db", Info, false, 0},
+		{"log level", map[string]string{"XUI_LOG_LEVEL": "WARN"}, name, defaultDBPath, Warn, false, 0},
+		{"invalid log level", map[string]string{"XUI_LOG_LEVEL": "verbose"}, name, defaultDBPath, Info, false, 1},
+		{"debug", map[string]string{"XUI_DEBUG": "1", "XUI_LOG_LEVEL": "error"}, name, defaultDBPath, Debug, true, 0},
+		{"debug off", map[string]string{"XUI_DEBUG": "false"}, name, defaultDBPath, Info, false, 0},
+		{"invalid debug", map[string]string{"XUI_DEBUG": "maybe"}, name, defaultDBPath, Info, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"XUI_NAME", "XUI_DB_PATH", "XUI_LOG_LEVEL", "XUI_DEBUG"} {
+				t.Setenv(key, tt.env[key])
+			}
+			logs := &bytes.Buffer{}
+			log.SetOutput(logs)
+			defer log.SetOutput(os.Stderr)
+
+			if got := GetName(); got != tt.wantName {
+				t.Errorf("GetName() = %q, want %q", got, tt.wantName)
+			}
+			if got := GetDBPath(); got != tt.wantDBPath {
+				t.Errorf("GetDBPath() = %q, want %q", got, tt.wantDBPath)
+			}
+			// invalid values are warned about once, not on every call
+			for i := 0; i < 2; i++ {
+				if got := GetLogLevel(); got != tt.wantLevel {
+					t.Errorf("GetLogLevel() = %q, want %q", got, tt.wantLevel)
+				}
+				if got := IsDebug(); got != tt.wantDebug {
+					t.Errorf("IsDebug() = %v, want %v", got, tt.wantDebug)
+				}
+			}
+			if got := strings.Count(logs.String(), "ignore invalid"); got != tt.wantWarnings {
+				t.Errorf("%v warnings logged, want %v: %q", got, tt.wantWarnings, logs.String())
+			}
+		})
+	}
+}
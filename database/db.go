@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"os"
 	"path"
+	"time"
 	"x-ui/config"
 	"x-ui/database/model"
 )
@@ -27,10 +28,15 @@ func initUser() error {
 		user := &model.User{
 			Username: "admin",
 			Password: "admin",
+			Role:     model.RoleAdmin,
 		}
 		return db.Create(user).Error
 	}
-	return nil
+	// users from before roles were the only admin of the panel
+	return db.Model(&model.User{}).
+		Where("role = ? or role is null", "").
+		Update("role", model.RoleAdmin).
+		Error
 }
 
 func initInbound() error {
@@ -41,7 +47,51 @@ func initSetting() error {
 	return db.AutoMigrate(&model.Setting{})
 }
 func initInboundClientIps() error {
-	return db.AutoMigrate(&model.InboundClientIps{})
+	err := db.AutoMigrate(&model.InboundClientIps{})
+	if err != nil {
+		return err
+	}
+	// rows from before last_seen was kept count as seen now, otherwise the first cleanup
+	// would prune every one of them
+	return db.Model(&model.InboundClientIps{}).
+		Where("last_seen is null or last_seen = 0").
+		Update("last_seen", time.Now().Unix()).Error
+}
+
+func initLockout() error {
+	return db.AutoMigrate(&model.Lockout{})
+}
+
+func initTrafficHistory() error {
+	return db.AutoMigrate(&model.TrafficHistory{})
+}
+
+func initClientTraffic() error {
+	return db.AutoMigrate(&model.ClientTraffic{})
+}
+
+func initClientPenalty() error {
+	return db.AutoMigrate(&model.ClientPenalty{})
+}
+
+func initUserTotp() error {
+	return db.AutoMigrate(&model.UserTotp{})
+}
+
+func initBannedIp() error {
+	return db.AutoMigrate(&model.BannedIp{})
+}
+
+func initLoginSession() error {
+	return db.AutoMigrate(&model.LoginSession{})
+}
+
+func initAuditLog() error {
+	return db.AutoMigrate(&model.AuditLog{})
+}
+
+func initSentAlert() error {
+	return db.AutoMigrate(&model.SentAlert{})
 }
 
 func InitDB(dbPath string) error {
@@ -83,6 +133,42 @@ func InitDB(dbPath string) error {
 	if err != nil {
 		return err
 	}
+	err = initLockout()
+	if err != nil {
+		return err
+	}
+	err = initTrafficHistory()
+	if err != nil {
+		return err
+	}
+	err = initClientTraffic()
+	if err != nil {
+		return err
+	}
+	err = initClientPenalty()
+	if err != nil {
+		return err
+	}
+	err = initSentAlert()
+	if err != nil {
+		return err
+	}
+	err = initUserTotp()
+	if err != nil {
+		return err
+	}
+	err = initBannedIp()
+	if err != nil {
+		return err
+	}
+	err = initAuditLog()
+	if err != nil {
+		return err
+	}
+	err = initLoginSession()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
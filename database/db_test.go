@@ -0,0 +1,66 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+	"x-ui/database/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestInboundClientIpsLastSeenBackfill(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "x-ui.db")
+	old, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the table as it was before last_seen was kept
+	err = old.Exec("CREATE TABLE inbound_client_ips (id integer PRIMARY KEY AUTOINCREMENT, client_email text UNIQUE, ips text, user_agents text)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = old.Exec(`INSERT INTO inbound_client_ips (client_email, ips) VALUES ('bob', '["203.0.113.1"]'), ('alice', '[]')`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := old.DB()
+	sqlDB.Close()
+
+	before := time.Now().Unix()
+	err = InitDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []*model.InboundClientIps
+	err = GetDB().Find(&rows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("migration kept %v rows, want 2", len(rows))
+	}
+	for _, row := range rows {
+		if row.LastSeen < before {
+			t.Errorf("%v has last_seen %v, want at least %v", row.ClientEmail, row.LastSeen, before)
+		}
+	}
+	// rows seen since are left alone by a later start
+	err = GetDB().Model(&model.InboundClientIps{}).Where("client_email = ?", "bob").Update("last_seen", 42).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = initInboundClientIps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := &model.InboundClientIps{}
+	err = GetDB().Where("client_email = ?", "bob").First(row).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.LastSeen != 42 {
+		t.Errorf("last_seen of a migrated row changed to %v", row.LastSeen)
+	}
+}
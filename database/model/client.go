@@ -0,0 +1,136 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+// Client is a user of a vmess, vless or trojan inbound, as stored in the clients of the inbound settings
+type Client struct {
+	ID         string `json:"id,omitempty" form:"id"`
+	Password   string `json:"password,omitempty" form:"password"`
+	AlterId    int    `json:"alterId,omitempty" form:"alterId"`
+	Flow       string `json:"flow,omitempty" form:"flow"`
+	Email      string `json:"email" form:"email"`
+	LimitIP    int    `json:"limitIp" form:"limitIp"`
+	TotalGB    int64  `json:"totalGB,omitempty" form:"totalGB"`
+	ExpiryTime int64  `json:"expiryTime,omitempty" form:"expiryTime"`
+	SubID      string `json:"subId,omitempty" form:"subId"`
+	// TgID is the telegram user the client is bound to, only that user can ask the bot about it
+	TgID int64 `json:"tgId,omitempty" form:"tgId"`
+	// Ephemeral clients are deleted once they expire
+	Ephemeral bool `json:"ephemeral,omitempty" form:"-"`
+
+	// fields not known here, kept so they survive a round trip
+	extra map[string]json.RawMessage
+}
+
+var clientFields = []string{
+	"id", "password", "alterId", "flow", "email", "limitIp", "totalGB", "expiryTime", "subId", "tgId", "ephemeral",
+}
+
+// clientAlias has the fields of Client without its json methods
+type clientAlias Client
+
+func (c *Client) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*clientAlias)(c))
+	if err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	for _, field := range clientFields {
+		delete(fields, field)
+	}
+	c.extra = nil
+	if len(fields) > 0 {
+		c.extra = fields
+	}
+	return nil
+}
+
+func (c Client) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(clientAlias(c))
+	if err != nil || len(c.extra) == 0 {
+		return data, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range c.extra {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// ParseClients returns the clients of the inbound settings, settings without clients have none
+func ParseClients(settings string) ([]Client, error) {
+	if settings == "" {
+		return nil, nil
+	}
+	s := struct {
+		Clients []Client `json:"clients"`
+	}{}
+	err := json.Unmarshal([]byte(settings), &s)
+	if err != nil {
+		return nil, err
+	}
+	return s.Clients, nil
+}
+
+// SetClients returns the inbound settings with its clients replaced, other fields are kept
+func SetClients(settings string, clients []Client) (string, error) {
+	fields := map[string]json.RawMessage{}
+	if settings != "" {
+		err := json.Unmarshal([]byte(settings), &fields)
+		if err != nil {
+			return "", err
+		}
+	}
+	if clients == nil {
+		clients = []Client{}
+	}
+	data, err := json.Marshal(clients)
+	if err != nil {
+		return "", err
+	}
+	fields["clients"] = data
+	data, err = json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (i *Inbound) GetClients() ([]Client, error) {
+	return ParseClients(i.Settings)
+}
+
+func (i *Inbound) SetClients(clients []Client) error {
+	settings, err := SetClients(i.Settings, clients)
+	if err != nil {
+		return err
+	}
+	i.Settings = settings
+	return nil
+}
+
+// GetClient returns the client with the email, nil if the inbound has none
+func (i *Inbound) GetClient(email string) (*Client, error) {
+	clients, err := i.GetClients()
+	if err != nil {
+		return nil, err
+	}
+	for j := range clients {
+		if clients[j].Email == email {
+			return &clients[j], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,127 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const fullClientSettings = `{
+  "clients": [
+    {
+      "id": "2a1e3b2c-0000-4000-8000-000000000000",
+      "alterId": 64,
+      "flow": "xtls-rprx-direct",
+      "email": "alice@example.com",
+      "limitIp": 2,
+      "totalGB": 10737418240,
+      "expiryTime": 1767225600000,
+      "subId": "abcdefghijklmnop",
+      "tgId": 123456789,
+      "level": 1
+    },
+    {
+      "password": "trojan-password",
+      "email": "bob",
+      "limitIp": 0,
+      "ephemeral": true
+    }
+  ],
+  "decryption": "none",
+  "fallbacks": []
+}`
+
+func TestParseClients(t *testing.T) {
+	clients, err := ParseClients(fullClientSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Client{
+		{
+			ID:         "2a1e3b2c-0000-4000-8000-000000000000",
+			AlterId:    64,
+			Flow:       "xtls-rprx-direct",
+			Email:      "alice@example.com",
+			LimitIP:    2,
+			TotalGB:    10737418240,
+			ExpiryTime: 1767225600000,
+			SubID:      "abcdefghijklmnop",
+			TgID:       123456789,
+			extra:      map[string]json.RawMessage{"level": json.RawMessage("1")},
+		},
+		{
+			Password:  "trojan-password",
+			Email:     "bob",
+			Ephemeral: true,
+		},
+	}
+	if !reflect.DeepEqual(clients, want) {
+		t.Errorf("ParseClients() = %+v, want %+v", clients, want)
+	}
+}
+
+func TestClientSettingsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+	}{
+		{"full clients", fullClientSettings},
+		{"no clients", `{"decryption": "none"}`},
+		{"empty clients", `{"clients": [], "network": "tcp,udp"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clients, err := ParseClients(tt.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings, err := SetClients(tt.settings, clients)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want map[string]interface{}
+			err = json.Unmarshal([]byte(settings), &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = json.Unmarshal([]byte(tt.settings), &want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want["clients"] == nil {
+				// settings without clients get an empty list
+				want["clients"] = []interface{}{}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SetClients(ParseClients()) = %v, want %v", settings, tt.settings)
+			}
+		})
+	}
+}
+
+func TestInboundGetClient(t *testing.T) {
+	inbound := &Inbound{Settings: fullClientSettings}
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"alice@example.com", "2a1e3b2c-0000-4000-8000-000000000000"},
+		{"bob", ""},
+		// only exact emails match
+		{"alice", "missing"},
+		{"", "missing"},
+	}
+	for _, tt := range tests {
+		client, err := inbound.GetClient(tt.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := "missing"
+		if client != nil {
+			got = client.ID
+		}
+		if got != tt.want {
+			t.Errorf("GetClient(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
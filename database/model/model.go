@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 	"x-ui/util/json_util"
 	"x-ui/xray"
@@ -17,10 +18,54 @@ const (
 	Shadowsocks Protocol = "shadowsocks"
 )
 
+// the roles of panel users, every role can do what the roles after it can
+const (
+	// RoleAdmin can do everything, including changing the panel settings and users
+	RoleAdmin = "admin"
+	// RoleOperator can manage the inbounds and their clients
+	RoleOperator = "operator"
+	// RoleReadOnly can only look
+	RoleReadOnly = "readonly"
+)
+
+var roleRanks = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func IsValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// UserSourceLdap is the source of users made by ldap logins, local users have none
+const UserSourceLdap = "ldap"
+
 type User struct {
 	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role"`
+	// Source is where the password is checked, ldap users have a random password here
+	Source string `json:"source"`
+}
+
+// HasRole reports whether the user can do what the role can
+func (u *User) HasRole(role string) bool {
+	return roleRanks[u.Role] >= roleRanks[role] && roleRanks[role] > 0
+}
+
+// UserTotp is the two factor authentication of a user, kept apart from User so the
+// secret never ends up in the session
+type UserTotp struct {
+	Id      int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId  int    `json:"userId" gorm:"unique"`
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled"`
+	// LastStep is the step of the last accepted code, a code can't be used twice
+	LastStep int64 `json:"-"`
+	// RecoveryCodes are the sha256 hashes of the unused recovery codes, comma separated
+	RecoveryCodes string `json:"-"`
 }
 
 type Inbound struct {
@@ -34,6 +79,18 @@ type Inbound struct {
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
 	Penalty    int    `json:"penalty" form:"penalty" gorm:"default:-1"`
 
+	// RejectCount is how many times xray failed to start because of this inbound,
+	// AutoDisabled is set when the inbound got disabled for it
+	RejectCount  int  `json:"rejectCount" form:"-"`
+	AutoDisabled bool `json:"autoDisabled" form:"-"`
+	// EmptySince is when the enabled inbound was first seen without clients, 0 while it has some
+	EmptySince int64 `json:"emptySince" form:"-"`
+
+	// ClientCount is only filled when the inbound list is asked for it
+	ClientCount int `json:"clientCount,omitempty" form:"-" gorm:"-"`
+	// ClientStats is the traffic of the clients, only filled for the inbound list
+	ClientStats []*ClientTraffic `json:"clientStats,omitempty" form:"-" gorm:"-"`
+
 	// config part
 	Listen         string   `json:"listen" form:"listen"`
 	Port           int      `json:"port" form:"port" gorm:"unique"`
@@ -48,6 +105,95 @@ type InboundClientIps struct {
 	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	ClientEmail string `json:"clientEmail" form:"clientEmail" gorm:"unique"`
 	Ips         string `json:"ips" form:"ips"`
+	UserAgents  string `json:"userAgents" form:"userAgents"`
+	LastSeen    int64  `json:"lastSeen" form:"lastSeen"`
+}
+
+// SentAlert marks an alert as sent on a channel, it is deleted once the alert doesn't hold
+// anymore so it is sent again the next time it does
+type SentAlert struct {
+	Id  int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Key string `json:"key" gorm:"unique"`
+}
+
+// ClientPenalty is a client taken off its inbound for breaking its limits, Penalty counts
+// the checks since, like the penalty of an inbound
+type ClientPenalty struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId int    `json:"inboundId" gorm:"index"`
+	Email     string `json:"email" gorm:"unique"`
+	Penalty   int    `json:"penalty"`
+}
+
+// BannedIp is an ip kept away from the panel logins until it is unbanned or the ban expires
+type BannedIp struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Ip        string `json:"ip" gorm:"unique"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"createdAt"`
+	// ExpiresAt is in seconds, 0 means the ban never expires
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// LoginSession is a session of the panel kept on the server, its cookie only holds SessionId
+type LoginSession struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	SessionId string `json:"-" gorm:"unique"`
+	// UserId is 0 until someone logs in with the session
+	UserId    int    `json:"userId" gorm:"index"`
+	Data      string `json:"-"`
+	Ip        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	// CreatedAt, LastSeen and ExpiresAt are in seconds
+	CreatedAt int64 `json:"createdAt"`
+	LastSeen  int64 `json:"lastSeen"`
+	ExpiresAt int64 `json:"expiresAt" gorm:"index"`
+}
+
+// AuditLog is a change someone made through the panel or the api, Diff holds the fields of
+// what the route edits that the change made, as json
+type AuditLog struct {
+	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserId   int    `json:"userId"`
+	Username string `json:"username" gorm:"index"`
+	Ip       string `json:"ip"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Params   string `json:"params"`
+	Diff     string `json:"diff"`
+	Success  bool   `json:"success"`
+	Msg      string `json:"msg"`
+	// CreatedAt is in seconds
+	CreatedAt int64 `json:"createdAt" gorm:"index"`
+}
+
+type Lockout struct {
+	Id          int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Key         string `json:"key" gorm:"unique"`
+	Count       int    `json:"count"`
+	LockedUntil int64  `json:"lockedUntil"`
+	UpdatedAt   int64  `json:"updatedAt"`
+}
+
+// IsExpired reports whether the inbound expired at now, in milliseconds
+func (i *Inbound) IsExpired(now int64) bool {
+	return i.ExpiryTime > 0 && i.ExpiryTime <= now
+}
+
+// IsExhausted reports whether the inbound used up its traffic quota
+func (i *Inbound) IsExhausted() bool {
+	return i.Total > 0 && i.Up+i.Down >= i.Total
+}
+
+// GetDisableReason returns why the inbound must stay disabled regardless of penalties, empty if it may be enabled
+func (i *Inbound) GetDisableReason(now int64) string {
+	if i.IsExpired(now) {
+		return "expired"
+	}
+	if i.IsExhausted() {
+		return "traffic exhausted"
+	}
+	return ""
 }
 
 func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
@@ -66,8 +212,63 @@ func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 	}
 }
 
+// ClientTraffic is the traffic a client used on its inbound
+type ClientTraffic struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	InboundId int    `json:"inboundId" gorm:"index"`
+	Email     string `json:"email" gorm:"unique"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+}
+
 type Setting struct {
 	Id    int    `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	Key   string `json:"key" form:"key"`
 	Value string `json:"value" form:"value"`
 }
+
+// TrafficHistory is the traffic of an inbound, or of a client when Email is set, within the hour starting at Time
+type TrafficHistory struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Tag   string `json:"tag" gorm:"index"`
+	Email string `json:"email" gorm:"index"`
+	Up    int64  `json:"up"`
+	Down  int64  `json:"down"`
+	Time  int64  `json:"time" gorm:"index"`
+}
+
+// GetIps returns the ips of the client with the unix time each was last seen, rows written
+// before the times were kept hold a plain array, every ip of them gets the LastSeen of the row
+func (c *InboundClientIps) GetIps() (map[string]int64, error) {
+	ips := map[string]int64{}
+	if c.Ips == "" {
+		return ips, nil
+	}
+	err := json.Unmarshal([]byte(c.Ips), &ips)
+	if err == nil {
+		return ips, nil
+	}
+	var list []string
+	if json.Unmarshal([]byte(c.Ips), &list) != nil {
+		return nil, err
+	}
+	for _, ip := range list {
+		ips[ip] = c.LastSeen
+	}
+	return ips, nil
+}
+
+// SetIps stores the ips with their last seen time, LastSeen becomes the latest of them
+func (c *InboundClientIps) SetIps(ips map[string]int64) error {
+	data, err := json.Marshal(ips)
+	if err != nil {
+		return err
+	}
+	c.Ips = string(data)
+	for _, lastSeen := range ips {
+		if lastSeen > c.LastSeen {
+			c.LastSeen = lastSeen
+		}
+	}
+	return nil
+}
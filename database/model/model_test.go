@@ -0,0 +1,66 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInboundClientIps(t *testing.T) {
+	tests := []struct {
+		name         string
+		ips          string
+		lastSeen     int64
+		want         map[string]int64
+		wantErr      bool
+		wantLastSeen int64
+	}{
+		{"with times", `{"1.2.3.4":1700000100,"2001:db8::1":1700000200}`, 0, map[string]int64{"1.2.3.4": 1700000100, "2001:db8::1": 1700000200}, false, 1700000200},
+		{"plain array of an older row", `["1.2.3.4","2001:db8::1"]`, 1700000000, map[string]int64{"1.2.3.4": 1700000000, "2001:db8::1": 1700000000}, false, 1700000000},
+		{"empty array", `[]`, 1700000000, map[string]int64{}, false, 0},
+		{"empty", "", 0, map[string]int64{}, false, 0},
+		{"invalid", `{"1.2.3.4":`, 0, nil, true, 0},
+		{"neither a map nor an array", `"1.2.3.4"`, 0, nil, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &InboundClientIps{Ips: tt.ips, LastSeen: tt.lastSeen}
+			got, err := c.GetIps()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetIps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetIps() = %v, want %v", got, tt.want)
+			}
+
+			// the ips read back the same once stored, an older row is stored in the new form
+			stored := &InboundClientIps{}
+			err = stored.SetIps(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.LastSeen != tt.wantLastSeen {
+				t.Errorf("LastSeen = %v, want %v", stored.LastSeen, tt.wantLastSeen)
+			}
+			again, err := stored.GetIps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(again, tt.want) {
+				t.Errorf("GetIps() after SetIps() = %v, want %v", again, tt.want)
+			}
+		})
+	}
+
+	// LastSeen never goes back
+	c := &InboundClientIps{LastSeen: 1700000300}
+	err := c.SetIps(map[string]int64{"1.2.3.4": 1700000100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.LastSeen != 1700000300 {
+		t.Errorf("LastSeen = %v, want %v", c.LastSeen, 1700000300)
+	}
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"github.com/op/go-logging"
+	"io"
 	"os"
 )
 
@@ -12,11 +13,16 @@ func init() {
 }
 
 func InitLogger(level logging.Level) {
+	InitLoggerTo(level, os.Stderr)
+}
+
+// InitLoggerTo is InitLogger writing to w instead of stderr
+func InitLoggerTo(level logging.Level, w io.Writer) {
 	format := logging.MustStringFormatter(
 		`%{time:2006/01/02 15:04:05} %{level} - %{message}`,
 	)
 	newLogger := logging.MustGetLogger("x-ui")
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
+	backend := logging.NewLogBackend(w, "", 0)
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 	backendLeveled := logging.AddModuleLevel(backendFormatter)
 	backendLeveled.SetLevel(level, "")
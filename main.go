@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	_ "unsafe"
 	"x-ui/config"
@@ -20,7 +22,8 @@ import (
 )
 
 func runWebServer() {
-	log.Printf("%v %v", config.GetName(), config.GetVersion())
+	buildInfo := config.GetBuildInfo()
+	log.Printf("%v %v (commit: %v, build time: %v, %v)", config.GetName(), buildInfo.Version, buildInfo.Commit, buildInfo.BuildTime, buildInfo.GoVersion)
 
 	switch config.GetLogLevel() {
 	case config.Debug:
@@ -39,6 +42,11 @@ func runWebServer() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	settingService := service.SettingService{}
+	err = settingService.CheckSecrets()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	var server *web.Server
 
@@ -70,7 +78,10 @@ func runWebServer() {
 				return
 			}
 		default:
-			server.Stop()
+			err := server.Stop()
+			if err != nil {
+				logger.Warning("stop server err:", err)
+			}
 			return
 		}
 	}
@@ -204,6 +215,36 @@ func updateSetting(port int, username string, password string) {
 	}
 }
 
+func resetAdmin(username string, password string, yes bool) {
+	if username == "" || password == "" {
+		fmt.Println("username and password are required")
+		return
+	}
+	if !yes {
+		fmt.Print("reset the admin username and password of this panel and turn off its two factor authentication? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("reset admin canceled")
+			return
+		}
+	}
+
+	err := database.InitDB(config.GetDBPath())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	userService := service.UserService{}
+	err = userService.ResetAdmin(username, password)
+	if err != nil {
+		fmt.Println("reset admin failed:", err)
+	} else {
+		fmt.Println("reset admin success")
+	}
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		runWebServer()
@@ -239,6 +280,14 @@ func main() {
 	settingCmd.IntVar(&tgbotchatid, "tgbotchatid", 0, "set telegrame bot chat id")
 	settingCmd.BoolVar(&enabletgbot, "enabletgbot", false, "enable telegram bot notify")
 
+	resetAdminCmd := flag.NewFlagSet("reset-admin", flag.ExitOnError)
+	var resetUsername string
+	var resetPassword string
+	var resetYes bool
+	resetAdminCmd.StringVar(&resetUsername, "username", "", "new login username")
+	resetAdminCmd.StringVar(&resetPassword, "password", "", "new login password")
+	resetAdminCmd.BoolVar(&resetYes, "y", false, "do not ask for confirmation")
+
 	oldUsage := flag.Usage
 	flag.Usage = func() {
 		oldUsage()
@@ -247,6 +296,7 @@ func main() {
 		fmt.Println("    run            run web panel")
 		fmt.Println("    v2-ui          migrate form v2-ui")
 		fmt.Println("    setting        set settings")
+		fmt.Println("    reset-admin    reset admin username and password, and turn off two factor authentication")
 	}
 
 	flag.Parse()
@@ -290,13 +340,22 @@ func main() {
 		if (tgbottoken != "") || (tgbotchatid != 0) || (tgbotRuntime != "") {
 			updateTgbotSetting(tgbottoken, tgbotchatid, tgbotRuntime)
 		}
+	case "reset-admin":
+		err := resetAdminCmd.Parse(os.Args[2:])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		resetAdmin(resetUsername, resetPassword, resetYes)
 	default:
-		fmt.Println("except 'run' or 'v2-ui' or 'setting' subcommands")
+		fmt.Println("except 'run' or 'v2-ui' or 'setting' or 'reset-admin' subcommands")
 		fmt.Println()
 		runCmd.Usage()
 		fmt.Println()
 		v2uiCmd.Usage()
 		fmt.Println()
 		settingCmd.Usage()
+		fmt.Println()
+		resetAdminCmd.Usage()
 	}
 }
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"net"
+	"strings"
+)
+
+// ParseNetworks parses a comma separated list of ips and cidrs, a single ip is a network of its own
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, NewError("invalid ip:", item)
+			}
+			bits := 128
+			if ipv4 := ip.To4(); ipv4 != nil {
+				ip = ipv4
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// NetworksContain reports whether ip is in one of the networks
+func NetworksContain(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
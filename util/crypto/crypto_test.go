@@ -0,0 +1,85 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty", ""},
+		{"token", "123456:ABC-DEF1234ghIkl-zyx57W2v1u123ew11"},
+		{"unicode", "密钥 🔑"},
+		{"long", strings.Repeat("secret", 1000)},
+	}
+	key := []byte("master key")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := Encrypt(key, tt.plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncrypted(encrypted) {
+				t.Errorf("IsEncrypted(%q) = false", encrypted)
+			}
+			if tt.plaintext != "" && strings.Contains(encrypted, tt.plaintext) {
+				t.Errorf("Encrypt() leaks the plaintext: %q", encrypted)
+			}
+			decrypted, err := Decrypt(key, encrypted)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decrypted != tt.plaintext {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, tt.plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptUsesNewNonce(t *testing.T) {
+	key := []byte("master key")
+	a, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("Encrypt() returned %q twice", a)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := []byte("master key")
+	encrypted, err := Encrypt(key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := strings.TrimPrefix(encrypted, EncryptedPrefix)
+	tampered := []byte(sealed)
+	tampered[len(tampered)-2] ^= 1
+	tests := []struct {
+		name  string
+		key   []byte
+		value string
+	}{
+		{"wrong key", []byte("other key"), encrypted},
+		{"not encrypted", key, "secret"},
+		{"invalid base64", key, EncryptedPrefix + "!!!"},
+		{"too short", key, EncryptedPrefix + "AAAA"},
+		{"tampered", key, EncryptedPrefix + string(tampered)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.key, tt.value)
+			if err == nil {
+				t.Errorf("Decrypt(%q) succeeded", tt.value)
+			}
+		})
+	}
+}
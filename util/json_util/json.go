@@ -1,7 +1,10 @@
 package json_util
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"reflect"
 )
 
 type RawMessage []byte
@@ -22,3 +25,38 @@ func (m *RawMessage) UnmarshalJSON(data []byte) error {
 	*m = append((*m)[0:0], data...)
 	return nil
 }
+
+// Equals reports whether both messages hold the same json value, key order and
+// whitespace don't matter. Invalid json is compared byte by byte
+func (m RawMessage) Equals(other RawMessage) bool {
+	if bytes.Equal(m, other) {
+		return true
+	}
+	value, err := decodeRawMessage(m)
+	if err != nil {
+		return false
+	}
+	otherValue, err := decodeRawMessage(other)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(value, otherValue)
+}
+
+// decodeRawMessage decodes the message keeping numbers as written, an empty message is null
+func decodeRawMessage(m RawMessage) (interface{}, error) {
+	if len(bytes.TrimSpace(m)) == 0 {
+		return nil, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(m))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("json.RawMessage: trailing data")
+	}
+	return value, nil
+}
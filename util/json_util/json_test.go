@@ -0,0 +1,43 @@
+package json_util
+
+import "testing"
+
+func TestRawMessageEquals(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     string
+		b     string
+		equal bool
+	}{
+		{"same bytes", `{"a":1}`, `{"a":1}`, true},
+		{"reordered keys", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, true},
+		{"whitespace", `{"a":1,"b":{"c":"d"}}`, "{\n  \"a\": 1,\n  \"b\": { \"c\": \"d\" }\n}", true},
+		{"nested reordered keys", `{"x":{"a":1,"b":2}}`, `{"x":{"b":2,"a":1}}`, true},
+		{"different value", `{"a":1}`, `{"a":2}`, false},
+		{"reordered array", `[1,2]`, `[2,1]`, false},
+		{"large numbers keep their digits", `{"a":12345678901234567890}`, `{"a":12345678901234567891}`, false},
+		{"both empty", ``, ``, true},
+		{"empty and null", ``, `null`, true},
+		{"empty and whitespace", ``, ` `, true},
+		{"empty and object", ``, `{}`, false},
+		{"invalid but same bytes", `{"a":`, `{"a":`, true},
+		{"invalid and valid", `{"a":`, `{"a":1}`, false},
+		{"invalid with other whitespace", `{"a": `, `{"a":`, false},
+		{"trailing data", `{"a":1} {}`, `{"a":1}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := RawMessage(tt.a), RawMessage(tt.b)
+			if got := a.Equals(b); got != tt.equal {
+				t.Errorf("%q.Equals(%q) = %v, want %v", tt.a, tt.b, got, tt.equal)
+			}
+			if got := b.Equals(a); got != tt.equal {
+				t.Errorf("%q.Equals(%q) = %v, want %v", tt.b, tt.a, got, tt.equal)
+			}
+		})
+	}
+	var nilMessage RawMessage
+	if !nilMessage.Equals(RawMessage("null")) {
+		t.Error("a nil message doesn't equal null")
+	}
+}
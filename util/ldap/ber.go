@@ -0,0 +1,167 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// the ber tags ldap uses, a tag is one byte of class, constructed bit and number
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+)
+
+// maxPacketLength is the longest message read from a server
+const maxPacketLength = 1 << 24
+
+var errMalformed = errors.New("malformed ldap message")
+
+// tlv is a decoded ber element, value holds the encoded children of constructed elements
+type tlv struct {
+	tag   byte
+	value []byte
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func encode(tag byte, value []byte) []byte {
+	b := append([]byte{tag}, encodeLength(len(value))...)
+	return append(b, value...)
+}
+
+func encodeString(tag byte, s string) []byte {
+	return encode(tag, []byte(s))
+}
+
+// encodeInt encodes the integer in the fewest two's complement bytes
+func encodeInt(tag byte, n int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+		if (n == 0 && b[0]&0x80 == 0) || (n == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return encode(tag, b)
+}
+
+func encodeBool(b bool) []byte {
+	if b {
+		return encode(tagBoolean, []byte{0xff})
+	}
+	return encode(tagBoolean, []byte{0})
+}
+
+func encodeConstructed(tag byte, children ...[]byte) []byte {
+	var value []byte
+	for _, child := range children {
+		value = append(value, child...)
+	}
+	return encode(tag, value)
+}
+
+// decode splits the bytes into the elements they encode
+func decode(b []byte) ([]*tlv, error) {
+	var elements []*tlv
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errMalformed
+		}
+		tag := b[0]
+		length, n, err := decodeLength(b[1:])
+		if err != nil {
+			return nil, err
+		}
+		b = b[1+n:]
+		if length > len(b) {
+			return nil, errMalformed
+		}
+		elements = append(elements, &tlv{tag: tag, value: b[:length]})
+		b = b[length:]
+	}
+	return elements, nil
+}
+
+// decodeLength returns the length the bytes start with and how many bytes it took
+func decodeLength(b []byte) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errMalformed
+	}
+	if b[0] < 0x80 {
+		return int(b[0]), 1, nil
+	}
+	count := int(b[0] & 0x7f)
+	if count == 0 || count > 4 || len(b) < 1+count {
+		return 0, 0, errMalformed
+	}
+	length := 0
+	for _, c := range b[1 : 1+count] {
+		length = length<<8 | int(c)
+	}
+	return length, 1 + count, nil
+}
+
+func (t *tlv) int() int64 {
+	var n int64
+	for i, c := range t.value {
+		if i == 0 && c&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+func (t *tlv) children() ([]*tlv, error) {
+	return decode(t.value)
+}
+
+// readPacket reads the next element from the server
+func readPacket(r *bufio.Reader) (*tlv, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	head := []byte{}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	head = append(head, first)
+	if first >= 0x80 {
+		rest := make([]byte, first&0x7f)
+		_, err = io.ReadFull(r, rest)
+		if err != nil {
+			return nil, err
+		}
+		head = append(head, rest...)
+	}
+	length, _, err := decodeLength(head)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxPacketLength {
+		return nil, errMalformed
+	}
+	value := make([]byte, length)
+	_, err = io.ReadFull(r, value)
+	if err != nil {
+		return nil, err
+	}
+	return &tlv{tag: tag, value: value}, nil
+}
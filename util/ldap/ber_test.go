@@ -0,0 +1,156 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEncodeLength(t *testing.T) {
+	tests := []struct {
+		length int
+		want   []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0x81, 0x80}},
+		{0xff, []byte{0x81, 0xff}},
+		{0x100, []byte{0x82, 0x01, 0x00}},
+		{maxPacketLength, []byte{0x84, 0x01, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		got := encodeLength(tt.length)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("encodeLength(%v) = %x, want %x", tt.length, got, tt.want)
+		}
+		length, n, err := decodeLength(got)
+		if err != nil || length != tt.length || n != len(got) {
+			t.Errorf("decodeLength(%x) = %v, %v, %v", got, length, n, err)
+		}
+	}
+}
+
+func TestEncodeIntRoundTrip(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x00, 0x80}},
+		{256, []byte{0x01, 0x00}},
+		{-1, []byte{0xff}},
+		{-128, []byte{0x80}},
+		{-129, []byte{0xff, 0x7f}},
+		{math.MaxInt32, []byte{0x7f, 0xff, 0xff, 0xff}},
+		{math.MinInt64, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		encoded := encodeInt(tagInteger, tt.n)
+		elements, err := decode(encoded)
+		if err != nil || len(elements) != 1 {
+			t.Fatalf("decode(%x) = %v, %v", encoded, elements, err)
+		}
+		if !bytes.Equal(elements[0].value, tt.want) {
+			t.Errorf("encodeInt(%v) = %x, want %x", tt.n, elements[0].value, tt.want)
+		}
+		if got := elements[0].int(); got != tt.n {
+			t.Errorf("int() of encodeInt(%v) = %v", tt.n, got)
+		}
+	}
+}
+
+func TestDecodeConstructed(t *testing.T) {
+	long := string(bytes.Repeat([]byte("x"), 300))
+	packet := encodeConstructed(tagSequence,
+		encodeInt(tagInteger, 7),
+		encodeConstructed(0x60, encodeString(tagOctetString, "cn=admin"), encodeBool(true)),
+		encodeString(tagOctetString, long),
+	)
+	elements, err := decode(packet)
+	if err != nil || len(elements) != 1 || elements[0].tag != tagSequence {
+		t.Fatalf("decode() = %v, %v", elements, err)
+	}
+	children, err := elements[0].children()
+	if err != nil || len(children) != 3 {
+		t.Fatalf("children() = %v, %v", children, err)
+	}
+	if children[0].int() != 7 {
+		t.Errorf("message id = %v, want 7", children[0].int())
+	}
+	inner, err := children[1].children()
+	if err != nil || len(inner) != 2 || string(inner[0].value) != "cn=admin" || !bytes.Equal(inner[1].value, []byte{0xff}) {
+		t.Errorf("inner children = %v, %v", inner, err)
+	}
+	if string(children[2].value) != long {
+		t.Errorf("long string has %v bytes, want %v", len(children[2].value), len(long))
+	}
+
+	packet = append(packet, encodeInt(tagInteger, 8)...)
+	read, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+	if err != nil || read.tag != tagSequence || !bytes.Equal(read.value, elements[0].value) {
+		t.Errorf("readPacket() = %v, %v", read, err)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"tag only", []byte{tagSequence}},
+		{"value too short", []byte{tagOctetString, 0x05, 'a'}},
+		{"length bytes missing", []byte{tagOctetString, 0x82, 0x01}},
+		{"indefinite length", []byte{tagSequence, 0x80, 0x00, 0x00}},
+		{"length too long", []byte{tagOctetString, 0x85, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(tt.b)
+			if err == nil {
+				t.Errorf("decode(%x) succeeded", tt.b)
+			}
+		})
+	}
+	_, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{tagSequence, 0x84, 0x7f, 0xff, 0xff, 0xff})))
+	if err == nil {
+		t.Error("readPacket() accepted a packet longer than maxPacketLength")
+	}
+}
+
+// reencode encodes the elements again with the shortest lengths
+func reencode(elements []*tlv) []byte {
+	var b []byte
+	for _, element := range elements {
+		b = append(b, encode(element.tag, element.value)...)
+	}
+	return b
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(encodeConstructed(tagSequence, encodeInt(tagInteger, 1), encodeString(tagOctetString, "cn=admin")))
+	f.Add([]byte{tagOctetString, 0x81, 0x01, 'a'})
+	f.Add([]byte{tagSequence, 0x84, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		elements, err := decode(b)
+		if err != nil {
+			return
+		}
+		// what decodes encodes back to elements with the same tags and values
+		again, err := decode(reencode(elements))
+		if err != nil || len(again) != len(elements) {
+			t.Fatalf("decode of the reencoded %x = %v, %v", b, again, err)
+		}
+		for i := range elements {
+			if again[i].tag != elements[i].tag || !bytes.Equal(again[i].value, elements[i].value) {
+				t.Fatalf("element %v of %x changed: %x %x", i, b, again[i].value, elements[i].value)
+			}
+			elements[i].children()
+			elements[i].int()
+		}
+		readPacket(bufio.NewReader(bytes.NewReader(b)))
+	})
+}
@@ -0,0 +1,200 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// the context specific tags of the search filter choices
+const (
+	filterAnd            = 0xa0
+	filterOr             = 0xa1
+	filterNot            = 0xa2
+	filterEqualityMatch  = 0xa3
+	filterSubstrings     = 0xa4
+	filterGreaterOrEqual = 0xa5
+	filterLessOrEqual    = 0xa6
+	filterPresent        = 0x87
+	filterApproxMatch    = 0xa8
+
+	substringInitial = 0x80
+	substringAny     = 0x81
+	substringFinal   = 0x82
+)
+
+var errFilter = errors.New("invalid ldap filter")
+
+// EscapeFilter escapes the value so it matches itself in a filter, for values users type
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\\', '*', '(', ')', 0:
+			b.WriteString("\\" + hex.EncodeToString([]byte{c}))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeFilter turns the \XX escapes of a filter value back into the bytes
+func unescapeFilter(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var b []byte
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b = append(b, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", errFilter
+		}
+		c, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", errFilter
+		}
+		b = append(b, c...)
+		i += 2
+	}
+	return string(b), nil
+}
+
+// compileFilter encodes the string filter of RFC 4515 for a search request
+func compileFilter(filter string) ([]byte, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	packet, end, err := parseFilter(filter, 0)
+	if err != nil {
+		return nil, err
+	}
+	if end != len(filter) {
+		return nil, errFilter
+	}
+	return packet, nil
+}
+
+// parseFilter parses the parenthesized filter at pos and returns it encoded along with
+// the position after it
+func parseFilter(filter string, pos int) ([]byte, int, error) {
+	if pos >= len(filter) || filter[pos] != '(' {
+		return nil, 0, errFilter
+	}
+	pos++
+	if pos >= len(filter) {
+		return nil, 0, errFilter
+	}
+	switch filter[pos] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if filter[pos] == '|' {
+			tag = filterOr
+		}
+		pos++
+		var children [][]byte
+		for pos < len(filter) && filter[pos] == '(' {
+			child, end, err := parseFilter(filter, pos)
+			if err != nil {
+				return nil, 0, err
+			}
+			children = append(children, child)
+			pos = end
+		}
+		if pos >= len(filter) || filter[pos] != ')' || len(children) == 0 {
+			return nil, 0, errFilter
+		}
+		return encodeConstructed(tag, children...), pos + 1, nil
+	case '!':
+		child, end, err := parseFilter(filter, pos+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if end >= len(filter) || filter[end] != ')' {
+			return nil, 0, errFilter
+		}
+		return encodeConstructed(filterNot, child), end + 1, nil
+	}
+	end := strings.IndexByte(filter[pos:], ')')
+	if end < 0 {
+		return nil, 0, errFilter
+	}
+	packet, err := parseItem(filter[pos : pos+end])
+	if err != nil {
+		return nil, 0, err
+	}
+	return packet, pos + end + 1, nil
+}
+
+// parseItem encodes a filter item like uid=john, without its parentheses
+func parseItem(item string) ([]byte, error) {
+	i := strings.IndexByte(item, '=')
+	if i <= 0 {
+		return nil, errFilter
+	}
+	attr, value := item[:i], item[i+1:]
+	tag := byte(filterEqualityMatch)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag = filterGreaterOrEqual
+	case '<':
+		tag = filterLessOrEqual
+	case '~':
+		tag = filterApproxMatch
+	}
+	if tag != filterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if attr == "" {
+		return nil, errFilter
+	}
+	if tag == filterEqualityMatch && value == "*" {
+		return encodeString(filterPresent, attr), nil
+	}
+	if tag == filterEqualityMatch && strings.Contains(value, "*") {
+		return parseSubstrings(attr, value)
+	}
+	value, err := unescapeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+	return encodeConstructed(tag, encodeString(tagOctetString, attr), encodeString(tagOctetString, value)), nil
+}
+
+func parseSubstrings(attr string, value string) ([]byte, error) {
+	parts := strings.Split(value, "*")
+	var substrings [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		part, err := unescapeFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		tag := byte(substringAny)
+		if i == 0 {
+			tag = substringInitial
+		} else if i == len(parts)-1 {
+			tag = substringFinal
+		}
+		substrings = append(substrings, encodeString(tag, part))
+	}
+	if len(substrings) == 0 {
+		return nil, errFilter
+	}
+	return encodeConstructed(filterSubstrings,
+		encodeString(tagOctetString, attr),
+		encodeConstructed(tagSequence, substrings...)), nil
+}
+
+// CheckFilter returns an error when the filter is not a valid search filter
+func CheckFilter(filter string) error {
+	_, err := compileFilter(filter)
+	return err
+}
@@ -0,0 +1,170 @@
+package ldap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// formatFilter turns the encoded filter back into its string form
+func formatFilter(t *testing.T, element *tlv) string {
+	t.Helper()
+	children, err := element.children()
+	if element.tag != filterPresent && err != nil {
+		t.Fatalf("filter %x has malformed children: %v", element.value, err)
+	}
+	switch element.tag {
+	case filterAnd, filterOr, filterNot:
+		op := map[byte]string{filterAnd: "&", filterOr: "|", filterNot: "!"}[element.tag]
+		s := "(" + op
+		for _, child := range children {
+			s += formatFilter(t, child)
+		}
+		return s + ")"
+	case filterPresent:
+		return "(" + string(element.value) + "=*)"
+	case filterSubstrings:
+		substrings, err := children[1].children()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := "(" + string(children[0].value) + "="
+		if len(substrings) > 0 && substrings[0].tag == substringInitial {
+			s += EscapeFilter(string(substrings[0].value))
+			substrings = substrings[1:]
+		}
+		s += "*"
+		for _, substring := range substrings {
+			if substring.tag == substringAny {
+				s += EscapeFilter(string(substring.value)) + "*"
+			} else {
+				s += EscapeFilter(string(substring.value))
+			}
+		}
+		return s + ")"
+	}
+	op := map[byte]string{filterEqualityMatch: "=", filterGreaterOrEqual: ">=", filterLessOrEqual: "<=", filterApproxMatch: "~="}[element.tag]
+	if op == "" || len(children) != 2 {
+		t.Fatalf("unknown filter %x %x", element.tag, element.value)
+	}
+	return "(" + string(children[0].value) + op + EscapeFilter(string(children[1].value)) + ")"
+}
+
+// roundTrip compiles the filter, formats the result and compiles that again, both must encode the same
+func roundTrip(t *testing.T, filter string) (string, error) {
+	t.Helper()
+	packet, err := compileFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	elements, err := decode(packet)
+	if err != nil || len(elements) != 1 {
+		t.Fatalf("compileFilter(%q) = %x, which doesn't decode: %v", filter, packet, err)
+	}
+	formatted := formatFilter(t, elements[0])
+	again, err := compileFilter(formatted)
+	if err != nil {
+		t.Fatalf("compileFilter(%q) of the formatted %q: %v", formatted, filter, err)
+	}
+	if !bytes.Equal(again, packet) {
+		t.Fatalf("%q and its formatted %q encode differently: %x %x", filter, formatted, packet, again)
+	}
+	return formatted, nil
+}
+
+func TestCompileFilterRoundTrip(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{"uid=john", "(uid=john)"},
+		{"(uid=john)", "(uid=john)"},
+		{"  (uid=john)  ", "(uid=john)"},
+		{"(objectClass=*)", "(objectClass=*)"},
+		{"(&(objectClass=person)(|(uid=john)(mail=john@example.com)))", "(&(objectClass=person)(|(uid=john)(mail=john@example.com)))"},
+		{"(!(disabled=TRUE))", "(!(disabled=TRUE))"},
+		{"(cn=Jo*)", "(cn=Jo*)"},
+		{"(cn=*hn)", "(cn=*hn)"},
+		{"(cn=J*o*h*n)", "(cn=J*o*h*n)"},
+		{"(cn=*o*)", "(cn=*o*)"},
+		{"(uidNumber>=1000)", "(uidNumber>=1000)"},
+		{"(uidNumber<=2000)", "(uidNumber<=2000)"},
+		{"(cn~=jon)", "(cn~=jon)"},
+		{`(cn=a\2ab\28c\29d\5ce)`, `(cn=a\2ab\28c\29d\5ce)`},
+		{`(cn=\4a\6f)`, "(cn=Jo)"},
+		{`(cn=\2a)`, `(cn=\2a)`},
+		{`(memberOf=cn=admins,ou=groups,dc=example,dc=com)`, `(memberOf=cn=admins,ou=groups,dc=example,dc=com)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := roundTrip(t, tt.filter)
+			if err != nil {
+				t.Fatalf("compileFilter(%q) = %v", tt.filter, err)
+			}
+			if got != tt.want {
+				t.Errorf("compileFilter(%q) formats as %q, want %q", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"()",
+		"(uid)",
+		"(=john)",
+		"(uid=john",
+		"(uid=john))",
+		"(&)",
+		"(&(uid=john)",
+		"(!(uid=john)(cn=john))",
+		"(cn=**)",
+		`(cn=\4)`,
+		`(cn=\zz)`,
+		"(>=1)",
+	}
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) {
+			if err := CheckFilter(filter); err == nil {
+				t.Errorf("CheckFilter(%q) succeeded", filter)
+			}
+		})
+	}
+}
+
+func FuzzCompileFilter(f *testing.F) {
+	for _, filter := range []string{
+		"(&(objectClass=person)(|(uid=john)(mail=*)))",
+		"(!(cn=J*o*n))",
+		`(cn~=a\2ab)`,
+		"(uidNumber>=1000)",
+		"uid=john",
+	} {
+		f.Add(filter)
+	}
+	f.Fuzz(func(t *testing.T, filter string) {
+		roundTrip(t, filter)
+	})
+}
+
+func FuzzEscapeFilter(f *testing.F) {
+	f.Add("john")
+	f.Add(`a*b(c)d\e`)
+	f.Add("\x00")
+	f.Fuzz(func(t *testing.T, value string) {
+		escaped := EscapeFilter(value)
+		if strings.ContainsAny(escaped, "*()\x00") {
+			t.Fatalf("EscapeFilter(%q) = %q keeps special characters", value, escaped)
+		}
+		// an escaped value only ever matches itself
+		packet, err := compileFilter("(cn=" + escaped + ")")
+		if err != nil {
+			t.Fatalf("compileFilter() of EscapeFilter(%q): %v", value, err)
+		}
+		want := encodeConstructed(filterEqualityMatch, encodeString(tagOctetString, "cn"), encodeString(tagOctetString, value))
+		if !bytes.Equal(packet, want) {
+			t.Fatalf("EscapeFilter(%q) compiles to %x, want %x", value, packet, want)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+// Package ldap is a small ldap v3 client, it binds and searches, which is all a login needs
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// the application tags of the protocol operations
+const (
+	opBindRequest       = 0x60
+	opBindResponse      = 0x61
+	opUnbindRequest     = 0x42
+	opSearchRequest     = 0x63
+	opSearchEntry       = 0x64
+	opSearchDone        = 0x65
+	opSearchReference   = 0x73
+	opExtendedRequest   = 0x77
+	opExtendedResponse  = 0x78
+	extendedRequestName = 0x80
+	simpleAuth          = 0x80
+)
+
+const startTlsOid = "1.3.6.1.4.1.1466.20037"
+
+// ResultInvalidCredentials is the result code of a bind with a wrong dn or password
+const ResultInvalidCredentials = 49
+
+// Error is a result other than success the server answered
+type Error struct {
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap result code %v", e.Code)
+	}
+	return fmt.Sprintf("ldap result code %v: %v", e.Code, e.Message)
+}
+
+// IsInvalidCredentials reports whether the error is a bind refused for a wrong dn or password
+func IsInvalidCredentials(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == ResultInvalidCredentials
+}
+
+// Entry is an object a search found
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// GetAttribute returns the values of the attribute, attribute names ignore case
+func (e *Entry) GetAttribute(name string) []string {
+	for key, values := range e.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	host    string
+	msgId   int64
+}
+
+// Dial connects to the server of the ldap:// or ldaps:// url, every operation has the timeout
+func Dial(rawUrl string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Hostname()
+	port := u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+	default:
+		return nil, fmt.Errorf("ldap url must be ldap:// or ldaps://: %v", rawUrl)
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "ldaps" {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	return &Conn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+		host:    host,
+	}, nil
+}
+
+func (c *Conn) Close() error {
+	c.msgId++
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	c.conn.Write(encodeConstructed(tagSequence, encodeInt(tagInteger, c.msgId), encode(opUnbindRequest, nil)))
+	return c.conn.Close()
+}
+
+// send sends the operation as the next message
+func (c *Conn) send(op []byte) (int64, error) {
+	c.msgId++
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.conn.Write(encodeConstructed(tagSequence, encodeInt(tagInteger, c.msgId), op))
+	return c.msgId, err
+}
+
+// receive returns the operation of the next answer to the message
+func (c *Conn) receive(msgId int64) (*tlv, error) {
+	for {
+		packet, err := readPacket(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if packet.tag != tagSequence {
+			return nil, errMalformed
+		}
+		elements, err := packet.children()
+		if err != nil {
+			return nil, err
+		}
+		if len(elements) < 2 || elements[0].tag != tagInteger {
+			return nil, errMalformed
+		}
+		// answers to other messages, like notices of disconnection, are skipped
+		if elements[0].int() == msgId {
+			return elements[1], nil
+		}
+	}
+}
+
+// checkResult returns the error of the ldap result an operation answered with
+func checkResult(op *tlv, tag byte) error {
+	if op.tag != tag {
+		return errMalformed
+	}
+	elements, err := op.children()
+	if err != nil {
+		return err
+	}
+	if len(elements) < 3 || elements[0].tag != tagEnumerated {
+		return errMalformed
+	}
+	code := elements[0].int()
+	if code != 0 {
+		return &Error{Code: code, Message: string(elements[2].value)}
+	}
+	return nil
+}
+
+// StartTLS upgrades the connection to tls, for ldap:// urls
+func (c *Conn) StartTLS() error {
+	msgId, err := c.send(encodeConstructed(opExtendedRequest, encodeString(extendedRequestName, startTlsOid)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(msgId)
+	if err != nil {
+		return err
+	}
+	err = checkResult(op, opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	conn := tls.Client(c.conn, &tls.Config{ServerName: c.host})
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	err = conn.Handshake()
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// Bind authenticates the connection as the dn with the password
+func (c *Conn) Bind(dn string, password string) error {
+	// an empty password makes an unauthenticated bind, which servers let through
+	if dn != "" && password == "" {
+		return &Error{Code: ResultInvalidCredentials, Message: "empty password"}
+	}
+	msgId, err := c.send(encodeConstructed(opBindRequest,
+		encodeInt(tagInteger, 3),
+		encodeString(tagOctetString, dn),
+		encodeString(simpleAuth, password)))
+	if err != nil {
+		return err
+	}
+	op, err := c.receive(msgId)
+	if err != nil {
+		return err
+	}
+	return checkResult(op, opBindResponse)
+}
+
+// Search returns the entries under the base dn matching the filter, with the attributes
+func (c *Conn) Search(baseDn string, filter string, attributes []string, sizeLimit int) ([]*Entry, error) {
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := make([][]byte, 0, len(attributes))
+	for _, attribute := range attributes {
+		attrs = append(attrs, encodeString(tagOctetString, attribute))
+	}
+	msgId, err := c.send(encodeConstructed(opSearchRequest,
+		encodeString(tagOctetString, baseDn),
+		// whole subtree, never dereferencing aliases
+		encodeInt(tagEnumerated, 2),
+		encodeInt(tagEnumerated, 0),
+		encodeInt(tagInteger, int64(sizeLimit)),
+		encodeInt(tagInteger, int64(c.timeout/time.Second)),
+		encodeBool(false),
+		compiled,
+		encodeConstructed(tagSequence, attrs...)))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*Entry
+	for {
+		op, err := c.receive(msgId)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case opSearchReference:
+		default:
+			return entries, checkResult(op, opSearchDone)
+		}
+	}
+}
+
+func parseEntry(op *tlv) (*Entry, error) {
+	elements, err := op.children()
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) < 2 {
+		return nil, errMalformed
+	}
+	entry := &Entry{
+		DN:         string(elements[0].value),
+		Attributes: map[string][]string{},
+	}
+	attributes, err := elements[1].children()
+	if err != nil {
+		return nil, err
+	}
+	for _, attribute := range attributes {
+		parts, err := attribute.children()
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) < 2 {
+			return nil, errMalformed
+		}
+		values, err := parts[1].children()
+		if err != nil {
+			return nil, err
+		}
+		name := string(parts[0].value)
+		for _, value := range values {
+			entry.Attributes[name] = append(entry.Attributes[name], string(value.value))
+		}
+	}
+	return entry, nil
+}
@@ -0,0 +1,73 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time range in minutes since midnight, it wraps past
+// midnight when End is before Start and covers the whole day when they are equal
+type Window struct {
+	Start int
+	End   int
+}
+
+// Windows is a set of daily time ranges, an empty set is always active
+type Windows []Window
+
+func (w Window) Contains(minute int) bool {
+	if w.Start == w.End {
+		return true
+	}
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+func (w Windows) Contains(t time.Time) bool {
+	if len(w) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, window := range w {
+		if window.Contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Parse reads comma separated ranges like "08:00-12:00,22:00-02:00", empty means always
+func Parse(value string) (Windows, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	windows := make(Windows, 0)
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, Window{Start: start, End: end})
+	}
+	return windows, nil
+}
@@ -0,0 +1,76 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Windows
+		wantErr bool
+	}{
+		{"", nil, false},
+		{" ", nil, false},
+		{"08:00-12:00", Windows{{480, 720}}, false},
+		{"08:00-12:00, 22:00-02:00", Windows{{480, 720}, {1320, 120}}, false},
+		{"00:00-00:00", Windows{{0, 0}}, false},
+		{"08:00", nil, true},
+		{"08:00-12:00-13:00", nil, true},
+		{"8am-12:00", nil, true},
+		{"24:00-01:00", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWindowsContains(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	tests := []struct {
+		name    string
+		windows string
+		clock   string
+		want    bool
+	}{
+		{"empty is always active", "", "03:00", true},
+		{"inside", "08:00-12:00", "10:30", true},
+		{"at the start", "08:00-12:00", "08:00", true},
+		{"at the end", "08:00-12:00", "12:00", false},
+		{"before", "08:00-12:00", "07:59", false},
+		{"wraps before midnight", "22:00-02:00", "23:00", true},
+		{"wraps after midnight", "22:00-02:00", "01:59", true},
+		{"outside a wrapping window", "22:00-02:00", "12:00", false},
+		{"second window", "08:00-09:00,18:00-19:00", "18:30", true},
+		{"between windows", "08:00-09:00,18:00-19:00", "12:00", false},
+		{"whole day", "05:00-05:00", "04:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := Parse(tt.windows)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := windows.Contains(at(tt.clock)); got != tt.want {
+				t.Errorf("Contains(%v) in %q = %v, want %v", tt.clock, tt.windows, got, tt.want)
+			}
+		})
+	}
+}
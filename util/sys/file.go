@@ -0,0 +1,19 @@
+// +build linux darwin
+
+package sys
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// GetFileId returns the device and inode of the file as "device:inode", it tells a file
+// apart from another one created at the same path later, like a rotated log
+func GetFileId(info os.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+}
@@ -0,0 +1,91 @@
+// Package totp implements the time based one time passwords of RFC 6238 as
+// authenticator apps use them, sha1 with 6 digits every 30 seconds
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	period = 30
+	digits = 6
+	// skew is how many periods a code may be off, clocks of phones drift
+	skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random base32 secret of 160 bits
+func NewSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return encoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// GetStep returns the step of the time, the number of periods since the unix epoch
+func GetStep(t time.Time) int64 {
+	return t.Unix() / period
+}
+
+// GenerateCode returns the code of the secret at the step
+func GenerateCode(secret string, step int64) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", digits, value%1000000), nil
+}
+
+// Validate returns the step the code is valid at around t, 0 if it is not valid
+func Validate(secret string, code string, t time.Time) int64 {
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return 0
+	}
+	step := GetStep(t)
+	for i := -skew; i <= skew; i++ {
+		expected, err := GenerateCode(secret, step+int64(i))
+		if err != nil {
+			return 0
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step + int64(i)
+		}
+	}
+	return 0
+}
+
+// GetUri returns the otpauth uri authenticator apps read from a qr code
+func GetUri(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("period", fmt.Sprint(period))
+	query.Set("digits", fmt.Sprint(digits))
+	query.Set("algorithm", "SHA1")
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
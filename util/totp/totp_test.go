@@ -0,0 +1,65 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// the sha1 secret of the test vectors of RFC 6238
+const testSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestGenerateCode(t *testing.T) {
+	tests := []struct {
+		time int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := GenerateCode(testSecret, GetStep(time.Unix(tt.time, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateCode() at %v = %v, want %v", tt.time, got, tt.want)
+		}
+	}
+}
+
+func TestValidateClockSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := GetStep(now)
+	tests := []struct {
+		name   string
+		offset int64
+		valid  bool
+	}{
+		{"current period", 0, true},
+		{"previous period", -1, true},
+		{"next period", 1, true},
+		{"two periods behind", -2, false},
+		{"two periods ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := GenerateCode(testSecret, step+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Validate(testSecret, code, now)
+			if tt.valid && got != step+tt.offset {
+				t.Errorf("Validate() = %v, want step %v", got, step+tt.offset)
+			}
+			if !tt.valid && got != 0 {
+				t.Errorf("Validate() = %v, want 0", got)
+			}
+		})
+	}
+	if got := Validate(testSecret, "12345", now); got != 0 {
+		t.Errorf("Validate() of a short code = %v, want 0", got)
+	}
+}
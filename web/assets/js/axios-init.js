@@ -3,6 +3,9 @@ axios.defaults.headers.common['X-Requested-With'] = 'XMLHttpRequest';
 
 axios.interceptors.request.use(
     config => {
+        if (config.data instanceof FormData) {
+            return config;
+        }
         config.data = Qs.stringify(config.data, {
             arrayFormat: 'repeat'
         });
@@ -3,6 +3,7 @@ class User {
     constructor() {
         this.username = "";
         this.password = "";
+        this.totpCode = "";
     }
 }
 
@@ -36,6 +37,9 @@ class DBInbound {
         this.remark = "";
         this.enable = true;
         this.expiryTime = 0;
+        this.autoDisabled = false;
+        this.emptySince = 0;
+        this.clientStats = [];
 
         this.listen = "";
         this.port = 0;
@@ -159,17 +163,103 @@ class AllSetting {
 
     constructor(data) {
         this.webListen = "";
+        this.webSocketMode = "0660";
         this.webPort = 54321;
         this.webCertFile = "";
         this.webKeyFile = "";
+        this.webCertMode = "manual";
+        this.webAcmeDomain = "";
+        this.webAcmeEmail = "";
+        this.webAcmeChallenge = "http-01";
+        this.webAcmeDnsProvider = "cloudflare";
+        this.webAcmeDnsToken = "";
         this.webBasePath = "/";
+        this.webProxyProtocol = false;
+        this.webHttpMode = "redirect";
+        this.webHttpRedirectPort = 0;
+        this.webHstsMaxAge = 0;
+        this.webHstsSubdomains = false;
+        this.webHstsPreload = false;
+        this.webShutdownTimeout = 10;
+        this.panelTitle = "";
         this.tgBotEnable = false;
         this.tgBotToken = "";
         this.tgBotChatId = 0;
+        this.tgNotifyLogin = true;
+        this.tgNotifyXrayDown = true;
+        this.tgBotSelfService = false;
+        this.smtpHost = "";
+        this.smtpPort = 587;
+        this.smtpUsername = "";
+        this.smtpPassword = "";
+        this.smtpFrom = "";
+        this.mailAdmins = "";
+        this.mailClients = false;
+        this.mailExpireDays = 3;
+        this.webhookUrls = "";
+        this.webhookSecret = "";
+        this.webhookEvents = "";
+        this.discordWebhooks = "";
+        this.slackWebhooks = "";
         this.tgRunTime = "";
         this.xrayTemplateConfig = "";
+        this.xrayIsolateFailedInbound = false;
+        this.xrayRejectThreshold = 0;
+        this.inboundSoftLimit = 0;
+        this.inboundHardLimit = 0;
+        this.emptyInboundAction = "off";
+        this.emptyInboundPeriod = 24;
         this.penalty = 0;
+        this.ipLimitIpv4Prefix = 32;
+        this.ipLimitIpv6Prefix = 128;
+        this.clientIpsRetention = 24;
+        this.ipLimitSkipList = "1.1.1.1";
+        this.ipLimitAction = "inbound";
+        this.sessionLimit = 0;
+        this.sessionWindow = 10;
+        this.restartGrace = 30;
+        this.ipLimitDecisionLog = true;
+        this.ipLimitSchedule = "";
+        this.inboundCheckSchedule = "";
+        this.accessLogEmailRegex = "";
+        this.i18nTrackMissing = false;
+        this.lockoutPersist = false;
+        this.loginMaxFailures = 5;
+        this.loginLockDuration = 5;
+        this.loginUserMaxFailures = 10;
+        this.loginBanAfter = 3;
+        this.loginBanDuration = 24;
+        this.webTrustedProxies = "127.0.0.1,::1";
+        this.oidcIssuer = "";
+        this.oidcClientId = "";
+        this.oidcClientSecret = "";
+        this.oidcRedirectUrl = "";
+        this.oidcUsernameClaim = "email";
+        this.authBackend = "local";
+        this.ldapUrl = "";
+        this.ldapStartTls = false;
+        this.ldapBindDn = "";
+        this.ldapBindPassword = "";
+        this.ldapBaseDn = "";
+        this.ldapUserFilter = "(uid=%s)";
+        this.ldapGroupAttribute = "memberOf";
+        this.ldapGroupRoles = "";
+        this.scanBlockThreshold = 0;
+        this.scanBlockDuration = 10;
+        this.corsOrigins = "";
+        this.corsMethods = "GET,POST";
+        this.corsHeaders = "Content-Type,X-Requested-With";
+        this.corsCredentials = false;
+        this.metricsFile = "";
+        this.metricsFileInterval = 60;
+        this.metricsToken = "";
+        this.apiTokens = "";
+        this.updateCheckUrl = "";
+        this.updateCheckInterval = 24;
 
+        this.xrayCheckInterval = 30;
+        this.trafficInterval = 10;
+        this.inboundCheckInterval = 30;
         this.timeLocation = "Asia/Shanghai";
 
         if (data == null) {
@@ -1157,12 +1157,13 @@ Inbound.VmessSettings = class extends Inbound.Settings {
     }
 };
 Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
-    constructor(id=RandomUtil.randomUUID(), alterId=0, email='', limitIp=0) {
+    constructor(id=RandomUtil.randomUUID(), alterId=0, email='', limitIp=0, tgId=0) {
         super();
         this.id = id;
         this.alterId = alterId;
         this.email = email;
         this.limitIp = limitIp;
+        this.tgId = tgId;
 
     }
 
@@ -1172,7 +1173,7 @@ Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
             json.alterId,
             json.email,
             json.limitIp,
-
+            json.tgId,
         );
     }
 };
@@ -1215,12 +1216,13 @@ Inbound.VLESSSettings = class extends Inbound.Settings {
 };
 Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
 
-    constructor(id=RandomUtil.randomUUID(), flow=FLOW_CONTROL.DIRECT, email='', limitIp=0) {
+    constructor(id=RandomUtil.randomUUID(), flow=FLOW_CONTROL.DIRECT, email='', limitIp=0, tgId=0) {
         super();
         this.id = id;
         this.flow = flow;
         this.email = email;
         this.limitIp = limitIp;
+        this.tgId = tgId;
     }
 
     static fromJson(json={}) {
@@ -1228,7 +1230,8 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
             json.id,
             json.flow,
             json.email,
-            json.limitIp
+            json.limitIp,
+            json.tgId,
         );
     }
 };
@@ -28,13 +28,21 @@ class HttpUtil {
         }
     }
 
+    // errors like 429 may still carry a message for the user
+    static _errorToMsg(e) {
+        if (e.response && e.response.data && e.response.data.hasOwnProperty('success')) {
+            return this._respToMsg(e.response);
+        }
+        return new Msg(false, e.toString());
+    }
+
     static async get(url, data, options) {
         let msg;
         try {
             const resp = await axios.get(url, data, options);
             msg = this._respToMsg(resp);
         } catch (e) {
-            msg = new Msg(false, e.toString());
+            msg = this._errorToMsg(e);
         }
         this._handleMsg(msg);
         return msg;
@@ -46,7 +54,7 @@ class HttpUtil {
             const resp = await axios.post(url, data, options);
             msg = this._respToMsg(resp);
         } catch (e) {
-            msg = new Msg(false, e.toString());
+            msg = this._errorToMsg(e);
         }
         this._handleMsg(msg);
         return msg;
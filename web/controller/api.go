@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ApiController serves the inbounds as a json rest api for other tools, it doesn't use
+// the panel session, every request needs one of the api tokens as bearer token
+type ApiController struct {
+	inboundService      service.InboundService
+	xrayService         service.XrayService
+	userService         service.UserService
+	notificationService service.NotificationService
+}
+
+func NewApiController(g *gin.RouterGroup) *ApiController {
+	a := &ApiController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *ApiController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/api/v1")
+	g.Use(a.checkApiToken, audit)
+
+	g.GET("/inbounds", a.getInbounds)
+	g.GET("/inbounds/:id", a.getInbound)
+	g.POST("/inbounds", a.addInbound)
+	g.PUT("/inbounds/:id", a.updateInbound)
+	g.DELETE("/inbounds/:id", a.delInbound)
+}
+
+// hasValidApiToken reports whether the request carries one of the api tokens as bearer token
+func hasValidApiToken(c *gin.Context) bool {
+	auth := c.GetHeader("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := []byte(strings.TrimPrefix(auth, "Bearer "))
+	settingService := service.SettingService{}
+	tokens, err := settingService.GetApiTokens()
+	if err != nil {
+		logger.Warning("get api tokens failed:", err)
+		return false
+	}
+	for _, apiToken := range tokens {
+		if subtle.ConstantTimeCompare(token, []byte(apiToken)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ApiController) checkApiToken(c *gin.Context) {
+	if hasValidApiToken(c) {
+		c.Next()
+		return
+	}
+	c.Header("WWW-Authenticate", "Bearer")
+	c.AbortWithStatusJSON(http.StatusUnauthorized, entity.Msg{Msg: "invalid api token"})
+}
+
+func apiObj(c *gin.Context, status int, obj interface{}) {
+	c.JSON(status, entity.Msg{Success: true, Obj: obj})
+}
+
+func apiError(c *gin.Context, status int, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		status = http.StatusNotFound
+		err = errors.New("inbound not found")
+	}
+	if status >= http.StatusInternalServerError {
+		logger.Warning("api request failed:", err)
+	}
+	c.AbortWithStatusJSON(status, entity.Msg{Msg: err.Error()})
+}
+
+func getApiId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, fmt.Errorf("invalid id: %v", c.Param("id")))
+		return 0, false
+	}
+	return id, true
+}
+
+func (a *ApiController) getInbounds(c *gin.Context) {
+	inbounds, err := a.inboundService.GetAllInbounds()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiObj(c, http.StatusOK, inbounds)
+}
+
+func (a *ApiController) getInbound(c *gin.Context) {
+	id, ok := getApiId(c)
+	if !ok {
+		return
+	}
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiObj(c, http.StatusOK, inbound)
+}
+
+func (a *ApiController) addInbound(c *gin.Context) {
+	inbound := &model.Inbound{}
+	err := c.ShouldBindJSON(inbound)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	// inbounds made through the api belong to the panel user
+	user, err := a.userService.GetFirstUser()
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	inbound.Id = 0
+	inbound.UserId = user.Id
+	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	if inbound.Enable {
+		err = a.inboundService.CheckEnabledInboundLimit(1, isForce(c))
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = a.inboundService.AddInbound(inbound)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	a.xrayService.SetToNeedRestart()
+	a.notificationService.Notify(service.EventInboundCreated, service.NewInboundEvent(inbound, ""))
+	apiObj(c, http.StatusCreated, inbound)
+}
+
+func (a *ApiController) updateInbound(c *gin.Context) {
+	id, ok := getApiId(c)
+	if !ok {
+		return
+	}
+	oldInbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	inbound := &model.Inbound{}
+	err = c.ShouldBindJSON(inbound)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	inbound.Id = id
+	if inbound.Enable && !oldInbound.Enable {
+		err = a.inboundService.CheckEnabledInboundLimit(1, isForce(c))
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = a.inboundService.UpdateInbound(inbound)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err)
+		return
+	}
+	a.xrayService.SetToNeedRestart()
+	inbound, err = a.inboundService.GetInbound(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiObj(c, http.StatusOK, inbound)
+}
+
+func (a *ApiController) delInbound(c *gin.Context) {
+	id, ok := getApiId(c)
+	if !ok {
+		return
+	}
+	_, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	err = a.inboundService.DelInbound(id)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, err)
+		return
+	}
+	a.xrayService.SetToNeedRestart()
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditBody is the most of a request or response body an audit log looks at
+const maxAuditBody = 1 << 16
+
+// auditReadRoutes are the post routes that change nothing, relative to the base path
+var auditReadRoutes = map[string]bool{
+	"/xui/inbound/list":             true,
+	"/xui/inbound/clientIps/:email": true,
+	"/xui/setting/all":              true,
+	"/xui/setting/getTotp":          true,
+	"/xui/setting/users":            true,
+	"/xui/setting/sessions":         true,
+	"/server/status":                true,
+	"/server/getXrayVersion":        true,
+	"/xray/fakedns":                 true,
+	"/xray/transport":               true,
+}
+
+type auditSnapshot func(c *gin.Context) (interface{}, error)
+
+func snapshotInbound(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	inboundService := service.InboundService{}
+	return inboundService.GetInbound(id)
+}
+
+func snapshotSetting(c *gin.Context) (interface{}, error) {
+	settingService := service.SettingService{}
+	return settingService.GetAllSetting()
+}
+
+func snapshotUser(c *gin.Context) (interface{}, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	userService := service.UserService{}
+	return userService.GetUser(id)
+}
+
+func snapshotLoginUser(c *gin.Context) (interface{}, error) {
+	user := getLoginUser(c)
+	if user == nil {
+		return nil, nil
+	}
+	userService := service.UserService{}
+	return userService.GetUser(user.Id)
+}
+
+func snapshotTransport(c *gin.Context) (interface{}, error) {
+	transportService := service.TransportService{}
+	return transportService.GetTransport()
+}
+
+// auditSnapshots read what a route edits, relative to the base path, audit logs of the
+// other routes have only their params
+var auditSnapshots = map[string]auditSnapshot{
+	"/xui/inbound/del/:id":                snapshotInbound,
+	"/xui/inbound/update/:id":             snapshotInbound,
+	"/xui/inbound/setClientIpLimit/:id":   snapshotInbound,
+	"/xui/inbound/addClients/:id":         snapshotInbound,
+	"/xui/inbound/addEphemeralClient/:id": snapshotInbound,
+	"/xray/sockopt/:id":                   snapshotInbound,
+	"/api/v1/inbounds/:id":                snapshotInbound,
+	"/xui/setting/update":                 snapshotSetting,
+	"/xui/setting/updateUser":             snapshotLoginUser,
+	"/xui/setting/setUser/:id":            snapshotUser,
+	"/xui/setting/delUser/:id":            snapshotUser,
+	"/xray/transport/update":              snapshotTransport,
+}
+
+// auditResponseWriter keeps the start of the response so the audit log knows how it went
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) keep(b []byte) {
+	if n := maxAuditBody - w.body.Len(); n > 0 {
+		if len(b) > n {
+			b = b[:n]
+		}
+		w.body.Write(b)
+	}
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.keep(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// getAuditParams returns the params of the request with secrets redacted, the body is put
+// back for the handler
+func getAuditParams(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	contentType := c.ContentType()
+	if strings.HasPrefix(contentType, "multipart/") {
+		// uploads are files, not params worth keeping
+		return ""
+	}
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 || len(body) > maxAuditBody {
+		return ""
+	}
+	if contentType == gin.MIMEJSON {
+		var params interface{}
+		if json.Unmarshal(body, &params) != nil {
+			return ""
+		}
+		return service.RedactAuditParams(params)
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	params := map[string]interface{}{}
+	for key, value := range values {
+		if len(value) == 1 {
+			params[key] = value[0]
+		} else {
+			params[key] = value
+		}
+	}
+	return service.RedactAuditParams(params)
+}
+
+// audit records the requests that change something in the audit log, with who made them and
+// the diff of what the route edits, it goes after checkLogin or checkApiToken
+func audit(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	path := "/" + strings.TrimPrefix(c.FullPath(), c.GetString("base_path"))
+	if c.FullPath() == "" || auditReadRoutes[path] {
+		c.Next()
+		return
+	}
+
+	auditLog := &model.AuditLog{
+		Ip:     getRemoteIp(c),
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		Params: getAuditParams(c),
+	}
+	// api requests have a token instead of a login user
+	if obj, ok := c.Get(loginUserKey); ok {
+		user := obj.(*model.User)
+		auditLog.UserId = user.Id
+		auditLog.Username = user.Username
+	} else {
+		auditLog.Username = "api"
+	}
+	snapshot := auditSnapshots[path]
+	var before interface{}
+	if snapshot != nil {
+		var err error
+		before, err = snapshot(c)
+		if err != nil {
+			before = nil
+		}
+	}
+
+	writer := &auditResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	msg := &entity.Msg{}
+	if json.Unmarshal(writer.body.Bytes(), msg) == nil {
+		auditLog.Success = msg.Success
+		auditLog.Msg = msg.Msg
+	} else {
+		auditLog.Success = writer.Status() < http.StatusBadRequest
+	}
+	if !auditLog.Success && auditLog.Msg == "" {
+		auditLog.Msg = http.StatusText(writer.Status())
+	}
+	if snapshot != nil && auditLog.Success {
+		after, err := snapshot(c)
+		if err != nil {
+			after = nil
+		}
+		auditLog.Diff = service.GetAuditDiff(before, after)
+	}
+	auditService := service.AuditService{}
+	err := auditService.AddAuditLog(auditLog)
+	if err != nil {
+		logger.Warning("add audit log failed:", err)
+	}
+}
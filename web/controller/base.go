@@ -3,14 +3,40 @@ package controller
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
 	"x-ui/web/session"
 )
 
+const loginUserKey = "login_user"
+
 type BaseController struct {
+	userService service.UserService
 }
 
+// checkLogin lets logged in users through, the user is read again so a deleted user or a
+// password changed by an admin ends the session
 func (a *BaseController) checkLogin(c *gin.Context) {
-	if !session.IsLogin(c) {
+	sessionUser := session.GetLoginUser(c)
+	var user *model.User
+	if sessionUser != nil {
+		var err error
+		user, err = a.userService.GetUser(sessionUser.Id)
+		if err != nil {
+			if !database.IsNotFound(err) {
+				logger.Warning("get login user failed:", err)
+			}
+			user = nil
+		} else if user.Password != sessionUser.Password {
+			user = nil
+		}
+		if user == nil {
+			session.ClearSession(c)
+		}
+	}
+	if user == nil {
 		if isAjax(c) {
 			pureJsonMsg(c, false, "登录时效已过，请重新登录")
 		} else {
@@ -18,6 +44,32 @@ func (a *BaseController) checkLogin(c *gin.Context) {
 		}
 		c.Abort()
 	} else {
+		c.Set(loginUserKey, user)
 		c.Next()
 	}
 }
+
+// getLoginUser returns the user checkLogin let through, with its current role
+func getLoginUser(c *gin.Context) *model.User {
+	if obj, ok := c.Get(loginUserKey); ok {
+		return obj.(*model.User)
+	}
+	return session.GetLoginUser(c)
+}
+
+// checkRole lets the request through when the login user has the role, it goes after checkLogin
+func checkRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := getLoginUser(c)
+		if user != nil && user.HasRole(role) {
+			c.Next()
+			return
+		}
+		if isAjax(c) {
+			pureJsonMsg(c, false, "没有权限执行此操作")
+			c.Abort()
+		} else {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
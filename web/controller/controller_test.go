@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// testDBPath is the database of the tests, for tests which have to open another one
+var testDBPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "x-ui-controller-test-")
+	if err != nil {
+		panic(err)
+	}
+	testDBPath = filepath.Join(dir, "x-ui.db")
+	err = database.InitDB(testDBPath)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setSettings stores the settings for the test and removes them when it ends
+func setSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	db := database.GetDB()
+	for key, value := range settings {
+		err := db.Create(&model.Setting{Key: key, Value: value}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for key := range settings {
+			db.Where("key = ?", key).Delete(model.Setting{})
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCors(t *testing.T) {
+	config := &CorsConfig{
+		Origins:     []string{"https://dash.example.com/"},
+		Methods:     "GET, POST",
+		Headers:     "Content-Type, Authorization",
+		Credentials: true,
+	}
+	engine := gin.New()
+	engine.Use(Cors(config, "/api/"))
+	engine.GET("/api/inbounds", func(c *gin.Context) {
+		c.String(http.StatusOK, "inbounds")
+	})
+	engine.GET("/login", func(c *gin.Context) {
+		c.String(http.StatusOK, "login")
+	})
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		preflight       bool
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+		wantMethods     string
+	}{
+		{"allowed origin", http.MethodGet, "/api/inbounds", "https://dash.example.com", false, http.StatusOK, "https://dash.example.com", "true", ""},
+		{"allowed origin in other case", http.MethodGet, "/api/inbounds", "https://DASH.example.com", false, http.StatusOK, "https://DASH.example.com", "true", ""},
+		{"disallowed origin", http.MethodGet, "/api/inbounds", "https://evil.example.com", false, http.StatusOK, "", "", ""},
+		{"route without cors", http.MethodGet, "/login", "https://dash.example.com", false, http.StatusOK, "", "", ""},
+		{"no origin", http.MethodGet, "/api/inbounds", "", false, http.StatusOK, "", "", ""},
+		{"preflight", http.MethodOptions, "/api/inbounds", "https://dash.example.com", true, http.StatusNoContent, "https://dash.example.com", "true", "GET, POST"},
+		{"preflight of disallowed origin", http.MethodOptions, "/api/inbounds", "https://evil.example.com", true, http.StatusNotFound, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("%v %v = %v, want %v", tt.method, tt.path, w.Code, tt.wantStatus)
+			}
+			header := w.Header()
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if tt.wantMethods != "" {
+				if got := header.Get("Access-Control-Allow-Headers"); got != config.Headers {
+					t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, config.Headers)
+				}
+				if got := header.Get("Access-Control-Max-Age"); got != "600" {
+					t.Errorf("Access-Control-Max-Age = %q, want %q", got, "600")
+				}
+			}
+			// a cached answer must not be given to another origin
+			wantVary := tt.origin != "" && tt.path == "/api/inbounds"
+			if got := header.Get("Vary") == "Origin"; got != wantVary {
+				t.Errorf("Vary: Origin set = %v, want %v", got, wantVary)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csrfHeader carries the csrf token of the session, pages get the token in their template
+// data and axios sends it with every request
+const csrfHeader = "X-CSRF-Token"
+
+// csrfField carries the csrf token in plain form posts
+const csrfField = "csrf_token"
+
+// checkCsrf rejects the requests that change something without the csrf token of the
+// session, or of the signed cookie before a login, so other sites can't make changes with
+// the cookies of the browser
+func checkCsrf(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	token := c.GetHeader(csrfHeader)
+	if token == "" {
+		token = c.PostForm(csrfField)
+	}
+	if session.CheckCsrfToken(c, token) {
+		c.Next()
+		return
+	}
+	if isAjax(c) {
+		pureJsonMsg(c, false, localize(c, "csrfInvalid", "页面已过期，请刷新页面后重试"))
+		c.Abort()
+	} else {
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
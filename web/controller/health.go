@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"net/http"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthController struct {
+	healthService service.HealthService
+}
+
+func NewHealthController(g *gin.RouterGroup) *HealthController {
+	a := &HealthController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *HealthController) initRouter(g *gin.RouterGroup) {
+	g.GET("/health", a.health)
+}
+
+// health needs no login, it is meant for load balancer and container probes
+func (a *HealthController) health(c *gin.Context) {
+	health := a.healthService.GetHealth()
+	status := http.StatusOK
+	if health.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, health)
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"x-ui/database"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getHealth(t *testing.T) (int, *service.Health) {
+	t.Helper()
+	engine := gin.New()
+	NewHealthController(engine.Group("/"))
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want %q", got, "no-store")
+	}
+	health := &service.Health{}
+	err := json.Unmarshal(w.Body.Bytes(), health)
+	if err != nil {
+		t.Fatalf("GET /health answered %q: %v", w.Body.String(), err)
+	}
+	return w.Code, health
+}
+
+func TestHealth(t *testing.T) {
+	code, health := getHealth(t)
+	if code != http.StatusOK {
+		t.Errorf("GET /health = %v, want %v", code, http.StatusOK)
+	}
+	// xray was never started by the tests, so it not running is healthy
+	want := service.Health{Status: "ok", Database: true, Xray: false}
+	if *health != want {
+		t.Errorf("GET /health = %+v, want %+v", *health, want)
+	}
+}
+
+func TestHealthDatabaseDown(t *testing.T) {
+	err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := database.InitDB(testDBPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	sqlDB, err := database.GetDB().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	code, health := getHealth(t)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("GET /health = %v, want %v", code, http.StatusServiceUnavailable)
+	}
+	want := service.Health{Status: "unhealthy", Database: false, Xray: false}
+	if *health != want {
+		t.Errorf("GET /health = %+v, want %+v", *health, want)
+	}
+}
@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hsts tells browsers to use only https for the panel host for maxAge seconds, the header
+// is only sent on https requests, directly or through a trusted proxy that terminates tls,
+// browsers ignore it over plain http anyway
+func Hsts(maxAge int, includeSubdomains bool, preload bool) gin.HandlerFunc {
+	value := fmt.Sprintf("max-age=%d", maxAge)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if preload {
+		value += "; preload"
+	}
+	return func(c *gin.Context) {
+		if isHttps(c.Request) {
+			c.Header("Strict-Transport-Security", value)
+		}
+	}
+}
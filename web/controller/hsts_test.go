@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHsts(t *testing.T) {
+	// the default trusted proxies are the loopback addresses
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		proto      string
+		want       bool
+	}{
+		{"http", "203.0.113.1:40000", false, "", false},
+		{"https", "203.0.113.1:40000", true, "", true},
+		{"https from a trusted proxy", "127.0.0.1:40000", false, "https", true},
+		{"https from a trusted proxy chain", "[::1]:40000", false, "HTTPS, http", true},
+		{"http from a trusted proxy", "127.0.0.1:40000", false, "http", false},
+		{"https from a local proxy on a unix socket", "@", false, "https", true},
+		{"https from an untrusted client", "203.0.113.1:40000", false, "https", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Request.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				c.Request.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			Hsts(31536000, true, false)(c)
+			got := w.Header().Get("Strict-Transport-Security")
+			if sent := got != ""; sent != tt.want {
+				t.Errorf("Strict-Transport-Security = %q, want sent = %v", got, tt.want)
+			}
+			if tt.want && got != "max-age=31536000; includeSubDomains" {
+				t.Errorf("Strict-Transport-Security = %q", got)
+			}
+		})
+	}
+}
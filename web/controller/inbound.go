@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
 	"strconv"
+	"time"
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/web/global"
@@ -12,9 +16,44 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+type inboundListForm struct {
+	Sort        string `json:"sort" form:"sort"`
+	Order       string `json:"order" form:"order"`
+	ClientCount bool   `json:"clientCount" form:"clientCount"`
+	Page        int    `json:"page" form:"page"`
+	PageSize    int    `json:"pageSize" form:"pageSize"`
+}
+
+type extendExpiryForm struct {
+	Ids    []int    `json:"ids" form:"ids"`
+	Emails []string `json:"emails" form:"emails"`
+	Days   int      `json:"days" form:"days"`
+}
+
+type testClientForm struct {
+	Email string `json:"email" form:"email"`
+	Url   string `json:"url" form:"url"`
+}
+
+type clientIpLimitForm struct {
+	Email   string `json:"email" form:"email"`
+	LimitIp int    `json:"limitIp" form:"limitIp"`
+}
+
+type inboundEnableForm struct {
+	Ids    []int `json:"ids" form:"ids"`
+	Enable bool  `json:"enable" form:"enable"`
+}
+
+type ephemeralClientForm struct {
+	Minutes int `json:"minutes" form:"minutes"`
+}
+
 type InboundController struct {
-	inboundService service.InboundService
-	xrayService    service.XrayService
+	inboundService      service.InboundService
+	xrayService         service.XrayService
+	connectivityService service.ConnectivityService
+	notificationService service.NotificationService
 }
 
 func NewInboundController(g *gin.RouterGroup) *InboundController {
@@ -27,13 +66,23 @@ func NewInboundController(g *gin.RouterGroup) *InboundController {
 func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/inbound")
 
+	// every user can look at the inbounds, operators manage them
+	operator := checkRole(model.RoleOperator)
+
 	g.POST("/list", a.getInbounds)
-	g.POST("/add", a.addInbound)
-	g.POST("/del/:id", a.delInbound)
-	g.POST("/update/:id", a.updateInbound)
+	g.POST("/add", operator, a.addInbound)
+	g.POST("/del/:id", operator, a.delInbound)
+	g.POST("/update/:id", operator, a.updateInbound)
 
 	g.POST("/clientIps/:email", a.getClientIps)
-	g.POST("/clearClientIps/:email", a.clearClientIps)
+	g.POST("/clearClientIps/:email", operator, a.clearClientIps)
+	g.POST("/setClientIpLimit/:id", operator, a.setClientIpLimit)
+	g.POST("/addClients/:id", operator, a.addClients)
+	g.POST("/setEnable", operator, a.setInboundsEnable)
+	g.POST("/addEphemeralClient/:id", operator, a.addEphemeralClient)
+	g.POST("/extendExpiry", operator, a.extendExpiry)
+	g.POST("/testClient/:id", operator, a.testClient)
+	g.GET("/export/:id", a.exportInbound)
 }
 
 func (a *InboundController) startTask() {
@@ -50,12 +99,18 @@ func (a *InboundController) startTask() {
 }
 
 func (a *InboundController) getInbounds(c *gin.Context) {
-	user := session.GetLoginUser(c)
-	inbounds, err := a.inboundService.GetInbounds(user.Id)
+	form := &inboundListForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "获取", err)
+		return
+	}
+	inbounds, total, err := a.inboundService.GetInboundList(form.Sort, form.Order == "desc", form.ClientCount, form.Page, form.PageSize)
 	if err != nil {
 		jsonMsg(c, "获取", err)
 		return
 	}
+	c.Header("X-Total-Count", strconv.Itoa(total))
 	jsonObj(c, inbounds, nil)
 }
 
@@ -70,10 +125,16 @@ func (a *InboundController) addInbound(c *gin.Context) {
 	inbound.UserId = user.Id
 	inbound.Enable = true
 	inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	err = a.inboundService.CheckEnabledInboundLimit(1, isForce(c))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
 	err = a.inboundService.AddInbound(inbound)
 	jsonMsg(c, "添加", err)
 	if err == nil {
 		a.xrayService.SetToNeedRestart()
+		a.notificationService.Notify(service.EventInboundCreated, service.NewInboundEvent(inbound, ""))
 	}
 }
 
@@ -104,6 +165,20 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 		jsonMsg(c, "修改", err)
 		return
 	}
+	if inbound.Enable {
+		oldInbound, err := a.inboundService.GetInbound(id)
+		if err != nil {
+			jsonMsg(c, "修改", err)
+			return
+		}
+		if !oldInbound.Enable {
+			err = a.inboundService.CheckEnabledInboundLimit(1, isForce(c))
+			if err != nil {
+				jsonMsg(c, "修改", err)
+				return
+			}
+		}
+	}
 	err = a.inboundService.UpdateInbound(inbound)
 	jsonMsg(c, "修改", err)
 	if err == nil {
@@ -132,3 +207,163 @@ func (a *InboundController) clearClientIps(c *gin.Context) {
 	}
 	jsonMsg(c, "Log Cleared", nil)
 }
+
+func (a *InboundController) setClientIpLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	form := &clientIpLimitForm{}
+	err = c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	err = a.inboundService.SetClientIpLimit(id, form.Email, form.LimitIp)
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) addClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	clients := make([]model.Client, 0)
+	err = c.ShouldBindJSON(&clients)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	err = a.inboundService.AddClients(id, clients)
+	jsonMsg(c, "添加", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) setInboundsEnable(c *gin.Context) {
+	form := &inboundEnableForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "修改", err)
+		return
+	}
+	if form.Enable {
+		adding := 0
+		for _, id := range form.Ids {
+			inbound, err := a.inboundService.GetInbound(id)
+			if err == nil && !inbound.Enable {
+				adding++
+			}
+		}
+		err = a.inboundService.CheckEnabledInboundLimit(adding, isForce(c))
+		if err != nil {
+			jsonMsg(c, "修改", err)
+			return
+		}
+	}
+	err = a.inboundService.WithBatch(func(batch *service.InboundBatch) error {
+		for _, id := range form.Ids {
+			err := batch.SetInboundEnable(id, form.Enable)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	jsonMsg(c, "修改", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// addEphemeralClient returns the link of the new client, it is only shown this once
+func (a *InboundController) addEphemeralClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	form := &ephemeralClientForm{}
+	err = c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	client, err := a.inboundService.AddEphemeralClient(id, time.Minute*time.Duration(form.Minutes))
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	a.xrayService.SetToNeedRestart()
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		jsonMsg(c, "添加", err)
+		return
+	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	link, err := service.GetClientLink(inbound, client, host)
+	jsonObj(c, gin.H{"client": client, "link": link}, err)
+}
+
+func (a *InboundController) extendExpiry(c *gin.Context) {
+	form := &extendExpiryForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "延长", err)
+		return
+	}
+	err = a.inboundService.ExtendExpiry(form.Ids, form.Emails, time.Hour*24*time.Duration(form.Days))
+	jsonMsg(c, "延长", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) testClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
+	}
+	form := &testClientForm{}
+	err = c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
+	}
+	result, err := a.connectivityService.TestClient(id, form.Email, form.Url)
+	if err != nil {
+		jsonMsg(c, "测试", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
+func (a *InboundController) exportInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	config, err := a.inboundService.ExportInboundConfig(id)
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		jsonMsg(c, "导出", err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%v.json\"", config.InboundConfigs[0].Tag))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
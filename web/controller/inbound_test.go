@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetInboundsEnableRestartsOnce(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.Inbound{})
+	})
+	a := &InboundController{}
+	ids := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		inbound := &model.Inbound{Port: 45000 + i, Protocol: model.VLESS, Tag: fmt.Sprintf("inbound-%v", 45000+i), Enable: true, Settings: "{}"}
+		err := a.inboundService.AddInbound(inbound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, fmt.Sprintf("ids=%v", inbound.Id))
+	}
+	a.xrayService.IsNeedRestartAndSetFalse()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body := strings.Join(ids, "&") + "&enable=false"
+	c.Request = httptest.NewRequest(http.MethodPost, "/xui/inbound/setEnable", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	a.setInboundsEnable(c)
+	msg := entity.Msg{}
+	err := json.Unmarshal(w.Body.Bytes(), &msg)
+	if err != nil || !msg.Success {
+		t.Fatalf("setInboundsEnable() answered %q", w.Body.String())
+	}
+
+	var enabled int64
+	db.Model(model.Inbound{}).Where("enable = ?", true).Count(&enabled)
+	if enabled != 0 {
+		t.Errorf("%v inbounds are still enabled", enabled)
+	}
+	// the five changes are committed together, so the one restart they ask for applies all of them
+	if !a.xrayService.IsNeedRestartAndSetFalse() {
+		t.Error("setInboundsEnable() didn't ask for a restart")
+	}
+}
+
+func TestSetClientIpLimitRestarts(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.Inbound{})
+	})
+	a := &InboundController{}
+	inbound := &model.Inbound{Port: 45100, Protocol: model.VLESS, Tag: "inbound-45100", Enable: true,
+		Settings: `{"clients": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811", "email": "limit-alice"}]}`}
+	err := a.inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantSuccess bool
+	}{
+		{"unknown client", "email=limit-bob&limitIp=2", false},
+		{"set", "email=limit-alice&limitIp=2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.xrayService.IsNeedRestartAndSetFalse()
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/xui/inbound/setClientIpLimit/%v", inbound.Id), strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(inbound.Id)}}
+			a.setClientIpLimit(c)
+			msg := entity.Msg{}
+			err := json.Unmarshal(w.Body.Bytes(), &msg)
+			if err != nil || msg.Success != tt.wantSuccess {
+				t.Fatalf("setClientIpLimit() answered %q", w.Body.String())
+			}
+			// the limit is enforced from the config, so a change needs a restart
+			if got := a.xrayService.IsNeedRestartAndSetFalse(); got != tt.wantSuccess {
+				t.Errorf("restart asked = %v, want %v", got, tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestSetInboundsEnableLimit(t *testing.T) {
+	db := database.GetDB()
+	setSettings(t, map[string]string{"inboundHardLimit": "3"})
+	a := &InboundController{}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantSuccess bool
+		wantEnabled int64
+	}{
+		{"past the hard cap", "", false, 2},
+		{"past the hard cap forced", "?force=true", true, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				db.Where("1 = 1").Delete(model.Inbound{})
+			})
+			// two enabled and two disabled inbounds, enabling all of them adds two
+			ids := make([]string, 0)
+			for i := 0; i < 4; i++ {
+				inbound := &model.Inbound{Port: 45200 + i, Protocol: model.VLESS, Tag: fmt.Sprintf("inbound-%v", 45200+i), Enable: i < 2, Settings: "{}"}
+				err := a.inboundService.AddInbound(inbound)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, fmt.Sprintf("ids=%v", inbound.Id))
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body := strings.Join(ids, "&") + "&enable=true"
+			c.Request = httptest.NewRequest(http.MethodPost, "/xui/inbound/setEnable"+tt.query, strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			a.setInboundsEnable(c)
+			msg := entity.Msg{}
+			err := json.Unmarshal(w.Body.Bytes(), &msg)
+			if err != nil || msg.Success != tt.wantSuccess {
+				t.Fatalf("setInboundsEnable() answered %q", w.Body.String())
+			}
+
+			var enabled int64
+			db.Model(model.Inbound{}).Where("enable = ?", true).Count(&enabled)
+			if enabled != tt.wantEnabled {
+				t.Errorf("%v inbounds are enabled, want %v", enabled, tt.wantEnabled)
+			}
+		})
+	}
+}
@@ -2,9 +2,13 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"x-ui/database/model"
 	"x-ui/logger"
-	"x-ui/web/job"
+	"x-ui/util/common"
+	"x-ui/web/entity"
 	"x-ui/web/service"
 	"x-ui/web/session"
 
@@ -14,12 +18,34 @@ import (
 type LoginForm struct {
 	Username string `json:"username" form:"username"`
 	Password string `json:"password" form:"password"`
+	// TotpCode is a code of the authenticator app or a recovery code, when two factor authentication is on
+	TotpCode string `json:"totpCode" form:"totpCode"`
 }
 
+const loginLockoutKeyPrefix = "login:"
+
+// loginUserLockoutKeyPrefix counts the failed logins of a username from any ip
+const loginUserLockoutKeyPrefix = "loginUser:"
+
+// loginBanKeyPrefix counts the lockouts of an ip, enough of them within loginBanWindow ban it
+const loginBanKeyPrefix = "loginBan:"
+
+const loginBanWindow = time.Hour * 24
+
+// loginFailureDelay is added to the answer of a failed login per recent failure, tests shorten it
+var loginFailureDelay = time.Millisecond * 500
+
 type IndexController struct {
 	BaseController
 
-	userService service.UserService
+	userService         service.UserService
+	lockoutService      service.LockoutService
+	brandingService     service.BrandingService
+	settingService      service.SettingService
+	tgBotService        service.TgBotService
+	notificationService service.NotificationService
+	oidcService         service.OidcService
+	banService          service.BanService
 }
 
 func NewIndexController(g *gin.RouterGroup) *IndexController {
@@ -30,8 +56,21 @@ func NewIndexController(g *gin.RouterGroup) *IndexController {
 
 func (a *IndexController) initRouter(g *gin.RouterGroup) {
 	g.GET("/", a.index)
-	g.POST("/login", a.login)
-	g.GET("/logout", a.logout)
+	g.POST("/login", checkCsrf, a.checkLoginLockout, a.login)
+	g.POST("/logout", checkCsrf, a.logout)
+	g.GET("/logo", a.logo)
+	g.GET("/oidc/login", a.checkLoginLockout, a.oidcLogin)
+	g.GET("/oidc/callback", a.checkLoginLockout, a.oidcCallback)
+}
+
+func (a *IndexController) logo(c *gin.Context) {
+	path, err := a.brandingService.GetLogoPath()
+	if err != nil || path == "" {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Cache-Control", "max-age=3600")
+	c.File(path)
 }
 
 func (a *IndexController) index(c *gin.Context) {
@@ -39,7 +78,135 @@ func (a *IndexController) index(c *gin.Context) {
 		c.Redirect(http.StatusTemporaryRedirect, "xui/")
 		return
 	}
-	html(c, "login.html", "登录", nil)
+	html(c, "login.html", "登录", gin.H{"oidc_enabled": a.oidcService.IsEnabled()})
+}
+
+// checkLoginLockout rejects logins from a banned ip or an ip locked out after too many failed logins
+func (a *IndexController) checkLoginLockout(c *gin.Context) {
+	banned, err := a.banService.IsBanned(getRemoteIp(c))
+	if err != nil {
+		logger.Warning("check ip ban failed:", err)
+	} else if banned {
+		c.AbortWithStatusJSON(http.StatusForbidden, entity.Msg{
+			Msg: localize(c, "loginBanned", "该 IP 已被封禁"),
+		})
+		return
+	}
+	lockedUntil, err := a.lockoutService.GetLockedUntil(loginLockoutKeyPrefix + getRemoteIp(c))
+	if err != nil {
+		logger.Warning("get login lockout failed:", err)
+	} else if !lockedUntil.IsZero() {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, entity.Msg{
+			Msg: localize(c, "loginLocked", "登录失败次数过多，请稍后再试"),
+		})
+		return
+	}
+	c.Next()
+}
+
+// getLoginUserKey returns the lockout key of the username, usernames are locked whether they exist or not
+func getLoginUserKey(username string) string {
+	return loginUserLockoutKeyPrefix + strings.ToLower(username)
+}
+
+// addLoginFailure counts a failed login of the ip and the username and slows down the answer
+// the more failures the ip had recently, the ip and username get locked out once they hit their
+// limits and an ip locked out too often gets banned
+func (a *IndexController) addLoginFailure(c *gin.Context, username string) {
+	maxFailures, err := a.settingService.GetLoginMaxFailures()
+	if err != nil {
+		logger.Warning("get login max failures failed:", err)
+		maxFailures = 5
+	}
+	lockDuration, err := a.settingService.GetLoginLockDuration()
+	if err != nil {
+		logger.Warning("get login lock duration failed:", err)
+		lockDuration = time.Minute * 5
+	}
+	if username != "" {
+		a.addLoginUserFailure(username, lockDuration)
+	}
+	key := loginLockoutKeyPrefix + getRemoteIp(c)
+	locked, err := a.lockoutService.AddFailure(key, maxFailures, lockDuration)
+	if err != nil {
+		logger.Warning("add login failure failed:", err)
+		return
+	}
+	if locked {
+		logger.Warningf("ip %v failed to login too often, locked for %v", getRemoteIp(c), lockDuration)
+		a.banRepeatedLockout(getRemoteIp(c))
+		return
+	}
+	failures, err := a.lockoutService.GetFailures(key)
+	if err != nil {
+		logger.Warning("get login failures failed:", err)
+		return
+	}
+	if failures > 10 {
+		failures = 10
+	}
+	time.Sleep(loginFailureDelay * time.Duration(failures))
+}
+
+func (a *IndexController) addLoginUserFailure(username string, lockDuration time.Duration) {
+	maxFailures, err := a.settingService.GetLoginUserMaxFailures()
+	if err != nil {
+		logger.Warning("get login user max failures failed:", err)
+		return
+	}
+	if maxFailures <= 0 {
+		return
+	}
+	locked, err := a.lockoutService.AddFailure(getLoginUserKey(username), maxFailures, lockDuration)
+	if err != nil {
+		logger.Warning("add login user failure failed:", err)
+	} else if locked {
+		logger.Warningf("user %v failed to login too often, locked for %v", username, lockDuration)
+	}
+}
+
+// banRepeatedLockout bans the ip once it got locked out loginBanAfter times within loginBanWindow
+func (a *IndexController) banRepeatedLockout(ip string) {
+	banAfter, err := a.settingService.GetLoginBanAfter()
+	if err != nil {
+		logger.Warning("get login ban after failed:", err)
+		return
+	}
+	if banAfter <= 0 {
+		return
+	}
+	ban, err := a.lockoutService.AddFailure(loginBanKeyPrefix+ip, banAfter, loginBanWindow)
+	if err != nil {
+		logger.Warning("add login lockout failed:", err)
+		return
+	}
+	if !ban {
+		return
+	}
+	banDuration, err := a.settingService.GetLoginBanDuration()
+	if err != nil {
+		logger.Warning("get login ban duration failed:", err)
+		return
+	}
+	err = a.banService.Ban(ip, "login", banDuration)
+	if err != nil {
+		logger.Warning("ban ip failed:", err)
+		return
+	}
+	logger.Warningf("ip %v got locked out of logins too often, banned", ip)
+}
+
+// resetLoginFailures forgets the failed logins of the ip and the username after a login
+func (a *IndexController) resetLoginFailures(c *gin.Context, username string) {
+	err := a.lockoutService.Reset(loginLockoutKeyPrefix + getRemoteIp(c))
+	if err != nil {
+		logger.Warning("reset login lockout failed:", err)
+	}
+	err = a.lockoutService.Reset(getLoginUserKey(username))
+	if err != nil {
+		logger.Warning("reset login user lockout failed:", err)
+	}
 }
 
 func (a *IndexController) login(c *gin.Context) {
@@ -57,16 +224,60 @@ func (a *IndexController) login(c *gin.Context) {
 		pureJsonMsg(c, false, "请输入密码")
 		return
 	}
-	user := a.userService.CheckUser(form.Username, form.Password)
-	timeStr := time.Now().Format("2006-01-02 15:04:05")
+	lockedUntil, err := a.lockoutService.GetLockedUntil(getLoginUserKey(form.Username))
+	if err != nil {
+		logger.Warning("get login user lockout failed:", err)
+	} else if !lockedUntil.IsZero() {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, entity.Msg{
+			Msg: localize(c, "loginUserLocked", "该账号登录失败次数过多，已被临时锁定，请稍后再试"),
+		})
+		return
+	}
+	user := a.userService.Authenticate(form.Username, form.Password)
+	if user != nil {
+		totpEnabled, err := a.userService.IsTotpEnabled(user.Id)
+		if err != nil {
+			logger.Warning("check two factor authentication failed:", err)
+			pureJsonMsg(c, false, "登录失败")
+			return
+		}
+		if totpEnabled && form.TotpCode == "" {
+			c.JSON(http.StatusOK, entity.Msg{
+				Success: false,
+				Msg:     "请输入两步验证码",
+				Obj:     gin.H{"totp": true},
+			})
+			return
+		}
+		ok, err := a.userService.CheckTotp(user.Id, form.TotpCode)
+		if err != nil {
+			logger.Warning("check two factor code failed:", err)
+		}
+		if !ok {
+			logger.Infof("wrong two factor code of %s", form.Username)
+			a.tgBotService.NotifyLogin(form.Username, getRemoteIp(c), false)
+			a.notificationService.Notify(service.EventLoginFailed, &service.LoginEvent{Username: form.Username, Ip: getRemoteIp(c)})
+			a.addLoginFailure(c, form.Username)
+			c.JSON(http.StatusOK, entity.Msg{
+				Success: false,
+				Msg:     "两步验证码错误",
+				Obj:     gin.H{"totp": true},
+			})
+			return
+		}
+	}
 	if user == nil {
-		job.NewStatsNotifyJob().UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 0)
-		logger.Infof("wrong username or password: \"%s\" \"%s\"", form.Username, form.Password)
+		a.tgBotService.NotifyLogin(form.Username, getRemoteIp(c), false)
+		a.notificationService.Notify(service.EventLoginFailed, &service.LoginEvent{Username: form.Username, Ip: getRemoteIp(c)})
+		logger.Infof("wrong username or password of %s", form.Username)
+		a.addLoginFailure(c, form.Username)
 		pureJsonMsg(c, false, "用户名或密码错误")
 		return
 	} else {
 		logger.Infof("%s login success,Ip Address:%s\n", form.Username, getRemoteIp(c))
-		job.NewStatsNotifyJob().UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 1)
+		a.tgBotService.NotifyLogin(form.Username, getRemoteIp(c), true)
+		a.resetLoginFailures(c, form.Username)
 	}
 
 	err = session.SetLoginUser(c, user)
@@ -74,11 +285,89 @@ func (a *IndexController) login(c *gin.Context) {
 	jsonMsg(c, "登录", err)
 }
 
+// getOidcRedirectUrl returns the url the provider sends users back to after a single sign on
+func (a *IndexController) getOidcRedirectUrl(c *gin.Context) (string, error) {
+	redirectUrl, err := a.settingService.GetOidcRedirectUrl()
+	if err != nil || redirectUrl != "" {
+		return redirectUrl, err
+	}
+	scheme := "http"
+	if isHttps(c.Request) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + c.GetString("base_path") + "oidc/callback", nil
+}
+
+func (a *IndexController) oidcLogin(c *gin.Context) {
+	basePath := c.GetString("base_path")
+	if !a.oidcService.IsEnabled() {
+		c.Redirect(http.StatusTemporaryRedirect, basePath)
+		return
+	}
+	redirectUrl, err := a.getOidcRedirectUrl(c)
+	if err != nil {
+		logger.Warning("get oidc redirect url failed:", err)
+		c.Redirect(http.StatusTemporaryRedirect, basePath+"?oidcError=1")
+		return
+	}
+	authUrl, login, err := a.oidcService.NewLogin(redirectUrl)
+	if err == nil {
+		err = session.SetOidcLogin(c, login.State, login.Nonce, login.CodeVerifier)
+	}
+	if err != nil {
+		logger.Warning("start oidc login failed:", err)
+		c.Redirect(http.StatusTemporaryRedirect, basePath+"?oidcError=1")
+		return
+	}
+	c.Redirect(http.StatusFound, authUrl)
+}
+
+// oidcCallback logs in the panel user the provider vouches for, the provider does any
+// two factor authentication
+func (a *IndexController) oidcCallback(c *gin.Context) {
+	basePath := c.GetString("base_path")
+	state, nonce, codeVerifier := session.PopOidcLogin(c)
+	login := &service.OidcLogin{State: state, Nonce: nonce, CodeVerifier: codeVerifier}
+	if state == "" {
+		login = nil
+	}
+	var user *model.User
+	redirectUrl, err := a.getOidcRedirectUrl(c)
+	if err == nil {
+		if providerErr := c.Query("error"); providerErr != "" {
+			err = common.NewError("oidc provider refused the login:", providerErr, c.Query("error_description"))
+		} else {
+			user, err = a.oidcService.Finish(redirectUrl, login, c.Query("state"), c.Query("code"))
+		}
+	}
+	if err != nil {
+		logger.Info("oidc login failed:", err)
+		a.notificationService.Notify(service.EventLoginFailed, &service.LoginEvent{Username: "(oidc)", Ip: getRemoteIp(c)})
+		a.addLoginFailure(c, "")
+		c.Redirect(http.StatusFound, basePath+"?oidcError=1")
+		return
+	}
+	logger.Infof("%s login success with oidc,Ip Address:%s\n", user.Username, getRemoteIp(c))
+	a.tgBotService.NotifyLogin(user.Username, getRemoteIp(c), true)
+	a.resetLoginFailures(c, user.Username)
+	err = session.SetLoginUser(c, user)
+	if err != nil {
+		logger.Warning("save login session failed:", err)
+		c.Redirect(http.StatusFound, basePath+"?oidcError=1")
+		return
+	}
+	c.Redirect(http.StatusFound, basePath+"xui/")
+}
+
 func (a *IndexController) logout(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	if user != nil {
 		logger.Info("user", user.Id, "logout")
 	}
 	session.ClearSession(c)
-	c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
+	if isAjax(c) {
+		pureJsonMsg(c, true, "")
+	} else {
+		c.Redirect(http.StatusFound, c.GetString("base_path"))
+	}
 }
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newLoginContext returns the context of a login request from the ip
+func newLoginContext(ip string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	c.Request.RemoteAddr = ip + ":40000"
+	return c, w
+}
+
+func TestLoginThresholds(t *testing.T) {
+	loginFailureDelay = 0
+	defer func() { loginFailureDelay = time.Millisecond * 500 }()
+
+	tests := []struct {
+		name     string
+		settings map[string]string
+		// failures are the failed logins of the same user from the ip, the lockouts of the ip are
+		// waited out between them
+		failures int
+		// wantIpLockouts is how many times the ip gets locked out
+		wantIpLockouts int
+		wantUserLocked bool
+		wantBanned     bool
+	}{
+		{"below every threshold", map[string]string{
+			"loginMaxFailures": "3", "loginUserMaxFailures": "4", "loginBanAfter": "2",
+		}, 2, 0, false, false},
+		{"ip locked out", map[string]string{
+			"loginMaxFailures": "3", "loginUserMaxFailures": "4", "loginBanAfter": "2",
+		}, 3, 1, false, false},
+		{"user locked out", map[string]string{
+			"loginMaxFailures": "3", "loginUserMaxFailures": "4", "loginBanAfter": "2",
+		}, 4, 1, true, false},
+		{"ip banned", map[string]string{
+			"loginMaxFailures": "3", "loginUserMaxFailures": "4", "loginBanAfter": "2",
+		}, 6, 2, true, true},
+		{"user lockout and ban turned off", map[string]string{
+			"loginMaxFailures": "3", "loginUserMaxFailures": "0", "loginBanAfter": "0",
+		}, 9, 3, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSettings(t, tt.settings)
+			a := &IndexController{}
+			const ip = "203.0.113.50"
+			const username = "Alice"
+			reset := func() {
+				a.lockoutService.Reset(loginLockoutKeyPrefix + ip)
+				a.lockoutService.Reset(loginBanKeyPrefix + ip)
+				a.lockoutService.Reset(getLoginUserKey(username))
+				database.GetDB().Where("1 = 1").Delete(model.BannedIp{})
+			}
+			reset()
+			defer reset()
+
+			ipLockouts := 0
+			for i := 0; i < tt.failures; i++ {
+				c, _ := newLoginContext(ip)
+				a.addLoginFailure(c, username)
+				lockedUntil, err := a.lockoutService.GetLockedUntil(loginLockoutKeyPrefix + ip)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !lockedUntil.IsZero() {
+					ipLockouts++
+					// the lockout runs out, the failures that led to it are still counted for the ban
+					a.lockoutService.Reset(loginLockoutKeyPrefix + ip)
+				}
+			}
+			if ipLockouts != tt.wantIpLockouts {
+				t.Errorf("ip got locked out %v times, want %v", ipLockouts, tt.wantIpLockouts)
+			}
+			// usernames are locked whatever their case
+			lockedUntil, err := a.lockoutService.GetLockedUntil(getLoginUserKey("alice"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userLocked := !lockedUntil.IsZero(); userLocked != tt.wantUserLocked {
+				t.Errorf("user locked = %v, want %v", userLocked, tt.wantUserLocked)
+			}
+			banned, err := a.banService.IsBanned(ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if banned != tt.wantBanned {
+				t.Errorf("ip banned = %v, want %v", banned, tt.wantBanned)
+			}
+
+			c, w := newLoginContext(ip)
+			a.checkLoginLockout(c)
+			wantCode := http.StatusOK
+			if banned {
+				wantCode = http.StatusForbidden
+			}
+			if w.Code != wantCode || c.IsAborted() != banned {
+				t.Errorf("checkLoginLockout() answered %v aborted = %v, want %v", w.Code, c.IsAborted(), wantCode)
+			}
+			// other ips are not affected
+			banned, err = a.banService.IsBanned("203.0.113.51")
+			if err != nil || banned {
+				t.Errorf("IsBanned() of another ip = %v, %v", banned, err)
+			}
+		})
+	}
+}
+
+func TestCheckLoginLockoutLocked(t *testing.T) {
+	setSettings(t, map[string]string{"loginMaxFailures": "1", "loginBanAfter": "0"})
+	a := &IndexController{}
+	const ip = "203.0.113.52"
+	defer a.lockoutService.Reset(loginLockoutKeyPrefix + ip)
+
+	c, _ := newLoginContext(ip)
+	a.addLoginFailure(c, "")
+	c, w := newLoginContext(ip)
+	a.checkLoginLockout(c)
+	if w.Code != http.StatusTooManyRequests || !c.IsAborted() {
+		t.Errorf("checkLoginLockout() of a locked ip answered %v aborted = %v", w.Code, c.IsAborted())
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("checkLoginLockout() didn't say when to retry")
+	}
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	metricsService service.MetricsService
+	settingService service.SettingService
+}
+
+func NewMetricsController(g *gin.RouterGroup) *MetricsController {
+	a := &MetricsController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *MetricsController) initRouter(g *gin.RouterGroup) {
+	g.GET("/metrics", a.checkMetricsAuth, a.metrics)
+}
+
+// checkMetricsAuth lets logged in users and scrapers sending the metrics token as bearer token through
+func (a *MetricsController) checkMetricsAuth(c *gin.Context) {
+	if session.IsLogin(c) {
+		c.Next()
+		return
+	}
+	token, err := a.settingService.GetMetricsToken()
+	auth := c.GetHeader("Authorization")
+	if err == nil && token != "" && strings.HasPrefix(auth, "Bearer ") &&
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+		c.Next()
+		return
+	}
+	c.Header("WWW-Authenticate", "Bearer")
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+func (a *MetricsController) metrics(c *gin.Context) {
+	metrics, err := a.metricsService.GetMetrics()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(metrics))
+}
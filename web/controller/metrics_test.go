@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newMetricsRouter serves the metrics controller and a /login route that logs the client in
+func newMetricsRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	db := database.GetDB()
+	user := &model.User{Username: "metrics", Password: "password"}
+	err := db.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Delete(user)
+		db.Where("user_id = ?", user.Id).Delete(model.LoginSession{})
+	})
+
+	engine := gin.New()
+	engine.Use(session.Sessions("session", session.NewStore(GetRequestIp, []byte("metrics-test-secret"))))
+	engine.GET("/login", func(c *gin.Context) {
+		err := session.SetLoginUser(c, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	NewMetricsController(engine.Group("/"))
+	return engine
+}
+
+func TestMetrics(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.Inbound{})
+	})
+	inbound := &model.Inbound{Port: 46000, Protocol: model.VLESS, Tag: "inbound-46000", Remark: "metrics", Enable: true, Settings: "{}", Up: 1024, Down: 2048}
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := newMetricsRouter(t)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	loginCookies := w.Result().Cookies()
+
+	tests := []struct {
+		name    string
+		token   string
+		auth    string
+		cookies []*http.Cookie
+		ok      bool
+	}{
+		{"right token", "scrape-token", "Bearer scrape-token", nil, true},
+		{"no token", "scrape-token", "", nil, false},
+		{"wrong token", "scrape-token", "Bearer other-token", nil, false},
+		{"token without bearer", "scrape-token", "scrape-token", nil, false},
+		{"no token configured", "", "Bearer ", nil, false},
+		{"logged in", "", "", loginCookies, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSettings(t, map[string]string{"metricsToken": tt.token})
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if !tt.ok {
+				if w.Code != http.StatusUnauthorized {
+					t.Fatalf("GET /metrics = %v, want %v", w.Code, http.StatusUnauthorized)
+				}
+				if got := w.Header().Get("WWW-Authenticate"); got != "Bearer" {
+					t.Errorf("WWW-Authenticate = %q, want %q", got, "Bearer")
+				}
+				if strings.Contains(w.Body.String(), "xui_") {
+					t.Errorf("unauthorized response has metrics: %q", w.Body.String())
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /metrics = %v, want %v", w.Code, http.StatusOK)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+				t.Errorf("Content-Type = %q", got)
+			}
+			lines := strings.Split(w.Body.String(), "\n")
+			for _, want := range []string{
+				`xui_inbound_up_bytes{tag="inbound-46000",remark="metrics"} 1024`,
+				`xui_inbound_down_bytes{tag="inbound-46000",remark="metrics"} 2048`,
+				`xui_inbounds{state="enabled"} 1`,
+				`xui_inbounds{state="disabled"} 0`,
+				`xui_xray_running 0`,
+				"# TYPE xui_uptime_seconds gauge",
+			} {
+				if !containsLine(lines, want) {
+					t.Errorf("metrics don't have the line %q:\n%s", want, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
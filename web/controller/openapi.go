@@ -0,0 +1,320 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"x-ui/config"
+	"x-ui/database/model"
+	"x-ui/util/json_util"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+type openApiModels struct {
+	request  interface{}
+	response interface{}
+}
+
+// openApiRouteModels are the bodies of the routes, relative to the base path, other tools are most
+// likely to build clients for, the other routes are documented with an untyped obj
+var openApiRouteModels = map[string]openApiModels{
+	"POST /xui/inbound/list":         {request: inboundListForm{}, response: []*model.Inbound{}},
+	"POST /xui/inbound/add":          {request: model.Inbound{}},
+	"POST /xui/inbound/update/:id":   {request: model.Inbound{}},
+	"POST /xui/inbound/setEnable":    {request: inboundEnableForm{}},
+	"POST /xui/inbound/extendExpiry": {request: extendExpiryForm{}},
+	"POST /server/status":            {response: service.Status{}},
+	"POST /xui/setting/all":          {response: entity.AllSetting{}},
+	"POST /xui/setting/update":       {request: entity.AllSetting{}},
+	"GET /api/v1/inbounds":           {response: []*model.Inbound{}},
+	"GET /api/v1/inbounds/:id":       {response: model.Inbound{}},
+	"POST /api/v1/inbounds":          {request: model.Inbound{}, response: model.Inbound{}},
+	"PUT /api/v1/inbounds/:id":       {request: model.Inbound{}, response: model.Inbound{}},
+}
+
+// openApiPublicRoutes need no login
+var openApiPublicRoutes = map[string]bool{
+	"/":        true,
+	"/login":   true,
+	"/logout":  true,
+	"/health":  true,
+	"/metrics": true,
+}
+
+// OpenApiController serves an openapi 3 document of the routes the engine has and a swagger ui for it
+type OpenApiController struct {
+	BaseController
+
+	engine *gin.Engine
+}
+
+func NewOpenApiController(g *gin.RouterGroup, engine *gin.Engine) *OpenApiController {
+	a := &OpenApiController{engine: engine}
+	a.initRouter(g)
+	return a
+}
+
+func (a *OpenApiController) initRouter(g *gin.RouterGroup) {
+	g.GET("/openapi.json", a.checkOpenApiAuth, a.openApi)
+	g.GET("/swagger", a.checkLogin, a.swagger)
+}
+
+// checkOpenApiAuth lets logged in users and api token holders read the document
+func (a *OpenApiController) checkOpenApiAuth(c *gin.Context) {
+	if session.IsLogin(c) || hasValidApiToken(c) {
+		c.Next()
+		return
+	}
+	c.Header("WWW-Authenticate", "Bearer")
+	c.AbortWithStatus(http.StatusUnauthorized)
+}
+
+func (a *OpenApiController) openApi(c *gin.Context) {
+	c.JSON(http.StatusOK, genOpenApi(a.engine.Routes(), c.GetString("base_path")))
+}
+
+func (a *OpenApiController) swagger(c *gin.Context) {
+	html(c, "swagger.html", "API", nil)
+}
+
+// genOpenApi describes the routes, gin doesn't know what the handlers accept so only the
+// routes in openApiRouteModels get typed bodies
+func genOpenApi(routes gin.RoutesInfo, basePath string) gin.H {
+	schemas := gin.H{}
+	paths := gin.H{}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path < routes[j].Path
+	})
+	for _, route := range routes {
+		path := "/" + strings.TrimPrefix(route.Path, basePath)
+		// static files and catch all routes are no api
+		if strings.Contains(path, "*") || route.Method == http.MethodHead || strings.HasPrefix(path, "/assets") {
+			continue
+		}
+		openApiPath, parameters := convertGinPath(path)
+		pathItem, ok := paths[openApiPath].(gin.H)
+		if !ok {
+			pathItem = gin.H{}
+			paths[openApiPath] = pathItem
+		}
+		operation := gin.H{
+			"operationId": strings.ToLower(route.Method) + strings.ReplaceAll(strings.Title(strings.NewReplacer("/", " ", ":", " ", "-", " ", ".", " ").Replace(path)), " ", ""),
+			"tags":        []string{getOpenApiTag(path)},
+		}
+		// the panel routes that change something check the csrf token, api routes have a token instead
+		if isCsrfChecked(route.Method, path) {
+			parameters = append(parameters, gin.H{"$ref": "#/components/parameters/csrfToken"})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		models := openApiRouteModels[route.Method+" "+path]
+		if models.request != nil {
+			operation["requestBody"] = gin.H{
+				"required": true,
+				"content": gin.H{
+					"application/json": gin.H{"schema": genSchema(reflect.TypeOf(models.request), schemas)},
+				},
+			}
+		}
+		operation["responses"] = genOpenApiResponses(route.Method, path, models.response, schemas)
+		if strings.HasPrefix(path, "/api/") {
+			operation["security"] = []gin.H{{"bearerAuth": []string{}}}
+		} else if !openApiPublicRoutes[path] && !strings.HasPrefix(path, "/sub/") {
+			operation["security"] = []gin.H{{"cookieAuth": []string{}}}
+		}
+		pathItem[strings.ToLower(route.Method)] = operation
+	}
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   config.GetName(),
+			"version": config.GetVersion(),
+		},
+		"servers": []gin.H{{"url": strings.TrimSuffix(basePath, "/")}},
+		"paths":   paths,
+		"components": gin.H{
+			"schemas": schemas,
+			"parameters": gin.H{
+				"csrfToken": gin.H{
+					"name":        csrfHeader,
+					"in":          "header",
+					"required":    true,
+					"description": "the csrf token of the page, the login page has the one signed into the csrf_token cookie",
+					"schema":      gin.H{"type": "string"},
+				},
+			},
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer"},
+				"cookieAuth": gin.H{"type": "apiKey", "in": "cookie", "name": "session"},
+			},
+		},
+	}
+}
+
+func isCsrfChecked(method string, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return !strings.HasPrefix(path, "/api/")
+}
+
+// convertGinPath turns /inbound/:id into /inbound/{id} and returns the parameters in it
+func convertGinPath(path string) (string, []gin.H) {
+	parameters := make([]gin.H, 0)
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, ":") {
+			continue
+		}
+		name := strings.TrimPrefix(part, ":")
+		parts[i] = "{" + name + "}"
+		parameters = append(parameters, gin.H{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   gin.H{"type": "string"},
+		})
+	}
+	return strings.Join(parts, "/"), parameters
+}
+
+func getOpenApiTag(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 1 && (parts[0] == "xui" || parts[0] == "api") {
+		return parts[0] + "/" + parts[1]
+	}
+	if parts[0] == "" {
+		return "index"
+	}
+	return parts[0]
+}
+
+func genOpenApiResponses(method string, path string, response interface{}, schemas gin.H) gin.H {
+	if strings.HasPrefix(path, "/api/") {
+		responses := gin.H{
+			"401": gin.H{"description": "invalid api token"},
+		}
+		status := "200"
+		if method == http.MethodPost {
+			status = "201"
+		}
+		if response != nil {
+			responses[status] = gin.H{
+				"description": "ok",
+				"content":     gin.H{"application/json": gin.H{"schema": genMsgSchema(response, schemas)}},
+			}
+		} else {
+			responses["204"] = gin.H{"description": "ok"}
+		}
+		return responses
+	}
+	return gin.H{
+		"200": gin.H{
+			"description": "ok, success in the body tells whether the request succeeded",
+			"content":     gin.H{"application/json": gin.H{"schema": genMsgSchema(response, schemas)}},
+		},
+	}
+}
+
+// genMsgSchema describes an entity.Msg carrying obj
+func genMsgSchema(obj interface{}, schemas gin.H) gin.H {
+	objSchema := gin.H{}
+	if obj != nil {
+		objSchema = genSchema(reflect.TypeOf(obj), schemas)
+	}
+	return gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"success": gin.H{"type": "boolean"},
+			"msg":     gin.H{"type": "string"},
+			"obj":     objSchema,
+		},
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	rawJsonType    = reflect.TypeOf(json_util.RawMessage{})
+)
+
+// genSchema describes t by its json encoding, named structs are put into schemas and referenced
+func genSchema(t reflect.Type, schemas gin.H) gin.H {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return gin.H{"type": "string", "format": "date-time"}
+	case rawMessageType, rawJsonType:
+		return gin.H{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return gin.H{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return gin.H{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return gin.H{"type": "array", "items": genSchema(t.Elem(), schemas)}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": genSchema(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return genStructSchema(t, schemas)
+		}
+		name := t.Name()
+		if _, ok := schemas[name]; !ok {
+			// set first, a struct referencing itself must not recurse forever
+			schemas[name] = gin.H{}
+			schemas[name] = genStructSchema(t, schemas)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + name}
+	}
+	return gin.H{}
+}
+
+func genStructSchema(t reflect.Type, schemas gin.H) gin.H {
+	properties := gin.H{}
+	addStructProperties(t, properties, schemas)
+	return gin.H{"type": "object", "properties": properties}
+}
+
+func addStructProperties(t reflect.Type, properties gin.H, schemas gin.H) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				addStructProperties(fieldType, properties, schemas)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = genSchema(field.Type, schemas)
+	}
+}
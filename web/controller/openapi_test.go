@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGenOpenApiCsrfToken(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/panel/"},
+		{Method: http.MethodPost, Path: "/panel/login"},
+		{Method: http.MethodPost, Path: "/panel/logout"},
+		{Method: http.MethodPost, Path: "/panel/xui/inbound/del/:id"},
+		{Method: http.MethodGet, Path: "/panel/server/banned-ips"},
+		{Method: http.MethodPost, Path: "/panel/api/v1/inbounds"},
+	}
+	doc := genOpenApi(routes, "/panel/")
+	parameter := doc["components"].(gin.H)["parameters"].(gin.H)["csrfToken"].(gin.H)
+	if parameter["name"] != "X-CSRF-Token" || parameter["in"] != "header" {
+		t.Errorf("csrfToken parameter = %v", parameter)
+	}
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{"get", "/", false},
+		{"post", "/login", true},
+		{"post", "/logout", true},
+		{"post", "/xui/inbound/del/{id}", true},
+		{"get", "/server/banned-ips", false},
+		{"post", "/api/v1/inbounds", false},
+	}
+	paths := doc["paths"].(gin.H)
+	for _, tt := range tests {
+		operation, ok := paths[tt.path].(gin.H)[tt.method].(gin.H)
+		if !ok {
+			t.Errorf("%v %v is not documented", tt.method, tt.path)
+			continue
+		}
+		parameters, _ := operation["parameters"].([]gin.H)
+		got := false
+		for _, parameter := range parameters {
+			if parameter["$ref"] == "#/components/parameters/csrfToken" {
+				got = true
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%v %v declares the csrf token = %v, want %v", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGenOpenApi(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/panel/"},
+		{Method: http.MethodPost, Path: "/panel/login"},
+		{Method: http.MethodGet, Path: "/panel/assets/*filepath"},
+		{Method: http.MethodHead, Path: "/panel/health"},
+		{Method: http.MethodGet, Path: "/panel/health"},
+		{Method: http.MethodPost, Path: "/panel/xui/inbound/list"},
+		{Method: http.MethodPost, Path: "/panel/xui/inbound/update/:id"},
+		{Method: http.MethodPost, Path: "/panel/server/status"},
+		{Method: http.MethodGet, Path: "/panel/sub/:subId"},
+		{Method: http.MethodGet, Path: "/panel/api/v1/inbounds/:id"},
+		{Method: http.MethodPost, Path: "/panel/api/v1/inbounds"},
+		{Method: http.MethodDelete, Path: "/panel/api/v1/inbounds/:id"},
+	}
+	doc := genOpenApi(routes, "/panel/")
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", doc["openapi"])
+	}
+	if servers := doc["servers"].([]gin.H); servers[0]["url"] != "/panel" {
+		t.Errorf("server url = %v, want /panel", servers[0]["url"])
+	}
+	paths := doc["paths"].(gin.H)
+	for _, path := range []string{"/assets/*filepath", "/assets/{filepath}"} {
+		if _, ok := paths[path]; ok {
+			t.Errorf("%v is documented", path)
+		}
+	}
+	if _, ok := paths["/health"].(gin.H)["head"]; ok {
+		t.Error("head /health is documented")
+	}
+
+	tests := []struct {
+		method       string
+		path         string
+		wantTag      string
+		wantSecurity string
+		wantParams   []string
+		wantRequest  string
+		wantResponse map[string]string
+	}{
+		{"get", "/", "index", "", nil, "", map[string]string{"200": ""}},
+		{"get", "/health", "health", "", nil, "", map[string]string{"200": ""}},
+		{"post", "/xui/inbound/list", "xui/inbound", "cookieAuth", []string{"csrfToken"}, "#/components/schemas/inboundListForm", map[string]string{"200": "array"}},
+		{"post", "/xui/inbound/update/{id}", "xui/inbound", "cookieAuth", []string{"id", "csrfToken"}, "#/components/schemas/Inbound", map[string]string{"200": ""}},
+		{"post", "/server/status", "server", "cookieAuth", []string{"csrfToken"}, "", map[string]string{"200": "#/components/schemas/Status"}},
+		{"get", "/sub/{subId}", "sub", "", []string{"subId"}, "", map[string]string{"200": ""}},
+		{"get", "/api/v1/inbounds/{id}", "api/v1", "bearerAuth", []string{"id"}, "", map[string]string{"200": "#/components/schemas/Inbound", "401": ""}},
+		{"post", "/api/v1/inbounds", "api/v1", "bearerAuth", nil, "#/components/schemas/Inbound", map[string]string{"201": "#/components/schemas/Inbound", "401": ""}},
+		{"delete", "/api/v1/inbounds/{id}", "api/v1", "bearerAuth", []string{"id"}, "", map[string]string{"204": "", "401": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			operation, ok := paths[tt.path].(gin.H)[tt.method].(gin.H)
+			if !ok {
+				t.Fatalf("%v %v is not documented", tt.method, tt.path)
+			}
+			if tags := operation["tags"].([]string); tags[0] != tt.wantTag {
+				t.Errorf("tag = %v, want %v", tags[0], tt.wantTag)
+			}
+			security := ""
+			if requirements, ok := operation["security"].([]gin.H); ok {
+				for scheme := range requirements[0] {
+					security = scheme
+				}
+			}
+			if security != tt.wantSecurity {
+				t.Errorf("security = %q, want %q", security, tt.wantSecurity)
+			}
+			params := make([]string, 0)
+			parameters, _ := operation["parameters"].([]gin.H)
+			for _, parameter := range parameters {
+				if ref, ok := parameter["$ref"].(string); ok {
+					params = append(params, strings.TrimPrefix(ref, "#/components/parameters/"))
+				} else {
+					params = append(params, parameter["name"].(string))
+				}
+			}
+			if len(params) != len(tt.wantParams) || (len(params) > 0 && !reflect.DeepEqual(params, tt.wantParams)) {
+				t.Errorf("parameters = %v, want %v", params, tt.wantParams)
+			}
+			request := ""
+			if body, ok := operation["requestBody"].(gin.H); ok {
+				request = body["content"].(gin.H)["application/json"].(gin.H)["schema"].(gin.H)["$ref"].(string)
+			}
+			if request != tt.wantRequest {
+				t.Errorf("request body = %q, want %q", request, tt.wantRequest)
+			}
+			responses := operation["responses"].(gin.H)
+			if len(responses) != len(tt.wantResponse) {
+				t.Errorf("responses = %v, want %v", responses, tt.wantResponse)
+			}
+			for status, want := range tt.wantResponse {
+				response, ok := responses[status].(gin.H)
+				if !ok {
+					t.Errorf("no %v response", status)
+					continue
+				}
+				if want == "" {
+					continue
+				}
+				// the body is an entity.Msg with the model in obj
+				obj := response["content"].(gin.H)["application/json"].(gin.H)["schema"].(gin.H)["properties"].(gin.H)["obj"].(gin.H)
+				got, _ := obj["$ref"].(string)
+				if got == "" {
+					got, _ = obj["type"].(string)
+				}
+				if got != want {
+					t.Errorf("%v response obj = %q, want %q", status, got, want)
+				}
+			}
+		})
+	}
+
+	// the models are described by their json encoding
+	schemas := doc["components"].(gin.H)["schemas"].(gin.H)
+	inbound := schemas["Inbound"].(gin.H)["properties"].(gin.H)
+	wantProperties := map[string]gin.H{
+		"port":   {"type": "integer", "format": "int64"},
+		"enable": {"type": "boolean"},
+		"remark": {"type": "string"},
+	}
+	for name, want := range wantProperties {
+		if !reflect.DeepEqual(inbound[name], want) {
+			t.Errorf("Inbound.%v = %v, want %v", name, inbound[name], want)
+		}
+	}
+	if _, ok := schemas["Status"]; !ok {
+		t.Error("the Status model of the server controller is not described")
+	}
+}
+
+type openApiTestNode struct {
+	Name     string             `json:"name"`
+	Children []*openApiTestNode `json:"children"`
+}
+
+type openApiTestEmbedded struct {
+	Created time.Time `json:"created"`
+}
+
+type openApiTestModel struct {
+	openApiTestEmbedded
+	Id       int              `json:"id"`
+	Size     int32            `json:"size,omitempty"`
+	Ratio    float64          `json:"ratio"`
+	Tags     []string         `json:"tags"`
+	Labels   map[string]int64 `json:"labels"`
+	Settings json.RawMessage  `json:"settings"`
+	Root     *openApiTestNode `json:"root"`
+	Skipped  string           `json:"-"`
+	Untagged bool
+	private  string
+}
+
+func TestGenSchema(t *testing.T) {
+	schemas := gin.H{}
+	got := genSchema(reflect.TypeOf(&openApiTestModel{}), schemas)
+	if got["$ref"] != "#/components/schemas/openApiTestModel" {
+		t.Fatalf("genSchema() = %v, want a reference", got)
+	}
+	want := gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"created":  gin.H{"type": "string", "format": "date-time"},
+			"id":       gin.H{"type": "integer", "format": "int64"},
+			"size":     gin.H{"type": "integer", "format": "int32"},
+			"ratio":    gin.H{"type": "number"},
+			"tags":     gin.H{"type": "array", "items": gin.H{"type": "string"}},
+			"labels":   gin.H{"type": "object", "additionalProperties": gin.H{"type": "integer", "format": "int64"}},
+			"settings": gin.H{},
+			"root":     gin.H{"$ref": "#/components/schemas/openApiTestNode"},
+			"Untagged": gin.H{"type": "boolean"},
+		},
+	}
+	if !reflect.DeepEqual(schemas["openApiTestModel"], want) {
+		t.Errorf("openApiTestModel schema = %v, want %v", schemas["openApiTestModel"], want)
+	}
+	// a model referencing itself is described once
+	wantNode := gin.H{
+		"type": "object",
+		"properties": gin.H{
+			"name":     gin.H{"type": "string"},
+			"children": gin.H{"type": "array", "items": gin.H{"$ref": "#/components/schemas/openApiTestNode"}},
+		},
+	}
+	if !reflect.DeepEqual(schemas["openApiTestNode"], wantNode) {
+		t.Errorf("openApiTestNode schema = %v, want %v", schemas["openApiTestNode"], wantNode)
+	}
+	if len(schemas) != 2 {
+		t.Errorf("schemas = %v, want only the two models", schemas)
+	}
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type rateLimitEntry struct {
+	count int
+	start time.Time
+}
+
+// rateLimit allows at most limit requests per client ip in every window
+func rateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	var lock sync.Mutex
+	entries := map[string]*rateLimitEntry{}
+	return func(c *gin.Context) {
+		ip := getRemoteIp(c)
+		now := time.Now()
+
+		lock.Lock()
+		for key, entry := range entries {
+			if now.Sub(entry.start) >= window {
+				delete(entries, key)
+			}
+		}
+		entry, ok := entries[ip]
+		if !ok {
+			entry = &rateLimitEntry{start: now}
+			entries[ip] = entry
+		}
+		entry.count++
+		exceeded := entry.count > limit
+		lock.Unlock()
+
+		if exceeded {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		c.Next()
+	}
+}
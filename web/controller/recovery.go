@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"x-ui/logger"
+	"x-ui/util/random"
+	"x-ui/web/entity"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+// RequestId gives every request an id, kept from the client when it sent a sane one,
+// so a logged error can be matched to what the user saw
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader(requestIdHeader)
+		if requestId == "" || len(requestId) > 64 || strings.ContainsAny(requestId, "\r\n") {
+			requestId = random.Seq(16)
+		}
+		c.Set("request_id", requestId)
+		c.Header(requestIdHeader, requestId)
+		c.Next()
+	}
+}
+
+// localize translates the key with the localizer of the request, fallback is used without one
+func localize(c *gin.Context, key string, fallback string) string {
+	value, ok := c.Get("localizer")
+	if !ok {
+		return fallback
+	}
+	localizer, ok := value.(*i18n.Localizer)
+	if !ok || localizer == nil {
+		return fallback
+	}
+	msg, err := localizer.Localize(&i18n.LocalizeConfig{MessageID: key})
+	if msg == "" || (err != nil && !isMessageNotFound(err)) {
+		return fallback
+	}
+	return msg
+}
+
+func isMessageNotFound(err error) bool {
+	_, ok := err.(*i18n.MessageNotFoundErr)
+	return ok
+}
+
+func wantsHtml(c *gin.Context) bool {
+	return !isAjax(c) && strings.Contains(c.GetHeader("Accept"), "text/html")
+}
+
+// Recovery logs the stack of a panicking handler along with the request id and answers
+// with a translated error, an error page for browsers and a json message otherwise
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			requestId := c.GetString("request_id")
+			logger.Errorf("panic handling %v %v, request id %v: %v\n%s", c.Request.Method, c.Request.URL.Path, requestId, err, debug.Stack())
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			msg := localize(c, "internalError", "Internal server error")
+			if wantsHtml(c) {
+				c.HTML(http.StatusInternalServerError, "error.html", getContext(gin.H{
+					"title":           msg,
+					"message":         msg,
+					"request_id":      requestId,
+					"request_id_text": localize(c, "requestId", "Request ID"),
+					"base_path":       c.GetString("base_path"),
+					"lang":            getLang(c),
+				}))
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, entity.Msg{
+				Success: false,
+				Msg:     msg + " (" + requestId + ")",
+			})
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scanBlockKeyPrefix = "scan:"
+
+// ScanBlock blocks an ip for duration after threshold requests to paths which don't exist,
+// 404s of matched routes (like an unknown subId) and paths under ignorePrefixes never count,
+// the counters share the login lockout store
+func ScanBlock(threshold int, duration time.Duration, ignorePrefixes ...string) gin.HandlerFunc {
+	lockoutService := service.LockoutService{}
+	return func(c *gin.Context) {
+		key := scanBlockKeyPrefix + getRemoteIp(c)
+		lockedUntil, err := lockoutService.GetLockedUntil(key)
+		if err != nil {
+			logger.Warning("get scan block failed:", err)
+		} else if !lockedUntil.IsZero() {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() != http.StatusNotFound || c.FullPath() != "" {
+			return
+		}
+		path := c.Request.URL.Path
+		for _, prefix := range ignorePrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return
+			}
+		}
+		locked, err := lockoutService.AddFailure(key, threshold, duration)
+		if err != nil {
+			logger.Warning("add scan failure failed:", err)
+		} else if locked {
+			logger.Warningf("ip %v requested too many paths which don't exist, blocked for %v", getRemoteIp(c), duration)
+		}
+	}
+}
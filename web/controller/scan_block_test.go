@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"x-ui/web/entity"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newScanBlockRouter() *gin.Engine {
+	engine := gin.New()
+	engine.Use(ScanBlock(3, time.Minute, "/assets/", "/favicon.ico"))
+	engine.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	// like the subscription routes, the route exists but the subId doesn't
+	engine.GET("/sub/info/:subId", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	return engine
+}
+
+func TestScanBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		ip      string
+		paths   []string
+		blocked bool
+	}{
+		{"paths which don't exist", "198.51.100.1", []string{"/wp-login.php", "/.env", "/phpmyadmin/"}, true},
+		{"too few paths which don't exist", "198.51.100.2", []string{"/wp-login.php", "/.env"}, false},
+		{"valid paths", "198.51.100.3", []string{"/ok", "/ok", "/ok", "/ok"}, false},
+		{"missing assets", "198.51.100.4", []string{"/assets/a.js", "/assets/b.js", "/favicon.ico", "/assets/c.js"}, false},
+		{"unknown subIds", "198.51.100.5", []string{"/sub/info/a", "/sub/info/b", "/sub/info/c", "/sub/info/d"}, false},
+	}
+	lockoutService := service.LockoutService{}
+	engine := newScanBlockRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				lockoutService.Reset(scanBlockKeyPrefix + tt.ip)
+			})
+			for _, path := range tt.paths {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = tt.ip + ":40000"
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, req)
+				if w.Code == http.StatusForbidden {
+					t.Fatalf("GET %v was blocked", path)
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/ok", nil)
+			req.RemoteAddr = tt.ip + ":40000"
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			want := http.StatusOK
+			if tt.blocked {
+				want = http.StatusForbidden
+			}
+			if w.Code != want {
+				t.Errorf("GET /ok after the paths = %v, want %v", w.Code, want)
+			}
+
+			// other ips are never blocked with it
+			req = httptest.NewRequest(http.MethodGet, "/ok", nil)
+			req.RemoteAddr = "203.0.113.1:40000"
+			w = httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Errorf("GET /ok from another ip = %v, want %v", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestGetBlockedIps(t *testing.T) {
+	lockoutService := service.LockoutService{}
+	t.Cleanup(func() {
+		lockoutService.Reset(scanBlockKeyPrefix + "198.51.100.10")
+		lockoutService.Reset(scanBlockKeyPrefix + "198.51.100.11")
+		lockoutService.Reset("198.51.100.12")
+	})
+	// a blocked scanner, a scanner below the threshold and a login lockout
+	for i := 0; i < 3; i++ {
+		_, err := lockoutService.AddFailure(scanBlockKeyPrefix+"198.51.100.10", 3, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = lockoutService.AddFailure("198.51.100.12", 3, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := lockoutService.AddFailure(scanBlockKeyPrefix+"198.51.100.11", 3, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &ServerController{}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/xui/server/getBlockedIps", nil)
+	a.getBlockedIps(c)
+
+	msg := struct {
+		entity.Msg
+		Obj []struct {
+			Ip          string `json:"ip"`
+			LockedUntil int64  `json:"lockedUntil"`
+		} `json:"obj"`
+	}{}
+	err = json.Unmarshal(w.Body.Bytes(), &msg)
+	if err != nil || !msg.Success {
+		t.Fatalf("getBlockedIps() answered %q", w.Body.String())
+	}
+	if len(msg.Obj) != 1 || msg.Obj[0].Ip != "198.51.100.10" {
+		t.Fatalf("getBlockedIps() = %+v, want only 198.51.100.10", msg.Obj)
+	}
+	lockedUntil := time.UnixMilli(msg.Obj[0].LockedUntil)
+	if lockedUntil.Before(time.Now()) || lockedUntil.After(time.Now().Add(time.Minute+time.Second)) {
+		t.Errorf("lockedUntil = %v, want within a minute", lockedUntil)
+	}
+}
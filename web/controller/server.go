@@ -1,16 +1,34 @@
 package controller
 
 import (
+	"encoding/csv"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
+	"x-ui/config"
+	"x-ui/database/model"
 	"x-ui/web/global"
 	"x-ui/web/service"
 )
 
+type banIpForm struct {
+	Ip string `json:"ip" form:"ip"`
+	// Hours is how long a manual ban lasts, 0 means until it is unbanned
+	Hours int `json:"hours" form:"hours"`
+}
+
 type ServerController struct {
 	BaseController
 
-	serverService service.ServerService
+	serverService         service.ServerService
+	trafficHistoryService service.TrafficHistoryService
+	lockoutService        service.LockoutService
+	banService            service.BanService
+	auditService          service.AuditService
+	i18nService           service.I18nService
 
 	lastStatus        *service.Status
 	lastGetStatusTime time.Time
@@ -31,10 +49,22 @@ func NewServerController(g *gin.RouterGroup) *ServerController {
 func (a *ServerController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/server")
 
-	g.Use(a.checkLogin)
+	g.Use(a.checkLogin, audit, checkCsrf)
 	g.POST("/status", a.status)
 	g.POST("/getXrayVersion", a.getXrayVersion)
-	g.POST("/installXray/:version", a.installXray)
+	g.POST("/installXray/:version", checkRole(model.RoleAdmin), a.installXray)
+	g.GET("/version", a.getVersion)
+	g.GET("/top", a.getTopTalkers)
+	g.GET("/blocked-ips", a.getBlockedIps)
+	g.GET("/banned-ips", checkRole(model.RoleAdmin), a.getBannedIps)
+	g.POST("/banned-ips/ban", checkRole(model.RoleAdmin), a.banIp)
+	g.POST("/banned-ips/unban", checkRole(model.RoleAdmin), a.unbanIp)
+	g.GET("/locked-users", checkRole(model.RoleAdmin), a.getLockedUsers)
+	g.POST("/locked-users/unlock", checkRole(model.RoleAdmin), a.unlockUser)
+	g.GET("/audit-logs", checkRole(model.RoleAdmin), a.getAuditLogs)
+	g.GET("/audit-logs/export", checkRole(model.RoleAdmin), a.exportAuditLogs)
+	g.GET("/i18n/missing", a.getMissingTranslations)
+	g.POST("/i18n/missing/clear", checkRole(model.RoleAdmin), a.clearMissingTranslations)
 }
 
 func (a *ServerController) refreshStatus() {
@@ -83,3 +113,170 @@ func (a *ServerController) installXray(c *gin.Context) {
 	err := a.serverService.UpdateXray(version)
 	jsonMsg(c, "安装 xray", err)
 }
+
+func (a *ServerController) getVersion(c *gin.Context) {
+	jsonObj(c, config.GetBuildInfo(), nil)
+}
+
+func (a *ServerController) getTopTalkers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	until, _ := strconv.ParseInt(c.Query("until"), 10, 64)
+	talkers, err := a.trafficHistoryService.GetTopTalkers(c.DefaultQuery("by", "client"), c.DefaultQuery("order", "total"), since, until, limit)
+	jsonObj(c, talkers, err)
+}
+
+func (a *ServerController) getBlockedIps(c *gin.Context) {
+	lockouts, err := a.lockoutService.GetLocked(scanBlockKeyPrefix)
+	if err != nil {
+		jsonMsg(c, "获取封禁 IP", err)
+		return
+	}
+	blocked := make([]gin.H, 0, len(lockouts))
+	for _, lockout := range lockouts {
+		blocked = append(blocked, gin.H{
+			"ip":          strings.TrimPrefix(lockout.Key, scanBlockKeyPrefix),
+			"lockedUntil": lockout.LockedUntil * 1000,
+		})
+	}
+	jsonObj(c, blocked, nil)
+}
+
+func (a *ServerController) getBannedIps(c *gin.Context) {
+	bans, err := a.banService.GetBans()
+	jsonObj(c, bans, err)
+}
+
+func (a *ServerController) banIp(c *gin.Context) {
+	form := &banIpForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "封禁 IP", err)
+		return
+	}
+	if form.Hours < 0 {
+		jsonMsg(c, "封禁 IP", errors.New("封禁时长不能为负数"))
+		return
+	}
+	err = a.banService.Ban(form.Ip, "manual", time.Hour*time.Duration(form.Hours))
+	jsonMsg(c, "封禁 IP", err)
+}
+
+// unbanIp lifts the ban of the ip along with its login lockout, so it can login right away
+func (a *ServerController) unbanIp(c *gin.Context) {
+	form := &banIpForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "解封 IP", err)
+		return
+	}
+	err = a.banService.Unban(form.Ip)
+	if err == nil {
+		err = a.lockoutService.Reset(loginLockoutKeyPrefix + form.Ip)
+	}
+	if err == nil {
+		err = a.lockoutService.Reset(loginBanKeyPrefix + form.Ip)
+	}
+	jsonMsg(c, "解封 IP", err)
+}
+
+func (a *ServerController) getLockedUsers(c *gin.Context) {
+	lockouts, err := a.lockoutService.GetLocked(loginUserLockoutKeyPrefix)
+	if err != nil {
+		jsonMsg(c, "获取锁定的账号", err)
+		return
+	}
+	locked := make([]gin.H, 0, len(lockouts))
+	for _, lockout := range lockouts {
+		locked = append(locked, gin.H{
+			"username":    strings.TrimPrefix(lockout.Key, loginUserLockoutKeyPrefix),
+			"lockedUntil": lockout.LockedUntil * 1000,
+		})
+	}
+	jsonObj(c, locked, nil)
+}
+
+func (a *ServerController) unlockUser(c *gin.Context) {
+	username := c.PostForm("username")
+	err := a.lockoutService.Reset(getLoginUserKey(username))
+	jsonMsg(c, "解锁账号", err)
+}
+
+func getAuditLogQuery(c *gin.Context) *service.AuditLogQuery {
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	until, _ := strconv.ParseInt(c.Query("until"), 10, 64)
+	return &service.AuditLogQuery{
+		Username: c.Query("username"),
+		Path:     c.Query("path"),
+		Since:    since,
+		Until:    until,
+	}
+}
+
+func (a *ServerController) getAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page <= 0 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+	auditLogs, total, err := a.auditService.GetAuditLogs(getAuditLogQuery(c), page, pageSize)
+	if err != nil {
+		jsonMsg(c, "获取审计日志", err)
+		return
+	}
+	jsonObj(c, gin.H{"logs": auditLogs, "total": total}, nil)
+}
+
+// exportAuditLogs downloads the matching audit logs as csv, or as json with format=json
+func (a *ServerController) exportAuditLogs(c *gin.Context) {
+	auditLogs, err := a.auditService.GetAllAuditLogs(getAuditLogQuery(c))
+	if err != nil {
+		jsonMsg(c, "导出审计日志", err)
+		return
+	}
+	if c.Query("format") == "json" {
+		c.Header("Content-Disposition", "attachment; filename=audit-logs.json")
+		c.JSON(http.StatusOK, auditLogs)
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=audit-logs.csv")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "time", "user_id", "username", "ip", "method", "path", "params", "diff", "success", "msg"})
+	for _, auditLog := range auditLogs {
+		w.Write([]string{
+			strconv.Itoa(auditLog.Id),
+			time.Unix(auditLog.CreatedAt, 0).Format(time.RFC3339),
+			strconv.Itoa(auditLog.UserId),
+			auditLog.Username,
+			auditLog.Ip,
+			auditLog.Method,
+			auditLog.Path,
+			auditLog.Params,
+			auditLog.Diff,
+			strconv.FormatBool(auditLog.Success),
+			auditLog.Msg,
+		})
+	}
+	w.Flush()
+}
+
+func (a *ServerController) getMissingTranslations(c *gin.Context) {
+	missing, err := a.i18nService.GetMissingTranslations()
+	if err != nil {
+		jsonMsg(c, "获取缺失的翻译", err)
+		return
+	}
+	jsonObj(c, missing, nil)
+}
+
+func (a *ServerController) clearMissingTranslations(c *gin.Context) {
+	err := a.i18nService.ClearMissingTranslations()
+	jsonMsg(c, "清空缺失的翻译", err)
+}
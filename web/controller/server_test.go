@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"x-ui/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetVersion(t *testing.T) {
+	a := &ServerController{}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/server/version", nil)
+	a.getVersion(c)
+
+	msg := struct {
+		Success bool             `json:"success"`
+		Obj     config.BuildInfo `json:"obj"`
+	}{}
+	err := json.Unmarshal(w.Body.Bytes(), &msg)
+	if err != nil || !msg.Success {
+		t.Fatalf("getVersion() answered %q", w.Body.String())
+	}
+	if msg.Obj != config.GetBuildInfo() {
+		t.Errorf("getVersion() = %+v, want %+v", msg.Obj, config.GetBuildInfo())
+	}
+}
@@ -2,7 +2,9 @@ package controller
 
 import (
 	"errors"
+	"io"
 	"time"
+	"x-ui/database/model"
 	"x-ui/web/entity"
 	"x-ui/web/service"
 	"x-ui/web/session"
@@ -17,10 +19,25 @@ type updateUserForm struct {
 	NewPassword string `json:"newPassword" form:"newPassword"`
 }
 
+type userForm struct {
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+	Role     string `json:"role" form:"role"`
+}
+
+type totpForm struct {
+	Code string `json:"code" form:"code"`
+}
+
 type SettingController struct {
-	settingService service.SettingService
-	userService    service.UserService
-	panelService   service.PanelService
+	settingService      service.SettingService
+	userService         service.UserService
+	panelService        service.PanelService
+	brandingService     service.BrandingService
+	tgBotService        service.TgBotService
+	mailService         service.MailService
+	notificationService service.NotificationService
+	loginSessionService service.LoginSessionService
 }
 
 func NewSettingController(g *gin.RouterGroup) *SettingController {
@@ -32,10 +49,29 @@ func NewSettingController(g *gin.RouterGroup) *SettingController {
 func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/setting")
 
-	g.POST("/all", a.getAllSetting)
-	g.POST("/update", a.updateSetting)
+	// every user manages its own login, the rest of the settings are for admins
+	admin := checkRole(model.RoleAdmin)
+
+	g.POST("/all", admin, a.getAllSetting)
+	g.POST("/update", admin, a.updateSetting)
 	g.POST("/updateUser", a.updateUser)
-	g.POST("/restartPanel", a.restartPanel)
+	g.POST("/restartPanel", admin, a.restartPanel)
+	g.POST("/uploadLogo", admin, a.uploadLogo)
+	g.POST("/delLogo", admin, a.delLogo)
+	g.POST("/getTotp", a.getTotp)
+	g.POST("/newTotp", a.newTotp)
+	g.POST("/enableTotp", a.enableTotp)
+	g.POST("/disableTotp", a.disableTotp)
+	g.POST("/testTgBot", admin, a.testTgBot)
+	g.POST("/testMail", admin, a.testMail)
+	g.POST("/testWebhook", admin, a.testWebhook)
+	g.POST("/users", admin, a.getUsers)
+	g.POST("/addUser", admin, a.addUser)
+	g.POST("/setUser/:id", admin, a.setUser)
+	g.POST("/delUser/:id", admin, a.delUser)
+	g.POST("/sessions", a.getSessions)
+	g.POST("/revokeSession/:id", a.revokeSession)
+	g.POST("/revokeOtherSessions", a.revokeOtherSessions)
 }
 
 func (a *SettingController) getAllSetting(c *gin.Context) {
@@ -66,6 +102,10 @@ func (a *SettingController) updateUser(c *gin.Context) {
 		return
 	}
 	user := session.GetLoginUser(c)
+	if getLoginUser(c).Source == model.UserSourceLdap {
+		jsonMsg(c, "修改用户", errors.New("LDAP 用户请在目录中修改密码"))
+		return
+	}
 	if user.Username != form.OldUsername || user.Password != form.OldPassword {
 		jsonMsg(c, "修改用户", errors.New("原用户名或原密码错误"))
 		return
@@ -83,7 +123,183 @@ func (a *SettingController) updateUser(c *gin.Context) {
 	jsonMsg(c, "修改用户", err)
 }
 
+func (a *SettingController) getUsers(c *gin.Context) {
+	users, err := a.userService.GetUsers()
+	jsonObj(c, users, err)
+}
+
+func (a *SettingController) addUser(c *gin.Context) {
+	form := &userForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "添加用户", err)
+		return
+	}
+	err = a.userService.AddUser(&model.User{
+		Username: form.Username,
+		Password: form.Password,
+		Role:     form.Role,
+	})
+	jsonMsg(c, "添加用户", err)
+}
+
+func (a *SettingController) setUser(c *gin.Context) {
+	form := &userForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "修改用户", err)
+		return
+	}
+	err = a.userService.SetUser(int(getUriId(c)), form.Username, form.Password, form.Role)
+	jsonMsg(c, "修改用户", err)
+}
+
+func (a *SettingController) delUser(c *gin.Context) {
+	id := int(getUriId(c))
+	if id == getLoginUser(c).Id {
+		jsonMsg(c, "删除用户", errors.New("不能删除当前登录的用户"))
+		return
+	}
+	err := a.userService.DelUser(id)
+	jsonMsg(c, "删除用户", err)
+}
+
+// getSessions lists the sessions of the login user, admins get the sessions of every user
+func (a *SettingController) getSessions(c *gin.Context) {
+	user := getLoginUser(c)
+	userId := user.Id
+	if user.HasRole(model.RoleAdmin) {
+		userId = 0
+	}
+	loginSessions, err := a.loginSessionService.GetSessions(userId)
+	if err != nil {
+		jsonMsg(c, "获取登录会话", err)
+		return
+	}
+	users, err := a.userService.GetUsers()
+	if err != nil {
+		jsonMsg(c, "获取登录会话", err)
+		return
+	}
+	usernames := map[int]string{}
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+	}
+	currentId := session.GetSessionId(c)
+	result := make([]gin.H, 0, len(loginSessions))
+	for _, loginSession := range loginSessions {
+		result = append(result, gin.H{
+			"id":        loginSession.Id,
+			"username":  usernames[loginSession.UserId],
+			"ip":        loginSession.Ip,
+			"userAgent": loginSession.UserAgent,
+			"createdAt": loginSession.CreatedAt * 1000,
+			"lastSeen":  loginSession.LastSeen * 1000,
+			"current":   loginSession.SessionId == currentId,
+		})
+	}
+	jsonObj(c, result, nil)
+}
+
+// revokeSession logs the session out, users revoke their own sessions, admins any session
+func (a *SettingController) revokeSession(c *gin.Context) {
+	user := getLoginUser(c)
+	userId := user.Id
+	if user.HasRole(model.RoleAdmin) {
+		userId = 0
+	}
+	err := a.loginSessionService.DelSession(int(getUriId(c)), userId)
+	jsonMsg(c, "注销会话", err)
+}
+
+func (a *SettingController) revokeOtherSessions(c *gin.Context) {
+	err := a.loginSessionService.DelOtherSessions(getLoginUser(c).Id, session.GetSessionId(c))
+	jsonMsg(c, "注销其他会话", err)
+}
+
+func (a *SettingController) getTotp(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	enabled, err := a.userService.IsTotpEnabled(user.Id)
+	jsonObj(c, gin.H{"enabled": enabled}, err)
+}
+
+func (a *SettingController) newTotp(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	secret, uri, err := a.userService.NewTotp(user)
+	jsonMsgObj(c, "生成两步验证密钥", gin.H{"secret": secret, "uri": uri}, err)
+}
+
+func (a *SettingController) enableTotp(c *gin.Context) {
+	form := &totpForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "启用两步验证", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	codes, err := a.userService.EnableTotp(user.Id, form.Code)
+	jsonMsgObj(c, "启用两步验证", codes, err)
+}
+
+func (a *SettingController) disableTotp(c *gin.Context) {
+	form := &totpForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "关闭两步验证", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	err = a.userService.DisableTotp(user.Id, form.Code)
+	jsonMsg(c, "关闭两步验证", err)
+}
+
 func (a *SettingController) restartPanel(c *gin.Context) {
 	err := a.panelService.RestartPanel(time.Second * 3)
 	jsonMsg(c, "重启面板", err)
 }
+
+// testTgBot sends a message with the saved bot settings, so they can be checked before waiting for a report
+func (a *SettingController) testTgBot(c *gin.Context) {
+	info, err := a.tgBotService.GetTrafficReport()
+	if err == nil {
+		err = a.tgBotService.SendMsg("x-ui 电报机器人测试消息\r\n" + info)
+	}
+	jsonMsg(c, "发送测试消息", err)
+}
+
+func (a *SettingController) testMail(c *gin.Context) {
+	err := a.mailService.SendAdminMail("x-ui 测试邮件", "x-ui 邮件提醒设置正常\r\n")
+	jsonMsg(c, "发送测试邮件", err)
+}
+
+func (a *SettingController) testWebhook(c *gin.Context) {
+	err := a.notificationService.Send(service.EventTest, gin.H{"message": "x-ui webhook test"})
+	jsonMsg(c, "发送测试事件", err)
+}
+
+func (a *SettingController) uploadLogo(c *gin.Context) {
+	file, err := c.FormFile("logo")
+	if err != nil {
+		jsonMsg(c, "上传 logo", err)
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		jsonMsg(c, "上传 logo", err)
+		return
+	}
+	defer f.Close()
+	// read one byte more than allowed so an oversized logo is rejected instead of truncated
+	data, err := io.ReadAll(io.LimitReader(f, service.MaxLogoSize+1))
+	if err != nil {
+		jsonMsg(c, "上传 logo", err)
+		return
+	}
+	err = a.brandingService.SaveLogo(data)
+	jsonMsg(c, "上传 logo", err)
+}
+
+func (a *SettingController) delLogo(c *gin.Context) {
+	err := a.brandingService.DelLogo()
+	jsonMsg(c, "删除 logo", err)
+}
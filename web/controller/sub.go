@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubController struct {
+	subService service.SubService
+}
+
+func NewSubController(g *gin.RouterGroup) *SubController {
+	a := &SubController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/sub")
+
+	g.Use(rateLimit(30, time.Minute))
+	g.GET("/links/:subId", a.links)
+	g.GET("/info/:subId", a.info)
+	g.GET("/badge/:subId", a.badge)
+}
+
+// subError answers 404 for a subscription id no client has and 500 for other failures,
+// so a broken database isn't reported to clients as a deleted subscription
+func subError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrSubNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	logger.Warning("get subscription failed:", err)
+	c.Status(http.StatusInternalServerError)
+}
+
+// links serves the subscription itself, base64 links by default and a clash profile with format=clash
+func (a *SubController) links(c *gin.Context) {
+	subId := c.Param("subId")
+	info, err := a.subService.GetSubInfo(subId)
+	if err != nil {
+		subError(c, err)
+		return
+	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	// clients show usage and expiry from this header, expire is in seconds
+	c.Header("Subscription-Userinfo", fmt.Sprintf("upload=%v; download=%v; total=%v; expire=%v",
+		info.Up, info.Down, info.Total, info.Expire/1000))
+	c.Header("Profile-Update-Interval", "12")
+	if c.Query("format") == "clash" {
+		profile, err := a.subService.GetSubClash(subId, host)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", subId+".yaml"))
+		c.Data(http.StatusOK, "text/yaml; charset=utf-8", profile)
+		return
+	}
+	links, err := a.subService.GetSubLinks(subId, host)
+	if err != nil {
+		subError(c, err)
+		return
+	}
+	c.String(http.StatusOK, links)
+}
+
+func (a *SubController) info(c *gin.Context) {
+	info, err := a.subService.GetSubInfo(c.Param("subId"))
+	if err != nil {
+		subError(c, err)
+		return
+	}
+	jsonObj(c, info, nil)
+}
+
+func (a *SubController) badge(c *gin.Context) {
+	info, err := a.subService.GetSubInfo(c.Param("subId"))
+	if err != nil {
+		subError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(info.RenderBadge(time.Now())))
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getSubInfo(subId string) *httptest.ResponseRecorder {
+	engine := gin.New()
+	NewSubController(engine.Group("/"))
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sub/info/"+subId, nil))
+	return w
+}
+
+func TestSubInfo(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.Inbound{})
+		db.Where("1 = 1").Delete(model.ClientTraffic{})
+	})
+	inbound := &model.Inbound{
+		Port:       47000,
+		Protocol:   model.VLESS,
+		Tag:        "inbound-47000",
+		Enable:     true,
+		Up:         111,
+		Down:       222,
+		Total:      333,
+		ExpiryTime: 1000,
+		Settings: `{"clients": [
+			{"id": "c7a9c0a5-5bb4-4a4b-8b1f-ef3d3a7d1f01", "email": "sub-info", "totalGB": 5368709120, "expiryTime": 1893456000000, "subId": "sub-info-test"},
+			{"id": "c7a9c0a5-5bb4-4a4b-8b1f-ef3d3a7d1f02", "email": "sub-info-no-limits", "subId": "sub-info-plain"}
+		]}`,
+	}
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(&model.ClientTraffic{InboundId: inbound.Id, Email: "sub-info", Up: 1024, Down: 4096}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		subId string
+		want  service.SubInfo
+	}{
+		{"client traffic and limits", "sub-info-test", service.SubInfo{Up: 1024, Down: 4096, Total: 5368709120, Expire: 1893456000000}},
+		// without traffic or limits of its own, the client gets those of the inbound
+		{"inbound traffic and limits", "sub-info-plain", service.SubInfo{Up: 111, Down: 222, Total: 333, Expire: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getSubInfo(tt.subId)
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET /sub/info/%v = %v, want %v", tt.subId, w.Code, http.StatusOK)
+			}
+			msg := struct {
+				Success bool            `json:"success"`
+				Obj     service.SubInfo `json:"obj"`
+			}{}
+			err := json.Unmarshal(w.Body.Bytes(), &msg)
+			if err != nil || !msg.Success {
+				t.Fatalf("GET /sub/info/%v answered %q", tt.subId, w.Body.String())
+			}
+			if msg.Obj != tt.want {
+				t.Errorf("GET /sub/info/%v = %+v, want %+v", tt.subId, msg.Obj, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown subId", func(t *testing.T) {
+		w := getSubInfo("sub-info-unknown")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET /sub/info/sub-info-unknown = %v, want %v", w.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestSubInfoDatabaseDown(t *testing.T) {
+	err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		err := database.InitDB(testDBPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	sqlDB, err := database.GetDB().DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	// the subscription may well exist, it must not look deleted to the client
+	w := getSubInfo("sub-info-test")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("GET /sub/info/sub-info-test = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestSubBadge(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.Inbound{})
+	})
+	inbound := &model.Inbound{Port: 47001, Protocol: model.VLESS, Tag: "inbound-47001", Enable: true,
+		Settings: `{"clients": [{"id": "c7a9c0a5-5bb4-4a4b-8b1f-ef3d3a7d1f03", "email": "sub-badge", "subId": "sub-badge-test"}]}`}
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	NewSubController(engine.Group("/"))
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sub/badge/sub-badge-test", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /sub/badge/sub-badge-test = %v, want %v", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/svg+xml; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "∞ / ∞") {
+		t.Errorf("badge = %q, want unlimited days and data", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sub/badge/sub-badge-unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /sub/badge/sub-badge-unknown = %v, want %v", w.Code, http.StatusNotFound)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"strings"
 	"x-ui/config"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/entity"
+	"x-ui/web/service"
+	"x-ui/web/session"
 )
 
 func getUriId(c *gin.Context) int64 {
@@ -19,16 +22,74 @@ func getUriId(c *gin.Context) int64 {
 	return s.Id
 }
 
+// getRemoteIp returns the client ip, X-Forwarded-For is only used when the request comes
+// from a trusted proxy, else anyone could pick the ip lockouts and limits apply to
 func getRemoteIp(c *gin.Context) string {
-	value := c.GetHeader("X-Forwarded-For")
-	if value != "" {
-		ips := strings.Split(value, ",")
-		return ips[0]
-	} else {
-		addr := c.Request.RemoteAddr
-		ip, _, _ := net.SplitHostPort(addr)
+	return GetRequestIp(c.Request)
+}
+
+// GetRequestIp is getRemoteIp for code that has only the request
+func GetRequestIp(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	value := r.Header.Get("X-Forwarded-For")
+	if value == "" {
 		return ip
 	}
+	trustedProxies, ok := getTrustedProxies(r)
+	if !ok {
+		return ip
+	}
+	// proxies append the address they got the request from, the client is the last untrusted one
+	ips := strings.Split(value, ",")
+	for i := len(ips) - 1; i > 0; i-- {
+		forwardedIp := strings.TrimSpace(ips[i])
+		if !common.NetworksContain(trustedProxies, net.ParseIP(forwardedIp)) {
+			return forwardedIp
+		}
+	}
+	return strings.TrimSpace(ips[0])
+}
+
+// getTrustedProxies returns the trusted proxies when the request comes from one of them
+func getTrustedProxies(r *http.Request) ([]*net.IPNet, bool) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	// the trusted proxies are cached by the setting service, this doesn't query the database
+	settingService := service.SettingService{}
+	trustedProxies, err := settingService.GetTrustedProxies()
+	if err != nil {
+		logger.Warning("get trusted proxies failed:", err)
+		return nil, false
+	}
+	// requests through a unix socket have no ip, they come from a local proxy
+	remoteIp := net.ParseIP(ip)
+	if remoteIp != nil && !common.NetworksContain(trustedProxies, remoteIp) {
+		return nil, false
+	}
+	return trustedProxies, true
+}
+
+// isHttps reports whether the client uses https, X-Forwarded-Proto is only used when the
+// request comes from a trusted proxy
+func isHttps(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	value := r.Header.Get("X-Forwarded-Proto")
+	if value == "" {
+		return false
+	}
+	if _, ok := getTrustedProxies(r); !ok {
+		return false
+	}
+	// the first proxy of a chain sets the scheme the client used
+	proto := strings.Split(value, ",")[0]
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
 }
 
 func jsonMsg(c *gin.Context, msg string, err error) {
@@ -77,9 +138,31 @@ func html(c *gin.Context, name string, title string, data gin.H) {
 	data["title"] = title
 	data["request_uri"] = c.Request.RequestURI
 	data["base_path"] = c.GetString("base_path")
+	data["lang"] = getLang(c)
+	// the i18n template functions translate with the localizer of this request
+	if localizer, ok := c.Get("localizer"); ok {
+		data["localizer"] = localizer
+	}
+	if user := getLoginUser(c); user != nil {
+		data["role"] = user.Role
+	}
+	token, err := session.GetCsrfToken(c)
+	if err != nil {
+		logger.Warning("get csrf token failed:", err)
+	}
+	data["csrf_token"] = token
 	c.HTML(http.StatusOK, name, getContext(data))
 }
 
+// getLang returns the language the request is answered in, for the lang attribute of pages
+func getLang(c *gin.Context) string {
+	lang := c.GetString("lang")
+	if lang == "" {
+		return "zh-Hans"
+	}
+	return lang
+}
+
 func getContext(h gin.H) gin.H {
 	a := gin.H{
 		"cur_ver": config.GetVersion(),
@@ -95,3 +178,8 @@ func getContext(h gin.H) gin.H {
 func isAjax(c *gin.Context) bool {
 	return c.GetHeader("X-Requested-With") == "XMLHttpRequest"
 }
+
+// isForce reports whether the request asks to override soft safety checks
+func isForce(c *gin.Context) bool {
+	return c.Query("force") == "true" || c.PostForm("force") == "true"
+}
@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"strconv"
+	"x-ui/database/model"
+	"x-ui/web/service"
+	"x-ui/xray"
+
+	"github.com/gin-gonic/gin"
+)
+
+type clientRouteForm struct {
+	Email       string `json:"email" form:"email"`
+	InboundTag  string `json:"inboundTag" form:"inboundTag"`
+	OutboundTag string `json:"outboundTag" form:"outboundTag"`
+}
+
+type dnsRoutingForm struct {
+	Server      string `json:"server" form:"server"`
+	OutboundTag string `json:"outboundTag" form:"outboundTag"`
+}
+
+type balancerForm struct {
+	Tag          string   `json:"tag" form:"tag"`
+	OutboundTags []string `json:"outboundTags" form:"outboundTags"`
+}
+
+type balancerRouteForm struct {
+	Email       string `json:"email" form:"email"`
+	InboundTag  string `json:"inboundTag" form:"inboundTag"`
+	BalancerTag string `json:"balancerTag" form:"balancerTag"`
+}
+
+type fakeDNSForm struct {
+	IPPool   string `json:"ipPool" form:"ipPool"`
+	PoolSize int64  `json:"poolSize" form:"poolSize"`
+}
+
+type XrayController struct {
+	BaseController
+
+	xrayService      service.XrayService
+	routingService   service.RoutingService
+	fakeDNSService   service.FakeDNSService
+	accessLogService service.AccessLogService
+	transportService service.TransportService
+}
+
+func NewXrayController(g *gin.RouterGroup) *XrayController {
+	a := &XrayController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *XrayController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/xray")
+
+	g.Use(a.checkLogin, audit, checkCsrf)
+	// the xray wide config is for admins, operators look at the logs and tune inbounds
+	admin := checkRole(model.RoleAdmin)
+	operator := checkRole(model.RoleOperator)
+	g.POST("/routing/client", admin, a.addClientRoute)
+	g.POST("/routing/dns", admin, a.setDNSRouting)
+	g.POST("/routing/balancer", admin, a.setBalancer)
+	g.POST("/routing/balancer/del/:tag", admin, a.delBalancer)
+	g.POST("/routing/balancer/client", admin, a.addBalancerRoute)
+	g.POST("/fakedns", a.getFakeDNS)
+	g.POST("/fakedns/enable", admin, a.enableFakeDNS)
+	g.POST("/fakedns/disable", admin, a.disableFakeDNS)
+	g.GET("/logs/search", operator, a.searchLogs)
+	g.POST("/transport", a.getTransport)
+	g.POST("/transport/update", admin, a.updateTransport)
+	g.POST("/sockopt/:id", operator, a.setInboundSockopt)
+}
+
+func (a *XrayController) addClientRoute(c *gin.Context) {
+	form := &clientRouteForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "添加路由", err)
+		return
+	}
+	err = a.routingService.AddClientRoute(form.Email, form.InboundTag, form.OutboundTag)
+	jsonMsg(c, "添加路由", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) setBalancer(c *gin.Context) {
+	form := &balancerForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "修改负载均衡", err)
+		return
+	}
+	err = a.routingService.SetBalancer(form.Tag, form.OutboundTags)
+	jsonMsg(c, "修改负载均衡", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) delBalancer(c *gin.Context) {
+	err := a.routingService.DelBalancer(c.Param("tag"))
+	jsonMsg(c, "删除负载均衡", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) addBalancerRoute(c *gin.Context) {
+	form := &balancerRouteForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "添加路由", err)
+		return
+	}
+	err = a.routingService.AddBalancerRoute(form.Email, form.InboundTag, form.BalancerTag)
+	jsonMsg(c, "添加路由", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) setDNSRouting(c *gin.Context) {
+	form := &dnsRoutingForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "修改 dns 路由", err)
+		return
+	}
+	err = a.routingService.SetDNSRouting(form.Server, form.OutboundTag)
+	jsonMsg(c, "修改 dns 路由", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) getFakeDNS(c *gin.Context) {
+	fakeDNS, err := a.fakeDNSService.GetFakeDNS()
+	jsonObj(c, fakeDNS, err)
+}
+
+func (a *XrayController) enableFakeDNS(c *gin.Context) {
+	form := &fakeDNSForm{}
+	err := c.ShouldBind(form)
+	if err != nil {
+		jsonMsg(c, "启用 fakedns", err)
+		return
+	}
+	err = a.fakeDNSService.EnableFakeDNS(form.IPPool, form.PoolSize)
+	jsonMsg(c, "启用 fakedns", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) disableFakeDNS(c *gin.Context) {
+	err := a.fakeDNSService.DisableFakeDNS()
+	jsonMsg(c, "禁用 fakedns", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) searchLogs(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	lines, err := a.accessLogService.SearchAccessLog(c.Query("email"), c.Query("ip"), offset, limit)
+	jsonObj(c, lines, err)
+}
+
+func (a *XrayController) getTransport(c *gin.Context) {
+	transport, err := a.transportService.GetTransport()
+	jsonObj(c, transport, err)
+}
+
+func (a *XrayController) updateTransport(c *gin.Context) {
+	transport := &xray.TransportConfig{}
+	err := c.ShouldBindJSON(transport)
+	if err != nil {
+		jsonMsg(c, "修改传输配置", err)
+		return
+	}
+	err = a.transportService.SetTransport(transport)
+	jsonMsg(c, "修改传输配置", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *XrayController) setInboundSockopt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "修改 sockopt", err)
+		return
+	}
+	sockopt := &xray.SockoptConfig{}
+	err = c.ShouldBindJSON(sockopt)
+	if err != nil {
+		jsonMsg(c, "修改 sockopt", err)
+		return
+	}
+	err = a.transportService.SetInboundSockopt(id, sockopt)
+	jsonMsg(c, "修改 sockopt", err)
+	if err == nil {
+		a.xrayService.SetToNeedRestart()
+	}
+}
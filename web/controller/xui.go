@@ -19,7 +19,7 @@ func NewXUIController(g *gin.RouterGroup) *XUIController {
 
 func (a *XUIController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/xui")
-	g.Use(a.checkLogin)
+	g.Use(a.checkLogin, audit, checkCsrf)
 
 	g.GET("/", a.index)
 	g.GET("/inbounds", a.inbounds)
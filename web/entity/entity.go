@@ -4,9 +4,17 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"x-ui/database/model"
 	"x-ui/util/common"
+	"x-ui/util/ldap"
+	"x-ui/util/schedule"
 	"x-ui/xray"
 )
 
@@ -26,30 +34,196 @@ type Pager struct {
 	List     interface{} `json:"list"`
 }
 
+// MinJobInterval is the shortest interval in seconds a configurable cron job may run at
+const MinJobInterval = 5
+
+// NotificationEvents are the events of the notification service webhooks can be limited to
+var NotificationEvents = map[string]bool{
+	"inbound.created":  true,
+	"inbound.disabled": true,
+	"client.expired":   true,
+	"xray.crashed":     true,
+	"login.failed":     true,
+}
+
+// the backends passwords of panel logins are checked against
+const (
+	AuthBackendLocal = "local"
+	AuthBackendLdap  = "ldap"
+	// AuthBackendBoth tries ldap first and the local users after it
+	AuthBackendBoth = "both"
+)
+
+// LdapGroupRole gives the members of an ldap group a panel role
+type LdapGroupRole struct {
+	Role  string
+	Group string
+}
+
+// ParseLdapGroupRoles parses role:group dn pairs separated by semicolons
+func ParseLdapGroupRoles(value string) ([]*LdapGroupRole, error) {
+	groupRoles := make([]*LdapGroupRole, 0)
+	for _, pair := range strings.Split(value, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, ":")
+		if i < 0 {
+			return nil, common.NewError("ldap group role must be role:group dn:", pair)
+		}
+		groupRole := &LdapGroupRole{
+			Role:  strings.TrimSpace(pair[:i]),
+			Group: strings.TrimSpace(pair[i+1:]),
+		}
+		if !model.IsValidRole(groupRole.Role) {
+			return nil, common.NewError("unknown role:", groupRole.Role)
+		}
+		if groupRole.Group == "" {
+			return nil, common.NewError("ldap group dn is empty:", pair)
+		}
+		groupRoles = append(groupRoles, groupRole)
+	}
+	return groupRoles, nil
+}
+
+// MinApiTokenLength keeps api tokens too long to guess
+const MinApiTokenLength = 16
+
 type AllSetting struct {
-	WebListen          string `json:"webListen" form:"webListen"`
-	WebPort            int    `json:"webPort" form:"webPort"`
-	WebCertFile        string `json:"webCertFile" form:"webCertFile"`
-	WebKeyFile         string `json:"webKeyFile" form:"webKeyFile"`
-	WebBasePath        string `json:"webBasePath" form:"webBasePath"`
-	TgBotEnable        bool   `json:"tgBotEnable" form:"tgBotEnable"`
-	TgBotToken         string `json:"tgBotToken" form:"tgBotToken"`
-	TgBotChatId        int    `json:"tgBotChatId" form:"tgBotChatId"`
-	TgRunTime          string `json:"tgRunTime" form:"tgRunTime"`
+	WebListen           string `json:"webListen" form:"webListen"`
+	WebSocketMode       string `json:"webSocketMode" form:"webSocketMode"`
+	WebPort             int    `json:"webPort" form:"webPort"`
+	WebCertFile         string `json:"webCertFile" form:"webCertFile"`
+	WebKeyFile          string `json:"webKeyFile" form:"webKeyFile"`
+	WebCertMode         string `json:"webCertMode" form:"webCertMode"`
+	WebAcmeDomain       string `json:"webAcmeDomain" form:"webAcmeDomain"`
+	WebAcmeEmail        string `json:"webAcmeEmail" form:"webAcmeEmail"`
+	WebAcmeChallenge    string `json:"webAcmeChallenge" form:"webAcmeChallenge"`
+	WebAcmeDnsProvider  string `json:"webAcmeDnsProvider" form:"webAcmeDnsProvider"`
+	WebAcmeDnsToken     string `json:"webAcmeDnsToken" form:"webAcmeDnsToken"`
+	WebBasePath         string `json:"webBasePath" form:"webBasePath"`
+	WebProxyProtocol    bool   `json:"webProxyProtocol" form:"webProxyProtocol"`
+	WebHttpMode         string `json:"webHttpMode" form:"webHttpMode"`
+	WebHttpRedirectPort int    `json:"webHttpRedirectPort" form:"webHttpRedirectPort"`
+	WebHstsMaxAge       int    `json:"webHstsMaxAge" form:"webHstsMaxAge"`
+	WebHstsSubdomains   bool   `json:"webHstsSubdomains" form:"webHstsSubdomains"`
+	WebHstsPreload      bool   `json:"webHstsPreload" form:"webHstsPreload"`
+	WebHttp3            bool   `json:"webHttp3" form:"webHttp3"`
+	WebShutdownTimeout  int    `json:"webShutdownTimeout" form:"webShutdownTimeout"`
+	PanelTitle          string `json:"panelTitle" form:"panelTitle"`
+	TgBotEnable         bool   `json:"tgBotEnable" form:"tgBotEnable"`
+	TgBotToken          string `json:"tgBotToken" form:"tgBotToken"`
+	TgBotChatId         int    `json:"tgBotChatId" form:"tgBotChatId"`
+	TgRunTime           string `json:"tgRunTime" form:"tgRunTime"`
+	TgNotifyLogin       bool   `json:"tgNotifyLogin" form:"tgNotifyLogin"`
+	TgNotifyXrayDown    bool   `json:"tgNotifyXrayDown" form:"tgNotifyXrayDown"`
+	TgBotSelfService    bool   `json:"tgBotSelfService" form:"tgBotSelfService"`
+
+	SmtpHost       string `json:"smtpHost" form:"smtpHost"`
+	SmtpPort       int    `json:"smtpPort" form:"smtpPort"`
+	SmtpUsername   string `json:"smtpUsername" form:"smtpUsername"`
+	SmtpPassword   string `json:"smtpPassword" form:"smtpPassword"`
+	SmtpFrom       string `json:"smtpFrom" form:"smtpFrom"`
+	MailAdmins     string `json:"mailAdmins" form:"mailAdmins"`
+	MailClients    bool   `json:"mailClients" form:"mailClients"`
+	MailExpireDays int    `json:"mailExpireDays" form:"mailExpireDays"`
+
+	WebhookUrls        string `json:"webhookUrls" form:"webhookUrls"`
+	WebhookSecret      string `json:"webhookSecret" form:"webhookSecret"`
+	WebhookEvents      string `json:"webhookEvents" form:"webhookEvents"`
+	DiscordWebhooks    string `json:"discordWebhooks" form:"discordWebhooks"`
+	SlackWebhooks      string `json:"slackWebhooks" form:"slackWebhooks"`
 	XrayTemplateConfig string `json:"xrayTemplateConfig" form:"xrayTemplateConfig"`
 
+	XrayIsolateFailedInbound bool `json:"xrayIsolateFailedInbound" form:"xrayIsolateFailedInbound"`
+	XrayRejectThreshold      int  `json:"xrayRejectThreshold" form:"xrayRejectThreshold"`
+	InboundSoftLimit         int  `json:"inboundSoftLimit" form:"inboundSoftLimit"`
+	InboundHardLimit         int  `json:"inboundHardLimit" form:"inboundHardLimit"`
+
+	EmptyInboundAction string `json:"emptyInboundAction" form:"emptyInboundAction"`
+	EmptyInboundPeriod int    `json:"emptyInboundPeriod" form:"emptyInboundPeriod"`
+
+	XrayCheckInterval    int `json:"xrayCheckInterval" form:"xrayCheckInterval"`
+	TrafficInterval      int `json:"trafficInterval" form:"trafficInterval"`
+	InboundCheckInterval int `json:"inboundCheckInterval" form:"inboundCheckInterval"`
+
 	TimeLocation string `json:"timeLocation" form:"timeLocation"`
 	Penalty      int    `json:"penalty" form:"penalty"`
+
+	IpLimitIpv4Prefix  int    `json:"ipLimitIpv4Prefix" form:"ipLimitIpv4Prefix"`
+	IpLimitIpv6Prefix  int    `json:"ipLimitIpv6Prefix" form:"ipLimitIpv6Prefix"`
+	ClientIpsRetention int    `json:"clientIpsRetention" form:"clientIpsRetention"`
+	IpLimitSkipList    string `json:"ipLimitSkipList" form:"ipLimitSkipList"`
+	IpLimitAction      string `json:"ipLimitAction" form:"ipLimitAction"`
+	SessionLimit       int    `json:"sessionLimit" form:"sessionLimit"`
+	SessionWindow      int    `json:"sessionWindow" form:"sessionWindow"`
+	RestartGrace       int    `json:"restartGrace" form:"restartGrace"`
+
+	IpLimitDecisionLog bool `json:"ipLimitDecisionLog" form:"ipLimitDecisionLog"`
+
+	IpLimitSchedule      string `json:"ipLimitSchedule" form:"ipLimitSchedule"`
+	InboundCheckSchedule string `json:"inboundCheckSchedule" form:"inboundCheckSchedule"`
+
+	AccessLogEmailRegex string `json:"accessLogEmailRegex" form:"accessLogEmailRegex"`
+	I18nTrackMissing    bool   `json:"i18nTrackMissing" form:"i18nTrackMissing"`
+
+	LockoutPersist       bool   `json:"lockoutPersist" form:"lockoutPersist"`
+	LoginMaxFailures     int    `json:"loginMaxFailures" form:"loginMaxFailures"`
+	LoginLockDuration    int    `json:"loginLockDuration" form:"loginLockDuration"`
+	LoginUserMaxFailures int    `json:"loginUserMaxFailures" form:"loginUserMaxFailures"`
+	LoginBanAfter        int    `json:"loginBanAfter" form:"loginBanAfter"`
+	LoginBanDuration     int    `json:"loginBanDuration" form:"loginBanDuration"`
+	OidcIssuer           string `json:"oidcIssuer" form:"oidcIssuer"`
+	OidcClientId         string `json:"oidcClientId" form:"oidcClientId"`
+	OidcClientSecret     string `json:"oidcClientSecret" form:"oidcClientSecret"`
+	OidcRedirectUrl      string `json:"oidcRedirectUrl" form:"oidcRedirectUrl"`
+	OidcUsernameClaim    string `json:"oidcUsernameClaim" form:"oidcUsernameClaim"`
+
+	AuthBackend        string `json:"authBackend" form:"authBackend"`
+	LdapUrl            string `json:"ldapUrl" form:"ldapUrl"`
+	LdapStartTls       bool   `json:"ldapStartTls" form:"ldapStartTls"`
+	LdapBindDn         string `json:"ldapBindDn" form:"ldapBindDn"`
+	LdapBindPassword   string `json:"ldapBindPassword" form:"ldapBindPassword"`
+	LdapBaseDn         string `json:"ldapBaseDn" form:"ldapBaseDn"`
+	LdapUserFilter     string `json:"ldapUserFilter" form:"ldapUserFilter"`
+	LdapGroupAttribute string `json:"ldapGroupAttribute" form:"ldapGroupAttribute"`
+	LdapGroupRoles     string `json:"ldapGroupRoles" form:"ldapGroupRoles"`
+	WebTrustedProxies  string `json:"webTrustedProxies" form:"webTrustedProxies"`
+	ScanBlockThreshold int    `json:"scanBlockThreshold" form:"scanBlockThreshold"`
+	ScanBlockDuration  int    `json:"scanBlockDuration" form:"scanBlockDuration"`
+
+	CorsOrigins     string `json:"corsOrigins" form:"corsOrigins"`
+	CorsMethods     string `json:"corsMethods" form:"corsMethods"`
+	CorsHeaders     string `json:"corsHeaders" form:"corsHeaders"`
+	CorsCredentials bool   `json:"corsCredentials" form:"corsCredentials"`
+
+	MetricsFile         string `json:"metricsFile" form:"metricsFile"`
+	MetricsFileInterval int    `json:"metricsFileInterval" form:"metricsFileInterval"`
+	MetricsToken        string `json:"metricsToken" form:"metricsToken"`
+	ApiTokens           string `json:"apiTokens" form:"apiTokens"`
+
+	UpdateCheckUrl      string `json:"updateCheckUrl" form:"updateCheckUrl"`
+	UpdateCheckInterval int    `json:"updateCheckInterval" form:"updateCheckInterval"`
 }
 
 func (s *AllSetting) CheckValid() error {
-	if s.WebListen != "" {
+	if strings.HasPrefix(s.WebListen, "unix:") {
+		if !strings.HasPrefix(strings.TrimPrefix(s.WebListen, "unix:"), "/") {
+			return common.NewError("web listen socket must be an absolute path:", s.WebListen)
+		}
+	} else if s.WebListen != "" {
 		ip := net.ParseIP(s.WebListen)
 		if ip == nil {
 			return common.NewError("web listen is not valid ip:", s.WebListen)
 		}
 	}
 
+	mode, err := strconv.ParseUint(s.WebSocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return common.NewError("web socket mode is not a valid octal file mode:", s.WebSocketMode)
+	}
+
 	if s.WebPort <= 0 || s.WebPort > 65535 {
 		return common.NewError("web port is not a valid port:", s.WebPort)
 	}
@@ -61,6 +235,42 @@ func (s *AllSetting) CheckValid() error {
 		}
 	}
 
+	switch s.WebCertMode {
+	case "manual":
+	case "acme":
+		if s.WebAcmeDomain == "" || net.ParseIP(s.WebAcmeDomain) != nil {
+			return common.NewError("acme cert mode needs a domain name:", s.WebAcmeDomain)
+		}
+		switch s.WebAcmeChallenge {
+		case "http-01":
+			// only dns-01 proves control of a whole domain
+			if strings.HasPrefix(s.WebAcmeDomain, "*.") {
+				return common.NewError("wildcard acme domains need the dns-01 challenge:", s.WebAcmeDomain)
+			}
+		case "dns-01":
+			if s.WebAcmeDnsProvider != "cloudflare" {
+				return common.NewError("acme dns provider must be cloudflare:", s.WebAcmeDnsProvider)
+			}
+			if s.WebAcmeDnsToken == "" {
+				return common.NewError("the dns-01 acme challenge needs a dns api token")
+			}
+		default:
+			return common.NewError("acme challenge must be http-01 or dns-01:", s.WebAcmeChallenge)
+		}
+	default:
+		return common.NewError("web cert mode must be manual or acme:", s.WebCertMode)
+	}
+
+	if len([]rune(s.PanelTitle)) > 64 {
+		return common.NewError("panel title can not be longer than 64 characters")
+	}
+
+	switch s.WebHttpMode {
+	case "redirect", "reject", "error":
+	default:
+		return common.NewError("web http mode must be one of redirect, reject or error:", s.WebHttpMode)
+	}
+
 	if !strings.HasPrefix(s.WebBasePath, "/") {
 		s.WebBasePath = "/" + s.WebBasePath
 	}
@@ -69,11 +279,278 @@ func (s *AllSetting) CheckValid() error {
 	}
 
 	xrayConfig := &xray.Config{}
-	err := json.Unmarshal([]byte(s.XrayTemplateConfig), xrayConfig)
+	err = json.Unmarshal([]byte(s.XrayTemplateConfig), xrayConfig)
 	if err != nil {
 		return common.NewError("xray template config invalid:", err)
 	}
 
+	if s.TgBotEnable {
+		if s.TgBotToken == "" {
+			return common.NewError("telegram bot token can not be empty when the bot is enabled")
+		}
+		if s.TgBotChatId == 0 {
+			return common.NewError("telegram bot chat id can not be empty when the bot is enabled")
+		}
+	}
+
+	if s.SmtpPort <= 0 || s.SmtpPort > 65535 {
+		return common.NewError("smtp port is not a valid port:", s.SmtpPort)
+	}
+	if s.SmtpFrom != "" {
+		_, err := mail.ParseAddress(s.SmtpFrom)
+		if err != nil {
+			return common.NewError("smtp from address is invalid:", err)
+		}
+	}
+	for _, admin := range strings.Split(s.MailAdmins, ",") {
+		admin = strings.TrimSpace(admin)
+		if admin == "" {
+			continue
+		}
+		_, err := mail.ParseAddress(admin)
+		if err != nil {
+			return common.NewError("mail admin address is invalid:", admin)
+		}
+	}
+	if s.MailExpireDays < 0 {
+		return common.NewError("mail expire days can not be negative:", s.MailExpireDays)
+	}
+
+	webhookUrls := strings.Join([]string{s.WebhookUrls, s.DiscordWebhooks, s.SlackWebhooks}, ",")
+	for _, webhookUrl := range strings.Split(webhookUrls, ",") {
+		webhookUrl = strings.TrimSpace(webhookUrl)
+		if webhookUrl == "" {
+			continue
+		}
+		u, err := url.Parse(webhookUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("webhook url is invalid:", webhookUrl)
+		}
+	}
+	for _, event := range strings.Split(s.WebhookEvents, ",") {
+		event = strings.TrimSpace(event)
+		if event != "" && !NotificationEvents[event] {
+			return common.NewError("unknown webhook event:", event)
+		}
+	}
+
+	if s.IpLimitIpv4Prefix <= 0 || s.IpLimitIpv4Prefix > 32 {
+		return common.NewError("ipv4 limit prefix is not valid:", s.IpLimitIpv4Prefix)
+	}
+	if s.IpLimitIpv6Prefix <= 0 || s.IpLimitIpv6Prefix > 128 {
+		return common.NewError("ipv6 limit prefix is not valid:", s.IpLimitIpv6Prefix)
+	}
+	if s.ClientIpsRetention <= 0 {
+		return common.NewError("client ips retention must be positive:", s.ClientIpsRetention)
+	}
+	switch s.IpLimitAction {
+	case "inbound", "client":
+	default:
+		return common.NewError("ip limit action must be one of inbound or client:", s.IpLimitAction)
+	}
+	_, err = common.ParseNetworks(s.IpLimitSkipList)
+	if err != nil {
+		return common.NewError("ip limit skip list is invalid:", err)
+	}
+
+	if s.SessionLimit < 0 {
+		return common.NewError("session limit can not be negative:", s.SessionLimit)
+	}
+	if s.SessionWindow <= 0 {
+		return common.NewError("session window is not valid:", s.SessionWindow)
+	}
+
+	if s.XrayRejectThreshold < 0 {
+		return common.NewError("xray reject threshold can not be negative:", s.XrayRejectThreshold)
+	}
+
+	if s.InboundSoftLimit < 0 || s.InboundHardLimit < 0 {
+		return common.NewError("inbound limits can not be negative")
+	}
+	if s.InboundSoftLimit > 0 && s.InboundHardLimit > 0 && s.InboundSoftLimit > s.InboundHardLimit {
+		return common.NewErrorf("inbound soft limit %v can not be larger than hard limit %v", s.InboundSoftLimit, s.InboundHardLimit)
+	}
+
+	switch s.EmptyInboundAction {
+	case "off", "flag", "disable":
+	default:
+		return common.NewError("empty inbound action must be one of off, flag or disable:", s.EmptyInboundAction)
+	}
+	if s.EmptyInboundPeriod <= 0 {
+		return common.NewError("empty inbound period is not valid:", s.EmptyInboundPeriod)
+	}
+
+	if s.LoginMaxFailures <= 0 {
+		return common.NewError("login max failures must be positive:", s.LoginMaxFailures)
+	}
+	if s.LoginLockDuration <= 0 {
+		return common.NewError("login lock duration must be positive:", s.LoginLockDuration)
+	}
+	if s.LoginUserMaxFailures < 0 {
+		return common.NewError("login user max failures can't be negative:", s.LoginUserMaxFailures)
+	}
+	if s.LoginBanAfter < 0 {
+		return common.NewError("login ban after can't be negative:", s.LoginBanAfter)
+	}
+	if s.LoginBanDuration < 0 {
+		return common.NewError("login ban duration can't be negative:", s.LoginBanDuration)
+	}
+	_, err = common.ParseNetworks(s.WebTrustedProxies)
+	if err != nil {
+		return common.NewError("trusted proxies are invalid:", err)
+	}
+
+	if s.ScanBlockThreshold < 0 {
+		return common.NewError("scan block threshold can not be negative:", s.ScanBlockThreshold)
+	}
+	if s.ScanBlockDuration <= 0 {
+		return common.NewError("scan block duration must be positive:", s.ScanBlockDuration)
+	}
+
+	for _, token := range strings.Split(s.ApiTokens, ",") {
+		token = strings.TrimSpace(token)
+		if token != "" && len(token) < MinApiTokenLength {
+			return common.NewErrorf("api token must be at least %v characters", MinApiTokenLength)
+		}
+	}
+
+	if s.OidcIssuer != "" {
+		u, err := url.Parse(s.OidcIssuer)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return common.NewError("oidc issuer must be a https url:", s.OidcIssuer)
+		}
+		if s.OidcClientId == "" {
+			return common.NewError("oidc client id is required with an oidc issuer")
+		}
+		if s.OidcUsernameClaim == "" {
+			return common.NewError("oidc username claim is required with an oidc issuer")
+		}
+	}
+	switch s.AuthBackend {
+	case AuthBackendLocal:
+	case AuthBackendLdap, AuthBackendBoth:
+		u, err := url.Parse(s.LdapUrl)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return common.NewError("ldap url must be ldap:// or ldaps://:", s.LdapUrl)
+		}
+		if s.LdapStartTls && u.Scheme != "ldap" {
+			return common.NewError("ldap start tls only works with ldap:// urls")
+		}
+		if s.LdapBaseDn == "" {
+			return common.NewError("ldap base dn is required")
+		}
+		if !strings.Contains(s.LdapUserFilter, "%s") {
+			return common.NewErrorf("ldap user filter must contain %%s for the username: %v", s.LdapUserFilter)
+		}
+		if err := ldap.CheckFilter(strings.ReplaceAll(s.LdapUserFilter, "%s", "x")); err != nil {
+			return common.NewError("ldap user filter is not valid:", s.LdapUserFilter)
+		}
+		if s.LdapGroupAttribute == "" {
+			return common.NewError("ldap group attribute is required")
+		}
+		groupRoles, err := ParseLdapGroupRoles(s.LdapGroupRoles)
+		if err != nil {
+			return err
+		}
+		if len(groupRoles) == 0 {
+			return common.NewError("ldap group roles are required, users in no mapped group can't login")
+		}
+	default:
+		return common.NewError("auth backend must be one of local, ldap or both:", s.AuthBackend)
+	}
+
+	if s.OidcRedirectUrl != "" {
+		u, err := url.Parse(s.OidcRedirectUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("oidc redirect url is not valid:", s.OidcRedirectUrl)
+		}
+	}
+
+	for _, origin := range strings.Split(s.CorsOrigins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			if s.CorsCredentials {
+				return common.NewError("cors credentials can not be allowed for every origin")
+			}
+			continue
+		}
+		originUrl, err := url.Parse(origin)
+		if err != nil || originUrl.Scheme == "" || originUrl.Host == "" || strings.Trim(originUrl.Path, "/") != "" {
+			return common.NewError("cors origin is not valid, it must look like https://example.com:", origin)
+		}
+	}
+
+	if s.WebHttpRedirectPort < 0 || s.WebHttpRedirectPort > 65535 {
+		return common.NewError("http redirect port is not a valid port:", s.WebHttpRedirectPort)
+	}
+	if s.WebHttpRedirectPort != 0 && s.WebHttpRedirectPort == s.WebPort {
+		return common.NewError("http redirect port can not be the web port:", s.WebHttpRedirectPort)
+	}
+	if s.WebHstsMaxAge < 0 {
+		return common.NewError("hsts max age can not be negative:", s.WebHstsMaxAge)
+	}
+	// the preload list only takes hosts asking for a year at least, subdomains included
+	if s.WebHstsPreload && (s.WebHstsMaxAge < 31536000 || !s.WebHstsSubdomains) {
+		return common.NewError("hsts preload needs a max age of 31536000 at least and subdomains included")
+	}
+
+	if s.WebShutdownTimeout <= 0 {
+		return common.NewError("shutdown timeout must be positive:", s.WebShutdownTimeout)
+	}
+
+	if s.RestartGrace < 0 {
+		return common.NewError("restart grace can not be negative:", s.RestartGrace)
+	}
+
+	_, err = schedule.Parse(s.IpLimitSchedule)
+	if err != nil {
+		return common.NewError("ip limit schedule is invalid:", err)
+	}
+	_, err = schedule.Parse(s.InboundCheckSchedule)
+	if err != nil {
+		return common.NewError("inbound check schedule is invalid:", err)
+	}
+
+	if s.AccessLogEmailRegex != "" {
+		emailRegex, err := regexp.Compile(s.AccessLogEmailRegex)
+		if err != nil {
+			return common.NewError("access log email regex is invalid:", err)
+		}
+		if emailRegex.NumSubexp() < 1 {
+			return common.NewError("access log email regex must capture the email in a group:", s.AccessLogEmailRegex)
+		}
+	}
+
+	if s.MetricsFile != "" && !filepath.IsAbs(s.MetricsFile) {
+		return common.NewError("metrics file is not an absolute path:", s.MetricsFile)
+	}
+	if s.MetricsFileInterval <= 0 {
+		return common.NewError("metrics file interval is not valid:", s.MetricsFileInterval)
+	}
+
+	if s.UpdateCheckUrl != "" {
+		u, err := url.Parse(s.UpdateCheckUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return common.NewError("update check url is not valid:", s.UpdateCheckUrl)
+		}
+	}
+	if s.UpdateCheckInterval < 1 {
+		return common.NewError("update check interval must be at least 1 hour:", s.UpdateCheckInterval)
+	}
+
+	if s.XrayCheckInterval < MinJobInterval {
+		return common.NewErrorf("xray check interval must be at least %vs: %v", MinJobInterval, s.XrayCheckInterval)
+	}
+	if s.TrafficInterval < MinJobInterval {
+		return common.NewErrorf("traffic interval must be at least %vs: %v", MinJobInterval, s.TrafficInterval)
+	}
+	if s.InboundCheckInterval < MinJobInterval {
+		return common.NewErrorf("inbound check interval must be at least %vs: %v", MinJobInterval, s.InboundCheckInterval)
+	}
+
 	_, err = time.LoadLocation(s.TimeLocation)
 	if err != nil {
 		return common.NewError("time location not exist:", s.TimeLocation)
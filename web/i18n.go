@@ -0,0 +1,123 @@
+package web
+
+import (
+	"fmt"
+	"io/fs"
+	"sync"
+	"x-ui/logger"
+	"x-ui/util/common"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v2"
+)
+
+// translationBundle holds the parsed translations, in debug mode they are read from disk
+// and parsed again when a file changes, so translations can be edited without a rebuild.
+// Every file under root is a translation, subdirectories included
+type translationBundle struct {
+	fsys    fs.FS
+	root    string
+	lock    sync.RWMutex
+	bundle  *i18n.Bundle
+	matcher language.Matcher
+	// version describes the files the bundle was parsed from, a change means a reload is needed
+	version string
+}
+
+func newTranslationBundle(fsys fs.FS, root string) (*translationBundle, error) {
+	b := &translationBundle{fsys: fsys, root: root}
+	err := b.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// getVersion returns the names, sizes and modification times of the translation files
+func (b *translationBundle) getVersion() (string, error) {
+	version := ""
+	err := fs.WalkDir(b.fsys, b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		version += fmt.Sprintf("%v:%v:%v;", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return version, err
+}
+
+// Reload parses the translation files again, the old translations stay in use if they are invalid
+func (b *translationBundle) Reload() error {
+	version, err := b.getVersion()
+	if err != nil {
+		return err
+	}
+	bundle := i18n.NewBundle(language.SimplifiedChinese)
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	bundle.RegisterUnmarshalFunc("yaml", yaml.Unmarshal)
+	bundle.RegisterUnmarshalFunc("yml", yaml.Unmarshal)
+	err = fs.WalkDir(b.fsys, b.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(b.fsys, path)
+		if err != nil {
+			return err
+		}
+		_, err = bundle.ParseMessageFileBytes(data, path)
+		if err != nil {
+			return common.NewErrorf("parse translation %v failed, supported formats are toml, json, yaml and yml: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.bundle = bundle
+	b.matcher = language.NewMatcher(bundle.LanguageTags())
+	b.version = version
+	return nil
+}
+
+// ReloadIfChanged reloads the translations when a translation file was added, removed or changed
+func (b *translationBundle) ReloadIfChanged() {
+	version, err := b.getVersion()
+	if err != nil {
+		logger.Warning("check translation files failed:", err)
+		return
+	}
+	b.lock.RLock()
+	changed := version != b.version
+	b.lock.RUnlock()
+	if !changed {
+		return
+	}
+	err = b.Reload()
+	if err != nil {
+		logger.Warning("reload translations failed:", err)
+		return
+	}
+	logger.Info("translations reloaded")
+}
+
+// Get returns the current bundle and a matcher of its languages
+func (b *translationBundle) Get() (*i18n.Bundle, language.Matcher) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.bundle, b.matcher
+}
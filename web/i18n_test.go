@@ -0,0 +1,297 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// writeTranslation writes the file under dir and moves its modification time forward,
+// so a rewrite within the same clock tick is seen as a change too
+func writeTranslation(t *testing.T, dir string, name string, data string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	err = os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func translate(t *testing.T, b *translationBundle, lang string, key string) string {
+	t.Helper()
+	bundle, _ := b.Get()
+	msg, err := i18n.NewLocalizer(bundle, lang).Localize(&i18n.LocalizeConfig{MessageID: key})
+	if err != nil {
+		t.Fatalf("localize %v in %v: %v", key, lang, err)
+	}
+	return msg
+}
+
+func TestTranslationReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTranslation(t, dir, "translation/translate.zh_Hans.toml", `"close" = "关闭"`)
+	writeTranslation(t, dir, "translation/translate.en_US.toml", `"close" = "close"`)
+	b, err := newTranslationBundle(os.DirFS(dir), "translation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"changed", `"close" = "shut"`, "shut"},
+		{"invalid keeps the old translations", `"close" = `, "shut"},
+		{"fixed again", `"close" = "dismiss"`, "dismiss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTranslation(t, dir, "translation/translate.en_US.toml", tt.data)
+			b.ReloadIfChanged()
+			if got := translate(t, b, "en-US", "close"); got != tt.want {
+				t.Errorf("close = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// translations can be read while they are reloaded
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := b.Reload()
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			bundle, matcher := b.Get()
+			if bundle == nil || matcher == nil {
+				t.Error("Get() returned no bundle during a reload")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTranslationYaml(t *testing.T) {
+	dir := t.TempDir()
+	writeTranslation(t, dir, "translation/translate.zh_Hans.toml", `"close" = "关闭"`)
+	writeTranslation(t, dir, "translation/translate.en_US.yaml", "close: close\nlogin: sign in\n")
+	writeTranslation(t, dir, "translation/translate.fa_IR.yml", "close: بستن\n")
+	b, err := newTranslationBundle(os.DirFS(dir), "translation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lang string
+		key  string
+		want string
+	}{
+		{"zh-Hans", "close", "关闭"},
+		{"en-US", "close", "close"},
+		{"en-US", "login", "sign in"},
+		{"fa-IR", "close", "بستن"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+" "+tt.key, func(t *testing.T) {
+			if got := translate(t, b, tt.lang, tt.key); got != tt.want {
+				t.Errorf("%v = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+
+	// the error of an unknown format names the ones which are supported
+	writeTranslation(t, dir, "translation/translate.de_DE.ini", "close = schließen\n")
+	err = b.Reload()
+	if err == nil || !strings.Contains(err.Error(), "toml, json, yaml and yml") {
+		t.Errorf("Reload() with an ini file = %v, want the supported formats", err)
+	}
+}
+
+func TestTranslationNestedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeTranslation(t, dir, "translation/translate.zh_Hans.toml", `"close" = "关闭"`)
+	writeTranslation(t, dir, "translation/en/translate.en_US.toml", `"close" = "close"`)
+	writeTranslation(t, dir, "translation/en/extra/more.en_US.yaml", `login: sign in`)
+	writeTranslation(t, dir, "translation/zh/hant/translate.zh_Hant.json", `{"close": "關閉"}`)
+	b, err := newTranslationBundle(os.DirFS(dir), "translation")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lang string
+		key  string
+		want string
+	}{
+		{"zh-Hans", "close", "关闭"},
+		{"en-US", "close", "close"},
+		{"en-US", "login", "sign in"},
+		{"zh-Hant", "close", "關閉"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+" "+tt.key, func(t *testing.T) {
+			if got := translate(t, b, tt.lang, tt.key); got != tt.want {
+				t.Errorf("%v = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+
+	// a file added to a new subdirectory is found on reload
+	writeTranslation(t, dir, "translation/fa/translate.fa_IR.toml", `"close" = "بستن"`)
+	b.ReloadIfChanged()
+	if got := translate(t, b, "fa-IR", "close"); got != "بستن" {
+		t.Errorf("close in a new subdirectory = %q", got)
+	}
+}
+
+// newI18nTestRouter serves the translations of files with the template, which sees the
+// localizer of the request with the query params as data
+func newI18nTestRouter(t *testing.T, files map[string]string, tmpl string) *gin.Engine {
+	t.Helper()
+	// in debug mode the translations are read from web/translation of the working directory
+	dir := t.TempDir()
+	for name, data := range files {
+		writeTranslation(t, dir, filepath.Join("web", "translation", name), data)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	t.Setenv("XUI_DEBUG", "true")
+
+	engine := gin.New()
+	s := NewServer()
+	err = s.initI18n(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetHTMLTemplate(template.Must(template.New("page").Funcs(engine.FuncMap).Parse(tmpl)))
+	engine.GET("/", func(c *gin.Context) {
+		data := gin.H{"localizer": c.MustGet("localizer"), "lang": c.GetString("lang")}
+		for key := range c.Request.URL.Query() {
+			data[key] = c.Query(key)
+		}
+		if count, err := strconv.Atoi(c.Query("count")); err == nil {
+			data["count"] = count
+		}
+		c.HTML(http.StatusOK, "page", data)
+	})
+	return engine
+}
+
+func getI18nPage(engine *gin.Engine, acceptLanguage string, query string) string {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	req.Header.Set("Accept-Language", acceptLanguage)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestI18nFallback(t *testing.T) {
+	engine := newI18nTestRouter(t, map[string]string{
+		"translate.zh_Hans.toml": `"close" = "关闭"
+"login" = "登录"`,
+		"translate.en_US.toml": `"close" = "close"
+"login" = "login"`,
+		"translate.fa_IR.toml": `"close" = "بستن"`,
+	}, `{{ i18n . .key }}`)
+
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		key            string
+		want           string
+	}{
+		{"translated", "fa-IR", "close", "بستن"},
+		// the default language of the bundle is simplified chinese
+		{"missing falls back to the default language", "fa-IR", "login", "登录"},
+		{"missing everywhere shows the key", "fa-IR", "pages.inbounds.title", "pages.inbounds.title"},
+		{"other language", "en-US", "login", "login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getI18nPage(engine, tt.acceptLanguage, "key="+tt.key); got != tt.want {
+				t.Errorf("%v in %v = %q, want %q", tt.key, tt.acceptLanguage, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestI18nPlural(t *testing.T) {
+	engine := newI18nTestRouter(t, map[string]string{
+		"translate.zh_Hans.toml": `[users]
+other = "{{.Count}} 个用户"
+
+[inbounds]
+other = "{{.Count}} 个入站"`,
+		"translate.en_US.toml": `[users]
+one = "{{.Count}} user"
+other = "{{.Count}} users"`,
+		// arabic has its own form for zero
+		"translate.ar.toml": `[users]
+zero = "لا مستخدمين"
+one = "مستخدم واحد"
+other = "{{.Count}} مستخدم"`,
+	}, `{{ i18nPlural . .key .count }}`)
+
+	tests := []struct {
+		acceptLanguage string
+		key            string
+		count          int
+		want           string
+	}{
+		{"en-US", "users", 0, "0 users"},
+		{"en-US", "users", 1, "1 user"},
+		{"en-US", "users", 5, "5 users"},
+		{"ar", "users", 0, "لا مستخدمين"},
+		{"ar", "users", 1, "مستخدم واحد"},
+		{"zh-CN", "users", 1, "1 个用户"},
+		// missing keys fall back like plain translations do
+		{"en-US", "inbounds", 5, "5 个入站"},
+		{"en-US", "clients", 5, "clients"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v %v %v", tt.acceptLanguage, tt.key, tt.count), func(t *testing.T) {
+			query := fmt.Sprintf("key=%v&count=%v", tt.key, tt.count)
+			if got := getI18nPage(engine, tt.acceptLanguage, query); got != tt.want {
+				t.Errorf("%v of %v in %v = %q, want %q", tt.key, tt.count, tt.acceptLanguage, got, tt.want)
+			}
+		})
+	}
+}
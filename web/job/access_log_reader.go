@@ -0,0 +1,137 @@
+package job
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"x-ui/logger"
+	"x-ui/util/sys"
+	"x-ui/web/service"
+)
+
+// accessLogReader remembers how far the access log was read, so every run only reads
+// the lines xray appended since, the log itself is left untouched for other tools
+type accessLogReader struct {
+	settingService service.SettingService
+	// file stays open between runs, so the lines written to it right before it
+	// got rotated are still read from the old file
+	file   *os.File
+	offset int64
+	// fileId is the device and inode of the file the offset belongs to, it is saved with the
+	// offset so a restarted panel doesn't apply it to a file rotated in the meantime
+	fileId string
+	loaded bool
+}
+
+// readNewLines calls fn with every complete line appended since the last call, a line still
+// being written is left for the next call. Reading starts over when the file got truncated or
+// was replaced by log rotation. A log xray didn't create yet is not an error, there is nothing to read
+func (r *accessLogReader) readNewLines(path string, fn func(line string)) error {
+	if !r.loaded {
+		offset, err := r.settingService.GetAccessLogOffset()
+		if err != nil {
+			logger.Warning("get access log offset failed:", err)
+		}
+		fileId, err := r.settingService.GetAccessLogFileId()
+		if err != nil {
+			logger.Warning("get access log file id failed:", err)
+		}
+		r.offset = offset
+		r.fileId = fileId
+		r.loaded = true
+	}
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if r.file != nil {
+		current, err := r.file.Stat()
+		if err == nil && info != nil && os.SameFile(current, info) {
+			if info.Size() < r.offset {
+				logger.Info("access log got truncated, read it from the start")
+				r.setOffset(0)
+			}
+			return r.readFrom(r.file, fn)
+		}
+		// the log got rotated or removed, what was written to the old file before still counts
+		err = r.readFrom(r.file, fn)
+		if err != nil {
+			logger.Warning("read rotated access log failed:", err)
+		}
+		r.file.Close()
+		r.file = nil
+		r.setOffset(0)
+		if info != nil {
+			logger.Info("access log got rotated, read it from the start")
+		}
+	}
+	if info == nil {
+		logger.Debug("access log", path, "doesn't exist yet")
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.file = file
+	// the offset saved by an earlier run only belongs to the same file, and that file can't
+	// be smaller than it
+	fileId := sys.GetFileId(info)
+	if fileId != r.fileId || info.Size() < r.offset {
+		r.setOffset(0)
+		r.setFileId(fileId)
+	}
+	return r.readFrom(file, fn)
+}
+
+// readFrom reads the complete lines of file after the offset and moves the offset past them
+func (r *accessLogReader) readFrom(file *os.File, fn func(line string)) error {
+	_, err := file.Seek(r.offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(file, 64*1024)
+	offset := r.offset
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			r.setOffset(offset)
+			return err
+		}
+		offset += int64(len(line))
+		fn(strings.TrimRight(line, "\r\n"))
+	}
+	r.setOffset(offset)
+	return nil
+}
+
+// setOffset moves the offset and saves it, so a restarted panel doesn't count lines twice
+func (r *accessLogReader) setOffset(offset int64) {
+	if offset == r.offset {
+		return
+	}
+	r.offset = offset
+	err := r.settingService.SetAccessLogOffset(offset)
+	if err != nil {
+		logger.Warning("save access log offset failed:", err)
+	}
+}
+
+// setFileId saves the file the offset belongs to
+func (r *accessLogReader) setFileId(fileId string) {
+	if fileId == r.fileId {
+		return
+	}
+	r.fileId = fileId
+	err := r.settingService.SetAccessLogFileId(fileId)
+	if err != nil {
+		logger.Warning("save access log file id failed:", err)
+	}
+}
@@ -0,0 +1,91 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestAccessLogReaderRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		// change runs while the panel is down, after the first reader read the log
+		change func(t *testing.T, path string)
+		want   []string
+	}{
+		{"appended", func(t *testing.T, path string) {
+			appendFile(t, path, "c\n")
+		}, []string{"c"}},
+		{"rotated to a larger file", func(t *testing.T, path string) {
+			rotateFile(t, path, "x\ny\nz\nw\n")
+		}, []string{"x", "y", "z", "w"}},
+		{"rotated to a file of the same size", func(t *testing.T, path string) {
+			rotateFile(t, path, "x\ny\n")
+		}, []string{"x", "y"}},
+		{"truncated", func(t *testing.T, path string) {
+			err := os.WriteFile(path, []byte("x\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"x"}},
+	}
+	db := database.GetDB()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer db.Where("key in ?", []string{"accessLogOffset", "accessLogFileId"}).Delete(model.Setting{})
+			path := filepath.Join(t.TempDir(), "access.log")
+			appendFile(t, path, "a\nb\n")
+
+			first := &accessLogReader{}
+			if got := readLines(t, first, path); !reflect.DeepEqual(got, []string{"a", "b"}) {
+				t.Fatalf("first read = %v", got)
+			}
+			first.file.Close()
+
+			tt.change(t, path)
+			second := &accessLogReader{}
+			defer second.file.Close()
+			if got := readLines(t, second, path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read after restart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func readLines(t *testing.T, r *accessLogReader, path string) []string {
+	t.Helper()
+	lines := make([]string, 0)
+	err := r.readNewLines(path, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func appendFile(t *testing.T, path string, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = file.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rotateFile moves the log away and creates a new one with data, like logrotate does
+func rotateFile(t *testing.T, path string, data string) {
+	t.Helper()
+	err := os.Rename(path, path+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, data)
+}
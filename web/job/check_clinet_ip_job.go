@@ -2,132 +2,302 @@ package job
 
 import (
 	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
+	"net"
 	"regexp"
-	"strconv"
+	"sort"
 	ss "strings"
+	"time"
 	"x-ui/database"
 	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/service"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// isInRestartGrace is a var so tests can simulate a restart of xray
+var isInRestartGrace = (*service.XrayService).IsInRestartGrace
+
 type CheckClientIpJob struct {
-	xrayService    service.XrayService
-	inboundService service.InboundService
-	penalty        int
+	xrayService         service.XrayService
+	inboundService      service.InboundService
+	settingService      service.SettingService
+	notificationService service.NotificationService
+	penalty             int
+	decisionLog         bool
+	// ipLimitAction is what is taken off for a client over its limits, inbound or client
+	ipLimitAction string
+	logReader     accessLogReader
+	// configError is the last reported problem of the xray config, so it is alerted once
+	configError string
 }
 
-var job *CheckClientIpJob
+// ipLimitPrefix defines the granularity used when counting client ips,
+// addresses inside the same prefix are counted as one
+type ipLimitPrefix struct {
+	ipv4 int
+	ipv6 int
+}
+
+// sessionLimit caps connections a client opens within window, unlike limitIp
+// which caps distinct addresses, this also catches many devices behind one ip
+type sessionLimit struct {
+	max    int
+	window time.Duration
+}
 
 func NewCheckClientIpJob(penalty int) *CheckClientIpJob {
-	job = new(CheckClientIpJob)
+	job := new(CheckClientIpJob)
 	job.penalty = penalty * 2
 	return job
 }
 
-func (j *CheckClientIpJob) Run() {
+func (j *CheckClientIpJob) Run() error {
 	logger.Debug("Check Client IP Job...")
-	emails := activateInboundsAfterPenalty(j.penalty)
-	processLogFile(emails)
+	j.decisionLog = j.isDecisionLogOn()
+	var err error
+	j.ipLimitAction, err = j.settingService.GetIpLimitAction()
+	if err != nil {
+		j.ipLimitAction = "inbound"
+	}
+	emails := j.activateInboundsAfterPenalty()
+	for email := range j.activateClientsAfterPenalty() {
+		emails[email] = true
+	}
+	if !j.checkXrayConfig() {
+		return nil
+	}
+	enforce := true
+	if isInRestartGrace(&j.xrayService) {
+		enforce = false
+		logger.Debug("xray restarted recently, skip client ip enforcement")
+	} else if !inSchedule(&j.settingService, j.settingService.GetIpLimitSchedule, timeNow()) {
+		enforce = false
+		logger.Debug("outside of the ip limit schedule, skip client ip enforcement")
+	}
+	return j.processLogFile(emails, j.getIpLimitPrefix(), j.getSessionLimit(), enforce)
 }
 
-func processLogFile(emails map[string]bool) {
+// isDecisionLogOn returns whether the ips of disabled clients are logged, the ips are
+// personal data so they are left out when the setting can't be read
+func (j *CheckClientIpJob) isDecisionLogOn() bool {
+	decisionLog, err := j.settingService.GetIpLimitDecisionLog()
+	if err != nil {
+		logger.Warning("get ip limit decision log setting failed:", err)
+		return false
+	}
+	return decisionLog
+}
+
+// checkXrayConfig alerts once when the xray config can't be used to enforce limits and
+// when it is fixed again, it returns whether the config is usable
+func (j *CheckClientIpJob) checkXrayConfig() bool {
+	accessLogService := service.AccessLogService{}
+	err := accessLogService.CheckXrayConfig()
+	if err == nil {
+		if j.configError != "" {
+			logger.Info("xray config is usable again, client ip limits are enforced")
+			NewStatsNotifyJob().SendAlert("xray 配置已恢复，IP 限制重新生效\r\n")
+			j.configError = ""
+		}
+		return true
+	}
+	if errors.Is(err, service.ErrXrayConfigNotFound) {
+		logger.Debug("xray is not configured yet, skip client ip job")
+		return false
+	}
+	if err.Error() != j.configError {
+		logger.Error("client ip limits are not enforced:", err)
+		NewStatsNotifyJob().SendAlert(fmt.Sprintf("IP 限制未生效: %v\r\n", err))
+		j.configError = err.Error()
+	}
+	return false
+}
+
+func (j *CheckClientIpJob) getSessionLimit() sessionLimit {
+	limit := sessionLimit{window: time.Second * 10}
+	max, err := j.settingService.GetSessionLimit()
+	if err == nil && max > 0 {
+		limit.max = max
+	}
+	window, err := j.settingService.GetSessionWindow()
+	if err == nil && window > 0 {
+		limit.window = time.Second * time.Duration(window)
+	}
+	return limit
+}
+
+func (j *CheckClientIpJob) getIpLimitPrefix() ipLimitPrefix {
+	prefix := ipLimitPrefix{ipv4: 32, ipv6: 128}
+	ipv4, err := j.settingService.GetIpLimitIpv4Prefix()
+	if err == nil && ipv4 > 0 && ipv4 <= 32 {
+		prefix.ipv4 = ipv4
+	}
+	ipv6, err := j.settingService.GetIpLimitIpv6Prefix()
+	if err == nil && ipv6 > 0 && ipv6 <= 128 {
+		prefix.ipv6 = ipv6
+	}
+	return prefix
+}
+
+// maxSessionsInWindow returns the most sessions started within any window
+func maxSessionsInWindow(starts []time.Time, window time.Duration) int {
+	sort.Slice(starts, func(i, j int) bool {
+		return starts[i].Before(starts[j])
+	})
+	max := 0
+	first := 0
+	for last := range starts {
+		for starts[last].Sub(starts[first]) >= window {
+			first++
+		}
+		if last-first+1 > max {
+			max = last - first + 1
+		}
+	}
+	return max
+}
+
+func parseLogTime(line string) (time.Time, bool) {
+	fields := ss.Fields(line)
+	if len(fields) < 2 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006/01/02 15:04:05", fields[0]+" "+fields[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func (j *CheckClientIpJob) processLogFile(emails map[string]bool, prefix ipLimitPrefix, sessions sessionLimit, enforce bool) error {
 	accessLogPath := GetAccessLogPath()
-	if accessLogPath == "" {
-		logger.Warning("xray log not init in config.json")
-		return
+	if accessLogPath == "" || accessLogPath == "none" {
+		logger.Debug("xray access log is off, skip client ip job")
+		return nil
 	}
 
-	data, err := os.ReadFile(accessLogPath)
-	InboundClientIps := make(map[string][]string)
-	checkError(err)
+	// the ips of every client with the unix time they were last seen
+	InboundClientIps := make(map[string]map[string]int64)
+	runTime := time.Now().Unix()
+	clientUserAgents := make(map[string][]string)
+	clientSessions := make(map[string][]time.Time)
 
-	// clean log
-	if err := os.Truncate(GetAccessLogPath(), 0); err != nil {
-		checkError(err)
+	skipList, err := j.settingService.GetIpLimitSkipList()
+	if err != nil {
+		logger.Warning("ip limit skip list is invalid:", err)
 	}
 
-	lines := ss.Split(string(data), "\n")
-	for _, line := range lines {
-		ipRegx, _ := regexp.Compile(`[0-9]+\.[0-9]+\.[0-9]+\.[0-9]+`)
-		emailRegx, _ := regexp.Compile(`email:.+`)
+	accessLogService := service.AccessLogService{}
+	emailRegx := accessLogService.GetEmailRegex()
+	// xray doesn't log client hints by default, cores which do log them put it before the email
+	userAgentRegx, _ := regexp.Compile(`(?i)user-agent:\s*"([^"]*)"`)
 
-		matchesIp := ipRegx.FindString(line)
-		if len(matchesIp) > 0 {
-			ip := string(matchesIp)
-			if ip == "127.0.0.1" || ip == "1.1.1.1" {
-				continue
+	err = j.logReader.readNewLines(accessLogPath, func(line string) {
+		ip := service.ExtractAccessLogIp(line)
+		if len(ip) > 0 {
+			if isSkippedIp(ip, skipList) {
+				return
 			}
 
-			matchesEmail := emailRegx.FindString(line)
+			matchesEmail := service.ExtractAccessLogEmail(line, emailRegx)
 			if matchesEmail == "" {
-				continue
+				return
 			}
-			matchesEmail = ss.TrimSpace(ss.Split(matchesEmail, "email: ")[1])
 			if _, ok := emails[matchesEmail]; !ok {
-				if InboundClientIps[matchesEmail] != nil {
-					if contains(InboundClientIps[matchesEmail], ip) {
-						continue
+				if sessions.max > 0 && ss.Contains(line, " accepted ") {
+					if t, ok := parseLogTime(line); ok {
+						clientSessions[matchesEmail] = append(clientSessions[matchesEmail], t)
 					}
-					InboundClientIps[matchesEmail] = append(InboundClientIps[matchesEmail], ip)
-				} else {
-					InboundClientIps[matchesEmail] = append(InboundClientIps[matchesEmail], ip)
+				}
+				userAgent := userAgentRegx.FindStringSubmatch(line)
+				if len(userAgent) > 1 && userAgent[1] != "" && !contains(clientUserAgents[matchesEmail], userAgent[1]) {
+					clientUserAgents[matchesEmail] = append(clientUserAgents[matchesEmail], userAgent[1])
+				}
+				lastSeen := runTime
+				if t, ok := parseLogTime(line); ok {
+					lastSeen = t.Unix()
+				}
+				if InboundClientIps[matchesEmail] == nil {
+					InboundClientIps[matchesEmail] = make(map[string]int64)
+				}
+				if lastSeen > InboundClientIps[matchesEmail][ip] {
+					InboundClientIps[matchesEmail][ip] = lastSeen
 				}
 			}
 		}
-	}
-	err = ClearInboudClientIps()
+	})
 	if err != nil {
-		return
+		return err
 	}
 
 	var inboundsClientIps []*model.InboundClientIps
 	for clientEmail, ips := range InboundClientIps {
-		inboundClientIps := GetInboundClientIps(clientEmail, ips)
+		inboundClientIps := j.GetInboundClientIps(clientEmail, ips, clientUserAgents[clientEmail], prefix, enforce)
 		if inboundClientIps != nil {
 			inboundsClientIps = append(inboundsClientIps, inboundClientIps)
 		}
 	}
 
 	err = AddInboundsClientIps(inboundsClientIps)
-	checkError(err)
-}
+	if err != nil {
+		return err
+	}
 
-type getEmail struct {
-	Email string `json:"email"`
+	if !enforce {
+		return nil
+	}
+	for clientEmail, starts := range clientSessions {
+		j.checkClientSessions(clientEmail, starts, sessions)
+	}
+	return nil
 }
 
-type justToGetEmail struct {
-	Clients []getEmail `json:"clients"`
+func (j *CheckClientIpJob) checkClientSessions(clientEmail string, starts []time.Time, sessions sessionLimit) {
+	count := maxSessionsInWindow(starts, sessions.window)
+	if count <= sessions.max {
+		return
+	}
+	inbound, err := GetInboundByEmail(clientEmail)
+	if err != nil {
+		checkError(err)
+		return
+	}
+	if inbound == nil || !inbound.Enable {
+		return
+	}
+	logger.Warningf("client %v opened %v sessions within %v, session limit is %v", clientEmail, count, sessions.window, sessions.max)
+	j.punish(inbound, clientEmail)
 }
 
 // Returns emails of inactive accounts
-func activateInboundsAfterPenalty(penalty int) map[string]bool {
+func (j *CheckClientIpJob) activateInboundsAfterPenalty() map[string]bool {
 	inbounds := GetInactivePenaltyInbounds()
 	activated := map[int]bool{}
 	for i := 0; i < len(inbounds); i++ {
 		element := inbounds[i]
-		if element.Penalty < penalty {
+		if element.Penalty < j.penalty {
 			updateInboudPenaltyBy1(element.Id, element.Penalty)
 		} else {
 			activated[i] = true
-			activateInboundAfterFullPenalty(element.Id)
+			j.activateInboundAfterFullPenalty(element.Id)
 		}
 	}
 
 	output := map[string]bool{}
 	for i := 0; i < len(inbounds); i++ {
 		if ok := activated[i]; !ok {
-			toGetEmail := &justToGetEmail{}
-			json.Unmarshal([]byte(inbounds[i].Settings), toGetEmail)
-			if len(toGetEmail.Clients) != 0 {
-				email := toGetEmail.Clients[0].Email
-				output[email] = true
-			} else {
-				continue
+			// every client of the inbound is disabled with it, not only the one over its limit
+			clients, err := inbounds[i].GetClients()
+			if err != nil {
+				logger.Warning("couldn't get clients of inbound with id: ", inbounds[i].Id, err)
+			}
+			for _, client := range clients {
+				output[client.Email] = true
 			}
 		}
 	}
@@ -135,6 +305,79 @@ func activateInboundsAfterPenalty(penalty int) map[string]bool {
 	return output
 }
 
+// punish takes the client over its limits off, with the client action only the client itself
+// so others on a shared inbound keep working
+func (j *CheckClientIpJob) punish(inbound *model.Inbound, clientEmail string) {
+	if j.ipLimitAction == "client" {
+		err := j.PenalizeClient(inbound, clientEmail)
+		if err == nil {
+			return
+		}
+		logger.Warning("couldn't penalize client", clientEmail, "alone, disable its inbound:", err)
+	}
+	j.DisableInbound(inbound.Id, clientEmail)
+}
+
+// PenalizeClient removes the client from its inbound until its penalty is over
+func (j *CheckClientIpJob) PenalizeClient(inbound *model.Inbound, clientEmail string) error {
+	added, err := j.inboundService.AddClientPenalty(inbound.Id, clientEmail)
+	if err != nil || !added {
+		return err
+	}
+	logger.Warningf("remove client %v from inbound with id: %v", clientEmail, inbound.Id)
+	err = j.xrayService.RemoveClient(inbound, clientEmail)
+	if err != nil {
+		// a restarted xray leaves the client out
+		logger.Warning("remove client from running xray failed, restart xray:", err)
+		j.xrayService.SetToNeedRestart()
+	}
+	return nil
+}
+
+// activateClientsAfterPenalty returns the emails of clients still serving a penalty
+func (j *CheckClientIpJob) activateClientsAfterPenalty() map[string]bool {
+	output := map[string]bool{}
+	penalties, err := j.inboundService.GetClientPenalties()
+	if err != nil {
+		logger.Error("couldn't find penalized clients: ", err)
+		return output
+	}
+	for _, penalty := range penalties {
+		if penalty.Penalty < j.penalty {
+			err = j.inboundService.SetClientPenalty(penalty.Id, penalty.Penalty+1)
+			if err != nil {
+				logger.Error("couldn't update client penalty: ", err)
+			}
+			output[penalty.Email] = true
+			continue
+		}
+		j.activateClientAfterFullPenalty(penalty)
+	}
+	return output
+}
+
+func (j *CheckClientIpJob) activateClientAfterFullPenalty(penalty *model.ClientPenalty) {
+	err := j.inboundService.DelClientPenalty(penalty.Id)
+	if err != nil {
+		logger.Error("couldn't delete client penalty: ", err)
+		return
+	}
+	inbound, err := j.inboundService.GetInbound(penalty.InboundId)
+	if err != nil || !inbound.Enable {
+		return
+	}
+	client, err := inbound.GetClient(penalty.Email)
+	if err != nil || client == nil {
+		return
+	}
+	err = j.xrayService.AddClient(inbound, client)
+	if err != nil {
+		logger.Warning("add client to running xray failed, restart xray:", err)
+		j.xrayService.SetToNeedRestart()
+	}
+	logger.Warningf("add client %v back to inbound with id: %v after finished penalty", penalty.Email, inbound.Id)
+}
+
 func updateInboudPenaltyBy1(id int, currentPenalty int) {
 	db := database.GetDB()
 	err := db.Model(model.Inbound{}).
@@ -145,43 +388,36 @@ func updateInboudPenaltyBy1(id int, currentPenalty int) {
 	}
 }
 
-func activateInboundAfterFullPenalty(id int) {
+func (j *CheckClientIpJob) activateInboundAfterFullPenalty(id int) {
 	db := database.GetDB()
-	var inbound *model.Inbound
+	inbound := &model.Inbound{}
 	err := db.Model(model.Inbound{}).
-		Where("id = ? and enable = ?", id, false).Find(&inbound).Error
+		Where("id = ? and enable = ?", id, false).First(inbound).Error
 	if err != nil {
 		logger.Error("couldn't find inbound with id: ", id)
 		return
-	} else {
-		job.xrayService.SetToNeedRestart()
 	}
 
-	inbound.Enable = true
 	inbound.Penalty = -1
-	db.Save(&inbound)
+	reason := inbound.GetDisableReason(time.Now().Unix() * 1000)
+	if reason != "" {
+		// the penalty is over, but the inbound stays disabled for its own reason
+		db.Save(inbound)
+		logger.Warningf("penalty finished for inbound with id: %v, but it stays disabled: %v", id, reason)
+		return
+	}
+	inbound.Enable = true
+	db.Save(inbound)
+	j.xrayService.SetToNeedRestart()
 
 	logger.Warning("enable inbound after finished penalty with id: ", id)
 }
 
 func GetAccessLogPath() string {
-	config, err := os.ReadFile("bin/config.json")
+	accessLogService := service.AccessLogService{}
+	accessLogPath, err := accessLogService.GetAccessLogPath()
 	checkError(err)
-
-	jsonConfig := map[string]interface{}{}
-	err = json.Unmarshal([]byte(config), &jsonConfig)
-	checkError(err)
-	if jsonConfig["log"] != nil {
-		jsonLog := jsonConfig["log"].(map[string]interface{})
-		if jsonLog["access"] != nil {
-
-			accessLogPath := jsonLog["access"].(string)
-
-			return accessLogPath
-		}
-	}
-	return ""
-
+	return accessLogPath
 }
 
 func checkError(e error) {
@@ -199,46 +435,121 @@ func contains(s []string, str string) bool {
 	return false
 }
 
-func ClearInboudClientIps() error {
-	db := database.GetDB()
-	err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&model.InboundClientIps{}).Error
-	checkError(err)
-	return err
+// isSkippedIp reports whether the ip must not be counted, loopback ips are always skipped
+func isSkippedIp(ip string, skipList []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsLoopback() || common.NetworksContain(skipList, parsed)
 }
 
-func GetInboundClientIps(clientEmail string, ips []string) *model.InboundClientIps {
-	jsonIps, err := json.Marshal(ips)
+// countDistinctSubnets returns the number of distinct networks the ips belong to
+func countDistinctSubnets(ips []string, prefix ipLimitPrefix) int {
+	subnets := map[string]bool{}
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			subnets[ip] = true
+			continue
+		}
+		var mask net.IPMask
+		if ipv4 := parsed.To4(); ipv4 != nil {
+			parsed = ipv4
+			mask = net.CIDRMask(prefix.ipv4, 32)
+		} else {
+			mask = net.CIDRMask(prefix.ipv6, 128)
+		}
+		subnets[parsed.Mask(mask).String()] = true
+	}
+	return len(subnets)
+}
+
+// mergeClientIps adds the stored ips of the client which were seen after since to ips
+func mergeClientIps(clientEmail string, ips map[string]int64, since int64) map[string]int64 {
+	merged := make(map[string]int64, len(ips))
+	for ip, lastSeen := range ips {
+		merged[ip] = lastSeen
+	}
+	stored := &model.InboundClientIps{}
+	err := database.GetDB().Where("client_email = ?", clientEmail).First(stored).Error
 	if err != nil {
-		return nil
+		return merged
+	}
+	storedIps, err := stored.GetIps()
+	if err != nil {
+		logger.Warning("stored ips of", clientEmail, "are invalid:", err)
+		return merged
+	}
+	for ip, lastSeen := range storedIps {
+		if lastSeen >= since && lastSeen > merged[ip] {
+			merged[ip] = lastSeen
+		}
+	}
+	return merged
+}
+
+func (j *CheckClientIpJob) GetInboundClientIps(clientEmail string, seenIps map[string]int64, userAgents []string, prefix ipLimitPrefix, enforce bool) *model.InboundClientIps {
+	// only the ips of this run count against the limit, the stored ones are kept for the panel
+	ips := make([]string, 0, len(seenIps))
+	for ip := range seenIps {
+		ips = append(ips, ip)
 	}
 
+	since := int64(0)
+	if retention, err := j.settingService.GetClientIpsRetention(); err == nil && retention > 0 {
+		since = time.Now().Add(-retention).Unix()
+	}
 	inboundClientIps := &model.InboundClientIps{}
 	inboundClientIps.ClientEmail = clientEmail
-	inboundClientIps.Ips = string(jsonIps)
+	err := inboundClientIps.SetIps(mergeClientIps(clientEmail, seenIps, since))
+	if err != nil {
+		return nil
+	}
+	if len(userAgents) > 0 {
+		jsonUserAgents, err := json.Marshal(userAgents)
+		if err == nil {
+			inboundClientIps.UserAgents = string(jsonUserAgents)
+		}
+	}
 
 	inbound, err := GetInboundByEmail(clientEmail)
 	if err != nil {
+		checkError(err)
 		return nil
 	}
-	limitIpRegx, _ := regexp.Compile(`"limitIp": .+`)
-	limitIpMactch := limitIpRegx.FindString(inbound.Settings)
-	limitIpMactchs := ss.Split(limitIpMactch, `"limitIp": `)
-	if len(limitIpMactchs) > 1 {
-		limitIpMactch = limitIpMactchs[1]
-	} else {
-		limitIpMactch = "0"
+	if inbound == nil {
+		return inboundClientIps
 	}
-	limitIp, err := strconv.Atoi(limitIpMactch)
+	client, err := inbound.GetClient(clientEmail)
 	if err != nil {
 		return nil
 	}
-	if limitIp < len(ips) && limitIp != 0 && inbound.Enable {
-		DisableInbound(inbound.Id)
+	limitIp := 0
+	if client != nil {
+		limitIp = client.LimitIP
+	}
+	subnets := countDistinctSubnets(ips, prefix)
+	if enforce && limitIp < subnets && limitIp != 0 && inbound.Enable {
+		logger.Warning(formatIpLimitDecision(clientEmail, inbound.Id, limitIp, subnets, ips, j.decisionLog))
+		j.punish(inbound, clientEmail)
 	}
 
 	return inboundClientIps
 }
 
+// formatIpLimitDecision describes why the client got disabled, the ips are left out unless withIps is set
+func formatIpLimitDecision(clientEmail string, inboundId int, limitIp int, subnets int, ips []string, withIps bool) string {
+	decision := fmt.Sprintf("ip limit exceeded: email=%q inbound=%v limitIp=%v distinct=%v ipCount=%v",
+		clientEmail, inboundId, limitIp, subnets, len(ips))
+	if withIps {
+		sorted := append([]string(nil), ips...)
+		sort.Strings(sorted)
+		decision += fmt.Sprintf(" ips=[%v]", ss.Join(sorted, ","))
+	}
+	return decision
+}
+
 func AddInboundsClientIps(inboundsClientIps []*model.InboundClientIps) error {
 	if len(inboundsClientIps) == 0 {
 		return nil
@@ -246,7 +557,11 @@ func AddInboundsClientIps(inboundsClientIps []*model.InboundClientIps) error {
 	db := database.GetDB()
 	tx := db.Begin()
 
-	err := tx.Save(inboundsClientIps).Error
+	// clients not in this run keep their row until CleanupClientIpsJob removes it
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ips", "user_agents", "last_seen"}),
+	}).Create(inboundsClientIps).Error
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -255,35 +570,55 @@ func AddInboundsClientIps(inboundsClientIps []*model.InboundClientIps) error {
 	return nil
 }
 
+// GetInboundByEmail returns the inbound with a client of exactly this email, nil if there is none.
+// The LIKE query only narrows down the candidates, an email like bob also matches bobby there
 func GetInboundByEmail(clientEmail string) (*model.Inbound, error) {
 	db := database.GetDB()
-	var inbounds *model.Inbound
-	err := db.Model(model.Inbound{}).Where("settings LIKE ?", "%"+clientEmail+"%").Find(&inbounds).Error
+	var candidates []*model.Inbound
+	err := db.Model(model.Inbound{}).Where("settings LIKE ?", "%"+clientEmail+"%").Find(&candidates).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, err
 	}
-	return inbounds, nil
+	var found *model.Inbound
+	for _, inbound := range candidates {
+		client, err := inbound.GetClient(clientEmail)
+		if err != nil || client == nil {
+			continue
+		}
+		if found != nil {
+			return nil, common.NewErrorf("client email %v is used by inbound %v and %v", clientEmail, found.Id, inbound.Id)
+		}
+		found = inbound
+	}
+	return found, nil
 }
 
-func DisableInbound(id int) error {
+// DisableInbound disables the inbound of the client which went over its limit, the inbound
+// may already be disabled when several of its clients go over their limit in the same run
+func (j *CheckClientIpJob) DisableInbound(id int, clientEmail string) error {
 	db := database.GetDB()
-	var inbound *model.Inbound
+	inbound := &model.Inbound{}
 	err := db.Model(model.Inbound{}).
-		Where("id = ? and enable = ?", id, true).Find(&inbound).Error
-	if err != nil {
+		Where("id = ? and enable = ?", id, true).First(inbound).Error
+	if database.IsNotFound(err) {
+		return nil
+	} else if err != nil {
 		logger.Error("couldn't find inbound with id: ", id)
+		return err
 	}
 
 	inbound.Enable = false
 	inbound.Penalty = 0
-	db.Save(&inbound)
-	logger.Warning("disable inbound with id:", id)
-
-	if err == nil {
-		job.xrayService.SetToNeedRestart()
+	err = db.Save(inbound).Error
+	if err != nil {
+		return err
 	}
-
-	return err
+	logger.Warningf("disable inbound with id: %v because of client: %v", id, clientEmail)
+	j.xrayService.SetToNeedRestart()
+	event := service.NewInboundEvent(inbound, "ip_limit")
+	event.ClientEmail = clientEmail
+	j.notificationService.Notify(service.EventInboundDisabled, event)
+	return nil
 }
 
 func GetInactivePenaltyInbounds() []*model.Inbound {
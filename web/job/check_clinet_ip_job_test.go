@@ -0,0 +1,856 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+
+	"github.com/op/go-logging"
+)
+
+func TestCountDistinctSubnets(t *testing.T) {
+	exact := ipLimitPrefix{ipv4: 32, ipv6: 128}
+	subnet := ipLimitPrefix{ipv4: 24, ipv6: 64}
+	tests := []struct {
+		name   string
+		ips    []string
+		prefix ipLimitPrefix
+		want   int
+	}{
+		{"ipv4 exact", []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"}, exact, 3},
+		{"ipv4 one prefix", []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"}, subnet, 1},
+		{"ipv4 two prefixes", []string{"203.0.113.1", "203.0.113.2", "198.51.100.7"}, subnet, 2},
+		{"ipv6 exact", []string{"2001:db8::1", "2001:db8::2", "2001:db8::ffff"}, exact, 3},
+		{"ipv6 one prefix", []string{"2001:db8::1", "2001:db8::2", "2001:db8::ffff"}, subnet, 1},
+		{"ipv6 two prefixes", []string{"2001:db8::1", "2001:db8:0:1::1"}, subnet, 2},
+		{"mapped ipv4 uses the ipv4 prefix", []string{"::ffff:203.0.113.1", "203.0.113.9"}, subnet, 1},
+		{"mixed families", []string{"203.0.113.1", "2001:db8::1"}, subnet, 2},
+		{"unparsable ips count by themselves", []string{"unknown", "unknown", "other"}, subnet, 2},
+		{"no ips", nil, subnet, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := countDistinctSubnets(tt.ips, tt.prefix)
+			if got != tt.want {
+				t.Errorf("countDistinctSubnets(%v) = %v, want %v", tt.ips, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsSkippedIp(t *testing.T) {
+	defaultList, err := common.ParseNetworks("1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	customList, err := common.ParseNetworks("203.0.113.7,192.168.0.0/16,2001:db8::1,2001:db8:1::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		ip       string
+		skipList []*net.IPNet
+		want     bool
+	}{
+		{"ipv4 loopback without a list", "127.0.0.1", nil, true},
+		{"ipv6 loopback without a list", "::1", nil, true},
+		{"public ip without a list", "1.1.1.1", nil, false},
+		{"default list", "1.1.1.1", defaultList, true},
+		{"default list other ip", "1.0.0.1", defaultList, false},
+		{"single ipv4", "203.0.113.7", customList, true},
+		{"next to single ipv4", "203.0.113.8", customList, false},
+		{"ipv4 cidr", "192.168.44.1", customList, true},
+		{"outside ipv4 cidr", "192.169.0.1", customList, false},
+		{"single ipv6", "2001:db8::1", customList, true},
+		{"next to single ipv6", "2001:db8::2", customList, false},
+		{"ipv6 cidr", "2001:db8:1:ff::1", customList, true},
+		{"outside ipv6 cidr", "2001:db8:2::1", customList, false},
+		{"loopback with a list", "127.0.0.2", customList, true},
+		{"unparsable", "unknown", customList, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSkippedIp(tt.ip, tt.skipList); got != tt.want {
+				t.Errorf("isSkippedIp(%v) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIpJobsAreIndependent(t *testing.T) {
+	db := database.GetDB()
+	xrayService := service.XrayService{}
+	xrayService.IsNeedRestartAndSetFalse()
+	short := NewCheckClientIpJob(1)
+	long := NewCheckClientIpJob(3)
+
+	tests := []struct {
+		name        string
+		job         *CheckClientIpJob
+		penalty     int
+		wantEnable  bool
+		wantPenalty int
+	}{
+		{"short penalty is over", short, 2, true, -1},
+		{"long penalty goes on", long, 2, false, 3},
+		{"long penalty is over", long, 6, true, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound := &model.Inbound{Port: 40003, Protocol: model.VMess, Tag: "inbound-40003", Penalty: tt.penalty}
+			err := db.Create(inbound).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Delete(inbound)
+
+			tt.job.activateInboundsAfterPenalty()
+			err = db.First(inbound, inbound.Id).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inbound.Enable != tt.wantEnable || inbound.Penalty != tt.wantPenalty {
+				t.Errorf("inbound enable = %v penalty = %v, want %v %v", inbound.Enable, inbound.Penalty, tt.wantEnable, tt.wantPenalty)
+			}
+			// only the job which enabled the inbound asks for the restart
+			if restart := xrayService.IsNeedRestartAndSetFalse(); restart != tt.wantEnable {
+				t.Errorf("need restart = %v, want %v", restart, tt.wantEnable)
+			}
+
+			err = tt.job.DisableInbound(inbound.Id, "client")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restart := xrayService.IsNeedRestartAndSetFalse(); restart != tt.wantEnable {
+				t.Errorf("need restart after disabling = %v, want %v", restart, tt.wantEnable)
+			}
+		})
+	}
+}
+
+func TestGetInboundByEmail(t *testing.T) {
+	db := database.GetDB()
+	newInbound := func(port int, emails ...string) *model.Inbound {
+		clients := make([]model.Client, 0, len(emails))
+		for _, email := range emails {
+			clients = append(clients, model.Client{Email: email})
+		}
+		inbound := &model.Inbound{Port: port, Protocol: model.VLESS, Tag: "inbound-" + strconv.Itoa(port), Enable: true}
+		err := inbound.SetClients(clients)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Create(inbound).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Delete(inbound) })
+		return inbound
+	}
+	bobby := newInbound(40010, "bobby", "bob2@x")
+	bob := newInbound(40011, "bob", "alice")
+	newInbound(40012, "carol")
+	newInbound(40013, "carol")
+
+	tests := []struct {
+		email   string
+		want    *model.Inbound
+		wantErr bool
+	}{
+		{"bob", bob, false},
+		{"bobby", bobby, false},
+		{"bob2@x", bobby, false},
+		{"alice", bob, false},
+		{"bo", nil, false},
+		{"bob2", nil, false},
+		{"dave", nil, false},
+		{"carol", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			got, err := GetInboundByEmail(tt.email)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetInboundByEmail(%q) error = %v, wantErr %v", tt.email, err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && got.Id != tt.want.Id) {
+				t.Errorf("GetInboundByEmail(%q) = %+v, want %+v", tt.email, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatIpLimitDecision(t *testing.T) {
+	ips := []string{"198.51.100.7", "2001:db8::1", "192.0.2.10"}
+	decision := formatIpLimitDecision("alice", 7, 2, 3, ips, true)
+	for _, want := range []string{`email="alice"`, "inbound=7", "limitIp=2", "distinct=3", "ipCount=3",
+		"ips=[192.0.2.10,198.51.100.7,2001:db8::1]"} {
+		if !strings.Contains(decision, want) {
+			t.Errorf("decision %q doesn't contain %q", decision, want)
+		}
+	}
+	// the ips are only logged when the decision log is on
+	decision = formatIpLimitDecision("alice", 7, 2, 3, ips, false)
+	if strings.Contains(decision, "ips=") || !strings.Contains(decision, "limitIp=2") {
+		t.Errorf("decision without ips = %q", decision)
+	}
+}
+
+func TestIsDecisionLogOn(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{"true", true},
+		{"false", false},
+		// an unreadable setting doesn't log the ips
+		{"maybe", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if tt.value != "" {
+				setJobSettings(t, map[string]string{"ipLimitDecisionLog": tt.value})
+			}
+			j := NewCheckClientIpJob(1)
+			if got := j.isDecisionLogOn(); got != tt.want {
+				t.Errorf("isDecisionLogOn() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// useAccessLog runs the test in a dir whose bin/config.json points xray's access log at a file with lines
+func useAccessLog(t *testing.T, lines []string) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := database.GetDB()
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		db.Where("key in ?", []string{"accessLogOffset", "accessLogFileId"}).Delete(model.Setting{})
+		db.Where("1 = 1").Delete(model.InboundClientIps{})
+	})
+
+	logPath := filepath.Join(dir, "access.log")
+	err = os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(map[string]interface{}{"log": map[string]string{"access": logPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll("bin", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join("bin", "config.json"), config, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// processAccessLog runs the job over the access log without enforcing limits and returns the stored ips of the clients
+func processAccessLog(t *testing.T) map[string]*model.InboundClientIps {
+	t.Helper()
+	j := NewCheckClientIpJob(1)
+	defer func() {
+		if j.logReader.file != nil {
+			j.logReader.file.Close()
+		}
+	}()
+	err := j.processLogFile(map[string]bool{}, ipLimitPrefix{}, sessionLimit{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientIps := make([]*model.InboundClientIps, 0)
+	err = database.GetDB().Find(&clientIps).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := make(map[string]*model.InboundClientIps)
+	for _, ips := range clientIps {
+		stored[ips.ClientEmail] = ips
+	}
+	return stored
+}
+
+func TestProcessLogFileUserAgents(t *testing.T) {
+	useAccessLog(t, []string{
+		`2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] user-agent: "v2rayNG/1.8.5" email: alice`,
+		`2024/01/02 10:00:01 1.2.3.4:5001 accepted tcp:example.com:443 [inbound-1 >> direct] User-Agent: "Shadowrocket/1900" email: alice`,
+		`2024/01/02 10:00:02 5.6.7.8:5002 accepted tcp:example.com:443 [inbound-1 >> direct] user-agent: "v2rayNG/1.8.5" email: alice`,
+		`2024/01/02 10:00:03 5.6.7.8:5003 accepted tcp:example.com:443 [inbound-1 >> direct] user-agent: "" email: alice`,
+		`2024/01/02 10:00:04 9.9.9.9:5004 accepted tcp:example.com:443 [inbound-1 >> direct] email: bob`,
+	})
+	stored := processAccessLog(t)
+
+	tests := []struct {
+		email          string
+		wantUserAgents []string
+	}{
+		{"alice", []string{"v2rayNG/1.8.5", "Shadowrocket/1900"}},
+		// xray doesn't log client hints by default, the ip is stored without them
+		{"bob", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			ips, ok := stored[tt.email]
+			if !ok {
+				t.Fatalf("no ips are stored for %v", tt.email)
+			}
+			if ips.Ips == "" {
+				t.Errorf("the ips of %v are empty", tt.email)
+			}
+			if tt.wantUserAgents == nil {
+				if ips.UserAgents != "" {
+					t.Errorf("user agents of %v = %q, want empty", tt.email, ips.UserAgents)
+				}
+				return
+			}
+			userAgents := make([]string, 0)
+			err := json.Unmarshal([]byte(ips.UserAgents), &userAgents)
+			if err != nil {
+				t.Fatalf("user agents of %v are %q: %v", tt.email, ips.UserAgents, err)
+			}
+			if !reflect.DeepEqual(userAgents, tt.wantUserAgents) {
+				t.Errorf("user agents of %v = %v, want %v", tt.email, userAgents, tt.wantUserAgents)
+			}
+		})
+	}
+}
+
+func TestProcessLogFileMixedFamilies(t *testing.T) {
+	useAccessLog(t, []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:01 [2001:db8::1]:5001 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		// the mapped form of an ipv4 client and the long form of an ipv6 client are the same clients
+		"2024/01/02 10:00:02 [::ffff:1.2.3.4]:5002 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:03 tcp:[2001:DB8:0:0::1]:5003 accepted udp:8.8.8.8:53 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:04 [::1]:5004 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:05 127.0.0.1:5005 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:06 1.1.1.1:5006 accepted tcp:example.com:443 [inbound-1 >> direct] email: mixed",
+		"2024/01/02 10:00:07 [2001:db8::2]:5007 accepted tcp:[2001:db8::53]:443 [inbound-1 >> direct] email: ipv6-only",
+	})
+	stored := processAccessLog(t)
+
+	tests := []struct {
+		email   string
+		wantIps []string
+	}{
+		{"mixed", []string{"1.2.3.4", "2001:db8::1"}},
+		{"ipv6-only", []string{"2001:db8::2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			clientIps, ok := stored[tt.email]
+			if !ok {
+				t.Fatalf("no ips are stored for %v", tt.email)
+			}
+			ips, err := clientIps.GetIps()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0)
+			for ip := range ips {
+				got = append(got, ip)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantIps) {
+				t.Errorf("ips of %v = %v, want %v", tt.email, got, tt.wantIps)
+			}
+		})
+	}
+}
+
+func TestProcessLogFileLastSeen(t *testing.T) {
+	setJobSettings(t, map[string]string{"clientIpsRetention": "0"})
+	useAccessLog(t, []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email: seen",
+		"2024/01/02 10:00:05 1.2.3.4:5001 accepted tcp:example.com:443 [inbound-1 >> direct] email: seen",
+		"2024/01/02 10:00:03 1.2.3.4:5002 accepted tcp:example.com:443 [inbound-1 >> direct] email: seen",
+		// a line without a time is seen when the job runs
+		"5.6.7.8:5003 accepted tcp:example.com:443 [inbound-1 >> direct] email: seen",
+	})
+	// a row written before the times were kept holds a plain array
+	err := database.GetDB().Create(&model.InboundClientIps{
+		ClientEmail: "seen",
+		Ips:         `["9.9.9.8","1.2.3.4"]`,
+		LastSeen:    1700000000,
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Unix()
+	stored := processAccessLog(t)
+	after := time.Now().Unix()
+
+	clientIps, ok := stored["seen"]
+	if !ok {
+		t.Fatal("no ips are stored")
+	}
+	ips := make(map[string]int64)
+	err = json.Unmarshal([]byte(clientIps.Ips), &ips)
+	if err != nil {
+		t.Fatalf("the ips are not stored as a map: %q", clientIps.Ips)
+	}
+	if len(ips) != 3 {
+		t.Errorf("ips = %v, want 3 of them", ips)
+	}
+	if want := time.Date(2024, 1, 2, 10, 0, 5, 0, time.Local).Unix(); ips["1.2.3.4"] != want {
+		t.Errorf("1.2.3.4 last seen = %v, want the latest line %v", ips["1.2.3.4"], want)
+	}
+	if ips["9.9.9.8"] != 1700000000 {
+		t.Errorf("9.9.9.8 last seen = %v, want the time of the old row %v", ips["9.9.9.8"], 1700000000)
+	}
+	if lastSeen := ips["5.6.7.8"]; lastSeen < before || lastSeen > after {
+		t.Errorf("5.6.7.8 last seen = %v, want the run time", lastSeen)
+	}
+	if clientIps.LastSeen != ips["5.6.7.8"] {
+		t.Errorf("LastSeen = %v, want the latest ip %v", clientIps.LastSeen, ips["5.6.7.8"])
+	}
+}
+
+func TestClientIpJobQuietUntilLogging(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	configPath := filepath.Join("bin", "config.json")
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T)
+	}{
+		{"no xray config", func(t *testing.T) {
+			os.Remove(configPath)
+		}},
+		{"access log off", func(t *testing.T) {
+			err := os.WriteFile(configPath, []byte(`{"log": {}}`), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"access log none", func(t *testing.T) {
+			err := os.WriteFile(configPath, []byte(`{"log": {"access": "none"}}`), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"no access log yet", func(t *testing.T) {
+			os.Remove("access.log")
+		}},
+		{"empty access log", func(t *testing.T) {
+			err := os.WriteFile("access.log", nil, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccessLog(t, nil)
+			tt.setup(t)
+			logs.Reset()
+			j := NewCheckClientIpJob(1)
+			// the job runs every few seconds, none of the runs may complain
+			for i := 0; i < 2; i++ {
+				err := j.Run()
+				if err != nil {
+					t.Fatalf("Run() = %v", err)
+				}
+			}
+			if j.logReader.file != nil {
+				j.logReader.file.Close()
+			}
+			if got := logs.String(); got != "" {
+				t.Errorf("Run() logged %q, want nothing", got)
+			}
+			var count int64
+			database.GetDB().Model(model.InboundClientIps{}).Count(&count)
+			if count != 0 {
+				t.Errorf("Run() stored the ips of %v clients, want none", count)
+			}
+		})
+	}
+}
+
+func TestMaxSessionsInWindow(t *testing.T) {
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	at := func(seconds ...int) []time.Time {
+		starts := make([]time.Time, 0, len(seconds))
+		for _, s := range seconds {
+			starts = append(starts, start.Add(time.Second*time.Duration(s)))
+		}
+		return starts
+	}
+	tests := []struct {
+		name   string
+		starts []time.Time
+		want   int
+	}{
+		{"none", nil, 0},
+		{"one", at(0), 1},
+		{"all in the window", at(0, 1, 2, 9), 4},
+		{"spread out", at(0, 10, 20, 30), 1},
+		{"unsorted", at(30, 0, 31, 1, 32, 33), 4},
+		{"window end is exclusive", at(0, 5, 10), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxSessionsInWindow(tt.starts, time.Second*10); got != tt.want {
+				t.Errorf("maxSessionsInWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	db := database.GetDB()
+	newInbound := func(port int, email string) *model.Inbound {
+		inbound := &model.Inbound{Port: port, Protocol: model.VLESS, Tag: "inbound-" + strconv.Itoa(port), Enable: true}
+		err := inbound.SetClients([]model.Client{{Email: email}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Create(inbound).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Delete(inbound) })
+		return inbound
+	}
+	// the session limit counts connections, all of greedy's come from the one ip
+	greedy := newInbound(40020, "greedy")
+	calm := newInbound(40021, "calm")
+	useAccessLog(t, []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-40020 >> direct] email: greedy",
+		"2024/01/02 10:00:01 1.2.3.4:5001 accepted tcp:example.com:443 [inbound-40020 >> direct] email: greedy",
+		"2024/01/02 10:00:02 1.2.3.4:5002 accepted tcp:example.com:443 [inbound-40020 >> direct] email: greedy",
+		"2024/01/02 10:00:03 1.2.3.4:5003 accepted tcp:example.com:443 [inbound-40020 >> direct] email: greedy",
+		"2024/01/02 10:00:00 5.6.7.8:5000 accepted tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+		"2024/01/02 10:00:01 5.6.7.8:5001 accepted tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+		"2024/01/02 10:00:30 5.6.7.8:5002 accepted tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+		"2024/01/02 10:01:00 5.6.7.8:5003 accepted tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+		"2024/01/02 10:01:01 5.6.7.8:5004 rejected tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+		"2024/01/02 10:01:02 5.6.7.8:5005 rejected tcp:example.com:443 [inbound-40021 >> direct] email: calm",
+	})
+	xrayService := service.XrayService{}
+	xrayService.IsNeedRestartAndSetFalse()
+
+	j := NewCheckClientIpJob(1)
+	defer func() {
+		if j.logReader.file != nil {
+			j.logReader.file.Close()
+		}
+	}()
+	err := j.processLogFile(map[string]bool{}, ipLimitPrefix{ipv4: 32, ipv6: 128}, sessionLimit{max: 2, window: time.Second * 10}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		inbound    *model.Inbound
+		wantEnable bool
+	}{
+		{greedy, false},
+		{calm, true},
+	} {
+		stored := &model.Inbound{}
+		err := db.First(stored, tt.inbound.Id).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Enable != tt.wantEnable {
+			t.Errorf("inbound %v enable = %v, want %v", stored.Tag, stored.Enable, tt.wantEnable)
+		}
+	}
+	if !xrayService.IsNeedRestartAndSetFalse() {
+		t.Error("disabling the inbound didn't ask for a restart")
+	}
+}
+
+func TestRestartGraceSkipsEnforcement(t *testing.T) {
+	db := database.GetDB()
+	setJobSettings(t, map[string]string{"sessionLimit": "2", "sessionWindow": "10"})
+	lines := []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-40030 >> direct] email: grace",
+		"2024/01/02 10:00:01 1.2.3.4:5001 accepted tcp:example.com:443 [inbound-40030 >> direct] email: grace",
+		"2024/01/02 10:00:02 1.2.3.4:5002 accepted tcp:example.com:443 [inbound-40030 >> direct] email: grace",
+	}
+	tests := []struct {
+		name       string
+		inGrace    bool
+		wantEnable bool
+	}{
+		{"within the grace window", true, true},
+		{"after the grace window", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isInRestartGrace = func(*service.XrayService) bool { return tt.inGrace }
+			defer func() { isInRestartGrace = (*service.XrayService).IsInRestartGrace }()
+			inbound := &model.Inbound{Port: 40030, Protocol: model.VLESS, Tag: "inbound-40030", Enable: true}
+			err := inbound.SetClients([]model.Client{{Email: "grace"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.Create(inbound).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Delete(inbound)
+			useAccessLog(t, lines)
+
+			j := NewCheckClientIpJob(1)
+			err = j.Run()
+			if j.logReader.file != nil {
+				j.logReader.file.Close()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.First(inbound, inbound.Id).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inbound.Enable != tt.wantEnable {
+				t.Errorf("inbound enable = %v, want %v", inbound.Enable, tt.wantEnable)
+			}
+			// the ips are recorded either way, only acting on them waits
+			var recorded int64
+			db.Model(model.InboundClientIps{}).Where("client_email = ?", "grace").Count(&recorded)
+			if recorded != 1 {
+				t.Error("the ips of the client weren't recorded")
+			}
+		})
+	}
+}
+
+func TestActivateInboundAfterFullPenalty(t *testing.T) {
+	db := database.GetDB()
+	xrayService := service.XrayService{}
+	xrayService.IsNeedRestartAndSetFalse()
+	now := time.Now().Unix() * 1000
+	j := NewCheckClientIpJob(1)
+
+	tests := []struct {
+		name       string
+		inbound    model.Inbound
+		wantEnable bool
+	}{
+		{"still valid", model.Inbound{ExpiryTime: now + 3600000, Total: 1000, Up: 100, Down: 100}, true},
+		{"no expiry or quota", model.Inbound{}, true},
+		{"expired", model.Inbound{ExpiryTime: now - 1000}, false},
+		{"over quota", model.Inbound{Total: 1000, Up: 600, Down: 400}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound := &tt.inbound
+			inbound.Port = 40004
+			inbound.Protocol = model.VMess
+			inbound.Tag = "inbound-40004"
+			inbound.Penalty = 2
+			err := db.Create(inbound).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Delete(inbound)
+
+			j.activateInboundsAfterPenalty()
+			err = db.First(inbound, inbound.Id).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the penalty is over either way, so the inbound is not picked up again
+			if inbound.Enable != tt.wantEnable || inbound.Penalty != -1 {
+				t.Errorf("inbound enable = %v penalty = %v, want %v -1", inbound.Enable, inbound.Penalty, tt.wantEnable)
+			}
+			if restart := xrayService.IsNeedRestartAndSetFalse(); restart != tt.wantEnable {
+				t.Errorf("need restart = %v, want %v", restart, tt.wantEnable)
+			}
+		})
+	}
+}
+
+func TestActivateInboundsAfterPenaltyEmails(t *testing.T) {
+	db := database.GetDB()
+	j := NewCheckClientIpJob(2)
+	inbound := &model.Inbound{Port: 40005, Protocol: model.VLESS, Tag: "inbound-40005", Penalty: 1}
+	err := inbound.SetClients([]model.Client{{Email: "penalty-a"}, {Email: "penalty-b"}, {Email: "penalty-c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(inbound)
+
+	// every client of the inbound serving its penalty is skipped, not only the first one
+	got := j.activateInboundsAfterPenalty()
+	want := map[string]bool{"penalty-a": true, "penalty-b": true, "penalty-c": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activateInboundsAfterPenalty() = %v, want %v", got, want)
+	}
+}
+
+func TestCheckXrayConfig(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	useAccessLog(t, nil)
+	configPath := filepath.Join("bin", "config.json")
+	valid, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := NewCheckClientIpJob(1)
+
+	// the steps run in order, each one is reported only when the state changes
+	tests := []struct {
+		name    string
+		config  []byte
+		want    bool
+		wantLog string
+	}{
+		{"valid", valid, true, ""},
+		{"malformed", []byte(`{"log": `), false, "client ip limits are not enforced"},
+		{"still malformed", []byte(`{"log": `), false, ""},
+		{"fixed", valid, true, "xray config is usable again"},
+		{"missing before xray starts", nil, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			if tt.config == nil {
+				os.Remove(configPath)
+			} else {
+				err := os.WriteFile(configPath, tt.config, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := j.checkXrayConfig(); got != tt.want {
+				t.Errorf("checkXrayConfig() = %v, want %v", got, tt.want)
+			}
+			got := logs.String()
+			if tt.wantLog == "" && got != "" {
+				t.Errorf("checkXrayConfig() logged %q, want nothing", got)
+			}
+			if tt.wantLog != "" && !strings.Contains(got, tt.wantLog) {
+				t.Errorf("checkXrayConfig() logged %q, want %q", got, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestPenaltyOfSeveralClients(t *testing.T) {
+	db := database.GetDB()
+	xrayService := service.XrayService{}
+	xrayService.IsNeedRestartAndSetFalse()
+	inbound := &model.Inbound{Port: 40006, Protocol: model.VLESS, Tag: "inbound-40006", Enable: true}
+	err := inbound.SetClients([]model.Client{
+		{Email: "several-a", LimitIP: 1},
+		{Email: "several-b", LimitIP: 1},
+		{Email: "several-c", LimitIP: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(inbound)
+	// a and b go over their limit in the same run, c doesn't
+	useAccessLog(t, []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-40006 >> direct] email: several-a",
+		"2024/01/02 10:00:01 1.2.3.5:5001 accepted tcp:example.com:443 [inbound-40006 >> direct] email: several-a",
+		"2024/01/02 10:00:02 [2001:db8::1]:5002 accepted tcp:example.com:443 [inbound-40006 >> direct] email: several-b",
+		"2024/01/02 10:00:03 [2001:db8::2]:5003 accepted tcp:example.com:443 [inbound-40006 >> direct] email: several-b",
+		"2024/01/02 10:00:04 5.6.7.8:5004 accepted tcp:example.com:443 [inbound-40006 >> direct] email: several-c",
+	})
+
+	j := NewCheckClientIpJob(1)
+	defer func() {
+		if j.logReader.file != nil {
+			j.logReader.file.Close()
+		}
+	}()
+	isInRestartGrace = func(*service.XrayService) bool { return false }
+	defer func() { isInRestartGrace = (*service.XrayService).IsInRestartGrace }()
+	err = j.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.First(inbound, inbound.Id).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inbound.Enable || inbound.Penalty != 0 {
+		t.Errorf("inbound enable = %v penalty = %v, want false 0", inbound.Enable, inbound.Penalty)
+	}
+	if !xrayService.IsNeedRestartAndSetFalse() {
+		t.Error("disabling the inbound didn't ask for a restart")
+	}
+	// disabling it again for the other client changes nothing
+	err = j.DisableInbound(inbound.Id, "several-b")
+	if err != nil {
+		t.Errorf("DisableInbound() of a disabled inbound = %v", err)
+	}
+	if xrayService.IsNeedRestartAndSetFalse() {
+		t.Error("disabling a disabled inbound asked for a restart")
+	}
+
+	// every client of the inbound is skipped while it serves its penalty
+	got := j.activateInboundsAfterPenalty()
+	want := map[string]bool{"several-a": true, "several-b": true, "several-c": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("activateInboundsAfterPenalty() = %v, want %v", got, want)
+	}
+}
+
+func TestPenaltyOfInboundWithoutClients(t *testing.T) {
+	db := database.GetDB()
+	j := NewCheckClientIpJob(2)
+	for i, settings := range []string{`{"clients": []}`, `{}`, ""} {
+		inbound := &model.Inbound{Port: 40007 + i, Protocol: model.VLESS, Tag: fmt.Sprintf("inbound-%v", 40007+i), Penalty: 1, Settings: settings}
+		err := db.Create(inbound).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Delete(inbound)
+	}
+
+	got := j.activateInboundsAfterPenalty()
+	if len(got) != 0 {
+		t.Errorf("activateInboundsAfterPenalty() = %v, want no emails", got)
+	}
+}
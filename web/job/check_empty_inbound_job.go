@@ -0,0 +1,68 @@
+package job
+
+import (
+	"fmt"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+// CheckEmptyInboundJob flags or disables enabled inbounds which have had no clients for a while,
+// they only hold a port open
+type CheckEmptyInboundJob struct {
+	inboundService      service.InboundService
+	xrayService         service.XrayService
+	settingService      service.SettingService
+	notificationService service.NotificationService
+	tgBotService        service.TgBotService
+	// notified keeps inbounds already reported, so each is notified once per empty period
+	notified map[int]int64
+}
+
+func NewCheckEmptyInboundJob() *CheckEmptyInboundJob {
+	return &CheckEmptyInboundJob{
+		notified: map[int]int64{},
+	}
+}
+
+func (j *CheckEmptyInboundJob) Run() error {
+	action, err := j.settingService.GetEmptyInboundAction()
+	if err != nil {
+		return err
+	}
+	if action == "off" {
+		return nil
+	}
+	period, err := j.settingService.GetEmptyInboundPeriod()
+	if err != nil {
+		return err
+	}
+	if period <= 0 {
+		return common.NewError("empty inbound period must be positive:", period)
+	}
+	inbounds, err := j.inboundService.GetEmptyInbounds(time.Hour * time.Duration(period))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, inbound := range inbounds {
+		if action == "disable" {
+			err = j.inboundService.DisableInbound(inbound.Id)
+			if err != nil {
+				errs = append(errs, common.NewErrorf("disable empty inbound %v failed: %v", inbound.Tag, err))
+				continue
+			}
+			j.xrayService.SetToNeedRestart()
+			logger.Infof("disabled inbound %v, it had no clients for %v hours", inbound.Tag, period)
+			j.notificationService.Notify(service.EventInboundDisabled, service.NewInboundEvent(inbound, "empty"))
+			// chats are told by the disabled event
+			j.tgBotService.Notify(fmt.Sprintf("入站 %v (%v) 超过 %v 小时没有用户，已自动禁用\r\n", inbound.Tag, inbound.Remark, period))
+		} else if j.notified[inbound.Id] != inbound.EmptySince {
+			j.notified[inbound.Id] = inbound.EmptySince
+			logger.Infof("inbound %v has had no clients for %v hours", inbound.Tag, period)
+			NewStatsNotifyJob().SendAlert(fmt.Sprintf("入站 %v (%v) 超过 %v 小时没有用户\r\n", inbound.Tag, inbound.Remark, period))
+		}
+	}
+	return common.Combine(errs...)
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/service"
+
+	"github.com/op/go-logging"
+)
+
+func TestCheckEmptyInboundJob(t *testing.T) {
+	db := database.GetDB()
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	xrayService := service.XrayService{}
+	now := time.Now().Unix() * 1000
+	longAgo := now - (time.Hour * 25).Milliseconds()
+	recently := now - time.Hour.Milliseconds()
+
+	tests := []struct {
+		name        string
+		action      string
+		inbound     model.Inbound
+		clients     []model.Client
+		wantEnable  bool
+		wantFlagged bool
+	}{
+		{"empty past the period", "disable", model.Inbound{EmptySince: longAgo}, nil, false, false},
+		{"empty within the period", "disable", model.Inbound{EmptySince: recently}, nil, true, false},
+		{"just emptied", "disable", model.Inbound{}, nil, true, false},
+		{"populated", "disable", model.Inbound{EmptySince: longAgo}, []model.Client{{Email: "empty-job"}}, true, false},
+		{"protocol without clients", "disable", model.Inbound{Protocol: model.Http, EmptySince: longAgo}, nil, true, false},
+		{"flagged past the period", "flag", model.Inbound{EmptySince: longAgo}, nil, true, true},
+		{"off", "off", model.Inbound{EmptySince: longAgo}, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setJobSettings(t, map[string]string{"emptyInboundAction": tt.action, "emptyInboundPeriod": "24"})
+			logs.Reset()
+			xrayService.IsNeedRestartAndSetFalse()
+			inbound := &tt.inbound
+			inbound.Port = 40040
+			if inbound.Protocol == "" {
+				inbound.Protocol = model.VLESS
+			}
+			inbound.Tag = "inbound-40040"
+			inbound.Enable = true
+			err := inbound.SetClients(tt.clients)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.Create(inbound).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Delete(inbound)
+
+			j := NewCheckEmptyInboundJob()
+			err = j.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.First(inbound, inbound.Id).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inbound.Enable != tt.wantEnable {
+				t.Errorf("inbound enable = %v, want %v", inbound.Enable, tt.wantEnable)
+			}
+			if restart := xrayService.IsNeedRestartAndSetFalse(); restart == tt.wantEnable {
+				t.Errorf("need restart = %v, want %v", restart, !tt.wantEnable)
+			}
+			flagged := strings.Contains(logs.String(), "has had no clients")
+			if flagged != tt.wantFlagged {
+				t.Errorf("flagged = %v, want %v", flagged, tt.wantFlagged)
+			}
+
+			// a flagged inbound is reported once for the period it is empty
+			logs.Reset()
+			err = j.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(logs.String(), "has had no clients") {
+				t.Error("the inbound was flagged again")
+			}
+		})
+	}
+}
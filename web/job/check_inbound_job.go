@@ -1,25 +1,48 @@
 package job
 
 import (
+	"time"
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/service"
 )
 
 type CheckInboundJob struct {
-	xrayService    service.XrayService
-	inboundService service.InboundService
+	xrayService         service.XrayService
+	inboundService      service.InboundService
+	settingService      service.SettingService
+	mailService         service.MailService
+	notificationService service.NotificationService
 }
 
 func NewCheckInboundJob() *CheckInboundJob {
 	return new(CheckInboundJob)
 }
 
-func (j *CheckInboundJob) Run() {
-	count, err := j.inboundService.DisableInvalidInbounds()
+func (j *CheckInboundJob) Run() error {
+	var errs []error
+	err := j.mailService.NotifyUsageAlerts()
 	if err != nil {
-		logger.Warning("disable invalid inbounds err:", err)
-	} else if count > 0 {
-		logger.Debugf("disabled %v inbounds", count)
+		errs = append(errs, common.NewError("mail usage alerts failed:", err))
+	}
+	err = j.notificationService.NotifyExpiredClients()
+	if err != nil {
+		errs = append(errs, common.NewError("notify expired clients failed:", err))
+	}
+	if !inSchedule(&j.settingService, j.settingService.GetInboundCheckSchedule, timeNow()) {
+		logger.Debug("outside of the inbound check schedule, skip disabling inbounds")
+		return common.Combine(errs...)
+	}
+	inbounds, err := j.inboundService.DisableInvalidInbounds()
+	if err != nil {
+		errs = append(errs, common.NewError("disable invalid inbounds failed:", err))
+	} else if len(inbounds) > 0 {
+		logger.Debugf("disabled %v inbounds", len(inbounds))
 		j.xrayService.SetToNeedRestart()
+		now := time.Now().Unix() * 1000
+		for _, inbound := range inbounds {
+			j.notificationService.Notify(service.EventInboundDisabled, service.NewInboundEvent(inbound, inbound.GetDisableReason(now)))
+		}
 	}
+	return common.Combine(errs...)
 }
@@ -0,0 +1,37 @@
+package job
+
+import (
+	"fmt"
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type CheckUpdateJob struct {
+	updateService  service.UpdateService
+	settingService service.SettingService
+	url            string
+	notified       string
+}
+
+func NewCheckUpdateJob(url string) *CheckUpdateJob {
+	return &CheckUpdateJob{
+		url: url,
+	}
+}
+
+func (j *CheckUpdateJob) Run() error {
+	_, err := j.updateService.CheckUpdate(j.url)
+	if err != nil {
+		return err
+	}
+	latest, available := j.updateService.GetUpdateInfo()
+	if !available || latest == j.notified {
+		return nil
+	}
+	j.notified = latest
+	logger.Infof("new version %v is available, current version %v", latest, config.GetVersion())
+
+	NewStatsNotifyJob().SendAlert(fmt.Sprintf("x-ui 有新版本可用: %s\r\n当前版本: %s\r\n", latest, config.GetVersion()))
+	return nil
+}
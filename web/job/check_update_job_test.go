@@ -0,0 +1,39 @@
+package job
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckUpdateJob(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v99.0.0"}`))
+	}))
+	defer feed.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + listener.Addr().String()
+	listener.Close()
+
+	j := NewCheckUpdateJob(feed.URL)
+	err = j.Run()
+	if err != nil || j.notified != "v99.0.0" {
+		t.Fatalf("Run() = %v, notified %q, want v99.0.0", err, j.notified)
+	}
+
+	// without network the run fails and is logged by the timed job, nothing is sent
+	j.url = unreachable
+	j.notified = ""
+	err = j.Run()
+	if err == nil {
+		t.Error("Run() with an unreachable feed succeeded")
+	}
+	if j.notified != "" {
+		t.Errorf("Run() with an unreachable feed notified about %q", j.notified)
+	}
+	NewTimedJob("check_update", j).Run()
+}
@@ -1,25 +1,99 @@
 package job
 
-import "x-ui/web/service"
+import (
+	"fmt"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
 
 type CheckXrayRunningJob struct {
-	xrayService service.XrayService
+	xrayService         service.XrayService
+	inboundService      service.InboundService
+	settingService      service.SettingService
+	tgBotService        service.TgBotService
+	notificationService service.NotificationService
 
 	checkTime int
+	// whether the chat was told xray is down, it is told again once xray is back
+	downNotified bool
+	// restart time of the last xray process whose failure was counted
+	lastRejectCheck int64
 }
 
 func NewCheckXrayRunningJob() *CheckXrayRunningJob {
 	return new(CheckXrayRunningJob)
 }
 
-func (j *CheckXrayRunningJob) Run() {
+func (j *CheckXrayRunningJob) Run() error {
 	if j.xrayService.IsXrayRunning() {
 		j.checkTime = 0
-		return
+		if j.downNotified {
+			j.downNotified = false
+			j.tgBotService.NotifyXrayDown(false)
+		}
+		return nil
 	}
+	err := j.checkRejectedInbound()
 	j.checkTime++
 	if j.checkTime < 2 {
-		return
+		return err
+	}
+	if !j.downNotified && j.xrayService.IsXrayExpected() {
+		j.downNotified = true
+		j.tgBotService.NotifyXrayDown(true)
+		event := &service.XrayEvent{Output: j.xrayService.GetXrayResult()}
+		if err := j.xrayService.GetXrayErr(); err != nil {
+			event.Error = err.Error()
+		}
+		j.notificationService.Notify(service.EventXrayCrashed, event)
 	}
 	j.xrayService.SetToNeedRestart()
+	return err
+}
+
+// checkRejectedInbound counts the failure against the inbound xray exited because of,
+// once per xray start, and disables the inbound when it reaches the threshold
+func (j *CheckXrayRunningJob) checkRejectedInbound() error {
+	restartTime := j.xrayService.GetLastRestartTime()
+	if restartTime == j.lastRejectCheck {
+		return nil
+	}
+	j.lastRejectCheck = restartTime
+
+	threshold, err := j.settingService.GetXrayRejectThreshold()
+	if err != nil {
+		return err
+	}
+	if threshold <= 0 {
+		return nil
+	}
+	inbound, err := j.xrayService.GetFailedInbound()
+	if err != nil {
+		return common.NewError("get failed inbound failed:", err)
+	}
+	if inbound == nil {
+		return nil
+	}
+	return j.rejectInbound(inbound, threshold)
+}
+
+// rejectInbound counts one start failure against the inbound and disables it at threshold failures
+func (j *CheckXrayRunningJob) rejectInbound(inbound *model.Inbound, threshold int) error {
+	count, err := j.inboundService.AddInboundReject(inbound.Id)
+	if err != nil {
+		return common.NewError("count inbound reject failed:", err)
+	}
+	if count < threshold {
+		return nil
+	}
+	err = j.inboundService.AutoDisableInbound(inbound.Id)
+	if err != nil {
+		return common.NewError("disable rejected inbound failed:", err)
+	}
+	logger.Warningf("xray failed to start %v times because of inbound %v (%v), disabled it", count, inbound.Tag, inbound.Remark)
+	j.notificationService.Notify(service.EventInboundDisabled, service.NewInboundEvent(inbound, "rejected"))
+	j.tgBotService.Notify(fmt.Sprintf("xray 因入站 %v (%v) 启动失败 %v 次，已自动禁用该入站\r\n", inbound.Tag, inbound.Remark, count))
+	return nil
 }
@@ -0,0 +1,36 @@
+package job
+
+import (
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestRejectInbound(t *testing.T) {
+	db := database.GetDB()
+	inbound := &model.Inbound{Port: 40040, Protocol: model.VLESS, Tag: "inbound-40040", Enable: true, Settings: `{"clients":[]}`}
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Delete(inbound) })
+
+	const threshold = 3
+	j := NewCheckXrayRunningJob()
+	for i := 1; i <= threshold; i++ {
+		err := j.rejectInbound(inbound, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := &model.Inbound{}
+		err = db.First(stored, inbound.Id).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		disabled := i >= threshold
+		if stored.RejectCount != i || stored.Enable == disabled || stored.AutoDisabled != disabled {
+			t.Errorf("after %v rejections reject count = %v enable = %v autoDisabled = %v, want disabled %v",
+				i, stored.RejectCount, stored.Enable, stored.AutoDisabled, disabled)
+		}
+	}
+}
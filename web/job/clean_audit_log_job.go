@@ -0,0 +1,20 @@
+package job
+
+import (
+	"time"
+	"x-ui/web/service"
+)
+
+const auditLogRetention = time.Hour * 24 * 180
+
+type CleanAuditLogJob struct {
+	auditService service.AuditService
+}
+
+func NewCleanAuditLogJob() *CleanAuditLogJob {
+	return new(CleanAuditLogJob)
+}
+
+func (j *CleanAuditLogJob) Run() error {
+	return j.auditService.DelAuditLogsBefore(time.Now().Add(-auditLogRetention))
+}
@@ -0,0 +1,27 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type CleanEphemeralClientJob struct {
+	inboundService service.InboundService
+	xrayService    service.XrayService
+}
+
+func NewCleanEphemeralClientJob() *CleanEphemeralClientJob {
+	return new(CleanEphemeralClientJob)
+}
+
+func (j *CleanEphemeralClientJob) Run() error {
+	count, err := j.inboundService.DelExpiredEphemeralClients()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Infof("deleted %v expired ephemeral clients", count)
+		j.xrayService.SetToNeedRestart()
+	}
+	return nil
+}
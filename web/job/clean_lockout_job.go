@@ -0,0 +1,19 @@
+package job
+
+import (
+	"time"
+	"x-ui/web/service"
+)
+
+type CleanLockoutJob struct {
+	lockoutService service.LockoutService
+}
+
+func NewCleanLockoutJob() *CleanLockoutJob {
+	return new(CleanLockoutJob)
+}
+
+func (j *CleanLockoutJob) Run() error {
+	// counters live as long as their longest window, the day ips are banned within
+	return j.lockoutService.CleanExpired(time.Hour * 24)
+}
@@ -0,0 +1,17 @@
+package job
+
+import (
+	"x-ui/web/service"
+)
+
+type CleanSessionJob struct {
+	loginSessionService service.LoginSessionService
+}
+
+func NewCleanSessionJob() *CleanSessionJob {
+	return new(CleanSessionJob)
+}
+
+func (j *CleanSessionJob) Run() error {
+	return j.loginSessionService.DelExpiredSessions()
+}
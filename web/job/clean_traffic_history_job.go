@@ -0,0 +1,20 @@
+package job
+
+import (
+	"time"
+	"x-ui/web/service"
+)
+
+const trafficHistoryRetention = time.Hour * 24 * 90
+
+type CleanTrafficHistoryJob struct {
+	trafficHistoryService service.TrafficHistoryService
+}
+
+func NewCleanTrafficHistoryJob() *CleanTrafficHistoryJob {
+	return new(CleanTrafficHistoryJob)
+}
+
+func (j *CleanTrafficHistoryJob) Run() error {
+	return j.trafficHistoryService.DelTrafficHistoryBefore(time.Now().Add(-trafficHistoryRetention))
+}
@@ -0,0 +1,27 @@
+package job
+
+import (
+	"time"
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type CleanupClientIpsJob struct {
+	inboundService service.InboundService
+	settingService service.SettingService
+}
+
+func NewCleanupClientIpsJob() *CleanupClientIpsJob {
+	return new(CleanupClientIpsJob)
+}
+
+func (j *CleanupClientIpsJob) Run() error {
+	retention, err := j.settingService.GetClientIpsRetention()
+	if err != nil {
+		return err
+	}
+	if retention <= 0 {
+		return common.NewError("client ips retention must be positive:", retention)
+	}
+	return j.inboundService.DelClientIpsBefore(time.Now().Add(-retention))
+}
@@ -0,0 +1,17 @@
+package job
+
+import (
+	"x-ui/web/service"
+)
+
+type RenewAcmeCertJob struct {
+	acmeService service.AcmeService
+}
+
+func NewRenewAcmeCertJob() *RenewAcmeCertJob {
+	return new(RenewAcmeCertJob)
+}
+
+func (j *RenewAcmeCertJob) Run() error {
+	return j.acmeService.RenewDnsCert()
+}
@@ -0,0 +1,26 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/util/schedule"
+	"x-ui/web/service"
+)
+
+// timeNow is the clock the scheduled jobs read, tests replace it
+var timeNow = time.Now
+
+// inSchedule reports whether now falls in the schedule, read in the panel time zone,
+// a schedule which can't be read keeps the job active
+func inSchedule(settingService *service.SettingService, getSchedule func() (schedule.Windows, error), now time.Time) bool {
+	windows, err := getSchedule()
+	if err != nil {
+		logger.Warning("get job schedule failed:", err)
+		return true
+	}
+	location, err := settingService.GetTimeLocation()
+	if err == nil {
+		now = now.In(location)
+	}
+	return windows.Contains(now)
+}
@@ -0,0 +1,83 @@
+package job
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// setJobSettings stores the settings for the test and removes them when it ends
+func setJobSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	db := database.GetDB()
+	for key, value := range settings {
+		err := db.Create(&model.Setting{Key: key, Value: value}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for key := range settings {
+			db.Where("key = ?", key).Delete(model.Setting{})
+		}
+	})
+}
+
+// setClock makes the jobs read now as the time until the test ends
+func setClock(t *testing.T, now time.Time) {
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+}
+
+func TestCheckInboundJobSchedule(t *testing.T) {
+	// 10:00 at UTC+3:30, 06:30 at UTC
+	now := time.Date(2024, 3, 1, 6, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule string
+		location string
+		acts     bool
+	}{
+		{"no schedule", "", "UTC", true},
+		{"inside", "06:00-07:00", "UTC", true},
+		{"outside", "08:00-09:00", "UTC", false},
+		{"inside in the panel time zone", "09:30-10:30", "Asia/Tehran", true},
+		{"outside in the panel time zone", "06:00-07:00", "Asia/Tehran", false},
+		{"invalid schedule keeps the job active", "later", "UTC", true},
+	}
+	db := database.GetDB()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setJobSettings(t, map[string]string{
+				"inboundCheckSchedule": tt.schedule,
+				"timeLocation":         tt.location,
+			})
+			setClock(t, now)
+			inbound := &model.Inbound{
+				Enable:     true,
+				Port:       40002,
+				Protocol:   model.VMess,
+				Tag:        "inbound-40002",
+				ExpiryTime: now.Add(-time.Hour).Unix() * 1000,
+			}
+			err := db.Create(inbound).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Delete(inbound)
+
+			err = NewCheckInboundJob().Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = db.First(inbound, inbound.Id).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inbound.Enable == tt.acts {
+				t.Errorf("expired inbound enable = %v, want %v", inbound.Enable, !tt.acts)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package job
+
+import (
+	"time"
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+// slowJobDuration is how long a run may take before it is logged as slow
+const slowJobDuration = time.Second * 10
+
+// Job is a cron job which returns why its run failed
+type Job interface {
+	Run() error
+}
+
+// TimedJob records the duration and outcome of every run of the wrapped job,
+// a run fails when the job returns an error or panics, a panic is logged
+// instead of crashing the panel
+type TimedJob struct {
+	name string
+	job  Job
+}
+
+func NewTimedJob(name string, job Job) *TimedJob {
+	return &TimedJob{
+		name: name,
+		job:  job,
+	}
+}
+
+func (j *TimedJob) Run() {
+	start := time.Now()
+	var err error
+	panicked := true
+	defer func() {
+		duration := time.Since(start)
+		if panicked {
+			logger.Errorf("job %v panicked after %v: %v", j.name, duration, recover())
+		} else if err != nil {
+			logger.Warningf("job %v failed after %v: %v", j.name, duration, err)
+		} else if duration >= slowJobDuration {
+			logger.Warningf("job %v is slow, took %v", j.name, duration)
+		} else {
+			logger.Debugf("job %v took %v", j.name, duration)
+		}
+		service.RecordJobRun(j.name, start, duration, panicked || err != nil)
+	}()
+	err = j.job.Run()
+	panicked = false
+}
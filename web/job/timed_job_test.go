@@ -0,0 +1,74 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+	"x-ui/web/service"
+)
+
+type funcJob func() error
+
+func (f funcJob) Run() error {
+	return f()
+}
+
+func getJobStats(t *testing.T, name string) service.JobStats {
+	t.Helper()
+	for _, stats := range service.GetJobStats() {
+		if stats.Name == name {
+			return stats
+		}
+	}
+	t.Fatalf("job %v has no stats", name)
+	return service.JobStats{}
+}
+
+func TestTimedJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		job         funcJob
+		wantFailed  bool
+		minDuration time.Duration
+	}{
+		{"test_succeeds", func() error {
+			time.Sleep(time.Millisecond * 5)
+			return nil
+		}, false, time.Millisecond * 5},
+		{"test_returns_error", func() error {
+			return errors.New("database is locked")
+		}, true, 0},
+		{"test_panics", func() error {
+			panic("nil map")
+		}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			job := NewTimedJob(tt.name, tt.job)
+			job.Run()
+			job.Run()
+
+			stats := getJobStats(t, tt.name)
+			if stats.Runs != 2 {
+				t.Errorf("Runs = %v, want 2", stats.Runs)
+			}
+			wantFailures := int64(0)
+			if tt.wantFailed {
+				wantFailures = 2
+			}
+			if stats.Failures != wantFailures {
+				t.Errorf("Failures = %v, want %v", stats.Failures, wantFailures)
+			}
+			if stats.LastFailed != tt.wantFailed {
+				t.Errorf("LastFailed = %v, want %v", stats.LastFailed, tt.wantFailed)
+			}
+			if stats.LastRun.Before(before) {
+				t.Errorf("LastRun = %v, before the run started at %v", stats.LastRun, before)
+			}
+			if stats.LastDuration < tt.minDuration || stats.TotalDuration < 2*tt.minDuration {
+				t.Errorf("LastDuration = %v, TotalDuration = %v, want at least %v and %v", stats.LastDuration, stats.TotalDuration, tt.minDuration, 2*tt.minDuration)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"x-ui/web/service"
+)
+
+// WriteMetricsFileJob writes the metrics for node_exporter's textfile collector
+type WriteMetricsFileJob struct {
+	metricsService service.MetricsService
+	path           string
+}
+
+func NewWriteMetricsFileJob(path string) *WriteMetricsFileJob {
+	return &WriteMetricsFileJob{
+		path: path,
+	}
+}
+
+func (j *WriteMetricsFileJob) Run() error {
+	metrics, err := j.metricsService.GetMetrics()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(j.path, []byte(metrics))
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames it,
+// so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
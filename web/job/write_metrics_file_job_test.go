@@ -0,0 +1,121 @@
+package job
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "x-ui-job-test-")
+	if err != nil {
+		panic(err)
+	}
+	err = database.InitDB(filepath.Join(dir, "x-ui.db"))
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+var (
+	metricNameRegex    = `[a-zA-Z_:][a-zA-Z0-9_:]*`
+	metricCommentRegex = regexp.MustCompile(`^# (HELP|TYPE) (` + metricNameRegex + `) (.+)$`)
+	metricSampleRegex  = regexp.MustCompile(`^(` + metricNameRegex + `)(\{[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*"(?:,[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\[\\"n])*")*\})? (\S+)$`)
+	metricTypes        = map[string]bool{"counter": true, "gauge": true, "histogram": true, "summary": true, "untyped": true}
+)
+
+// checkPrometheusText fails the test on lines of data that aren't valid prometheus text format,
+// every sample needs a TYPE before it and a metric may only be typed once
+func checkPrometheusText(t *testing.T, data string) {
+	t.Helper()
+	typed := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		if matches := metricCommentRegex.FindStringSubmatch(line); matches != nil {
+			if matches[1] == "TYPE" {
+				if typed[matches[2]] {
+					t.Errorf("line %v: %v is typed twice", n, matches[2])
+				}
+				if !metricTypes[matches[3]] {
+					t.Errorf("line %v: unknown type %q", n, matches[3])
+				}
+				typed[matches[2]] = true
+			}
+			continue
+		}
+		matches := metricSampleRegex.FindStringSubmatch(line)
+		if matches == nil {
+			t.Errorf("line %v is not a valid sample: %q", n, line)
+			continue
+		}
+		if !typed[matches[1]] {
+			t.Errorf("line %v: %v has no TYPE before it", n, matches[1])
+		}
+		if _, err := strconv.ParseFloat(matches[3], 64); err != nil {
+			t.Errorf("line %v: invalid value %q", n, matches[3])
+		}
+	}
+	if !strings.HasSuffix(data, "\n") {
+		t.Error("the last line doesn't end with a line feed")
+	}
+}
+
+func TestWriteMetricsFileJob(t *testing.T) {
+	db := database.GetDB()
+	inbound := &model.Inbound{
+		Remark:   "quote \" backslash \\ newline \n",
+		Enable:   true,
+		Port:     40001,
+		Protocol: model.VMess,
+		Tag:      "inbound-40001",
+		Up:       1024,
+		Down:     2048,
+	}
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(inbound)
+
+	path := filepath.Join(t.TempDir(), "x-ui.prom")
+	// an old file is replaced as a whole
+	err = os.WriteFile(path, []byte("stale"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewWriteMetricsFileJob(path).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPrometheusText(t, string(data))
+	want := `xui_inbound_up_bytes{tag="inbound-40001",remark="quote \" backslash \\ newline \n"} 1024`
+	if !strings.Contains(string(data), want+"\n") {
+		t.Errorf("metrics file misses %q:\n%s", want, data)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the temp file was left behind: %v", entries)
+	}
+}
@@ -2,6 +2,7 @@ package job
 
 import (
 	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/service"
 )
 
@@ -14,17 +15,30 @@ func NewXrayTrafficJob() *XrayTrafficJob {
 	return new(XrayTrafficJob)
 }
 
-func (j *XrayTrafficJob) Run() {
+func (j *XrayTrafficJob) Run() error {
 	if !j.xrayService.IsXrayRunning() {
-		return
+		return nil
 	}
-	traffics, err := j.xrayService.GetXrayTraffic()
+	traffics, clientTraffics, err := j.xrayService.GetXrayTraffic()
 	if err != nil {
-		logger.Warning("get xray traffic failed:", err)
-		return
+		return err
 	}
+	var errs []error
 	err = j.inboundService.AddTraffic(traffics)
 	if err != nil {
-		logger.Warning("add traffic failed:", err)
+		errs = append(errs, common.NewError("add traffic failed:", err))
 	}
+	err = j.inboundService.AddClientTraffic(clientTraffics)
+	if err != nil {
+		errs = append(errs, common.NewError("add client traffic failed:", err))
+	}
+	// clients past their traffic or expiry are left out of the config, the restart takes them off
+	depleted, err := j.xrayService.HasDepletedClients()
+	if err != nil {
+		errs = append(errs, common.NewError("check depleted clients failed:", err))
+	} else if depleted {
+		logger.Info("clients used up their traffic or expired, restarting xray")
+		j.xrayService.SetToNeedRestart()
+	}
+	return common.Combine(errs...)
 }
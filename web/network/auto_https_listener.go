@@ -4,11 +4,14 @@ import "net"
 
 type AutoHttpsListener struct {
 	net.Listener
+
+	mode AutoHttpsMode
 }
 
-func NewAutoHttpsListener(listener net.Listener) net.Listener {
+func NewAutoHttpsListener(listener net.Listener, mode AutoHttpsMode) net.Listener {
 	return &AutoHttpsListener{
 		Listener: listener,
+		mode:     mode,
 	}
 }
 
@@ -17,5 +20,5 @@ func (l *AutoHttpsListener) Accept() (net.Conn, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewAutoHttpsConn(conn), nil
+	return NewAutoHttpsConn(conn, l.mode), nil
 }
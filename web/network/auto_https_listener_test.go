@@ -0,0 +1,123 @@
+package network
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveAutoHttps serves "ok" over tls the way the panel does, with the auto https listener
+// between the tcp listener and the tls one
+func serveAutoHttps(t *testing.T, mode AutoHttpsMode) net.Listener {
+	t.Helper()
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "panel")
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := NewAutoHttpsListener(inner, mode)
+	listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	server := &http.Server{
+		// plain http connections end in a handshake error, which is expected here
+		ErrorLog: log.New(io.Discard, "", 0),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener
+}
+
+// sendPlainHttp sends a plain http request and returns all the server answered
+func sendPlainHttp(t *testing.T, listener net.Listener) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write([]byte("GET /panel/login?lang=en HTTP/1.1\r\nHost: panel.example.com:2053\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("reading the answer failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestAutoHttpsListener(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         AutoHttpsMode
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{"redirect", AutoHttpsRedirect, http.StatusTemporaryRedirect, "https://panel.example.com:2053/panel/login?lang=en", ""},
+		{"unknown mode redirects", AutoHttpsMode(""), http.StatusTemporaryRedirect, "https://panel.example.com:2053/panel/login?lang=en", ""},
+		{"reject", AutoHttpsReject, 0, "", ""},
+		{"error page", AutoHttpsError, http.StatusBadRequest, "", autoHttpsErrorPage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := serveAutoHttps(t, tt.mode)
+
+			answer := sendPlainHttp(t, listener)
+			if tt.wantStatus == 0 {
+				if answer != "" {
+					t.Errorf("plain http was answered with %q, want the connection closed", answer)
+				}
+			} else {
+				resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(answer)), nil)
+				if err != nil {
+					t.Fatalf("plain http was answered with %q: %v", answer, err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %v, want %v", resp.StatusCode, tt.wantStatus)
+				}
+				if got := resp.Header.Get("Location"); got != tt.wantLocation {
+					t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+				}
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+			}
+
+			// the client hello is peeked, not consumed, so tls works the same in every mode
+			client := &http.Client{
+				Timeout: 5 * time.Second,
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				},
+			}
+			resp, err := client.Get("https://" + listener.Addr().String() + "/panel/")
+			if err != nil {
+				t.Fatalf("https request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+				t.Errorf("https request = %v %q, want %v %q", resp.StatusCode, body, http.StatusOK, "ok")
+			}
+		})
+	}
+}
@@ -4,23 +4,43 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 )
 
+// AutoHttpsMode is what to do with a plain http request sent to the https port
+type AutoHttpsMode string
+
+const (
+	AutoHttpsRedirect AutoHttpsMode = "redirect"
+	AutoHttpsReject   AutoHttpsMode = "reject"
+	AutoHttpsError    AutoHttpsMode = "error"
+)
+
+// tlsRecordTypeHandshake is the first byte of a tls client hello
+const tlsRecordTypeHandshake = 0x16
+
+const autoHttpsErrorPage = "<html><body><h1>400 Bad Request</h1><p>This port only accepts https.</p></body></html>"
+
 type AutoHttpsConn struct {
 	net.Conn
 
+	mode AutoHttpsMode
+
 	firstBuf []byte
+	firstErr error
 	bufStart int
 
 	readRequestOnce sync.Once
 }
 
-func NewAutoHttpsConn(conn net.Conn) net.Conn {
+func NewAutoHttpsConn(conn net.Conn, mode AutoHttpsMode) net.Conn {
 	return &AutoHttpsConn{
 		Conn: conn,
+		mode: mode,
 	}
 }
 
@@ -28,7 +48,8 @@ func (c *AutoHttpsConn) readRequest() bool {
 	c.firstBuf = make([]byte, 2048)
 	n, err := c.Conn.Read(c.firstBuf)
 	c.firstBuf = c.firstBuf[:n]
-	if err != nil {
+	c.firstErr = err
+	if n == 0 || c.firstBuf[0] == tlsRecordTypeHandshake {
 		return false
 	}
 	reader := bytes.NewReader(c.firstBuf)
@@ -37,15 +58,32 @@ func (c *AutoHttpsConn) readRequest() bool {
 	if err != nil {
 		return false
 	}
-	resp := http.Response{
-		Header: http.Header{},
+	switch c.mode {
+	case AutoHttpsReject:
+	case AutoHttpsError:
+		resp := http.Response{
+			StatusCode:    http.StatusBadRequest,
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(autoHttpsErrorPage)),
+			ContentLength: int64(len(autoHttpsErrorPage)),
+			Close:         true,
+		}
+		resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+		resp.Write(c.Conn)
+	default:
+		resp := http.Response{
+			Header: http.Header{},
+		}
+		resp.StatusCode = http.StatusTemporaryRedirect
+		location := fmt.Sprintf("https://%v%v", request.Host, request.RequestURI)
+		resp.Header.Set("Location", location)
+		resp.Write(c.Conn)
 	}
-	resp.StatusCode = http.StatusTemporaryRedirect
-	location := fmt.Sprintf("https://%v%v", request.Host, request.RequestURI)
-	resp.Header.Set("Location", location)
-	resp.Write(c.Conn)
 	c.Close()
 	c.firstBuf = nil
+	c.firstErr = nil
 	return true
 }
 
@@ -62,6 +100,11 @@ func (c *AutoHttpsConn) Read(buf []byte) (int, error) {
 		}
 		return n, nil
 	}
+	if c.firstErr != nil {
+		err := c.firstErr
+		c.firstErr = nil
+		return 0, err
+	}
 
 	return c.Conn.Read(buf)
 }
@@ -0,0 +1,120 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+	"x-ui/logger"
+)
+
+// CertReloader serves the certificate in certFile and keyFile, Watch reads the files again
+// when they change, so renewed certificates are used without restarting the panel or
+// dropping the connections and sessions it has
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	// cert holds the *tls.Certificate handshakes get, only Watch replaces it
+	cert        atomic.Value
+	certModTime time.Time
+	keyModTime  time.Time
+	// failed keeps a broken or missing file from being reported on every check
+	failed bool
+}
+
+// NewCertReloader loads the certificate once, so a broken certificate is reported at start
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	certModTime, keyModTime, err := r.getModTimes()
+	if err != nil {
+		return nil, err
+	}
+	err = r.load(certModTime, keyModTime)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewPendingCertReloader serves the certificate once the files exist, for certificates
+// still being issued, handshakes fail until then
+func NewPendingCertReloader(certFile string, keyFile string) *CertReloader {
+	return &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+func (r *CertReloader) getModTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (r *CertReloader) load(certModTime time.Time, keyModTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(&cert)
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return nil
+}
+
+// check loads the files when they changed, the last good certificate is kept while they
+// are missing or invalid, e.g. in the middle of a renewal
+func (r *CertReloader) check() {
+	certModTime, keyModTime, err := r.getModTimes()
+	if err == nil {
+		if certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime) {
+			return
+		}
+		err = r.load(certModTime, keyModTime)
+	}
+	if err != nil {
+		// files of pending certificates are expected to be missing
+		if !r.failed && r.cert.Load() != nil {
+			logger.Warning("reload certificate failed:", err)
+		}
+		r.failed = true
+		return
+	}
+	r.failed = false
+	logger.Info("certificate reloaded:", r.certFile)
+}
+
+// Watch checks the files every interval until ctx is done
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, ok := r.cert.Load().(*tls.Certificate)
+	if !ok {
+		return nil, errors.New("certificate is not issued yet: " + r.certFile)
+	}
+	return cert, nil
+}
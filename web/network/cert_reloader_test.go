@@ -0,0 +1,153 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self signed certificate of name and moves the file times forward,
+// so a rewrite within the same clock tick is seen as a change too
+func writeCert(t *testing.T, certFile string, keyFile string, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	modTime := time.Now()
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	}
+	err := os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(path, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// handshake connects to the listener and returns the common name of the certificate it serves
+func handshake(t *testing.T, listener net.Listener) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func serveTls(t *testing.T, r *CertReloader) net.Listener {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: r.GetCertificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "first")
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := serveTls(t, r)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		change func()
+		want   string
+	}{
+		{"unchanged", func() {}, "first"},
+		{"renewed", func() { writeCert(t, certFile, keyFile, "second") }, "second"},
+		{"broken keeps the last good one", func() { writeFile(t, certFile, []byte("broken")) }, "second"},
+		{"removed keeps the last good one", func() { os.Remove(keyFile) }, "second"},
+		{"renewed again", func() { writeCert(t, certFile, keyFile, "third") }, "third"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change()
+			// give Watch a few checks, a kept certificate is served right away otherwise
+			time.Sleep(50 * time.Millisecond)
+			got := ""
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+				if got = handshake(t, listener); got == tt.want {
+					break
+				}
+			}
+			if got != tt.want {
+				t.Errorf("served certificate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPendingCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	r := NewPendingCertReloader(certFile, keyFile)
+	listener := serveTls(t, r)
+
+	if got := handshake(t, listener); got != "" {
+		t.Fatalf("served %q before the certificate was issued", got)
+	}
+	writeCert(t, certFile, keyFile, "issued")
+	r.check()
+	if got := handshake(t, listener); got != "issued" {
+		t.Errorf("served certificate = %q, want %q", got, "issued")
+	}
+}
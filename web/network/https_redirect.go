@@ -0,0 +1,24 @@
+package network
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// NewHttpsRedirectHandler redirects every request to the same url on the https port,
+// the path and query are kept so the base path of the panel is kept too
+func NewHttpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,41 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpsRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort int
+		host      string
+		uri       string
+		want      string
+	}{
+		{"panel port", 54321, "panel.example.com:8080", "/", "https://panel.example.com:54321/"},
+		{"host without port", 54321, "panel.example.com", "/", "https://panel.example.com:54321/"},
+		{"base path and query", 54321, "panel.example.com", "/secret/xui/inbounds?page=2&sort=traffic", "https://panel.example.com:54321/secret/xui/inbounds?page=2&sort=traffic"},
+		{"default https port", 443, "panel.example.com:80", "/secret/", "https://panel.example.com/secret/"},
+		{"ipv4", 54321, "203.0.113.7:80", "/", "https://203.0.113.7:54321/"},
+		{"ipv6", 54321, "[2001:db8::1]:80", "/", "https://[2001:db8::1]:54321/"},
+		{"ipv6 on the default https port", 443, "[2001:db8::1]:80", "/", "https://[2001:db8::1]/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHttpsRedirectHandler(tt.httpsPort)
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				req := httptest.NewRequest(method, "http://"+tt.host+tt.uri, nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusMovedPermanently {
+					t.Errorf("%v %v = %v, want %v", method, tt.uri, w.Code, http.StatusMovedPermanently)
+				}
+				if got := w.Header().Get("Location"); got != tt.want {
+					t.Errorf("%v %v Location = %q, want %q", method, tt.uri, got, tt.want)
+				}
+			}
+		})
+	}
+}
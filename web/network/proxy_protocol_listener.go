@@ -0,0 +1,15 @@
+package network
+
+import (
+	"net"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// NewProxyProtocolListener parses PROXY protocol v1/v2 headers sent by a load balancer,
+// so RemoteAddr of accepted connections is the real client address
+func NewProxyProtocolListener(listener net.Listener) net.Listener {
+	return &proxyproto.Listener{
+		Listener: listener,
+	}
+}
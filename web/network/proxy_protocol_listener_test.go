@@ -0,0 +1,76 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func formatProxyHeader(t *testing.T, version byte, source string, dest string) []byte {
+	t.Helper()
+	sourceAddr, err := net.ResolveTCPAddr("tcp", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	destAddr, err := net.ResolveTCPAddr("tcp", dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := proxyproto.HeaderProxyFromAddrs(version, sourceAddr, destAddr).Format()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestProxyProtocolListenerRemoteAddr(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"v1 ipv4", []byte("PROXY TCP4 203.0.113.7 192.0.2.1 51234 443\r\n"), "203.0.113.7:51234"},
+		{"v1 ipv6", []byte("PROXY TCP6 2001:db8::7 2001:db8::1 51234 443\r\n"), "[2001:db8::7]:51234"},
+		{"v2 ipv4", formatProxyHeader(t, 2, "203.0.113.8:40000", "192.0.2.1:443"), "203.0.113.8:40000"},
+		{"v2 ipv6", formatProxyHeader(t, 2, "[2001:db8::8]:40000", "[2001:db8::1]:443"), "[2001:db8::8]:40000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener := NewProxyProtocolListener(inner)
+			defer listener.Close()
+
+			client, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+			_, err = client.Write(append(tt.header, "GET / HTTP/1.1\r\n"...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if got := conn.RemoteAddr().String(); got != tt.want {
+				t.Errorf("RemoteAddr() = %v, want %v", got, tt.want)
+			}
+			// the header is not part of the data the panel reads
+			buf := make([]byte, 3)
+			_, err = conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "GET" {
+				t.Errorf("Read() = %q, want %q", buf, "GET")
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/web/controller"
+	"x-ui/web/entity"
+	"x-ui/web/global"
+	"x-ui/web/service"
+	"x-ui/web/session"
+
+	"github.com/gin-gonic/gin"
+	"github.com/op/go-logging"
+	"github.com/robfig/cron/v3"
+)
+
+// newTestRouter returns the router of the panel as Start sets it up, without listening
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	s := NewServer()
+	s.cron = cron.New()
+	global.SetWebServer(s)
+	engine, err := s.initRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+// loginTestUser adds a user with the role and returns the cookies of a session it is logged
+// in with and the csrf token of the session
+func loginTestUser(t *testing.T, username string, role string) ([]*http.Cookie, string) {
+	t.Helper()
+	db := database.GetDB()
+	user := &model.User{Username: username, Password: "password", Role: role}
+	err := db.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Delete(user)
+		db.Where("user_id = ?", user.Id).Delete(model.LoginSession{})
+	})
+
+	settingService := service.SettingService{}
+	secret, err := settingService.GetSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := gin.New()
+	engine.Use(session.Sessions("session", session.NewStore(controller.GetRequestIp, secret)))
+	engine.GET("/", func(c *gin.Context) {
+		err := session.SetLoginUser(c, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := session.GetCsrfToken(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.String(http.StatusOK, token)
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Result().Cookies(), w.Body.String()
+}
+
+// doAjax sends an ajax request with the cookies and csrf token to the router
+func doAjax(engine *gin.Engine, method string, path string, cookies []*http.Cookie, csrfToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if csrfToken != "" {
+		req.Header.Set("X-CSRF-Token", csrfToken)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoleRouteGuards(t *testing.T) {
+	engine := newTestRouter(t)
+	type login struct {
+		cookies []*http.Cookie
+		token   string
+	}
+	logins := map[string]login{}
+	for _, role := range []string{model.RoleAdmin, model.RoleOperator, model.RoleReadOnly} {
+		cookies, token := loginTestUser(t, "guard-"+role, role)
+		logins[role] = login{cookies, token}
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		// allowed are the roles the route lets through
+		allowed map[string]bool
+	}{
+		{http.MethodPost, "/xui/inbound/list", map[string]bool{model.RoleAdmin: true, model.RoleOperator: true, model.RoleReadOnly: true}},
+		{http.MethodPost, "/xui/inbound/del/0", map[string]bool{model.RoleAdmin: true, model.RoleOperator: true}},
+		{http.MethodPost, "/xui/inbound/clearClientIps/nobody", map[string]bool{model.RoleAdmin: true, model.RoleOperator: true}},
+		{http.MethodPost, "/xui/setting/all", map[string]bool{model.RoleAdmin: true}},
+		{http.MethodPost, "/xui/setting/users", map[string]bool{model.RoleAdmin: true}},
+		{http.MethodPost, "/xui/setting/sessions", map[string]bool{model.RoleAdmin: true, model.RoleOperator: true, model.RoleReadOnly: true}},
+		{http.MethodPost, "/xray/transport", map[string]bool{model.RoleAdmin: true, model.RoleOperator: true, model.RoleReadOnly: true}},
+		{http.MethodPost, "/xray/fakedns/disable", map[string]bool{model.RoleAdmin: true}},
+		{http.MethodGet, "/server/banned-ips", map[string]bool{model.RoleAdmin: true}},
+		{http.MethodGet, "/server/audit-logs", map[string]bool{model.RoleAdmin: true}},
+	}
+	for _, tt := range tests {
+		for role, login := range logins {
+			t.Run(role+" "+tt.path, func(t *testing.T) {
+				w := doAjax(engine, tt.method, tt.path, login.cookies, login.token)
+				msg := entity.Msg{}
+				err := json.Unmarshal(w.Body.Bytes(), &msg)
+				if err != nil {
+					t.Fatalf("%v %v: invalid answer %v %q", tt.method, tt.path, w.Code, w.Body.String())
+				}
+				forbidden := !msg.Success && msg.Msg == "没有权限执行此操作"
+				if forbidden == tt.allowed[role] {
+					t.Errorf("%v %v as %v: forbidden = %v, want %v", tt.method, tt.path, role, forbidden, !tt.allowed[role])
+				}
+			})
+		}
+	}
+
+	// without a session nothing gets through
+	w := doAjax(engine, http.MethodPost, "/xui/inbound/list", nil, "")
+	msg := entity.Msg{}
+	err := json.Unmarshal(w.Body.Bytes(), &msg)
+	if err != nil || msg.Success {
+		t.Errorf("request without a session = %v %q", w.Code, w.Body.String())
+	}
+}
+
+var csrfTokenRegex = regexp.MustCompile(`X-CSRF-Token'\] = '([0-9a-f]+)'`)
+
+// countLoginSessions returns how many sessions are stored
+func countLoginSessions(t *testing.T) int64 {
+	t.Helper()
+	var count int64
+	err := database.GetDB().Model(model.LoginSession{}).Count(&count).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+// getLoginPage returns the cookies and the csrf token of the login page
+func getLoginPage(t *testing.T, engine *gin.Engine) ([]*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login page answered %v", w.Code)
+	}
+	matches := csrfTokenRegex.FindStringSubmatch(w.Body.String())
+	if matches == nil {
+		t.Fatal("login page has no csrf token")
+	}
+	return w.Result().Cookies(), matches[1]
+}
+
+func TestCsrf(t *testing.T) {
+	engine := newTestRouter(t)
+	db := database.GetDB()
+	user := &model.User{Username: "csrf", Password: "password", Role: model.RoleAdmin}
+	err := db.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Delete(user)
+		db.Where("user_id = ?", user.Id).Delete(model.LoginSession{})
+	})
+
+	// visitors don't get a stored session
+	sessions := countLoginSessions(t)
+	cookies, token := getLoginPage(t, engine)
+	if countLoginSessions(t) != sessions {
+		t.Error("the login page stored a session")
+	}
+	for _, cookie := range cookies {
+		if cookie.Name == "session" {
+			t.Errorf("the login page set a session cookie %v", cookie)
+		}
+	}
+	otherCookies, otherToken := getLoginPage(t, engine)
+	if otherToken == token {
+		t.Fatal("two visitors got the same csrf token")
+	}
+	forged := []*http.Cookie{{Name: "csrf_token", Value: token}}
+
+	login := func(cookies []*http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=csrf&password=password"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		token   string
+	}{
+		{"no token", cookies, ""},
+		{"no cookie", nil, token},
+		{"wrong token", cookies, otherToken},
+		{"cookie of another visitor", otherCookies, token},
+		{"unsigned cookie", forged, token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := login(tt.cookies, tt.token)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("login answered %v %q, want %v", w.Code, w.Body.String(), http.StatusForbidden)
+			}
+		})
+	}
+	if countLoginSessions(t) != sessions {
+		t.Fatal("rejected logins stored a session")
+	}
+
+	w := login(cookies, token)
+	msg := entity.Msg{}
+	err = json.Unmarshal(w.Body.Bytes(), &msg)
+	if err != nil || !msg.Success {
+		t.Fatalf("login answered %v %q", w.Code, w.Body.String())
+	}
+	if countLoginSessions(t) != sessions+1 {
+		t.Error("the login didn't store a session")
+	}
+	var sessionCookies []*http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "session" {
+			sessionCookies = append(sessionCookies, cookie)
+		}
+	}
+	if len(sessionCookies) == 0 {
+		t.Fatal("the login set no session cookie")
+	}
+
+	// logout changes the session, so it takes a post with the token of the session
+	w = doAjax(engine, http.MethodGet, "/logout", sessionCookies, "")
+	if w.Code == http.StatusOK || countLoginSessions(t) != sessions+1 {
+		t.Errorf("logout with a get answered %v", w.Code)
+	}
+	w = doAjax(engine, http.MethodPost, "/logout", sessionCookies, token)
+	if w.Code != http.StatusOK || countLoginSessions(t) != sessions+1 {
+		t.Errorf("logout without the token of the session answered %v %q", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/xui/", nil)
+	for _, cookie := range sessionCookies {
+		req.AddCookie(cookie)
+	}
+	engine.ServeHTTP(w, req)
+	matches := csrfTokenRegex.FindStringSubmatch(w.Body.String())
+	if w.Code != http.StatusOK || matches == nil {
+		t.Fatalf("panel page answered %v without a csrf token", w.Code)
+	}
+	if matches[1] == token {
+		t.Error("the login kept the csrf token of the visitor")
+	}
+	w = doAjax(engine, http.MethodPost, "/logout", sessionCookies, matches[1])
+	if w.Code != http.StatusOK || countLoginSessions(t) != sessions {
+		t.Errorf("logout answered %v %q, sessions %v", w.Code, w.Body.String(), countLoginSessions(t))
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	engine := newTestRouter(t)
+	engine.GET("/test-panic", func(c *gin.Context) {
+		panic("test panic")
+	})
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		wantHtml bool
+		wantMsg  string
+	}{
+		{"page", map[string]string{"Accept": "text/html", "Accept-Language": "en-US", "X-Request-Id": "page-request"}, true, "Internal server error, please try again later"},
+		{"translated page", map[string]string{"Accept": "text/html", "Accept-Language": "zh-CN", "X-Request-Id": "zh-request"}, true, "服务器内部错误，请稍后再试"},
+		{"ajax", map[string]string{"Accept": "text/html", "X-Requested-With": "XMLHttpRequest", "Accept-Language": "en-US", "X-Request-Id": "ajax-request"}, false, "Internal server error, please try again later"},
+		{"json", map[string]string{"Accept": "application/json", "Accept-Language": "en-US", "X-Request-Id": "json-request"}, false, "Internal server error, please try again later"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			requestId := tt.headers["X-Request-Id"]
+			req := httptest.NewRequest(http.MethodGet, "/test-panic", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("GET /test-panic = %v, want %v", w.Code, http.StatusInternalServerError)
+			}
+			if got := w.Header().Get("X-Request-Id"); got != requestId {
+				t.Errorf("X-Request-Id = %q, want %q", got, requestId)
+			}
+			body := w.Body.String()
+			if tt.wantHtml {
+				if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+					t.Errorf("Content-Type = %q, want html", w.Header().Get("Content-Type"))
+				}
+				if !strings.Contains(body, "<p>"+tt.wantMsg+"</p>") || !strings.Contains(body, requestId) {
+					t.Errorf("error page doesn't have the message and the request id:\n%s", body)
+				}
+			} else {
+				msg := entity.Msg{}
+				err := json.Unmarshal(w.Body.Bytes(), &msg)
+				if err != nil {
+					t.Fatalf("GET /test-panic answered %q: %v", body, err)
+				}
+				want := entity.Msg{Success: false, Msg: tt.wantMsg + " (" + requestId + ")"}
+				if msg.Success != want.Success || msg.Msg != want.Msg || msg.Obj != nil {
+					t.Errorf("GET /test-panic = %+v, want %+v", msg, want)
+				}
+			}
+
+			log := logs.String()
+			for _, want := range []string{
+				"panic handling GET /test-panic, request id " + requestId + ": test panic",
+				"runtime/debug.Stack",
+				"web.TestRecovery",
+			} {
+				if !strings.Contains(log, want) {
+					t.Errorf("log doesn't have %q:\n%s", want, log)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenApiRoutes(t *testing.T) {
+	setSettings(t, map[string]string{"apiTokens": "openapi-token"})
+	engine := newTestRouter(t)
+	cookies, _ := loginTestUser(t, "openapi", model.RoleAdmin)
+	get := func(path string, cookies []*http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		cookies    []*http.Cookie
+		token      string
+		wantStatus int
+	}{
+		{"logged in", cookies, "", http.StatusOK},
+		{"api token", nil, "openapi-token", http.StatusOK},
+		{"wrong api token", nil, "other-token", http.StatusUnauthorized},
+		{"anonymous", nil, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get("/openapi.json", tt.cookies, tt.token)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("GET /openapi.json = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusOK {
+				if got := w.Header().Get("WWW-Authenticate"); got != "Bearer" {
+					t.Errorf("WWW-Authenticate = %q, want Bearer", got)
+				}
+				return
+			}
+			doc := struct {
+				Paths map[string]map[string]interface{} `json:"paths"`
+			}{}
+			err := json.Unmarshal(w.Body.Bytes(), &doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the document lists the routes the router really has
+			for _, path := range []string{"/xui/inbound/list", "/server/status", "/api/v1/inbounds/{id}", "/openapi.json"} {
+				if _, ok := doc.Paths[path]; !ok {
+					t.Errorf("%v is not documented", path)
+				}
+			}
+		})
+	}
+
+	w := get("/swagger", nil, "")
+	if w.Code == http.StatusOK {
+		t.Error("the swagger ui is shown without a login")
+	}
+	w = get("/swagger", cookies, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /swagger = %v, want %v", w.Code, http.StatusOK)
+	}
+	// the ui is served with the panel assets, nothing is loaded from elsewhere
+	body := w.Body.String()
+	if !strings.Contains(body, "assets/swagger-ui-dist@") || strings.Contains(body, "https://") {
+		t.Errorf("the swagger ui doesn't load its bundle from the panel assets: %v", body)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// accessLogEmailRegex takes the token after "email:", xray versions differ on the space after the colon
+var accessLogEmailRegex = regexp.MustCompile(`email:\s*(\S+)`)
+
+// ErrXrayConfigNotFound means xray wasn't started yet, there is no access log to look at before it is
+var ErrXrayConfigNotFound = errors.New("xray config not found")
+
+type AccessLogService struct {
+	settingService SettingService
+}
+
+// GetEmailRegex returns the regex used to find client emails in the access log,
+// the configured override if there is a valid one
+func (s *AccessLogService) GetEmailRegex() *regexp.Regexp {
+	pattern, err := s.settingService.GetAccessLogEmailRegex()
+	if err != nil || pattern == "" {
+		return accessLogEmailRegex
+	}
+	emailRegex, err := regexp.Compile(pattern)
+	if err != nil || emailRegex.NumSubexp() < 1 {
+		return accessLogEmailRegex
+	}
+	return emailRegex
+}
+
+// ExtractAccessLogEmail returns the first capture group of emailRegex in the line
+func ExtractAccessLogEmail(line string, emailRegex *regexp.Regexp) string {
+	matches := emailRegex.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(matches[1])
+}
+
+// GetAccessLogPath returns the access log path xray is running with, empty if access log is off
+func (s *AccessLogService) GetAccessLogPath() (string, error) {
+	configPath := xray.GetConfigPath()
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%w: %v", ErrXrayConfigNotFound, configPath)
+	} else if err != nil {
+		return "", common.NewErrorf("read xray config %v failed: %v", configPath, err)
+	}
+	config := struct {
+		Log struct {
+			Access string `json:"access"`
+		} `json:"log"`
+	}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return "", common.NewErrorf("xray config %v is invalid: %v", configPath, err)
+	}
+	return config.Log.Access, nil
+}
+
+// CheckXrayConfig returns why the config xray runs with is missing or invalid, nil if it is fine
+func (s *AccessLogService) CheckXrayConfig() error {
+	_, err := s.GetAccessLogPath()
+	return err
+}
+
+// NormalizeIp returns the canonical form of the ip, ipv4 mapped ipv6 addresses become
+// plain ipv4 so a client isn't counted twice, empty if it is not an ip
+func NormalizeIp(ip string) string {
+	parsed := net.ParseIP(strings.Trim(ip, "[]"))
+	if parsed == nil {
+		return ""
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.String()
+	}
+	return parsed.String()
+}
+
+// parseLogAddress returns the ip of a log address like 1.2.3.4:80, [2001:db8::1]:80 or tcp:1.2.3.4:80
+func parseLogAddress(field string) string {
+	for _, network := range []string{"tcp:", "udp:"} {
+		field = strings.TrimPrefix(field, network)
+	}
+	if host, _, err := net.SplitHostPort(field); err == nil {
+		field = host
+	}
+	return NormalizeIp(field)
+}
+
+// ExtractAccessLogIp returns the source ip of an access log line, it is the first address
+// in the line and comes before the destination
+func ExtractAccessLogIp(line string) string {
+	for _, field := range strings.Fields(line) {
+		if ip := parseLogAddress(field); ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// ParseAccessLogLine returns the source ip and client email of an access log line
+func ParseAccessLogLine(line string, emailRegex *regexp.Regexp) (string, string) {
+	return ExtractAccessLogIp(line), ExtractAccessLogEmail(line, emailRegex)
+}
+
+// SearchAccessLog returns matching lines of the access log, the log is read
+// line by line so big logs are never loaded into memory at once
+func (s *AccessLogService) SearchAccessLog(email string, ip string, offset int, limit int) ([]string, error) {
+	path, err := s.GetAccessLogPath()
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0)
+	if path == "" || path == "none" {
+		return lines, nil
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return lines, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	emailRegex := s.GetEmailRegex()
+	if normalized := NormalizeIp(ip); normalized != "" {
+		ip = normalized
+	}
+	matched := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineIp, lineEmail := ParseAccessLogLine(line, emailRegex)
+		if email != "" && lineEmail != email {
+			continue
+		}
+		if ip != "" && lineIp != ip {
+			continue
+		}
+		matched++
+		if matched <= offset {
+			continue
+		}
+		lines = append(lines, line)
+		if len(lines) >= limit {
+			break
+		}
+	}
+	return lines, scanner.Err()
+}
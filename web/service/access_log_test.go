@@ -0,0 +1,178 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// useAccessLog runs the test in a dir whose bin/config.json points xray's access log at a file with lines
+func useAccessLog(t *testing.T, lines []string) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	logPath := filepath.Join(dir, "access.log")
+	err = os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := json.Marshal(map[string]interface{}{"log": map[string]string{"access": logPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll("bin", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join("bin", "config.json"), config, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSearchAccessLog(t *testing.T) {
+	fixture := []string{
+		"2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email: alice",
+		"2024/01/02 10:00:01 5.6.7.8:5001 accepted tcp:example.com:443 [inbound-1 >> direct] email: bob",
+		"2024/01/02 10:00:02 [::ffff:1.2.3.4]:5002 accepted tcp:example.org:443 [inbound-1 >> direct] email: alice",
+		"2024/01/02 10:00:03 tcp:[2001:db8::1]:5003 accepted udp:1.1.1.1:53 [inbound-2 >> direct] email: alice",
+		"2024/01/02 10:00:04 1.2.3.4:5004 accepted tcp:example.net:80 [inbound-1 >> direct] email: bob",
+		"2024/01/02 10:00:05 1.2.3.4:5005 accepted tcp:example.com:443 [inbound-1 >> direct] email: alice2",
+	}
+	useAccessLog(t, fixture)
+
+	tests := []struct {
+		name   string
+		email  string
+		ip     string
+		offset int
+		limit  int
+		want   []int
+	}{
+		{"everything", "", "", 0, 100, []int{0, 1, 2, 3, 4, 5}},
+		{"by email", "alice", "", 0, 100, []int{0, 2, 3}},
+		{"by ip", "", "1.2.3.4", 0, 100, []int{0, 2, 4, 5}},
+		{"by ipv4 mapped ip", "", "::ffff:1.2.3.4", 0, 100, []int{0, 2, 4, 5}},
+		{"by ipv6", "", "2001:db8::1", 0, 100, []int{3}},
+		{"by email and ip", "alice", "1.2.3.4", 0, 100, []int{0, 2}},
+		{"limit", "", "1.2.3.4", 0, 2, []int{0, 2}},
+		{"offset", "", "1.2.3.4", 1, 100, []int{2, 4, 5}},
+		{"offset and limit", "", "1.2.3.4", 1, 2, []int{2, 4}},
+		{"offset past the matches", "alice", "", 3, 100, []int{}},
+		{"no matches", "carol", "", 0, 100, []int{}},
+	}
+	s := &AccessLogService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.SearchAccessLog(tt.email, tt.ip, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := make([]string, 0, len(tt.want))
+			for _, i := range tt.want {
+				want = append(want, fixture[i])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SearchAccessLog(%q, %q, %v, %v) = %q, want %q", tt.email, tt.ip, tt.offset, tt.limit, got, want)
+			}
+		})
+	}
+}
+
+func TestExtractAccessLogEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		line    string
+		want    string
+	}{
+		{"space after the colon", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email: alice", "alice"},
+		{"no space after the colon", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email:alice", "alice"},
+		{"email with a tag suffix", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct] email: alice@inbound-1", "alice@inbound-1"},
+		{"several spaces and trailing space", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 email:   bob  ", "bob"},
+		{"email before more fields", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 email: carol [inbound-1 -> direct]", "carol"},
+		{"no email", "", "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 [inbound-1 >> direct]", ""},
+		{"override", `user=(\S+)`, "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 user=dave", "dave"},
+		// an override without a capture group can't yield the email, the default is used
+		{"override without a group", `user=\S+`, "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 email: erin", "erin"},
+		{"invalid override", `user=(\S+`, "2024/01/02 10:00:00 1.2.3.4:5000 accepted tcp:example.com:443 email: frank", "frank"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanSettings(t)
+			if tt.pattern != "" {
+				err := database.GetDB().Create(&model.Setting{Key: "accessLogEmailRegex", Value: tt.pattern}).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := &AccessLogService{}
+			if got := ExtractAccessLogEmail(tt.line, s.GetEmailRegex()); got != tt.want {
+				t.Errorf("ExtractAccessLogEmail(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckXrayConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantErr      string
+		wantNotFound bool
+	}{
+		{"valid", `{"log": {"access": "/var/log/xray/access.log"}}`, "", false},
+		{"access log off", `{"log": {}}`, "", false},
+		{"missing", "", "xray config not found", true},
+		{"malformed", `{"log": {"access": `, "is invalid", false},
+	}
+	serverService := ServerService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAccessLog(t, nil)
+			if tt.config == "" {
+				os.Remove(filepath.Join("bin", "config.json"))
+			} else {
+				err := os.WriteFile(filepath.Join("bin", "config.json"), []byte(tt.config), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := (&AccessLogService{}).CheckXrayConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckXrayConfig() = %v, want nil", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckXrayConfig() = %v, want %q", err, tt.wantErr)
+			}
+			// a missing config is told apart, it is expected until xray first starts
+			if notFound := errors.Is(err, ErrXrayConfigNotFound); notFound != tt.wantNotFound {
+				t.Errorf("errors.Is(%v, ErrXrayConfigNotFound) = %v", err, notFound)
+			}
+			// the status the dashboard polls shows the problem
+			status := serverService.GetStatus(nil)
+			if got := status.Xray.ConfigError; (got == "") != (tt.wantErr == "") || !strings.Contains(got, tt.wantErr) {
+				t.Errorf("status xray configError = %q, want %q", got, tt.wantErr)
+			}
+		})
+	}
+}
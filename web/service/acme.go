@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/util/common"
+
+	"golang.org/x/crypto/acme"
+)
+
+// acmeIssueTimeout bounds a whole issuance, dns changes take most of it
+const acmeIssueTimeout = time.Minute * 10
+
+// acmeDnsPropagationTimeout is how long a challenge record is looked up before the
+// challenge is answered anyway, let's encrypt asks the authoritative servers, not ours
+const acmeDnsPropagationTimeout = time.Minute * 2
+
+// acmeRenewBefore is how long before it expires a certificate is renewed
+const acmeRenewBefore = time.Hour * 24 * 30
+
+// acmeDnsLock keeps the renewal job and the issuance at start from ordering at once
+var acmeDnsLock sync.Mutex
+
+// acmeDnsProvider adds the txt records of dns-01 challenges
+type acmeDnsProvider interface {
+	// addTxtRecord adds the record and returns a function removing it
+	addTxtRecord(ctx context.Context, name string, value string) (func(), error)
+}
+
+// AcmeService gets and renews the panel certificate with the dns-01 challenge, http-01
+// certificates are handled by autocert when the panel starts
+type AcmeService struct {
+	settingService SettingService
+}
+
+func getAcmeDnsDir() string {
+	return filepath.Join(config.GetDataDir(), "acme", "dns")
+}
+
+// GetDnsCertFiles returns the files the certificate of the domain is kept in
+func (s *AcmeService) GetDnsCertFiles(domain string) (string, string) {
+	name := strings.ReplaceAll(domain, "*", "_")
+	dir := getAcmeDnsDir()
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// IsDnsMode reports whether the panel certificate comes from the dns-01 challenge
+func (s *AcmeService) IsDnsMode() bool {
+	certMode, err := s.settingService.GetCertMode()
+	if err != nil || certMode != "acme" {
+		return false
+	}
+	challenge, err := s.settingService.GetAcmeChallenge()
+	return err == nil && challenge == "dns-01"
+}
+
+// needsDnsCert reports whether the certificate in certFile is missing or about to expire
+func needsDnsCert(certFile string) bool {
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return true
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return time.Until(cert.NotAfter) < acmeRenewBefore
+}
+
+// RenewDnsCert gets a certificate for the configured domain when there is none yet or it
+// expires within 30 days, the panel picks the new files up without restarting
+func (s *AcmeService) RenewDnsCert() error {
+	acmeDnsLock.Lock()
+	defer acmeDnsLock.Unlock()
+
+	domain, err := s.settingService.GetAcmeDomain()
+	if err != nil {
+		return err
+	}
+	if domain == "" {
+		return common.NewError("acme cert mode needs a domain")
+	}
+	certFile, keyFile := s.GetDnsCertFiles(domain)
+	if !needsDnsCert(certFile) {
+		return nil
+	}
+	provider, err := s.getDnsProvider()
+	if err != nil {
+		return err
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), acmeIssueTimeout)
+	defer cancel()
+	logger.Info("requesting certificate with dns-01 for", domain)
+	certPem, keyPem, err := issueDnsCert(ctx, provider, domain, email)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(keyFile, keyPem, 0600)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(certFile, certPem, 0644)
+	if err != nil {
+		return err
+	}
+	logger.Info("certificate issued for", domain)
+	return nil
+}
+
+func (s *AcmeService) getDnsProvider() (acmeDnsProvider, error) {
+	name, err := s.settingService.GetAcmeDnsProvider()
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.settingService.GetAcmeDnsToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, common.NewError("the dns-01 acme challenge needs a dns api token")
+	}
+	switch name {
+	case "cloudflare":
+		return &cloudflareDnsProvider{token: token}, nil
+	default:
+		return nil, common.NewError("unknown acme dns provider:", name)
+	}
+}
+
+// writeFileAtomic writes the file through a temporary one, so readers never see half of it
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// getAcmeAccountKey returns the key of the acme account, making it the first time
+func getAcmeAccountKey() (crypto.Signer, error) {
+	path := filepath.Join(getAcmeDnsDir(), "account.key")
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, common.NewError("acme account key is not pem:", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// issueDnsCert orders a certificate for the domain from let's encrypt, proving control of it
+// with the dns-01 challenge, and returns the pem certificate chain and key
+func issueDnsCert(ctx context.Context, provider acmeDnsProvider, domain string, email string) ([]byte, []byte, error) {
+	accountKey, err := getAcmeAccountKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: acme.LetsEncryptURL,
+	}
+	account := &acme.Account{}
+	if email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	_, err = client.Register(ctx, account, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, authzUrl := range order.AuthzURLs {
+		err = authorizeDns(ctx, client, provider, authzUrl)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var certPem []byte
+	for _, der := range chain {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem, nil
+}
+
+// authorizeDns answers the dns-01 challenge of the authorization, the record is removed
+// once the authorization is decided
+func authorizeDns(ctx context.Context, client *acme.Client, provider acmeDnsProvider, authzUrl string) error {
+	authz, err := client.GetAuthorization(ctx, authzUrl)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return common.NewError("acme server offers no dns-01 challenge for", authz.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+	// wildcard authorizations are for the base domain
+	name := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+	remove, err := provider.addTxtRecord(ctx, name, value)
+	if err != nil {
+		return err
+	}
+	defer remove()
+	waitTxtRecord(ctx, name, value)
+
+	_, err = client.Accept(ctx, challenge)
+	if err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// waitTxtRecord waits until the record can be looked up, up to acmeDnsPropagationTimeout
+func waitTxtRecord(ctx context.Context, name string, value string) {
+	deadline := time.Now().Add(acmeDnsPropagationTimeout)
+	for time.Now().Before(deadline) {
+		values, _ := net.DefaultResolver.LookupTXT(ctx, name)
+		for _, v := range values {
+			if v == value {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 5):
+		}
+	}
+	logger.Warning("acme challenge record not visible yet, answering anyway:", name)
+}
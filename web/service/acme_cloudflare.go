@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+const cloudflareApiUrl = "https://api.cloudflare.com/client/v4"
+
+const cloudflareTimeout = time.Second * 30
+
+// cloudflareResponseMax is the most bytes read from an answer of the api
+const cloudflareResponseMax = 1 << 20
+
+var cloudflareClient = &http.Client{Timeout: cloudflareTimeout}
+
+// cloudflareDnsProvider adds challenge records through the cloudflare api, the token needs
+// the dns edit permission of the zone
+type cloudflareDnsProvider struct {
+	token string
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (p *cloudflareDnsProvider) request(ctx context.Context, method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, cloudflareApiUrl+path, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+p.token)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := cloudflareClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	cfResponse := &cloudflareResponse{}
+	err = json.NewDecoder(io.LimitReader(response.Body, cloudflareResponseMax)).Decode(cfResponse)
+	if err != nil {
+		return common.NewErrorf("cloudflare api answered %v: %v", response.Status, err)
+	}
+	if !cfResponse.Success {
+		messages := make([]string, 0, len(cfResponse.Errors))
+		for _, e := range cfResponse.Errors {
+			messages = append(messages, e.Message)
+		}
+		return common.NewErrorf("cloudflare api failed: %v", strings.Join(messages, "; "))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(cfResponse.Result, result)
+}
+
+// getZoneId returns the id of the zone the name is in, trying the name and then its parents
+func (p *cloudflareDnsProvider) getZoneId(ctx context.Context, name string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zone := strings.Join(labels[i:], ".")
+		var zones []struct {
+			Id string `json:"id"`
+		}
+		err := p.request(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones)
+		if err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].Id, nil
+		}
+	}
+	return "", common.NewError("no cloudflare zone the token can see holds", name)
+}
+
+func (p *cloudflareDnsProvider) addTxtRecord(ctx context.Context, name string, value string) (func(), error) {
+	zoneId, err := p.getZoneId(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	record := struct {
+		Id string `json:"id"`
+	}{}
+	err = p.request(ctx, http.MethodPost, "/zones/"+zoneId+"/dns_records", map[string]interface{}{
+		"type":    "TXT",
+		"name":    name,
+		"content": value,
+		"ttl":     120,
+	}, &record)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		// the issuance context may be over, removing the record gets its own time
+		ctx, cancel := context.WithTimeout(context.Background(), cloudflareTimeout)
+		defer cancel()
+		err := p.request(ctx, http.MethodDelete, "/zones/"+zoneId+"/dns_records/"+record.Id, nil, nil)
+		if err != nil {
+			logger.Warning("remove acme challenge record failed:", err)
+		}
+	}, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// usageAlertPercent is the share of a quota which is warned about before it is used up
+const usageAlertPercent = 80
+
+const (
+	UsageAlertExpired  = "expired"
+	UsageAlertExpiring = "expiring"
+	UsageAlertTraffic  = "traffic"
+)
+
+// UsageAlert tells an inbound or a client is about to expire, expired or used most of its quota
+type UsageAlert struct {
+	// Key is the same for the same alert on every check
+	Key  string
+	Kind string
+	// ClientEmail is the client the alert is about, empty for an inbound
+	ClientEmail string
+	Subject     string
+	Body        string
+}
+
+type AlertService struct {
+	inboundService InboundService
+}
+
+// getUsageLevel returns 100 when the quota is used up, usageAlertPercent when most of it is, 0 otherwise
+func getUsageLevel(used int64, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	if used >= total {
+		return 100
+	}
+	if used*100 >= total*usageAlertPercent {
+		return usageAlertPercent
+	}
+	return 0
+}
+
+// getUsageAlerts returns the alerts of something named name with the given usage and expiry
+func getUsageAlerts(key string, name string, used int64, total int64, expiryTime int64, now time.Time, expireDays int) []*UsageAlert {
+	alerts := make([]*UsageAlert, 0)
+	nowMs := now.Unix() * 1000
+	expiry := time.Unix(expiryTime/1000, 0).Format("2006-01-02 15:04:05")
+	if expiryTime > 0 && expiryTime <= nowMs {
+		alerts = append(alerts, &UsageAlert{
+			Key:     key + ":expired",
+			Kind:    UsageAlertExpired,
+			Subject: fmt.Sprintf("%v 已到期", name),
+			Body:    fmt.Sprintf("%v 已于 %v 到期\r\n", name, expiry),
+		})
+	} else if expiryTime > 0 && expiryTime-nowMs <= int64(expireDays)*24*3600*1000 {
+		alerts = append(alerts, &UsageAlert{
+			Key:     key + ":expiring",
+			Kind:    UsageAlertExpiring,
+			Subject: fmt.Sprintf("%v 即将到期", name),
+			Body:    fmt.Sprintf("%v 将于 %v 到期\r\n", name, expiry),
+		})
+	}
+	level := getUsageLevel(used, total)
+	if level > 0 {
+		alerts = append(alerts, &UsageAlert{
+			Key:     fmt.Sprintf("%v:traffic%v", key, level),
+			Kind:    UsageAlertTraffic,
+			Subject: fmt.Sprintf("%v 已使用 %v%% 流量", name, level),
+			Body:    fmt.Sprintf("%v 已使用 %v，共 %v\r\n", name, common.FormatTraffic(used), common.FormatTraffic(total)),
+		})
+	}
+	return alerts
+}
+
+// GetUsageAlerts returns the alerts of every inbound and client, expireDays is how early expiry is warned about
+func (s *AlertService) GetUsageAlerts(now time.Time, expireDays int) ([]*UsageAlert, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	clientTraffics, err := s.inboundService.getClientTraffics()
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make([]*UsageAlert, 0)
+	for _, inbound := range inbounds {
+		name := fmt.Sprintf("入站 %v (%v)", inbound.Remark, inbound.Port)
+		key := fmt.Sprintf("inbound:%v", inbound.Id)
+		alerts = append(alerts, getUsageAlerts(key, name, inbound.Up+inbound.Down, inbound.Total, inbound.ExpiryTime, now, expireDays)...)
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email == "" {
+				continue
+			}
+			var used int64
+			if traffic := clientTraffics[client.Email]; traffic != nil {
+				used = traffic.Up + traffic.Down
+			}
+			name := fmt.Sprintf("用户 %v", client.Email)
+			key := fmt.Sprintf("client:%v", client.Email)
+			for _, alert := range getUsageAlerts(key, name, used, client.TotalGB, client.ExpiryTime, now, expireDays) {
+				alert.ClientEmail = client.Email
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+	return alerts, nil
+}
+
+// GetNewAlerts returns the alerts not sent on the channel yet, the sent alerts which
+// don't hold anymore are forgotten
+func (s *AlertService) GetNewAlerts(channel string, alerts []*UsageAlert) ([]*UsageAlert, error) {
+	db := database.GetDB()
+	sentAlerts := make([]*model.SentAlert, 0)
+	err := db.Where("key LIKE ?", channel+":%").Find(&sentAlerts).Error
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		current[channel+":"+alert.Key] = true
+	}
+	sent := make(map[string]bool, len(sentAlerts))
+	for _, sentAlert := range sentAlerts {
+		if !current[sentAlert.Key] {
+			err = db.Delete(sentAlert).Error
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		sent[sentAlert.Key] = true
+	}
+	newAlerts := make([]*UsageAlert, 0)
+	for _, alert := range alerts {
+		if !sent[channel+":"+alert.Key] {
+			newAlerts = append(newAlerts, alert)
+		}
+	}
+	return newAlerts, nil
+}
+
+func (s *AlertService) SetAlertSent(channel string, alert *UsageAlert) error {
+	return database.GetDB().Create(&model.SentAlert{Key: channel + ":" + alert.Key}).Error
+}
+
+// formatAlerts joins the alerts into one message
+func formatAlerts(alerts []*UsageAlert) string {
+	bodies := make([]string, 0, len(alerts))
+	for _, alert := range alerts {
+		bodies = append(bodies, alert.Body)
+	}
+	return strings.Join(bodies, "")
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"gorm.io/gorm"
+)
+
+// auditRedacted replaces the values of secrets in the params and diffs of audit logs
+const auditRedacted = "******"
+
+// auditSecretParams are the param and field names, besides the secret settings, whose values
+// stay out of audit logs, names are matched case insensitively
+var auditSecretParams = map[string]bool{
+	"password":    true,
+	"oldpassword": true,
+	"newpassword": true,
+	"code":        true,
+	"totpcode":    true,
+	"secret":      true,
+	"token":       true,
+}
+
+// auditSecret holds the value of a secret in flattened fields, so diffs tell it changed
+// without showing it
+type auditSecret struct {
+	value interface{}
+}
+
+type AuditLogQuery struct {
+	Username string
+	Path     string
+	// Since and Until are in seconds, 0 means no bound
+	Since int64
+	Until int64
+}
+
+type AuditService struct {
+}
+
+func isAuditSecret(name string) bool {
+	return secretSettings[name] || auditSecretParams[strings.ToLower(name)]
+}
+
+func (s *AuditService) AddAuditLog(auditLog *model.AuditLog) error {
+	if auditLog.CreatedAt == 0 {
+		auditLog.CreatedAt = time.Now().Unix()
+	}
+	return database.GetDB().Create(auditLog).Error
+}
+
+func (s *AuditService) queryAuditLogs(query *AuditLogQuery) *gorm.DB {
+	db := database.GetDB().Model(model.AuditLog{})
+	if query.Username != "" {
+		db = db.Where("username = ?", query.Username)
+	}
+	if query.Path != "" {
+		db = db.Where("path like ?", "%"+query.Path+"%")
+	}
+	if query.Since > 0 {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	if query.Until > 0 {
+		db = db.Where("created_at < ?", query.Until)
+	}
+	return db
+}
+
+// GetAuditLogs returns a page of the matching audit logs, newest first, with how many match
+func (s *AuditService) GetAuditLogs(query *AuditLogQuery, page int, pageSize int) ([]*model.AuditLog, int64, error) {
+	var total int64
+	err := s.queryAuditLogs(query).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	auditLogs := make([]*model.AuditLog, 0)
+	err = s.queryAuditLogs(query).
+		Order("id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&auditLogs).
+		Error
+	return auditLogs, total, err
+}
+
+// GetAllAuditLogs returns every matching audit log, oldest first, for exports
+func (s *AuditService) GetAllAuditLogs(query *AuditLogQuery) ([]*model.AuditLog, error) {
+	auditLogs := make([]*model.AuditLog, 0)
+	err := s.queryAuditLogs(query).Order("id").Find(&auditLogs).Error
+	return auditLogs, err
+}
+
+func (s *AuditService) DelAuditLogsBefore(t time.Time) error {
+	return database.GetDB().Where("created_at < ?", t.Unix()).Delete(model.AuditLog{}).Error
+}
+
+// RedactAuditParams returns the params as json with the values of secrets replaced
+func RedactAuditParams(params interface{}) string {
+	data, err := json.Marshal(redactAuditValue(toAuditValue(params)))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// toAuditValue turns the value into the maps, slices and scalars json decodes to
+func toAuditValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+func redactAuditValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if isAuditSecret(key) {
+				value[key] = auditRedacted
+			} else {
+				value[key] = redactAuditValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactAuditValue(child)
+		}
+	}
+	return v
+}
+
+// flattenAuditValue adds the leaves of the value to fields by their dotted paths, strings
+// holding json objects or arrays, like the settings of inbounds, are flattened too
+func flattenAuditValue(fields map[string]interface{}, path string, v interface{}) {
+	if s, ok := v.(string); ok && (strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[")) {
+		var value interface{}
+		if json.Unmarshal([]byte(s), &value) == nil {
+			v = value
+		}
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if isAuditSecret(key) {
+				fields[childPath] = auditSecret{child}
+			} else {
+				flattenAuditValue(fields, childPath, child)
+			}
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			fields[path] = value
+		}
+		for i, child := range value {
+			flattenAuditValue(fields, path+"["+strconv.Itoa(i)+"]", child)
+		}
+	default:
+		fields[path] = value
+	}
+}
+
+// GetAuditDiff returns the fields that differ between before and after as json, each with
+// its value before and after, a nil before or after stands for what doesn't exist
+func GetAuditDiff(before interface{}, after interface{}) string {
+	beforeFields := map[string]interface{}{}
+	afterFields := map[string]interface{}{}
+	if value := toAuditValue(before); value != nil {
+		flattenAuditValue(beforeFields, "", value)
+	}
+	if value := toAuditValue(after); value != nil {
+		flattenAuditValue(afterFields, "", value)
+	}
+	redact := func(v interface{}) interface{} {
+		if _, ok := v.(auditSecret); ok {
+			return auditRedacted
+		}
+		return v
+	}
+	diff := map[string][2]interface{}{}
+	for path, value := range beforeFields {
+		afterValue, ok := afterFields[path]
+		if !ok || !reflect.DeepEqual(value, afterValue) {
+			diff[path] = [2]interface{}{redact(value), redact(afterValue)}
+		}
+	}
+	for path, value := range afterFields {
+		if _, ok := beforeFields[path]; !ok {
+			diff[path] = [2]interface{}{nil, redact(value)}
+		}
+	}
+	if len(diff) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedactAuditParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params interface{}
+		want   string
+	}{
+		{"login", map[string]interface{}{"username": "admin", "password": "hunter2", "totpCode": "123456"},
+			`{"password":"******","totpCode":"******","username":"admin"}`},
+		{"names in any case", map[string]interface{}{"NewPassword": "hunter2", "OLDPASSWORD": "hunter1"},
+			`{"NewPassword":"******","OLDPASSWORD":"******"}`},
+		{"secret settings", map[string]interface{}{"tgBotToken": "bot token", "smtpPassword": "smtp", "oidcClientSecret": "oidc", "webPort": 54321},
+			`{"oidcClientSecret":"******","smtpPassword":"******","tgBotToken":"******","webPort":54321}`},
+		{"nested", map[string]interface{}{"users": []interface{}{
+			map[string]interface{}{"username": "a", "password": "1"},
+			map[string]interface{}{"username": "b", "password": map[string]interface{}{"hash": "2"}},
+		}}, `{"users":[{"password":"******","username":"a"},{"password":"******","username":"b"}]}`},
+		{"struct", struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}{"admin", "hunter2"}, `{"password":"******","username":"admin"}`},
+		{"no params", nil, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RedactAuditParams(tt.params)
+			if got != tt.want {
+				t.Errorf("RedactAuditParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAuditDiffRedactsSecrets(t *testing.T) {
+	before := map[string]interface{}{
+		"remark":   "old",
+		"settings": `{"clients":[{"email":"a","password":"old secret"}]}`,
+		"secret":   "old session secret",
+	}
+	after := map[string]interface{}{
+		"remark":   "new",
+		"settings": `{"clients":[{"email":"a","password":"new secret"},{"email":"b","password":"b secret"}]}`,
+		"secret":   "old session secret",
+	}
+	got := GetAuditDiff(before, after)
+	for _, secret := range []string{"old secret", "new secret", "b secret", "old session secret"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("GetAuditDiff() = %v shows %q", got, secret)
+		}
+	}
+	diff := map[string][2]interface{}{}
+	err := json.Unmarshal([]byte(got), &diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]interface{}{
+		"remark":                       {"old", "new"},
+		"settings.clients[0].password": {auditRedacted, auditRedacted},
+		"settings.clients[1].email":    {nil, "b"},
+		"settings.clients[1].password": {nil, auditRedacted},
+	}
+	if len(diff) != len(want) {
+		t.Errorf("GetAuditDiff() = %v, want %v", diff, want)
+	}
+	for path, values := range want {
+		if diff[path] != values {
+			t.Errorf("diff of %v = %v, want %v", path, diff[path], values)
+		}
+	}
+}
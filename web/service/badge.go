@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"time"
+	"x-ui/util/common"
+)
+
+const (
+	badgeColorGreen  = "#4c1"
+	badgeColorYellow = "#dfb317"
+	badgeColorRed    = "#e05d44"
+)
+
+// badge text is drawn with a fixed width per char, close enough for the short strings used here
+const badgeCharWidth = 7
+
+// getRemaining returns the remaining days and bytes of the subscription, -1 means unlimited
+func (info *SubInfo) getRemaining(now time.Time) (days int64, traffic int64) {
+	days, traffic = -1, -1
+	if info.Expire > 0 {
+		days = (info.Expire - now.Unix()*1000) / (24 * 3600 * 1000)
+		if days < 0 {
+			days = 0
+		}
+	}
+	if info.Total > 0 {
+		traffic = info.Total - info.Up - info.Down
+		if traffic < 0 {
+			traffic = 0
+		}
+	}
+	return
+}
+
+func (info *SubInfo) getBadgeColor(now time.Time) string {
+	days, traffic := info.getRemaining(now)
+	expired := info.Expire > 0 && info.Expire <= now.Unix()*1000
+	if expired || traffic == 0 || (days >= 0 && days < 3) || (traffic > 0 && traffic*10 < info.Total) {
+		return badgeColorRed
+	}
+	if (days >= 0 && days < 7) || (traffic > 0 && traffic*4 < info.Total) {
+		return badgeColorYellow
+	}
+	return badgeColorGreen
+}
+
+// RenderBadge renders the remaining days and traffic as a shields.io style svg
+func (info *SubInfo) RenderBadge(now time.Time) string {
+	days, traffic := info.getRemaining(now)
+	dayText := "∞"
+	if days >= 0 {
+		dayText = fmt.Sprintf("%dd", days)
+	}
+	trafficText := "∞"
+	if traffic >= 0 {
+		trafficText = common.FormatTraffic(traffic)
+	}
+	label := "remaining"
+	value := html.EscapeString(dayText + " / " + trafficText)
+	color := info.getBadgeColor(now)
+
+	labelWidth := len([]rune(label))*badgeCharWidth + 10
+	valueWidth := len([]rune(dayText+" / "+trafficText))*badgeCharWidth + 10
+	width := labelWidth + valueWidth
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<rect width="%d" height="20" fill="#555"/>`+
+		`<rect x="%d" width="%d" height="20" fill="%s"/>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="14">%s</text>`+
+		`</g></svg>`,
+		width, label, value,
+		labelWidth,
+		labelWidth, valueWidth, color,
+		labelWidth/2, label,
+		labelWidth+valueWidth/2, value)
+}
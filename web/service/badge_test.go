@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderBadge(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	const gb = int64(1024 * 1024 * 1024)
+	inDays := func(days int) int64 {
+		return now.Add(time.Hour*24*time.Duration(days)+time.Hour).Unix() * 1000
+	}
+	tests := []struct {
+		name      string
+		info      SubInfo
+		wantValue string
+		wantColor string
+	}{
+		{"plenty left", SubInfo{Up: gb, Down: gb, Total: 10 * gb, Expire: inDays(30)}, "30d / 8.00GB", badgeColorGreen},
+		{"unlimited", SubInfo{Up: gb, Down: gb}, "∞ / ∞", badgeColorGreen},
+		{"a week left", SubInfo{Total: 10 * gb, Expire: inDays(6)}, "6d / 10.00GB", badgeColorYellow},
+		{"a quarter of the data left", SubInfo{Up: 4 * gb, Down: 4 * gb, Total: 10 * gb, Expire: inDays(30)}, "30d / 2.00GB", badgeColorYellow},
+		{"days almost over", SubInfo{Total: 10 * gb, Expire: inDays(2)}, "2d / 10.00GB", badgeColorRed},
+		{"data almost used", SubInfo{Down: 9*gb + gb/2, Total: 10 * gb}, "∞ / 512.00MB", badgeColorRed},
+		{"data used", SubInfo{Up: 6 * gb, Down: 6 * gb, Total: 10 * gb}, "∞ / 0.00B", badgeColorRed},
+		{"expired", SubInfo{Expire: now.Add(-time.Hour).Unix() * 1000}, "0d / ∞", badgeColorRed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svg := tt.info.RenderBadge(now)
+			if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") {
+				t.Fatalf("RenderBadge() = %q, want an svg", svg)
+			}
+			if !strings.Contains(svg, `aria-label="remaining: `+tt.wantValue+`"`) || !strings.Contains(svg, ">"+tt.wantValue+"</text>") {
+				t.Errorf("RenderBadge() = %q, want the value %q", svg, tt.wantValue)
+			}
+			if !strings.Contains(svg, `fill="`+tt.wantColor+`"`) {
+				t.Errorf("RenderBadge() = %q, want the color %v", svg, tt.wantColor)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm/clause"
+)
+
+type BanService struct {
+}
+
+// IsBanned reports whether the ip is banned now
+func (s *BanService) IsBanned(ip string) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(model.BannedIp{}).
+		Where("ip = ? and (expires_at = 0 or expires_at > ?)", ip, time.Now().Unix()).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// Ban bans the ip for duration, forever when it is 0, replacing any ban it had
+func (s *BanService) Ban(ip string, reason string, duration time.Duration) error {
+	if net.ParseIP(ip) == nil {
+		return common.NewError("not a valid ip:", ip)
+	}
+	now := time.Now()
+	bannedIp := &model.BannedIp{
+		Ip:        ip,
+		Reason:    reason,
+		CreatedAt: now.Unix(),
+	}
+	if duration > 0 {
+		bannedIp.ExpiresAt = now.Add(duration).Unix()
+	}
+	return database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ip"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "created_at", "expires_at"}),
+	}).Create(bannedIp).Error
+}
+
+func (s *BanService) Unban(ip string) error {
+	result := database.GetDB().Where("ip = ?", ip).Delete(model.BannedIp{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewError("ip is not banned:", ip)
+	}
+	return nil
+}
+
+// GetBans returns the bans in force, forgetting the expired ones
+func (s *BanService) GetBans() ([]*model.BannedIp, error) {
+	db := database.GetDB()
+	now := time.Now().Unix()
+	err := db.Where("expires_at != 0 and expires_at <= ?", now).Delete(model.BannedIp{}).Error
+	if err != nil {
+		return nil, err
+	}
+	bans := make([]*model.BannedIp, 0)
+	err = db.Model(model.BannedIp{}).Order("created_at desc").Find(&bans).Error
+	return bans, err
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"x-ui/config"
+	"x-ui/util/common"
+)
+
+const MaxLogoSize = 512 * 1024
+
+// getDataDir is where the logo is stored, tests replace it
+var getDataDir = config.GetDataDir
+
+// logoTypes are the accepted logo content types, svg is left out since it can carry scripts
+var logoTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type BrandingService struct {
+	settingService SettingService
+}
+
+// GetLogoPath returns the path of the uploaded logo, empty if there is none
+func (s *BrandingService) GetLogoPath() (string, error) {
+	logo, err := s.settingService.GetPanelLogo()
+	if err != nil || logo == "" {
+		return "", err
+	}
+	return filepath.Join(getDataDir(), logo), nil
+}
+
+// SaveLogo checks the image and stores it in the data directory, replacing the old logo
+func (s *BrandingService) SaveLogo(data []byte) error {
+	if len(data) == 0 {
+		return common.NewError("logo is empty")
+	}
+	if len(data) > MaxLogoSize {
+		return common.NewErrorf("logo can not be larger than %v KB", MaxLogoSize/1024)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := logoTypes[contentType]
+	if !ok {
+		return common.NewError("logo must be a png, jpeg, gif or webp image, got", contentType)
+	}
+	oldPath, err := s.GetLogoPath()
+	if err != nil {
+		return err
+	}
+	logo := "logo" + ext
+	err = os.WriteFile(filepath.Join(getDataDir(), logo), data, 0644)
+	if err != nil {
+		return err
+	}
+	if oldPath != "" && filepath.Base(oldPath) != logo {
+		os.Remove(oldPath)
+	}
+	return s.settingService.SetPanelLogo(logo)
+}
+
+func (s *BrandingService) DelLogo() error {
+	path, err := s.GetLogoPath()
+	if err != nil || path == "" {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return s.settingService.SetPanelLogo("")
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"x-ui/config"
+)
+
+func encodePng(t *testing.T) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSaveLogo(t *testing.T) {
+	dir := t.TempDir()
+	getDataDir = func() string { return dir }
+	t.Cleanup(func() {
+		getDataDir = config.GetDataDir
+	})
+	cleanSettings(t)
+	brandingService := BrandingService{}
+
+	pngLogo := encodePng(t)
+	// a jpeg only needs its magic bytes to be detected
+	jpegLogo := append([]byte{0xff, 0xd8, 0xff}, make([]byte, 64)...)
+	oversized := append(encodePng(t), make([]byte, MaxLogoSize)...)
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  bool
+		wantLogo string
+	}{
+		{"png", pngLogo, false, "logo.png"},
+		{"jpeg replaces the png", jpegLogo, false, "logo.jpg"},
+		{"empty", nil, true, "logo.jpg"},
+		{"oversized", oversized, true, "logo.jpg"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`), true, "logo.jpg"},
+		{"not an image", []byte("just some text"), true, "logo.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := brandingService.SaveLogo(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SaveLogo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			path, err := brandingService.GetLogoPath()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.wantLogo); path != want {
+				t.Errorf("GetLogoPath() = %q, want %q", path, want)
+			}
+			// a rejected upload leaves the stored logo alone
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != tt.wantLogo {
+				t.Errorf("data dir has %v, want only %v", entries, tt.wantLogo)
+			}
+		})
+	}
+
+	err := brandingService.DelLogo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := brandingService.GetLogoPath()
+	if err != nil || path != "" {
+		t.Errorf("GetLogoPath() after DelLogo() = %q, %v, want none", path, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("data dir has %v after DelLogo(), want nothing", entries)
+	}
+}
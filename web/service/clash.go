@@ -0,0 +1,158 @@
+package service
+
+import (
+	"fmt"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gopkg.in/yaml.v2"
+)
+
+const clashGroupName = "PROXY"
+
+type clashWSOpts struct {
+	Path    string            `yaml:"path,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+type clashH2Opts struct {
+	Path string   `yaml:"path,omitempty"`
+	Host []string `yaml:"host,omitempty"`
+}
+
+type clashGRPCOpts struct {
+	ServiceName string `yaml:"grpc-service-name,omitempty"`
+}
+
+type clashProxy struct {
+	Name       string         `yaml:"name"`
+	Type       string         `yaml:"type"`
+	Server     string         `yaml:"server"`
+	Port       int            `yaml:"port"`
+	UUID       string         `yaml:"uuid,omitempty"`
+	AlterId    *int           `yaml:"alterId,omitempty"`
+	Cipher     string         `yaml:"cipher,omitempty"`
+	Password   string         `yaml:"password,omitempty"`
+	Flow       string         `yaml:"flow,omitempty"`
+	UDP        bool           `yaml:"udp"`
+	TLS        bool           `yaml:"tls,omitempty"`
+	ServerName string         `yaml:"servername,omitempty"`
+	SNI        string         `yaml:"sni,omitempty"`
+	Network    string         `yaml:"network,omitempty"`
+	WSOpts     *clashWSOpts   `yaml:"ws-opts,omitempty"`
+	H2Opts     *clashH2Opts   `yaml:"h2-opts,omitempty"`
+	GRPCOpts   *clashGRPCOpts `yaml:"grpc-opts,omitempty"`
+}
+
+type clashProxyGroup struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Proxies []string `yaml:"proxies"`
+}
+
+type clashProfile struct {
+	Proxies     []*clashProxy      `yaml:"proxies"`
+	ProxyGroups []*clashProxyGroup `yaml:"proxy-groups"`
+	Rules       []string           `yaml:"rules"`
+}
+
+// clashDirectRules keep local networks off the proxy
+var clashDirectRules = []string{
+	"IP-CIDR,127.0.0.0/8,DIRECT",
+	"IP-CIDR,10.0.0.0/8,DIRECT",
+	"IP-CIDR,172.16.0.0/12,DIRECT",
+	"IP-CIDR,192.168.0.0/16,DIRECT",
+	"IP-CIDR6,::1/128,DIRECT",
+	"IP-CIDR6,fc00::/7,DIRECT",
+}
+
+// GetClashProxy describes the client on the inbound as a clash proxy, vless needs clash meta.
+// Transports clash doesn't have, like kcp and quic, are an error
+func GetClashProxy(inbound *model.Inbound, client *model.Client, address string) (*clashProxy, error) {
+	stream, err := getStreamInfo(inbound)
+	if err != nil {
+		return nil, err
+	}
+	if serverName := stream.serverName(); serverName != "" {
+		address = serverName
+	}
+	proxy := &clashProxy{
+		Name:   getClientRemark(inbound, client),
+		Type:   string(inbound.Protocol),
+		Server: address,
+		Port:   inbound.Port,
+		UDP:    true,
+	}
+	switch inbound.Protocol {
+	case model.VMess:
+		alterId := client.AlterId
+		proxy.UUID = client.ID
+		proxy.AlterId = &alterId
+		proxy.Cipher = "auto"
+	case model.VLESS:
+		proxy.UUID = client.ID
+		proxy.Flow = client.Flow
+	case model.Trojan:
+		proxy.Password = client.Password
+	default:
+		return nil, common.NewError("protocol is not supported by clash:", inbound.Protocol)
+	}
+
+	if stream.Security == "tls" || stream.Security == "xtls" {
+		if inbound.Protocol == model.Trojan {
+			proxy.SNI = stream.serverName()
+		} else {
+			proxy.TLS = true
+			proxy.ServerName = stream.serverName()
+		}
+	} else if inbound.Protocol == model.Trojan {
+		return nil, common.NewError("trojan without tls is not supported by clash")
+	}
+
+	path, host := stream.pathAndHost()
+	switch stream.Network {
+	case "", "tcp":
+	case "ws":
+		proxy.Network = "ws"
+		proxy.WSOpts = &clashWSOpts{Path: path}
+		if host != "" {
+			proxy.WSOpts.Headers = map[string]string{"Host": host}
+		}
+	case "http":
+		proxy.Network = "h2"
+		proxy.H2Opts = &clashH2Opts{Path: path, Host: stream.HTTPSettings.Host}
+	case "grpc":
+		proxy.Network = "grpc"
+		proxy.GRPCOpts = &clashGRPCOpts{ServiceName: path}
+	default:
+		return nil, common.NewError("transport is not supported by clash:", stream.Network)
+	}
+	return proxy, nil
+}
+
+// genClashProfile builds a profile sending everything but local networks through a group of the proxies
+func genClashProfile(proxies []*clashProxy) ([]byte, error) {
+	names := make([]string, 0, len(proxies))
+	seen := map[string]int{}
+	for _, proxy := range proxies {
+		// clash refuses a profile with two proxies of the same name
+		seen[proxy.Name]++
+		if seen[proxy.Name] > 1 {
+			proxy.Name = fmt.Sprintf("%v %v", proxy.Name, seen[proxy.Name])
+		}
+		names = append(names, proxy.Name)
+	}
+	if len(names) == 0 {
+		names = append(names, "DIRECT")
+	}
+	profile := &clashProfile{
+		Proxies: proxies,
+		ProxyGroups: []*clashProxyGroup{{
+			Name:    clashGroupName,
+			Type:    "select",
+			Proxies: names,
+		}},
+		Rules: append(append([]string(nil), clashDirectRules...), "MATCH,"+clashGroupName),
+	}
+	return yaml.Marshal(profile)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"sync"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"gorm.io/gorm"
+)
+
+// clientLock serializes changes to clients, so values checked for uniqueness
+// can't be taken by a concurrent change before they are saved
+var clientLock sync.Mutex
+
+// clientKeys holds the values which must be unique across the clients of all inbounds
+type clientKeys struct {
+	emails map[string]bool
+	ids    map[string]bool
+	subIds map[string]bool
+}
+
+// getClientKeys returns the unique values of the clients of all inbounds but the one with ignoreId
+func getClientKeys(tx *gorm.DB, ignoreId int) (*clientKeys, error) {
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Where("id != ?", ignoreId).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	keys := &clientKeys{
+		emails: map[string]bool{},
+		ids:    map[string]bool{},
+		subIds: map[string]bool{},
+	}
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			keys.add(&clients[i])
+		}
+	}
+	return keys, nil
+}
+
+func (k *clientKeys) add(client *model.Client) {
+	if client.Email != "" {
+		k.emails[client.Email] = true
+	}
+	if client.ID != "" {
+		k.ids[client.ID] = true
+	}
+	if client.SubID != "" {
+		k.subIds[client.SubID] = true
+	}
+}
+
+func (k *clientKeys) newId() string {
+	for {
+		id := uuid.New()
+		if !k.ids[id.String()] {
+			return id.String()
+		}
+	}
+}
+
+func (k *clientKeys) newSubId() string {
+	for {
+		subId := random.Seq(16)
+		if !k.subIds[subId] {
+			return subId
+		}
+	}
+}
+
+// prepareClient validates the client for the protocol, fills generated fields
+// and reserves its unique values
+func (k *clientKeys) prepareClient(protocol model.Protocol, client *model.Client) error {
+	if client.Email == "" {
+		return common.NewError("client email can not be empty")
+	}
+	return k.prepareInboundClient(protocol, client)
+}
+
+// prepareInboundClient is prepareClient for clients saved with their inbound,
+// the inbound form leaves the email empty by default so it may be
+func (k *clientKeys) prepareInboundClient(protocol model.Protocol, client *model.Client) error {
+	if client.Email != "" && k.emails[client.Email] {
+		return common.NewError("client email already exists:", client.Email)
+	}
+	switch protocol {
+	case model.VMess, model.VLESS:
+		if client.ID == "" {
+			client.ID = k.newId()
+		} else if _, err := uuid.ParseString(client.ID); err != nil {
+			return common.NewError("client id is not a valid uuid:", client.ID)
+		} else if k.ids[client.ID] {
+			return common.NewError("client id already exists:", client.ID)
+		}
+	case model.Trojan:
+		if client.Password == "" {
+			client.Password = random.Seq(10)
+		}
+	default:
+		return common.NewError("protocol does not support clients:", protocol)
+	}
+	if client.LimitIP < 0 {
+		return common.NewError("ip limit can not be negative:", client.LimitIP)
+	}
+	if client.SubID == "" {
+		client.SubID = k.newSubId()
+	} else if k.subIds[client.SubID] {
+		return common.NewError("client subscription id already exists:", client.SubID)
+	}
+	k.add(client)
+	return nil
+}
+
+// isClientProtocol reports whether inbounds of the protocol have clients
+func isClientProtocol(protocol model.Protocol) bool {
+	return protocol == model.VMess || protocol == model.VLESS || protocol == model.Trojan
+}
+
+// prepareInboundClients prepares the clients of the inbound against the clients of every
+// other inbound, the caller holds clientLock until the inbound is saved
+func prepareInboundClients(tx *gorm.DB, inbound *model.Inbound) error {
+	if !isClientProtocol(inbound.Protocol) {
+		return nil
+	}
+	clients, err := inbound.GetClients()
+	if err != nil || len(clients) == 0 {
+		return err
+	}
+	keys, err := getClientKeys(tx, inbound.Id)
+	if err != nil {
+		return err
+	}
+	for i := range clients {
+		err = keys.prepareInboundClient(inbound.Protocol, &clients[i])
+		if err != nil {
+			return err
+		}
+	}
+	return inbound.SetClients(clients)
+}
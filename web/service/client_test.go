@@ -0,0 +1,280 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func newClientInbound(t *testing.T, port int, protocol model.Protocol, clients []model.Client) *model.Inbound {
+	t.Helper()
+	inbound := &model.Inbound{
+		Port:     port,
+		Protocol: protocol,
+		Tag:      fmt.Sprintf("inbound-%v", port),
+		Enable:   true,
+	}
+	err := inbound.SetClients(clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inbound
+}
+
+func cleanInbounds(t *testing.T) {
+	t.Cleanup(func() {
+		db := database.GetDB()
+		db.Where("1 = 1").Delete(model.Inbound{})
+	})
+}
+
+func TestConcurrentClientsAreUnique(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	shared := newClientInbound(t, 41000, model.VLESS, nil)
+	err := inboundService.AddInbound(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 20
+	const perWorker = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			clients := make([]model.Client, perWorker)
+			for i := range clients {
+				clients[i].Email = fmt.Sprintf("add-%v-%v", w, i)
+			}
+			errs <- inboundService.AddClients(shared.Id, clients)
+		}(w)
+		go func(w int) {
+			defer wg.Done()
+			clients := make([]model.Client, perWorker)
+			for i := range clients {
+				clients[i].Email = fmt.Sprintf("inbound-%v-%v", w, i)
+			}
+			errs <- inboundService.AddInbound(newClientInbound(t, 41001+w, model.VMess, clients))
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inbounds, err := inboundService.GetAllInbounds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]bool{}
+	subIds := map[string]bool{}
+	count := 0
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, client := range clients {
+			count++
+			if client.ID == "" || ids[client.ID] {
+				t.Errorf("client %v has an empty or duplicate id %q", client.Email, client.ID)
+			}
+			if client.SubID == "" || subIds[client.SubID] {
+				t.Errorf("client %v has an empty or duplicate subId %q", client.Email, client.SubID)
+			}
+			ids[client.ID] = true
+			subIds[client.SubID] = true
+		}
+	}
+	if count != workers*perWorker*2 {
+		t.Errorf("got %v clients, want %v", count, workers*perWorker*2)
+	}
+}
+
+func TestInboundClientCollisions(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	existing := newClientInbound(t, 42000, model.VMess, []model.Client{{
+		Email: "taken",
+		ID:    "2a1e3b2c-0000-4000-8000-000000000000",
+		SubID: "taken-sub",
+	}})
+	err := inboundService.AddInbound(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		client  model.Client
+		wantErr bool
+	}{
+		{"generated values", model.Client{}, false},
+		{"duplicate email", model.Client{Email: "taken"}, true},
+		{"duplicate id", model.Client{ID: "2a1e3b2c-0000-4000-8000-000000000000"}, true},
+		{"duplicate subId", model.Client{SubID: "taken-sub"}, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound := newClientInbound(t, 42001+i, model.VMess, []model.Client{tt.client})
+			err := inboundService.AddInbound(inbound)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddInbound() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			clients, _ := inbound.GetClients()
+			if clients[0].ID == "" || clients[0].SubID == "" {
+				t.Errorf("AddInbound() didn't generate id and subId: %+v", clients[0])
+			}
+		})
+	}
+
+	// an inbound keeps its own clients when it is updated
+	existing.Remark = "updated"
+	err = inboundService.UpdateInbound(existing)
+	if err != nil {
+		t.Errorf("UpdateInbound() error = %v", err)
+	}
+}
+
+func TestSetClientIpLimit(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	inbound := newClientInbound(t, 41100, model.VLESS, []model.Client{
+		{Email: "limit-alice", LimitIP: 1},
+		{Email: "limit-bob", LimitIP: 2},
+	})
+	err := inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getLimits := func() map[string]int {
+		t.Helper()
+		inbound, err := inboundService.GetInbound(inbound.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients, err := inbound.GetClients()
+		if err != nil {
+			t.Fatal(err)
+		}
+		limits := map[string]int{}
+		for _, client := range clients {
+			limits[client.Email] = client.LimitIP
+		}
+		return limits
+	}
+
+	tests := []struct {
+		name    string
+		email   string
+		limit   int
+		wantErr bool
+		want    map[string]int
+	}{
+		{"set", "limit-alice", 3, false, map[string]int{"limit-alice": 3, "limit-bob": 2}},
+		{"clear to unlimited", "limit-alice", 0, false, map[string]int{"limit-alice": 0, "limit-bob": 2}},
+		{"negative", "limit-bob", -1, true, map[string]int{"limit-alice": 0, "limit-bob": 2}},
+		{"unknown client", "limit-carol", 1, true, map[string]int{"limit-alice": 0, "limit-bob": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := inboundService.SetClientIpLimit(inbound.Id, tt.email, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetClientIpLimit() = %v, want error %v", err, tt.wantErr)
+			}
+			got := getLimits()
+			if len(got) != len(tt.want) {
+				t.Fatalf("clients = %v, want %v", got, tt.want)
+			}
+			for email, limit := range tt.want {
+				if got[email] != limit {
+					t.Errorf("limit of %v = %v, want %v", email, got[email], limit)
+				}
+			}
+		})
+	}
+
+	err = inboundService.SetClientIpLimit(inbound.Id+1000, "limit-alice", 1)
+	if err == nil {
+		t.Error("SetClientIpLimit() changed a client of an inbound which doesn't exist")
+	}
+}
+
+func TestEphemeralClient(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	past := time.Now().Add(-time.Hour).Unix() * 1000
+	inbound := newClientInbound(t, 41300, model.VLESS, []model.Client{
+		{Email: "ephemeral-regular", ExpiryTime: past},
+	})
+	err := inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = inboundService.AddEphemeralClient(inbound.Id, 0)
+	if err == nil {
+		t.Error("AddEphemeralClient() took a duration of 0")
+	}
+	before := time.Now()
+	client, err := inboundService.AddEphemeralClient(inbound.Id, time.Minute*30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantExpiry := before.Add(time.Minute*30).Unix() * 1000
+	if !client.Ephemeral || client.ID == "" || client.SubID == "" ||
+		client.ExpiryTime < wantExpiry || client.ExpiryTime > wantExpiry+int64(time.Minute/time.Millisecond) {
+		t.Errorf("AddEphemeralClient() = %+v, want an ephemeral client expiring at %v", client, wantExpiry)
+	}
+	getEmails := func() []string {
+		t.Helper()
+		stored, err := inboundService.GetInbound(inbound.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients, err := stored.GetClients()
+		if err != nil {
+			t.Fatal(err)
+		}
+		emails := make([]string, 0, len(clients))
+		for _, c := range clients {
+			emails = append(emails, c.Email)
+		}
+		return emails
+	}
+	if emails := getEmails(); len(emails) != 2 || emails[1] != client.Email {
+		t.Fatalf("clients = %v, want the ephemeral client added", emails)
+	}
+
+	// the client is usable until it expires
+	count, err := inboundService.DelExpiredEphemeralClients()
+	if err != nil || count != 0 {
+		t.Fatalf("DelExpiredEphemeralClients() before the expiry = %v, %v", count, err)
+	}
+	err = inboundService.updateClient(inbound.Id, client.Email, func(c *model.Client) {
+		c.ExpiryTime = past
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = inboundService.DelExpiredEphemeralClients()
+	if err != nil || count != 1 {
+		t.Fatalf("DelExpiredEphemeralClients() after the expiry = %v, %v, want 1", count, err)
+	}
+	// expired clients which aren't ephemeral are only disabled, never deleted
+	if emails := getEmails(); len(emails) != 1 || emails[0] != "ephemeral-regular" {
+		t.Errorf("clients = %v, want only ephemeral-regular", emails)
+	}
+}
@@ -0,0 +1,405 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// DefaultConnectivityTestUrl answers 204 and is reachable from most networks
+const DefaultConnectivityTestUrl = "https://www.gstatic.com/generate_204"
+
+const (
+	connectivityStartTimeout = time.Second * 5
+	connectivityTestTimeout  = time.Second * 10
+)
+
+type ConnectivityResult struct {
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"statusCode"`
+	Latency    int64  `json:"latency"`
+	Error      string `json:"error"`
+}
+
+// connectivityBlockedNetworks can't be tested against, the test request leaves from the
+// panel host so these would let panel users reach its local and internal services
+var connectivityBlockedNetworks, _ = common.ParseNetworks("0.0.0.0/8,10.0.0.0/8,100.64.0.0/10,127.0.0.0/8,169.254.0.0/16,172.16.0.0/12,192.168.0.0/16,::/128,::1/128,fc00::/7,fe80::/10")
+
+// dialFunc opens the connections to the test client, net.Dialer's DialContext by default
+type dialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+type ConnectivityService struct {
+	inboundService InboundService
+	xrayService    XrayService
+	// dial replaces the dialer in tests
+	dial dialFunc
+}
+
+func (s *ConnectivityService) getDial() dialFunc {
+	if s.dial != nil {
+		return s.dial
+	}
+	dialer := &net.Dialer{}
+	return dialer.DialContext
+}
+
+// lookupIP resolves the host of the test url, tests replace it
+var lookupIP = net.LookupIP
+
+// newTestRequest makes sure the test url is an http url of a public host and returns the
+// request of it. The request goes to the checked address of the host, the name is only sent
+// as the host header and tls server name, so a name which resolves to another address when
+// it is looked up again can't point the test at a local or internal service
+func newTestRequest(testUrl string) (*http.Request, error) {
+	parsedUrl, err := url.Parse(testUrl)
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") || parsedUrl.Hostname() == "" {
+		return nil, common.NewError("test url must be an http or https url:", testUrl)
+	}
+	host := parsedUrl.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ips, err = lookupIP(host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, common.NewError("test url host has no address:", host)
+		}
+	}
+	for _, ip := range ips {
+		if common.NetworksContain(connectivityBlockedNetworks, ip) || ip.IsMulticast() {
+			return nil, common.NewError("test url must point to a public address:", testUrl)
+		}
+	}
+	port := parsedUrl.Port()
+	if port == "" {
+		port = "80"
+		if parsedUrl.Scheme == "https" {
+			port = "443"
+		}
+	}
+	req, err := http.NewRequest(http.MethodGet, testUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Host = net.JoinHostPort(ips[0].String(), port)
+	req.Host = parsedUrl.Host
+	return req, nil
+}
+
+// firstString returns value when it is a string, or the first string of it when it is a list
+func firstString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				return str
+			}
+		}
+	}
+	return ""
+}
+
+// getTestRealitySettings returns the reality settings of a client of the server ones, the
+// private key of the server is left out. The public key is read from the settings object
+// the panel keeps it in, or from the top level
+func getTestRealitySettings(reality map[string]interface{}) map[string]interface{} {
+	extra, _ := reality["settings"].(map[string]interface{})
+	get := func(key string) string {
+		if value := firstString(reality[key]); value != "" {
+			return value
+		}
+		return firstString(extra[key])
+	}
+	settings := map[string]interface{}{}
+	for key, value := range map[string]string{
+		"publicKey":   get("publicKey"),
+		"fingerprint": get("fingerprint"),
+		"spiderX":     get("spiderX"),
+		"serverName":  firstString([]interface{}{get("serverName"), firstString(reality["serverNames"])}),
+		"shortId":     firstString([]interface{}{get("shortId"), firstString(reality["shortIds"])}),
+	} {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+	if settings["fingerprint"] == nil {
+		settings["fingerprint"] = "chrome"
+	}
+	return settings
+}
+
+// getTestStreamSettings turns the inbound stream settings into the ones a client uses,
+// tls keeps only the server name and skips verification since the panel dials itself
+func getTestStreamSettings(inbound *model.Inbound) (map[string]interface{}, error) {
+	stream := map[string]interface{}{}
+	if inbound.StreamSettings != "" {
+		err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		if err != nil {
+			return nil, err
+		}
+	}
+	delete(stream, "sockopt")
+	for _, key := range []string{"tlsSettings", "xtlsSettings"} {
+		settings, ok := stream[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stream[key] = map[string]interface{}{
+			"serverName":    settings["serverName"],
+			"allowInsecure": true,
+		}
+	}
+	if reality, ok := stream["realitySettings"].(map[string]interface{}); ok {
+		stream["realitySettings"] = getTestRealitySettings(reality)
+	}
+	return stream, nil
+}
+
+// buildTestClientConfig returns an xray config which proxies http on proxyPort through the client
+func buildTestClientConfig(inbound *model.Inbound, client *model.Client, address string, proxyPort int) ([]byte, error) {
+	var settings interface{}
+	switch inbound.Protocol {
+	case model.VMess:
+		settings = map[string]interface{}{
+			"vnext": []interface{}{map[string]interface{}{
+				"address": address,
+				"port":    inbound.Port,
+				"users": []interface{}{map[string]interface{}{
+					"id":       client.ID,
+					"alterId":  client.AlterId,
+					"security": "auto",
+				}},
+			}},
+		}
+	case model.VLESS:
+		settings = map[string]interface{}{
+			"vnext": []interface{}{map[string]interface{}{
+				"address": address,
+				"port":    inbound.Port,
+				"users": []interface{}{map[string]interface{}{
+					"id":         client.ID,
+					"flow":       client.Flow,
+					"encryption": "none",
+				}},
+			}},
+		}
+	case model.Trojan:
+		settings = map[string]interface{}{
+			"servers": []interface{}{map[string]interface{}{
+				"address":  address,
+				"port":     inbound.Port,
+				"password": client.Password,
+				"flow":     client.Flow,
+			}},
+		}
+	default:
+		return nil, common.NewError("protocol does not support connectivity test:", inbound.Protocol)
+	}
+	stream, err := getTestStreamSettings(inbound)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{
+		"log": map[string]interface{}{
+			"loglevel": "warning",
+		},
+		"inbounds": []interface{}{map[string]interface{}{
+			"listen":   "127.0.0.1",
+			"port":     proxyPort,
+			"protocol": "http",
+		}},
+		"outbounds": []interface{}{map[string]interface{}{
+			"protocol":       string(inbound.Protocol),
+			"settings":       settings,
+			"streamSettings": stream,
+		}},
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+func getFreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitForPort(dial dialFunc, address string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		conn, err := dial(ctx, "tcp", address)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+// dialThroughProxy returns a dialer which opens connections through a CONNECT tunnel of the
+// http proxy. Plain http requests are tunneled too, a proxied http request names the host
+// and the proxy would look it up again
+func dialThroughProxy(dial dialFunc, proxyAddress string) dialFunc {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		conn, err := dial(ctx, "tcp", proxyAddress)
+		if err != nil {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		connectReq := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: address},
+			Host:   address,
+			Header: http.Header{},
+		}
+		err = connectReq.Write(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// the tunnel says nothing before the request is sent, so nothing is left in the reader
+		resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, common.NewError("proxy refused the tunnel:", resp.Status)
+		}
+		conn.SetDeadline(time.Time{})
+		return conn, nil
+	}
+}
+
+// probeThroughProxy sends the test request through the http proxy and reports how it went,
+// it succeeds when the url answers with a 2xx or 3xx status
+func probeThroughProxy(dial dialFunc, proxyAddress string, req *http.Request, timeout time.Duration) *ConnectivityResult {
+	httpClient := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:       dialThroughProxy(dial, proxyAddress),
+			DisableKeepAlives: true,
+			// the request goes to the address, the certificate is checked for the name
+			TLSClientConfig: &tls.Config{ServerName: (&url.URL{Host: req.Host}).Hostname()},
+		},
+		// the status of the url itself tells whether it is reachable
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	result := &ConnectivityResult{
+		Latency: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.Success = resp.StatusCode >= 200 && resp.StatusCode < 400
+	if !result.Success {
+		result.Error = resp.Status
+	}
+	return result
+}
+
+// TestClient starts a throwaway xray client for the client with the email, requests testUrl
+// through the inbound with it and stops it again, the request follows the routing of the server
+func (s *ConnectivityService) TestClient(inboundId int, email string, testUrl string) (*ConnectivityResult, error) {
+	if testUrl == "" {
+		testUrl = DefaultConnectivityTestUrl
+	}
+	req, err := newTestRequest(testUrl)
+	if err != nil {
+		return nil, err
+	}
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	if !inbound.Enable {
+		return nil, common.NewError("inbound is disabled:", inbound.Tag)
+	}
+	if !s.xrayService.IsXrayRunning() {
+		return nil, common.NewError("xray is not running")
+	}
+	client, err := inbound.GetClient(email)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, common.NewError("client not found:", email)
+	}
+
+	address := "127.0.0.1"
+	if ip := net.ParseIP(inbound.Listen); ip != nil && !ip.IsUnspecified() {
+		address = inbound.Listen
+	}
+	proxyPort, err := getFreePort()
+	if err != nil {
+		return nil, err
+	}
+	data, err := buildTestClientConfig(inbound, client, address, proxyPort)
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := os.CreateTemp("", "x-ui-test-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(configFile.Name())
+	_, err = configFile.Write(data)
+	if closeErr := configFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, xray.GetBinaryPath(), "-c", configFile.Name())
+	err = cmd.Start()
+	if err != nil {
+		cancel()
+		return nil, common.NewError("start test client failed:", err)
+	}
+	defer func() {
+		cancel()
+		cmd.Wait()
+	}()
+
+	proxyAddress := net.JoinHostPort("127.0.0.1", strconv.Itoa(proxyPort))
+	dial := s.getDial()
+	err = waitForPort(dial, proxyAddress, connectivityStartTimeout)
+	if err != nil {
+		return nil, common.NewError("test client did not start:", err)
+	}
+	return probeThroughProxy(dial, proxyAddress, req, connectivityTestTimeout), nil
+}
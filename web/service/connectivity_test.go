@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database/model"
+)
+
+// newTestProxy answers CONNECT like the http inbound of xray, every tunnel goes to backend
+// whatever address it asks for, the asked addresses are sent to targets
+func newTestProxy(t *testing.T, backend string) (string, <-chan string) {
+	t.Helper()
+	targets := make(chan string, 10)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "only tunnels are accepted", http.StatusMethodNotAllowed)
+			return
+		}
+		targets <- r.Host
+		backendConn, err := net.Dial("tcp", backend)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer backendConn.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go io.Copy(backendConn, conn)
+		io.Copy(conn, backendConn)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy.Listener.Addr().String(), targets
+}
+
+func TestProbeThroughProxy(t *testing.T) {
+	dial := (&net.Dialer{}).DialContext
+	failDial := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	tests := []struct {
+		name    string
+		status  int
+		dial    dialFunc
+		success bool
+	}{
+		{"ok", http.StatusOK, dial, true},
+		{"no content", http.StatusNoContent, dial, true},
+		{"redirect", http.StatusFound, dial, true},
+		{"not found", http.StatusNotFound, dial, false},
+		{"forbidden", http.StatusForbidden, dial, false},
+		{"bad gateway", http.StatusBadGateway, dial, false},
+		{"dial error", 0, failDial, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status == http.StatusFound {
+					w.Header().Set("Location", "http://127.0.0.1:1/")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			proxyAddress, _ := newTestProxy(t, server.Listener.Addr().String())
+
+			req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := probeThroughProxy(tt.dial, proxyAddress, req, 5*time.Second)
+			if result.Success != tt.success {
+				t.Errorf("Success = %v, want %v (%+v)", result.Success, tt.success, result)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("StatusCode = %v, want %v", result.StatusCode, tt.status)
+			}
+			if !tt.success && result.Error == "" {
+				t.Error("a failed probe has no error")
+			}
+		})
+	}
+
+	// a proxy which refuses the tunnel fails the probe
+	proxyAddress, _ := newTestProxy(t, "127.0.0.1:1")
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	result := probeThroughProxy(dial, proxyAddress, req, 5*time.Second)
+	if result.Success || result.Error == "" {
+		t.Errorf("probe through a refused tunnel = %+v", result)
+	}
+}
+
+func TestNewTestRequest(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://1.1.1.1/", true},
+		{"http://93.184.216.34:8080/path", true},
+		{"http://[2606:4700:4700::1111]/", true},
+		{"ftp://1.1.1.1/", false},
+		{"file:///etc/passwd", false},
+		{"http:///path", false},
+		{"http://127.0.0.1:54321/", false},
+		{"http://localhost/", false},
+		{"http://10.0.0.1/", false},
+		{"http://172.16.5.4/", false},
+		{"http://192.168.1.1/", false},
+		{"http://100.64.0.1/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://0.0.0.0/", false},
+		{"http://[::1]/", false},
+		{"http://[fd00::1]/", false},
+		{"http://[fe80::1]/", false},
+		{"http://[::ffff:127.0.0.1]/", false},
+		{"http://224.0.0.1/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			_, err := newTestRequest(tt.url)
+			if (err == nil) != tt.valid {
+				t.Errorf("newTestRequest(%q) = %v, want valid %v", tt.url, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestNewTestRequestRebinding(t *testing.T) {
+	// the name resolves to a public address when it is checked and to loopback after that
+	lookups := 0
+	lookupIP = func(host string) ([]net.IP, error) {
+		lookups++
+		if lookups == 1 {
+			return []net.IP{net.ParseIP("93.184.216.34")}, nil
+		}
+		return []net.IP{net.ParseIP("127.0.0.1")}, nil
+	}
+	defer func() { lookupIP = net.LookupIP }()
+
+	req, err := newTestRequest("http://rebind.example/generate_204")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Host != "93.184.216.34:80" || req.Host != "rebind.example" {
+		t.Errorf("request goes to %v with host %v", req.URL.Host, req.Host)
+	}
+	// the proxy is asked for the checked address, it doesn't look the name up again
+	var requestUri, host string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestUri, host = r.RequestURI, r.Host
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	proxyAddress, targets := newTestProxy(t, backend.Listener.Addr().String())
+	result := probeThroughProxy((&net.Dialer{}).DialContext, proxyAddress, req, 5*time.Second)
+	if !result.Success {
+		t.Fatalf("probeThroughProxy() = %+v", result)
+	}
+	if target := <-targets; target != "93.184.216.34:80" {
+		t.Errorf("proxy was asked for %v", target)
+	}
+	if requestUri != "/generate_204" || host != "rebind.example" {
+		t.Errorf("server got %v with host %v", requestUri, host)
+	}
+	if lookups != 1 {
+		t.Errorf("the host was looked up %v times", lookups)
+	}
+
+	// a test started after the name moved to loopback is refused
+	_, err = newTestRequest("https://rebind.example:8443/")
+	if err == nil {
+		t.Error("newTestRequest() accepted a name of loopback")
+	}
+}
+
+func TestNewTestRequestResolvesEveryAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		ips   []net.IP
+		valid bool
+	}{
+		{"public", []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("2606:2800:220:1::")}, true},
+		{"one internal address", []net.IP{net.ParseIP("93.184.216.34"), net.ParseIP("10.0.0.1")}, false},
+		{"loopback", []net.IP{net.ParseIP("127.0.0.1")}, false},
+		{"no address", nil, false},
+	}
+	defer func() { lookupIP = net.LookupIP }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupIP = func(host string) ([]net.IP, error) {
+				return tt.ips, nil
+			}
+			req, err := newTestRequest("https://multi.example/")
+			if (err == nil) != tt.valid {
+				t.Fatalf("newTestRequest() = %v, want valid %v", err, tt.valid)
+			}
+			if err == nil && req.URL.Host != "93.184.216.34:443" {
+				t.Errorf("request goes to %v", req.URL.Host)
+			}
+		})
+	}
+}
+
+func TestTestStreamRealitySettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		reality string
+		want    map[string]interface{}
+	}{
+		{
+			"panel settings",
+			`{"show":false,"dest":"example.com:443","privateKey":"server-private","serverNames":["example.com","www.example.com"],"shortIds":["a1b2","c3"],"settings":{"publicKey":"server-public","fingerprint":"firefox","spiderX":"/"}}`,
+			map[string]interface{}{"publicKey": "server-public", "fingerprint": "firefox", "spiderX": "/", "serverName": "example.com", "shortId": "a1b2"},
+		},
+		{
+			"top level public key",
+			`{"privateKey":"server-private","publicKey":"server-public","serverNames":["example.com"],"shortIds":[""]}`,
+			map[string]interface{}{"publicKey": "server-public", "fingerprint": "chrome", "serverName": "example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound := &model.Inbound{
+				StreamSettings: `{"network":"tcp","security":"reality","realitySettings":` + tt.reality + `}`,
+			}
+			stream, err := getTestStreamSettings(inbound)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "server-private") {
+				t.Errorf("the private key is in the client settings: %s", data)
+			}
+			got, _ := json.Marshal(stream["realitySettings"])
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("realitySettings = %s, want %s", got, want)
+			}
+		})
+	}
+}
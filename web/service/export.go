@@ -0,0 +1,57 @@
+package service
+
+import (
+	"os"
+	"x-ui/util/json_util"
+	"x-ui/xray"
+)
+
+const exportOutbounds = `[
+  {
+    "protocol": "freedom",
+    "settings": {},
+    "tag": "direct"
+  },
+  {
+    "protocol": "blackhole",
+    "settings": {},
+    "tag": "blocked"
+  }
+]`
+
+// geo files are left out so the config runs with a bare xray binary
+const exportRouting = `{
+  "rules": [
+    {
+      "type": "field",
+      "protocol": ["bittorrent"],
+      "outboundTag": "blocked"
+    }
+  ]
+}`
+
+// ExportInboundConfig returns a complete xray config running only the inbound, with direct
+// and blocked outbounds, it is checked by the local xray binary when there is one
+func (s *InboundService) ExportInboundConfig(id int) (*xray.Config, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	config := &xray.Config{
+		LogConfig:       json_util.RawMessage(`{"loglevel": "warning"}`),
+		RouterConfig:    json_util.RawMessage(exportRouting),
+		InboundConfigs:  []xray.InboundConfig{*inbound.GenXrayInboundConfig()},
+		OutboundConfigs: json_util.RawMessage(exportOutbounds),
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(xray.GetBinaryPath()); err == nil {
+		err = checkConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
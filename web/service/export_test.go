@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+func TestExportInboundConfig(t *testing.T) {
+	cleanInbounds(t)
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	var checked []*xray.Config
+	var checkErr error
+	checkConfig = func(config *xray.Config) error {
+		checked = append(checked, config)
+		return checkErr
+	}
+	defer func() { checkConfig = xray.CheckConfig }()
+
+	inboundService := &InboundService{}
+	inbound := newClientInbound(t, 47300, model.VLESS, []model.Client{{Email: "export-a"}})
+	err = inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newClientInbound(t, 47301, model.VLESS, []model.Client{{Email: "export-b"}})
+	err = inboundService.AddInbound(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without a local xray binary the config is exported unchecked
+	_, err = inboundService.ExportInboundConfig(inbound.Id)
+	if err != nil || len(checked) != 0 {
+		t.Fatalf("ExportInboundConfig() without xray = %v, checked %v times", err, len(checked))
+	}
+
+	err = os.MkdirAll("bin", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.FromSlash(xray.GetBinaryPath()), nil, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := inboundService.ExportInboundConfig(inbound.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checked) != 1 || checked[0] != config {
+		t.Fatalf("the exported config was checked %v times, want once", len(checked))
+	}
+	if len(config.InboundConfigs) != 1 || config.InboundConfigs[0].Tag != inbound.Tag || config.InboundConfigs[0].Port != inbound.Port {
+		t.Errorf("inbounds = %+v, want only %v", config.InboundConfigs, inbound.Tag)
+	}
+
+	// the rules route only to the outbounds the config has
+	outbounds := []struct {
+		Tag string `json:"tag"`
+	}{}
+	err = json.Unmarshal(config.OutboundConfigs, &outbounds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outboundTags := map[string]bool{}
+	for _, outbound := range outbounds {
+		outboundTags[outbound.Tag] = true
+	}
+	if !outboundTags["direct"] || !outboundTags["blocked"] {
+		t.Errorf("outbounds = %+v, want direct and blocked", outbounds)
+	}
+	routing := struct {
+		Rules []xray.RoutingRule `json:"rules"`
+	}{}
+	err = json.Unmarshal(config.RouterConfig, &routing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range routing.Rules {
+		if !outboundTags[rule.OutboundTag] {
+			t.Errorf("rule %+v routes to an outbound the config doesn't have", rule)
+		}
+	}
+
+	checkErr = errors.New("xray config test failed")
+	_, err = inboundService.ExportInboundConfig(inbound.Id)
+	if err == nil {
+		t.Error("ExportInboundConfig() of a config xray can't load didn't fail")
+	}
+	_, err = inboundService.ExportInboundConfig(other.Id + 100)
+	if err == nil {
+		t.Error("ExportInboundConfig() of an unknown inbound didn't fail")
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"encoding/json"
+	"x-ui/logger"
+	"x-ui/xray"
+)
+
+type FakeDNSService struct {
+	settingService SettingService
+	inboundService InboundService
+}
+
+func getTemplateDNSServers(template map[string]interface{}) []interface{} {
+	dns, ok := template["dns"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	servers, _ := dns["servers"].([]interface{})
+	return servers
+}
+
+func setTemplateDNSServers(template map[string]interface{}, servers []interface{}) {
+	dns, ok := template["dns"].(map[string]interface{})
+	if !ok {
+		dns = map[string]interface{}{}
+		template["dns"] = dns
+	}
+	dns["servers"] = servers
+}
+
+// GetFakeDNS returns the fakedns config of the template, nil if fakedns is disabled
+func (s *FakeDNSService) GetFakeDNS() (*xray.FakeDNSConfig, error) {
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := template["fakeDns"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	fakeDNS := &xray.FakeDNSConfig{}
+	err = json.Unmarshal(data, fakeDNS)
+	if err != nil {
+		return nil, err
+	}
+	return fakeDNS, nil
+}
+
+// EnableFakeDNS sets the fakedns pool and adds fakedns to the dns servers,
+// fakedns does nothing unless dns queries are answered by it
+func (s *FakeDNSService) EnableFakeDNS(ipPool string, poolSize int64) error {
+	fakeDNS, err := s.GetFakeDNS()
+	if err != nil {
+		return err
+	}
+	if fakeDNS == nil {
+		fakeDNS = &xray.FakeDNSConfig{}
+	}
+	fakeDNS.IPPool = ipPool
+	fakeDNS.PoolSize = poolSize
+	err = fakeDNS.Validate()
+	if err != nil {
+		return err
+	}
+
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	template["fakeDns"] = fakeDNS
+	servers := getTemplateDNSServers(template)
+	found := false
+	for _, server := range servers {
+		if server == "fakedns" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		servers = append([]interface{}{"fakedns"}, servers...)
+		setTemplateDNSServers(template, servers)
+	}
+
+	if !s.hasFakeDNSSniffing() {
+		logger.Warning("fakedns enabled but no enabled inbound sniffs with destOverride fakedns")
+	}
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+func (s *FakeDNSService) DisableFakeDNS() error {
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	delete(template, "fakeDns")
+	servers := getTemplateDNSServers(template)
+	if servers != nil {
+		newServers := make([]interface{}, 0, len(servers))
+		for _, server := range servers {
+			if server != "fakedns" {
+				newServers = append(newServers, server)
+			}
+		}
+		setTemplateDNSServers(template, newServers)
+	}
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+func (s *FakeDNSService) hasFakeDNSSniffing() bool {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return false
+	}
+	for _, inbound := range inbounds {
+		if inbound.Enable && xray.SniffingHasFakeDNS([]byte(inbound.Sniffing)) {
+			return true
+		}
+	}
+	return false
+}
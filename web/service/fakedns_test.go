@@ -0,0 +1,57 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnableFakeDNS(t *testing.T) {
+	cleanSettings(t)
+	s := &FakeDNSService{}
+	err := s.settingService.SetXrayConfigTemplate(`{"dns": {"servers": ["1.1.1.1"]}, "outbounds": [{"protocol": "freedom"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getServers := func() []interface{} {
+		t.Helper()
+		template, err := getXrayTemplate(&s.settingService)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return getTemplateDNSServers(template)
+	}
+
+	err = s.EnableFakeDNS("198.18.0.0/33", 65535)
+	if err == nil {
+		t.Fatal("EnableFakeDNS() took an invalid pool")
+	}
+	if fakeDNS, _ := s.GetFakeDNS(); fakeDNS != nil {
+		t.Errorf("a failed EnableFakeDNS() stored %+v", fakeDNS)
+	}
+
+	// enabling it twice only changes the pool
+	for _, poolSize := range []int64{65535, 1024} {
+		err = s.EnableFakeDNS("198.18.0.0/15", poolSize)
+		if err != nil {
+			t.Fatalf("EnableFakeDNS() = %v", err)
+		}
+		fakeDNS, err := s.GetFakeDNS()
+		if err != nil || fakeDNS == nil || fakeDNS.IPPool != "198.18.0.0/15" || fakeDNS.PoolSize != poolSize {
+			t.Fatalf("GetFakeDNS() = %+v, %v", fakeDNS, err)
+		}
+		if servers := getServers(); !reflect.DeepEqual(servers, []interface{}{"fakedns", "1.1.1.1"}) {
+			t.Errorf("dns servers = %v, want fakedns first", servers)
+		}
+	}
+
+	err = s.DisableFakeDNS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fakeDNS, _ := s.GetFakeDNS(); fakeDNS != nil {
+		t.Errorf("GetFakeDNS() after DisableFakeDNS() = %+v", fakeDNS)
+	}
+	if servers := getServers(); !reflect.DeepEqual(servers, []interface{}{"1.1.1.1"}) {
+		t.Errorf("dns servers after DisableFakeDNS() = %v", servers)
+	}
+}
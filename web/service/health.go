@@ -0,0 +1,39 @@
+package service
+
+import (
+	"x-ui/database"
+	"x-ui/util/common"
+)
+
+type Health struct {
+	Status   string `json:"status"`
+	Database bool   `json:"database"`
+	Xray     bool   `json:"xray"`
+}
+
+type HealthService struct {
+	xrayService XrayService
+}
+
+// GetHealth reports whether the database answers and xray runs, the panel is
+// unhealthy if the database is down or xray was started but is not running
+func (s *HealthService) GetHealth() *Health {
+	health := &Health{
+		Status:   "ok",
+		Database: s.pingDB() == nil,
+		Xray:     s.xrayService.IsXrayRunning(),
+	}
+	if !health.Database || (!health.Xray && s.xrayService.IsXrayExpected()) {
+		health.Status = "unhealthy"
+	}
+	return health
+}
+
+func (s *HealthService) pingDB() error {
+	db := database.GetDB()
+	if db == nil {
+		return common.NewError("database is not initialized")
+	}
+	var one int
+	return db.Raw("select 1").Scan(&one).Error
+}
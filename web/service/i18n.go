@@ -0,0 +1,73 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"x-ui/util/common"
+)
+
+var missingTranslationLock sync.Mutex
+
+// missingTranslations maps a language to the translation keys pages asked for but it lacks
+var missingTranslations = map[string]map[string]bool{}
+
+type I18nService struct {
+	settingService SettingService
+}
+
+// AddMissingTranslation records a key which is not translated to the language
+func AddMissingTranslation(lang string, key string) {
+	missingTranslationLock.Lock()
+	defer missingTranslationLock.Unlock()
+
+	keys, ok := missingTranslations[lang]
+	if !ok {
+		keys = map[string]bool{}
+		missingTranslations[lang] = keys
+	}
+	keys[key] = true
+}
+
+func (s *I18nService) checkTracking() error {
+	track, err := s.settingService.GetI18nTrackMissing()
+	if err != nil {
+		return err
+	}
+	if !track {
+		return common.NewError("missing translation tracking is off")
+	}
+	return nil
+}
+
+// GetMissingTranslations returns the sorted missing keys of every language
+func (s *I18nService) GetMissingTranslations() (map[string][]string, error) {
+	err := s.checkTracking()
+	if err != nil {
+		return nil, err
+	}
+	missingTranslationLock.Lock()
+	defer missingTranslationLock.Unlock()
+
+	result := map[string][]string{}
+	for lang, keys := range missingTranslations {
+		list := make([]string, 0, len(keys))
+		for key := range keys {
+			list = append(list, key)
+		}
+		sort.Strings(list)
+		result[lang] = list
+	}
+	return result, nil
+}
+
+func (s *I18nService) ClearMissingTranslations() error {
+	err := s.checkTracking()
+	if err != nil {
+		return err
+	}
+	missingTranslationLock.Lock()
+	defer missingTranslationLock.Unlock()
+
+	missingTranslations = map[string]map[string]bool{}
+	return nil
+}
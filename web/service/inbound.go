@@ -2,16 +2,23 @@ package service
 
 import (
 	"fmt"
+	"math"
+	"sort"
 	"time"
 	"x-ui/database"
 	"x-ui/database/model"
+	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/random"
 	"x-ui/xray"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-type InboundService struct{}
+type InboundService struct {
+	settingService SettingService
+}
 
 func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
 	db := database.GetDB()
@@ -23,6 +30,87 @@ func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
+// GetInboundList returns a page of the inbounds, which every panel user shares, sorted by sortBy,
+// which is one of clientCount, traffic and expiry, or the id when empty, along with the count of
+// all inbounds. Inbounds never expiring sort after the others, page starts at 1 and pageSize 0 returns all
+func (s *InboundService) GetInboundList(sortBy string, desc bool, withClientCount bool, page int, pageSize int) ([]*model.Inbound, int, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, 0, err
+	}
+	if withClientCount || sortBy == "clientCount" {
+		for _, inbound := range inbounds {
+			clients, _ := inbound.GetClients()
+			inbound.ClientCount = len(clients)
+		}
+	}
+
+	var key func(inbound *model.Inbound) int64
+	switch sortBy {
+	case "":
+	case "clientCount":
+		key = func(inbound *model.Inbound) int64 {
+			return int64(inbound.ClientCount)
+		}
+	case "traffic":
+		key = func(inbound *model.Inbound) int64 {
+			return inbound.Up + inbound.Down
+		}
+	case "expiry":
+		key = func(inbound *model.Inbound) int64 {
+			if inbound.ExpiryTime <= 0 {
+				return math.MaxInt64
+			}
+			return inbound.ExpiryTime
+		}
+	default:
+		return nil, 0, common.NewError("unknown inbound sort:", sortBy)
+	}
+	sort.SliceStable(inbounds, func(i, j int) bool {
+		if key != nil {
+			a, b := key(inbounds[i]), key(inbounds[j])
+			if a != b {
+				return a < b != desc
+			}
+		}
+		return inbounds[i].Id < inbounds[j].Id
+	})
+	if !withClientCount {
+		for _, inbound := range inbounds {
+			inbound.ClientCount = 0
+		}
+	}
+	traffics, err := s.getClientTraffics()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, inbound := range inbounds {
+		clients, _ := inbound.GetClients()
+		for _, client := range clients {
+			if traffic := traffics[client.Email]; traffic != nil && client.Email != "" {
+				inbound.ClientStats = append(inbound.ClientStats, traffic)
+			}
+		}
+	}
+
+	total := len(inbounds)
+	if pageSize > 0 {
+		if page < 1 {
+			page = 1
+		}
+		start := (page - 1) * pageSize
+		if start > total {
+			start = total
+		}
+		end := start + pageSize
+		if end > total {
+			end = total
+		}
+		inbounds = inbounds[start:end]
+	}
+	return inbounds, total, nil
+}
+
 func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 	db := database.GetDB()
 	var inbounds []*model.Inbound
@@ -33,8 +121,7 @@ func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
-func (s *InboundService) checkPortExist(port int, ignoreId int) (bool, error) {
-	db := database.GetDB()
+func (s *InboundService) checkPortExist(db *gorm.DB, port int, ignoreId int) (bool, error) {
 	db = db.Model(model.Inbound{}).Where("port = ?", port)
 	if ignoreId > 0 {
 		db = db.Where("id != ?", ignoreId)
@@ -47,55 +134,139 @@ func (s *InboundService) checkPortExist(port int, ignoreId int) (bool, error) {
 	return count > 0, nil
 }
 
-func (s *InboundService) AddInbound(inbound *model.Inbound) error {
-	exist, err := s.checkPortExist(inbound.Port, 0)
+// CheckEnabledInboundLimit checks whether adding more enabled inbounds stays within the
+// configured limits, it warns past the soft limit and refuses past the hard limit unless forced
+func (s *InboundService) CheckEnabledInboundLimit(adding int, force bool) error {
+	if adding <= 0 {
+		return nil
+	}
+	softLimit, err := s.settingService.GetInboundSoftLimit()
 	if err != nil {
 		return err
 	}
-	if exist {
-		return common.NewError("端口已存在:", inbound.Port)
+	hardLimit, err := s.settingService.GetInboundHardLimit()
+	if err != nil {
+		return err
+	}
+	if softLimit <= 0 && hardLimit <= 0 {
+		return nil
 	}
 	db := database.GetDB()
-	return db.Save(inbound).Error
-}
-
-func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
-	for _, inbound := range inbounds {
-		exist, err := s.checkPortExist(inbound.Port, 0)
-		if err != nil {
-			return err
-		}
-		if exist {
-			return common.NewError("端口已存在:", inbound.Port)
+	var count int64
+	err = db.Model(model.Inbound{}).Where("enable = ?", true).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	total := int(count) + adding
+	if hardLimit > 0 && total > hardLimit {
+		if !force {
+			return common.NewErrorf("enabled inbounds would be %v, more than the limit %v", total, hardLimit)
 		}
+		logger.Warningf("enabled inbounds will be %v, more than the limit %v, forced", total, hardLimit)
+		return nil
+	}
+	if softLimit > 0 && total >= softLimit {
+		logger.Warningf("enabled inbounds will be %v, reaching the warning limit %v", total, softLimit)
 	}
+	return nil
+}
+
+// InboundBatch applies inbound mutations inside one transaction, see WithBatch
+type InboundBatch struct {
+	tx             *gorm.DB
+	inboundService *InboundService
+}
+
+func (b *InboundBatch) AddInbound(inbound *model.Inbound) error {
+	return b.inboundService.addInbound(b.tx, inbound)
+}
 
+func (b *InboundBatch) UpdateInbound(inbound *model.Inbound) error {
+	return b.inboundService.updateInbound(b.tx, inbound)
+}
+
+func (b *InboundBatch) DelInbound(id int) error {
+	return b.inboundService.delInbound(b.tx, id)
+}
+
+func (b *InboundBatch) SetInboundEnable(id int, enable bool) error {
+	return b.tx.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Update("enable", enable).
+		Error
+}
+
+// WithBatch runs fn in a single transaction, all of its mutations are committed
+// together or none of them are, so the caller only needs to restart xray once
+// and a restart in between never sees half of the changes
+func (s *InboundService) WithBatch(fn func(batch *InboundBatch) error) (err error) {
 	db := database.GetDB()
 	tx := db.Begin()
-	var err error
 	defer func() {
+		// a batch that panics half way is rolled back like one that fails
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
 		if err == nil {
-			tx.Commit()
+			err = tx.Commit().Error
 		} else {
 			tx.Rollback()
 		}
 	}()
+	err = fn(&InboundBatch{tx: tx, inboundService: s})
+	return
+}
 
-	for _, inbound := range inbounds {
-		err = tx.Save(inbound).Error
-		if err != nil {
-			return err
-		}
+func (s *InboundService) addInbound(db *gorm.DB, inbound *model.Inbound) error {
+	exist, err := s.checkPortExist(db, inbound.Port, 0)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return common.NewError("端口已存在:", inbound.Port)
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	err = prepareInboundClients(db, inbound)
+	if err != nil {
+		return err
 	}
+	return db.Save(inbound).Error
+}
 
-	return nil
+func (s *InboundService) AddInbound(inbound *model.Inbound) error {
+	return s.addInbound(database.GetDB(), inbound)
 }
 
-func (s *InboundService) DelInbound(id int) error {
-	db := database.GetDB()
+func (s *InboundService) AddInbounds(inbounds []*model.Inbound) error {
+	return s.WithBatch(func(batch *InboundBatch) error {
+		for _, inbound := range inbounds {
+			err := batch.AddInbound(inbound)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *InboundService) delInbound(db *gorm.DB, id int) error {
+	err := db.Where("inbound_id = ?", id).Delete(model.ClientTraffic{}).Error
+	if err != nil {
+		return err
+	}
+	err = db.Where("inbound_id = ?", id).Delete(model.ClientPenalty{}).Error
+	if err != nil {
+		return err
+	}
 	return db.Delete(model.Inbound{}, id).Error
 }
 
+func (s *InboundService) DelInbound(id int) error {
+	return s.delInbound(database.GetDB(), id)
+}
+
 func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 	db := database.GetDB()
 	inbound := &model.Inbound{}
@@ -106,8 +277,8 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 	return inbound, nil
 }
 
-func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
-	exist, err := s.checkPortExist(inbound.Port, inbound.Id)
+func (s *InboundService) updateInbound(db *gorm.DB, inbound *model.Inbound) error {
+	exist, err := s.checkPortExist(db, inbound.Port, inbound.Id)
 	if err != nil {
 		return err
 	}
@@ -115,7 +286,15 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
 		return common.NewError("端口已存在:", inbound.Port)
 	}
 
-	oldInbound, err := s.GetInbound(inbound.Id)
+	clientLock.Lock()
+	defer clientLock.Unlock()
+	err = prepareInboundClients(db, inbound)
+	if err != nil {
+		return err
+	}
+
+	oldInbound := &model.Inbound{}
+	err = db.Model(model.Inbound{}).First(oldInbound, inbound.Id).Error
 	if err != nil {
 		return err
 	}
@@ -132,11 +311,17 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
 	oldInbound.StreamSettings = inbound.StreamSettings
 	oldInbound.Sniffing = inbound.Sniffing
 	oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+	// the inbound got edited, give it another chance
+	oldInbound.RejectCount = 0
+	oldInbound.AutoDisabled = false
 
-	db := database.GetDB()
 	return db.Save(oldInbound).Error
 }
 
+func (s *InboundService) UpdateInbound(inbound *model.Inbound) error {
+	return s.updateInbound(database.GetDB(), inbound)
+}
+
 func (s *InboundService) AddTraffic(traffics []*xray.Traffic) (err error) {
 	if len(traffics) == 0 {
 		return nil
@@ -160,20 +345,295 @@ func (s *InboundService) AddTraffic(traffics []*xray.Traffic) (err error) {
 			if err != nil {
 				return
 			}
+			err = addTrafficHistory(tx.Session(&gorm.Session{NewDB: true}), traffic.Tag, "", traffic.Up, traffic.Down)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// AddClientTraffic adds the traffic of every client to its total and to the traffic history,
+// clients which are on no inbound anymore are skipped
+func (s *InboundService) AddClientTraffic(traffics []*xray.ClientTraffic) (err error) {
+	emailInbounds := map[string]*model.Inbound{}
+	loaded := false
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+	}()
+	for _, traffic := range traffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		if !loaded {
+			emailInbounds, err = s.getEmailInbounds()
+			if err != nil {
+				return
+			}
+			loaded = true
+		}
+		inbound, ok := emailInbounds[traffic.Email]
+		if !ok {
+			continue
+		}
+		result := tx.Model(model.ClientTraffic{}).
+			Where("email = ?", traffic.Email).
+			Updates(map[string]interface{}{
+				"inbound_id": inbound.Id,
+				"up":         gorm.Expr("up + ?", traffic.Up),
+				"down":       gorm.Expr("down + ?", traffic.Down),
+			})
+		err = result.Error
+		if err != nil {
+			return
+		}
+		if result.RowsAffected == 0 {
+			err = tx.Create(&model.ClientTraffic{
+				InboundId: inbound.Id,
+				Email:     traffic.Email,
+				Up:        traffic.Up,
+				Down:      traffic.Down,
+			}).Error
+			if err != nil {
+				return
+			}
+		}
+		err = addTrafficHistory(tx.Session(&gorm.Session{NewDB: true}), inbound.Tag, traffic.Email, traffic.Up, traffic.Down)
+		if err != nil {
+			return
 		}
 	}
 	return
 }
 
-func (s *InboundService) DisableInvalidInbounds() (int64, error) {
+// getEmailInbounds maps the email of every client to its inbound
+func (s *InboundService) getEmailInbounds() (map[string]*model.Inbound, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	emailInbounds := map[string]*model.Inbound{}
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email != "" {
+				emailInbounds[client.Email] = inbound
+			}
+		}
+	}
+	return emailInbounds, nil
+}
+
+// getClientTraffics returns the traffic of every client by its email
+func (s *InboundService) getClientTraffics() (map[string]*model.ClientTraffic, error) {
+	traffics := make([]*model.ClientTraffic, 0)
+	err := database.GetDB().Find(&traffics).Error
+	if err != nil {
+		return nil, err
+	}
+	clientTraffics := make(map[string]*model.ClientTraffic, len(traffics))
+	for _, traffic := range traffics {
+		clientTraffics[traffic.Email] = traffic
+	}
+	return clientTraffics, nil
+}
+
+// getDepletedEmails returns the emails of the clients which used up their traffic or expired by
+// inbound id, they are left out of the xray config like the clients serving a penalty
+func (s *InboundService) getDepletedEmails(inbounds []*model.Inbound, now int64) (map[int]map[string]bool, error) {
+	traffics, err := s.getClientTraffics()
+	if err != nil {
+		return nil, err
+	}
+	emails := map[int]map[string]bool{}
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email == "" {
+				continue
+			}
+			var used int64
+			if traffic := traffics[client.Email]; traffic != nil {
+				used = traffic.Up + traffic.Down
+			}
+			depleted := client.TotalGB > 0 && used >= client.TotalGB
+			expired := client.ExpiryTime > 0 && client.ExpiryTime <= now
+			if !depleted && !expired {
+				continue
+			}
+			if emails[inbound.Id] == nil {
+				emails[inbound.Id] = map[string]bool{}
+			}
+			emails[inbound.Id][client.Email] = true
+		}
+	}
+	return emails, nil
+}
+
+// GetClientTraffic returns the traffic of the client, nil if it has none yet
+func (s *InboundService) GetClientTraffic(email string) (*model.ClientTraffic, error) {
+	traffic := &model.ClientTraffic{}
+	err := database.GetDB().Where("email = ?", email).First(traffic).Error
+	if database.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return traffic, nil
+}
+
+// AddClientPenalty starts the penalty of the client, it returns false when it is already serving one
+func (s *InboundService) AddClientPenalty(inboundId int, email string) (bool, error) {
+	result := database.GetDB().
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.ClientPenalty{InboundId: inboundId, Email: email})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *InboundService) GetClientPenalties() ([]*model.ClientPenalty, error) {
+	penalties := make([]*model.ClientPenalty, 0)
+	err := database.GetDB().Find(&penalties).Error
+	return penalties, err
+}
+
+func (s *InboundService) SetClientPenalty(id int, penalty int) error {
+	return database.GetDB().Model(model.ClientPenalty{}).Where("id = ?", id).Update("penalty", penalty).Error
+}
+
+func (s *InboundService) DelClientPenalty(id int) error {
+	return database.GetDB().Delete(model.ClientPenalty{}, id).Error
+}
+
+// getPenalizedEmails returns the emails of the clients serving a penalty by inbound id
+func (s *InboundService) getPenalizedEmails() (map[int]map[string]bool, error) {
+	penalties, err := s.GetClientPenalties()
+	if err != nil {
+		return nil, err
+	}
+	emails := map[int]map[string]bool{}
+	for _, penalty := range penalties {
+		if emails[penalty.InboundId] == nil {
+			emails[penalty.InboundId] = map[string]bool{}
+		}
+		emails[penalty.InboundId][penalty.Email] = true
+	}
+	return emails, nil
+}
+
+// DisableInvalidInbounds disables the enabled inbounds which expired or used up their traffic and returns them
+func (s *InboundService) DisableInvalidInbounds() ([]*model.Inbound, error) {
 	db := database.GetDB()
 	now := time.Now().Unix() * 1000
-	result := db.Model(model.Inbound{}).
+	inbounds := make([]*model.Inbound, 0)
+	err := db.Model(model.Inbound{}).
 		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
-		Update("enable", false)
-	err := result.Error
-	count := result.RowsAffected
-	return count, err
+		Find(&inbounds).Error
+	if err != nil || len(inbounds) == 0 {
+		return nil, err
+	}
+	ids := make([]int, 0, len(inbounds))
+	for _, inbound := range inbounds {
+		ids = append(ids, inbound.Id)
+	}
+	err = db.Model(model.Inbound{}).Where("id in ?", ids).Update("enable", false).Error
+	if err != nil {
+		return nil, err
+	}
+	return inbounds, nil
+}
+
+func (s *InboundService) DisableInbound(id int) error {
+	db := database.GetDB()
+	return db.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Update("enable", false).Error
+}
+
+// hasClientList reports whether inbounds of the protocol serve the clients in their settings
+func hasClientList(protocol model.Protocol) bool {
+	switch protocol {
+	case model.VMess, model.VLESS, model.Trojan:
+		return true
+	}
+	return false
+}
+
+// GetEmptyInbounds records since when each enabled inbound has had no clients and returns
+// the ones empty for at least period, inbounds of protocols without clients are ignored
+func (s *InboundService) GetEmptyInbounds(period time.Duration) ([]*model.Inbound, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix() * 1000
+	db := database.GetDB()
+	empty := make([]*model.Inbound, 0)
+	for _, inbound := range inbounds {
+		emptySince := int64(0)
+		if inbound.Enable && hasClientList(inbound.Protocol) {
+			clients, err := inbound.GetClients()
+			if err == nil && len(clients) == 0 {
+				emptySince = inbound.EmptySince
+				if emptySince == 0 {
+					emptySince = now
+				}
+			}
+		}
+		if emptySince != inbound.EmptySince {
+			err = db.Model(model.Inbound{}).
+				Where("id = ?", inbound.Id).
+				Update("empty_since", emptySince).
+				Error
+			if err != nil {
+				return nil, err
+			}
+			inbound.EmptySince = emptySince
+		}
+		if emptySince > 0 && now-emptySince >= period.Milliseconds() {
+			empty = append(empty, inbound)
+		}
+	}
+	return empty, nil
+}
+
+// AddInboundReject counts one more xray start failure caused by the inbound and returns the count
+func (s *InboundService) AddInboundReject(id int) (int, error) {
+	db := database.GetDB()
+	err := db.Model(model.Inbound{}).
+		Where("id = ?", id).
+		UpdateColumn("reject_count", gorm.Expr("reject_count + 1")).
+		Error
+	if err != nil {
+		return 0, err
+	}
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return 0, err
+	}
+	return inbound.RejectCount, nil
+}
+
+// AutoDisableInbound disables the inbound and flags it as disabled by the panel
+func (s *InboundService) AutoDisableInbound(id int) error {
+	db := database.GetDB()
+	return db.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"enable": false, "auto_disabled": true}).
+		Error
 }
 
 func (s *InboundService) GetInboundClientIps(clientEmail string) (string, error) {
@@ -186,12 +646,18 @@ func (s *InboundService) GetInboundClientIps(clientEmail string) (string, error)
 	return InboundClientIps.Ips, nil
 }
 
+// DelClientIpsBefore removes the ips of clients which weren't seen since t
+func (s *InboundService) DelClientIpsBefore(t time.Time) error {
+	db := database.GetDB()
+	return db.Where("last_seen < ?", t.Unix()).Delete(model.InboundClientIps{}).Error
+}
+
 func (s *InboundService) ClearClientIps(clientEmail string) error {
 	db := database.GetDB()
 
 	result := db.Model(model.InboundClientIps{}).
 		Where("client_email = ?", clientEmail).
-		Update("ips", "")
+		Updates(map[string]interface{}{"ips": "", "user_agents": ""})
 	err := result.Error
 
 	if err != nil {
@@ -199,3 +665,293 @@ func (s *InboundService) ClearClientIps(clientEmail string) error {
 	}
 	return nil
 }
+
+// FindClient returns the client whose id, password or email is the key and its inbound, nil if there is none
+func (s *InboundService) FindClient(key string) (*model.Inbound, *model.Client, error) {
+	if key == "" {
+		return nil, nil, nil
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if clients[i].ID == key || clients[i].Password == key || clients[i].Email == key {
+				return inbound, &clients[i], nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// GetTgClients returns the clients bound to the telegram user, inbounds[i] is the inbound of clients[i]
+func (s *InboundService) GetTgClients(tgId int64) ([]*model.Inbound, []*model.Client, error) {
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	tgInbounds := make([]*model.Inbound, 0)
+	tgClients := make([]*model.Client, 0)
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if clients[i].TgID == tgId {
+				tgInbounds = append(tgInbounds, inbound)
+				tgClients = append(tgClients, &clients[i])
+			}
+		}
+	}
+	return tgInbounds, tgClients, nil
+}
+
+// SetClientTgId binds the client with the given email to the telegram user, 0 unbinds it
+func (s *InboundService) SetClientTgId(inboundId int, email string, tgId int64) error {
+	return s.updateClient(inboundId, email, func(client *model.Client) {
+		client.TgID = tgId
+	})
+}
+
+// SetClientIpLimit changes limitIp of the client with the given email, 0 means unlimited
+func (s *InboundService) SetClientIpLimit(inboundId int, email string, limit int) error {
+	if limit < 0 {
+		return common.NewError("ip limit can not be negative:", limit)
+	}
+	return s.updateClient(inboundId, email, func(client *model.Client) {
+		client.LimitIP = limit
+	})
+}
+
+// updateClient applies update to the client with the given email and saves its inbound
+func (s *InboundService) updateClient(inboundId int, email string, update func(client *model.Client)) error {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+
+	clients, err := inbound.GetClients()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range clients {
+		if clients[i].Email != email {
+			continue
+		}
+		update(&clients[i])
+		found = true
+	}
+	if !found {
+		return common.NewError("client not found:", email)
+	}
+	err = inbound.SetClients(clients)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Save(inbound).Error
+}
+
+// AddClients appends all clients to the inbound, nothing is added if any of them is invalid
+func (s *InboundService) AddClients(inboundId int, clients []model.Client) error {
+	if len(clients) == 0 {
+		return common.NewError("no client to add")
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		inbound := &model.Inbound{}
+		err := tx.Model(model.Inbound{}).First(inbound, inboundId).Error
+		if err != nil {
+			return err
+		}
+		newClients, err := inbound.GetClients()
+		if err != nil {
+			return err
+		}
+		keys, err := getClientKeys(tx, 0)
+		if err != nil {
+			return err
+		}
+
+		for i := range clients {
+			client := &clients[i]
+			err = keys.prepareClient(inbound.Protocol, client)
+			if err != nil {
+				return err
+			}
+			newClients = append(newClients, *client)
+		}
+		err = inbound.SetClients(newClients)
+		if err != nil {
+			return err
+		}
+		return tx.Save(inbound).Error
+	})
+}
+
+// AddEphemeralClient adds a generated client to the inbound which expires after duration
+// and is deleted by DelExpiredEphemeralClients afterwards
+func (s *InboundService) AddEphemeralClient(inboundId int, duration time.Duration) (*model.Client, error) {
+	if duration <= 0 {
+		return nil, common.NewError("duration must be positive:", duration)
+	}
+	clients := []model.Client{{
+		Email:      "temp-" + random.Seq(8),
+		ExpiryTime: time.Now().Add(duration).Unix() * 1000,
+		Ephemeral:  true,
+	}}
+	err := s.AddClients(inboundId, clients)
+	if err != nil {
+		return nil, err
+	}
+	return &clients[0], nil
+}
+
+// ExtendExpiry moves the expiry of the inbounds and of the clients with the emails later by duration,
+// an expiry of 0 never expires and is kept. Inbounds disabled only because they expired are enabled
+// again, those over their quota, serving an ip penalty or disabled by the panel stay disabled
+func (s *InboundService) ExtendExpiry(inboundIds []int, emails []string, duration time.Duration) error {
+	if duration <= 0 {
+		return common.NewError("duration must be positive:", duration)
+	}
+	if len(inboundIds) == 0 && len(emails) == 0 {
+		return common.NewError("no inbound or client to extend")
+	}
+	ids := map[int]bool{}
+	for _, id := range inboundIds {
+		ids[id] = true
+	}
+	missingEmails := map[string]bool{}
+	for _, email := range emails {
+		missingEmails[email] = true
+	}
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	now := time.Now().Unix() * 1000
+	extend := duration.Milliseconds()
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var inbounds []*model.Inbound
+		err := tx.Model(model.Inbound{}).Find(&inbounds).Error
+		if err != nil {
+			return err
+		}
+		for _, inbound := range inbounds {
+			changed := false
+			if ids[inbound.Id] {
+				delete(ids, inbound.Id)
+				if inbound.ExpiryTime > 0 {
+					expired := inbound.IsExpired(now)
+					inbound.ExpiryTime += extend
+					changed = true
+					if expired && !inbound.Enable && inbound.Penalty < 0 && !inbound.AutoDisabled &&
+						inbound.GetDisableReason(now) == "" {
+						inbound.Enable = true
+					}
+				}
+			}
+			if len(emails) > 0 {
+				clients, err := inbound.GetClients()
+				if err != nil {
+					continue
+				}
+				clientChanged := false
+				for i := range clients {
+					if _, ok := missingEmails[clients[i].Email]; !ok {
+						continue
+					}
+					delete(missingEmails, clients[i].Email)
+					if clients[i].ExpiryTime > 0 {
+						clients[i].ExpiryTime += extend
+						clientChanged = true
+					}
+				}
+				if clientChanged {
+					err = inbound.SetClients(clients)
+					if err != nil {
+						return err
+					}
+					changed = true
+				}
+			}
+			if changed {
+				err = tx.Save(inbound).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for id := range ids {
+			return common.NewError("inbound not found:", id)
+		}
+		for email := range missingEmails {
+			return common.NewError("client not found:", email)
+		}
+		return nil
+	})
+}
+
+// DelExpiredEphemeralClients deletes the expired ephemeral clients of all inbounds and returns how many were deleted
+func (s *InboundService) DelExpiredEphemeralClients() (int, error) {
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	now := time.Now().Unix() * 1000
+	count := 0
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var inbounds []*model.Inbound
+		err := tx.Model(model.Inbound{}).Find(&inbounds).Error
+		if err != nil {
+			return err
+		}
+		for _, inbound := range inbounds {
+			clients, err := inbound.GetClients()
+			if err != nil {
+				continue
+			}
+			newClients := make([]model.Client, 0, len(clients))
+			for _, client := range clients {
+				if client.Ephemeral && client.ExpiryTime > 0 && client.ExpiryTime <= now {
+					continue
+				}
+				newClients = append(newClients, client)
+			}
+			if len(newClients) == len(clients) {
+				continue
+			}
+			count += len(clients) - len(newClients)
+			err = inbound.SetClients(newClients)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(model.Inbound{}).
+				Where("id = ?", inbound.Id).
+				Update("settings", inbound.Settings).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+
+	"github.com/op/go-logging"
+)
+
+func TestCheckEnabledInboundLimit(t *testing.T) {
+	cleanInbounds(t)
+	cleanSettings(t)
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	inboundService := &InboundService{}
+	// three enabled inbounds, the disabled one doesn't count
+	for i := 0; i < 4; i++ {
+		inbound := newClientInbound(t, 47000+i, model.VLESS, nil)
+		inbound.Enable = i < 3
+		err := inboundService.AddInbound(inbound)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		softLimit string
+		hardLimit string
+		adding    int
+		force     bool
+		wantErr   bool
+		wantWarn  string
+	}{
+		{"no limits", "0", "0", 10, false, false, ""},
+		{"below the warning threshold", "5", "6", 1, false, false, ""},
+		{"at the warning threshold", "5", "6", 2, false, false, "reaching the warning limit 5"},
+		{"at the hard cap", "5", "6", 3, false, false, "reaching the warning limit 5"},
+		{"past the hard cap", "5", "6", 4, false, true, ""},
+		{"past the hard cap forced", "5", "6", 4, true, false, "more than the limit 6, forced"},
+		{"only a hard cap", "0", "4", 2, false, true, ""},
+		{"nothing is enabled", "1", "1", 0, false, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			s := &SettingService{}
+			err := s.saveSetting("inboundSoftLimit", tt.softLimit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.saveSetting("inboundHardLimit", tt.hardLimit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = inboundService.CheckEnabledInboundLimit(tt.adding, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckEnabledInboundLimit(%v, %v) error = %v, wantErr %v", tt.adding, tt.force, err, tt.wantErr)
+			}
+			got := logs.String()
+			if tt.wantWarn == "" && got != "" {
+				t.Errorf("CheckEnabledInboundLimit(%v, %v) logged %q, want nothing", tt.adding, tt.force, got)
+			}
+			if tt.wantWarn != "" && !strings.Contains(got, tt.wantWarn) {
+				t.Errorf("CheckEnabledInboundLimit(%v, %v) logged %q, want %q", tt.adding, tt.force, got, tt.wantWarn)
+			}
+		})
+	}
+}
+
+func TestGetInboundList(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	// ties on client count and on traffic keep the order of the ids
+	specs := []struct {
+		clients  int
+		up, down int64
+	}{
+		{2, 200, 300},
+		{0, 100, 200},
+		{3, 50, 50},
+		{2, 300, 0},
+	}
+	ports := make([]int, 0)
+	for i, spec := range specs {
+		port := 47100 + i
+		clients := make([]model.Client, 0)
+		for j := 0; j < spec.clients; j++ {
+			clients = append(clients, model.Client{Email: fmt.Sprintf("list-%v-%v", port, j)})
+		}
+		inbound := newClientInbound(t, port, model.VLESS, clients)
+		inbound.Up = spec.up
+		inbound.Down = spec.down
+		err := inboundService.AddInbound(inbound)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, port)
+	}
+
+	tests := []struct {
+		name            string
+		sortBy          string
+		desc            bool
+		withClientCount bool
+		page            int
+		pageSize        int
+		wantPorts       []int
+		wantCounts      []int
+	}{
+		{"by id", "", false, false, 0, 0, ports, []int{0, 0, 0, 0}},
+		{"by client count", "clientCount", false, true, 0, 0, []int{47101, 47100, 47103, 47102}, []int{0, 2, 2, 3}},
+		{"by client count desc", "clientCount", true, true, 0, 0, []int{47102, 47100, 47103, 47101}, []int{3, 2, 2, 0}},
+		{"by client count without counts", "clientCount", false, false, 0, 0, []int{47101, 47100, 47103, 47102}, []int{0, 0, 0, 0}},
+		{"by traffic", "traffic", false, false, 0, 0, []int{47102, 47101, 47103, 47100}, []int{0, 0, 0, 0}},
+		{"by traffic desc", "traffic", true, false, 0, 0, []int{47100, 47101, 47103, 47102}, []int{0, 0, 0, 0}},
+		{"first page", "traffic", false, false, 1, 3, []int{47102, 47101, 47103}, []int{0, 0, 0}},
+		{"second page", "traffic", false, false, 2, 3, []int{47100}, []int{0}},
+		{"page past the end", "traffic", false, false, 3, 3, []int{}, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbounds, total, err := inboundService.GetInboundList(tt.sortBy, tt.desc, tt.withClientCount, tt.page, tt.pageSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != len(specs) {
+				t.Errorf("total = %v, want %v", total, len(specs))
+			}
+			gotPorts := make([]int, 0)
+			gotCounts := make([]int, 0)
+			for _, inbound := range inbounds {
+				gotPorts = append(gotPorts, inbound.Port)
+				gotCounts = append(gotCounts, inbound.ClientCount)
+			}
+			if !reflect.DeepEqual(gotPorts, tt.wantPorts) {
+				t.Errorf("ports = %v, want %v", gotPorts, tt.wantPorts)
+			}
+			if !reflect.DeepEqual(gotCounts, tt.wantCounts) {
+				t.Errorf("client counts = %v, want %v", gotCounts, tt.wantCounts)
+			}
+		})
+	}
+
+	_, _, err := inboundService.GetInboundList("name", false, false, 0, 0)
+	if err == nil {
+		t.Error("GetInboundList() with an unknown sort didn't fail")
+	}
+}
+
+func TestExtendExpiry(t *testing.T) {
+	cleanInbounds(t)
+	db := database.GetDB()
+	inboundService := &InboundService{}
+	now := time.Now().Unix() * 1000
+	past := now - 3600000
+	future := now + 3600000
+	extend := (time.Hour * 24 * 3).Milliseconds()
+
+	tests := []struct {
+		name       string
+		inbound    model.Inbound
+		wantExpiry int64
+		wantEnable bool
+	}{
+		{"disabled for expiry", model.Inbound{ExpiryTime: past}, past + extend, true},
+		{"expired and over quota", model.Inbound{ExpiryTime: past, Total: 100, Up: 100}, past + extend, false},
+		{"expired and serving a penalty", model.Inbound{ExpiryTime: past, Penalty: 2}, past + extend, false},
+		{"expired and disabled by the panel", model.Inbound{ExpiryTime: past, AutoDisabled: true}, past + extend, false},
+		{"disabled before expiring", model.Inbound{ExpiryTime: future}, future + extend, false},
+		{"never expires", model.Inbound{Enable: true}, 0, true},
+	}
+	ids := make([]int, 0)
+	for i := range tests {
+		inbound := &tests[i].inbound
+		inbound.Port = 47200 + i
+		inbound.Protocol = model.VLESS
+		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
+		inbound.Settings = "{}"
+		err := db.Create(inbound).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, inbound.Id)
+	}
+	clientInbound := newClientInbound(t, 47210, model.VLESS, []model.Client{
+		{Email: "extend-a", ExpiryTime: past},
+		{Email: "extend-b"},
+		{Email: "extend-c", ExpiryTime: past},
+	})
+	err := inboundService.AddInbound(clientInbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing changes when one of them doesn't exist
+	err = inboundService.ExtendExpiry(ids, []string{"extend-a", "extend-unknown"}, time.Hour*24*3)
+	if err == nil {
+		t.Fatal("ExtendExpiry() of an unknown client didn't fail")
+	}
+	inbound, err := inboundService.GetInbound(ids[0])
+	if err != nil || inbound.ExpiryTime != past {
+		t.Fatalf("the failed ExtendExpiry() changed the expiry to %v", inbound.ExpiryTime)
+	}
+
+	err = inboundService.ExtendExpiry(ids, []string{"extend-a", "extend-b"}, time.Hour*24*3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inbound, err := inboundService.GetInbound(ids[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inbound.ExpiryTime != tt.wantExpiry || inbound.Enable != tt.wantEnable {
+				t.Errorf("inbound expiry = %v enable = %v, want %v %v", inbound.ExpiryTime, inbound.Enable, tt.wantExpiry, tt.wantEnable)
+			}
+		})
+	}
+
+	inbound, err = inboundService.GetInbound(clientInbound.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantExpiry := map[string]int64{"extend-a": past + extend, "extend-b": 0, "extend-c": past}
+	clients, err := inbound.GetClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range clients {
+		if client.ExpiryTime != wantExpiry[client.Email] {
+			t.Errorf("client %v expiry = %v, want %v", client.Email, client.ExpiryTime, wantExpiry[client.Email])
+		}
+	}
+
+	for _, duration := range []time.Duration{0, -time.Hour} {
+		err = inboundService.ExtendExpiry(ids, nil, duration)
+		if err == nil {
+			t.Errorf("ExtendExpiry() by %v didn't fail", duration)
+		}
+	}
+	err = inboundService.ExtendExpiry(nil, nil, time.Hour)
+	if err == nil {
+		t.Error("ExtendExpiry() of nothing didn't fail")
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStats is the timing of the runs of a cron job
+type JobStats struct {
+	Name          string        `json:"name"`
+	Runs          int64         `json:"runs"`
+	Failures      int64         `json:"failures"`
+	LastRun       time.Time     `json:"lastRun"`
+	LastDuration  time.Duration `json:"lastDuration"`
+	LastFailed    bool          `json:"lastFailed"`
+	TotalDuration time.Duration `json:"totalDuration"`
+}
+
+var jobStatsLock sync.Mutex
+var jobStats = map[string]*JobStats{}
+
+// RecordJobRun adds a run of the job which started at start and took duration
+func RecordJobRun(name string, start time.Time, duration time.Duration, failed bool) {
+	jobStatsLock.Lock()
+	defer jobStatsLock.Unlock()
+
+	stats, ok := jobStats[name]
+	if !ok {
+		stats = &JobStats{Name: name}
+		jobStats[name] = stats
+	}
+	stats.Runs++
+	if failed {
+		stats.Failures++
+	}
+	stats.LastRun = start
+	stats.LastDuration = duration
+	stats.LastFailed = failed
+	stats.TotalDuration += duration
+}
+
+// GetJobStats returns the stats of every job which ran at least once, sorted by name
+func GetJobStats() []JobStats {
+	jobStatsLock.Lock()
+	defer jobStatsLock.Unlock()
+
+	stats := make([]JobStats, 0, len(jobStats))
+	for _, s := range jobStats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/ldap"
+	"x-ui/util/random"
+	"x-ui/web/entity"
+)
+
+const ldapTimeout = time.Second * 10
+
+// Authenticate returns the user the username and password log in as, checking them against
+// the configured backend
+func (s *UserService) Authenticate(username string, password string) *model.User {
+	backend, err := s.settingService.GetAuthBackend()
+	if err != nil {
+		logger.Warning("get auth backend failed:", err)
+		backend = entity.AuthBackendLocal
+	}
+	if backend == entity.AuthBackendLocal {
+		return s.CheckUser(username, password)
+	}
+	user, err := s.checkLdapUser(username, password)
+	if err != nil {
+		logger.Warning("check ldap user failed:", err)
+	}
+	if user == nil && backend == entity.AuthBackendBoth {
+		return s.CheckUser(username, password)
+	}
+	return user
+}
+
+// getLdapRole returns the highest role the groups map to, empty when none does
+func getLdapRole(groupRoles []*entity.LdapGroupRole, groups []string) string {
+	role := ""
+	for _, groupRole := range groupRoles {
+		for _, group := range groups {
+			if !strings.EqualFold(strings.TrimSpace(group), groupRole.Group) {
+				continue
+			}
+			if role == "" || (&model.User{Role: groupRole.Role}).HasRole(role) {
+				role = groupRole.Role
+			}
+		}
+	}
+	return role
+}
+
+// checkLdapUser returns the panel user of the ldap user when the password is right and a
+// group of the user maps to a role, it returns nil without error for wrong credentials
+func (s *UserService) checkLdapUser(username string, password string) (*model.User, error) {
+	if username == "" || password == "" {
+		return nil, nil
+	}
+	ldapUrl, err := s.settingService.GetLdapUrl()
+	if err != nil {
+		return nil, err
+	}
+	startTls, err := s.settingService.GetLdapStartTls()
+	if err != nil {
+		return nil, err
+	}
+	bindDn, err := s.settingService.GetLdapBindDn()
+	if err != nil {
+		return nil, err
+	}
+	bindPassword, err := s.settingService.GetLdapBindPassword()
+	if err != nil {
+		return nil, err
+	}
+	baseDn, err := s.settingService.GetLdapBaseDn()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := s.settingService.GetLdapUserFilter()
+	if err != nil {
+		return nil, err
+	}
+	groupAttribute, err := s.settingService.GetLdapGroupAttribute()
+	if err != nil {
+		return nil, err
+	}
+	groupRoles, err := s.settingService.GetLdapGroupRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.Dial(ldapUrl, ldapTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if startTls {
+		err = conn.StartTLS()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if bindDn != "" {
+		err = conn.Bind(bindDn, bindPassword)
+		if err != nil {
+			return nil, common.NewError("ldap bind dn can't bind:", err)
+		}
+	}
+	filter = strings.ReplaceAll(filter, "%s", ldap.EscapeFilter(username))
+	// a size limit of 2 is enough to tell an ambiguous filter
+	entries, err := conn.Search(baseDn, filter, []string{groupAttribute}, 2)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if len(entries) > 1 {
+		return nil, common.NewError("ldap user filter matches more than one user:", filter)
+	}
+	err = conn.Bind(entries[0].DN, password)
+	if ldap.IsInvalidCredentials(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	role := getLdapRole(groupRoles, entries[0].GetAttribute(groupAttribute))
+	if role == "" {
+		logger.Infof("ldap user %s is in no group with a panel role", username)
+		return nil, nil
+	}
+	return s.syncLdapUser(username, role)
+}
+
+// syncLdapUser returns the panel user of the ldap user, making it on the first login and
+// giving it the role its groups have now
+func (s *UserService) syncLdapUser(username string, role string) (*model.User, error) {
+	db := database.GetDB()
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("username = ?", username).First(user).Error
+	if database.IsNotFound(err) {
+		user = &model.User{
+			Username: username,
+			Password: random.Seq(32),
+			Source:   model.UserSourceLdap,
+		}
+	} else if err != nil {
+		return nil, err
+	} else if user.Source != model.UserSourceLdap {
+		// ldap must not log anyone in as a local user
+		return nil, common.NewError("a local user has the name of the ldap user:", username)
+	}
+	user.Role = role
+	err = db.Save(user).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// streamInfo is the part of streamSettings needed to build share links
+type streamInfo struct {
+	Network     string `json:"network"`
+	Security    string `json:"security"`
+	TLSSettings struct {
+		ServerName string `json:"serverName"`
+	} `json:"tlsSettings"`
+	XTLSSettings struct {
+		ServerName string `json:"serverName"`
+	} `json:"xtlsSettings"`
+	WSSettings struct {
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+	} `json:"wsSettings"`
+	HTTPSettings struct {
+		Path string   `json:"path"`
+		Host []string `json:"host"`
+	} `json:"httpSettings"`
+	GRPCSettings struct {
+		ServiceName string `json:"serviceName"`
+	} `json:"grpcSettings"`
+}
+
+func (s *streamInfo) serverName() string {
+	switch s.Security {
+	case "tls":
+		return s.TLSSettings.ServerName
+	case "xtls":
+		return s.XTLSSettings.ServerName
+	}
+	return ""
+}
+
+func (s *streamInfo) pathAndHost() (path string, host string) {
+	switch s.Network {
+	case "ws":
+		path = s.WSSettings.Path
+		for name, value := range s.WSSettings.Headers {
+			if strings.ToLower(name) == "host" {
+				host = value
+			}
+		}
+	case "http":
+		path = s.HTTPSettings.Path
+		host = strings.Join(s.HTTPSettings.Host, ",")
+	case "grpc":
+		path = s.GRPCSettings.ServiceName
+	}
+	return
+}
+
+func getStreamInfo(inbound *model.Inbound) (*streamInfo, error) {
+	stream := &streamInfo{Network: "tcp", Security: "none"}
+	if inbound.StreamSettings != "" {
+		err := json.Unmarshal([]byte(inbound.StreamSettings), stream)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+// getClientRemark is the name clients show for the client on the inbound
+func getClientRemark(inbound *model.Inbound, client *model.Client) string {
+	if client.Email != "" {
+		return fmt.Sprintf("%v-%v", inbound.Remark, client.Email)
+	}
+	return inbound.Remark
+}
+
+// GetClientLink builds the share link of the client on the inbound, address is
+// the host clients connect to and is replaced by the tls server name when set
+func GetClientLink(inbound *model.Inbound, client *model.Client, address string) (string, error) {
+	stream, err := getStreamInfo(inbound)
+	if err != nil {
+		return "", err
+	}
+	if serverName := stream.serverName(); serverName != "" {
+		address = serverName
+	}
+	path, host := stream.pathAndHost()
+	remark := getClientRemark(inbound, client)
+	hostPort := net.JoinHostPort(address, strconv.Itoa(inbound.Port))
+
+	switch inbound.Protocol {
+	case model.VMess:
+		network := stream.Network
+		if network == "http" {
+			network = "h2"
+		}
+		obj := map[string]interface{}{
+			"v":    "2",
+			"ps":   remark,
+			"add":  address,
+			"port": inbound.Port,
+			"id":   client.ID,
+			"aid":  client.AlterId,
+			"net":  network,
+			"type": "none",
+			"host": host,
+			"path": path,
+			"tls":  stream.Security,
+		}
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+	case model.VLESS, model.Trojan:
+		params := url.Values{}
+		params.Set("type", stream.Network)
+		params.Set("security", stream.Security)
+		switch stream.Network {
+		case "ws", "http":
+			params.Set("path", path)
+			if host != "" {
+				params.Set("host", host)
+			}
+		case "grpc":
+			params.Set("serviceName", path)
+		}
+		if serverName := stream.serverName(); serverName != "" {
+			params.Set("sni", serverName)
+		}
+		if client.Flow != "" {
+			params.Set("flow", client.Flow)
+		}
+		link := &url.URL{
+			Scheme:   string(inbound.Protocol),
+			Host:     hostPort,
+			RawQuery: params.Encode(),
+			Fragment: remark,
+		}
+		if inbound.Protocol == model.VLESS {
+			link.User = url.User(client.ID)
+		} else {
+			link.User = url.User(client.Password)
+		}
+		return link.String(), nil
+	default:
+		return "", common.NewError("protocol does not support client links:", inbound.Protocol)
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"gorm.io/gorm"
+)
+
+// lockoutStore keeps failure counters, it lives in memory by default and in
+// the database when lockout persistence is enabled so restarts don't reset it
+type lockoutStore interface {
+	get(key string) (*model.Lockout, error)
+	save(lockout *model.Lockout) error
+	delete(key string) error
+	deleteExpired(now int64, idle int64) error
+	listLocked(prefix string, now int64) ([]*model.Lockout, error)
+}
+
+type memoryLockoutStore struct {
+	lockouts map[string]model.Lockout
+}
+
+func (s *memoryLockoutStore) get(key string) (*model.Lockout, error) {
+	lockout, ok := s.lockouts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &lockout, nil
+}
+
+func (s *memoryLockoutStore) save(lockout *model.Lockout) error {
+	s.lockouts[lockout.Key] = *lockout
+	return nil
+}
+
+func (s *memoryLockoutStore) delete(key string) error {
+	delete(s.lockouts, key)
+	return nil
+}
+
+func (s *memoryLockoutStore) deleteExpired(now int64, idle int64) error {
+	for key, lockout := range s.lockouts {
+		if lockout.LockedUntil <= now && lockout.UpdatedAt+idle <= now {
+			delete(s.lockouts, key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryLockoutStore) listLocked(prefix string, now int64) ([]*model.Lockout, error) {
+	lockouts := make([]*model.Lockout, 0)
+	for key, lockout := range s.lockouts {
+		if strings.HasPrefix(key, prefix) && lockout.LockedUntil > now {
+			lockout := lockout
+			lockouts = append(lockouts, &lockout)
+		}
+	}
+	return lockouts, nil
+}
+
+type dbLockoutStore struct{}
+
+func (s *dbLockoutStore) get(key string) (*model.Lockout, error) {
+	db := database.GetDB()
+	lockout := &model.Lockout{}
+	err := db.Model(model.Lockout{}).Where("key = ?", key).First(lockout).Error
+	if database.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return lockout, nil
+}
+
+func (s *dbLockoutStore) save(lockout *model.Lockout) error {
+	db := database.GetDB()
+	return db.Save(lockout).Error
+}
+
+func (s *dbLockoutStore) delete(key string) error {
+	db := database.GetDB()
+	return db.Where("key = ?", key).Delete(model.Lockout{}).Error
+}
+
+func (s *dbLockoutStore) deleteExpired(now int64, idle int64) error {
+	db := database.GetDB()
+	return db.Session(&gorm.Session{AllowGlobalUpdate: true}).
+		Where("locked_until <= ? and updated_at + ? <= ?", now, idle, now).
+		Delete(model.Lockout{}).Error
+}
+
+func (s *dbLockoutStore) listLocked(prefix string, now int64) ([]*model.Lockout, error) {
+	db := database.GetDB()
+	lockouts := make([]*model.Lockout, 0)
+	err := db.Model(model.Lockout{}).
+		Where("key like ? and locked_until > ?", prefix+"%", now).
+		Find(&lockouts).Error
+	return lockouts, err
+}
+
+var lockoutLock sync.Mutex
+var memoryLockouts = &memoryLockoutStore{lockouts: map[string]model.Lockout{}}
+
+type LockoutService struct {
+	settingService SettingService
+}
+
+func (s *LockoutService) getStore() lockoutStore {
+	persist, err := s.settingService.GetLockoutPersist()
+	if err == nil && persist {
+		return &dbLockoutStore{}
+	}
+	return memoryLockouts
+}
+
+// GetLockedUntil returns the time the key stays locked until, zero if it is not locked
+func (s *LockoutService) GetLockedUntil(key string) (time.Time, error) {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	lockout, err := s.getStore().get(key)
+	if err != nil || lockout == nil {
+		return time.Time{}, err
+	}
+	lockedUntil := time.Unix(lockout.LockedUntil, 0)
+	if !lockedUntil.After(time.Now()) {
+		return time.Time{}, nil
+	}
+	return lockedUntil, nil
+}
+
+// AddFailure records a failure for the key and locks it for lockDuration once
+// maxFailures is reached, failures older than lockDuration are forgotten
+func (s *LockoutService) AddFailure(key string, maxFailures int, lockDuration time.Duration) (bool, error) {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	store := s.getStore()
+	lockout, err := store.get(key)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().Unix()
+	if lockout == nil {
+		lockout = &model.Lockout{Key: key}
+	} else if lockout.LockedUntil <= now && lockout.UpdatedAt+int64(lockDuration.Seconds()) <= now {
+		lockout.Count = 0
+		lockout.LockedUntil = 0
+	}
+	lockout.Count++
+	lockout.UpdatedAt = now
+	locked := maxFailures > 0 && lockout.Count >= maxFailures
+	if locked {
+		lockout.Count = 0
+		lockout.LockedUntil = now + int64(lockDuration.Seconds())
+	}
+	return locked, store.save(lockout)
+}
+
+// GetFailures returns the recent failures of the key which didn't lock it yet
+func (s *LockoutService) GetFailures(key string) (int, error) {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	lockout, err := s.getStore().get(key)
+	if err != nil || lockout == nil {
+		return 0, err
+	}
+	return lockout.Count, nil
+}
+
+func (s *LockoutService) Reset(key string) error {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	return s.getStore().delete(key)
+}
+
+// GetLocked returns the entries with the key prefix which are locked now
+func (s *LockoutService) GetLocked(prefix string) ([]*model.Lockout, error) {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	return s.getStore().listLocked(prefix, time.Now().Unix())
+}
+
+// CleanExpired removes entries which are not locked and had no failure for idle
+func (s *LockoutService) CleanExpired(idle time.Duration) error {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+
+	return s.getStore().deleteExpired(time.Now().Unix(), int64(idle.Seconds()))
+}
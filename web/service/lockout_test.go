@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// restartLockouts drops what a restart of the panel loses, the lockouts kept in memory
+func restartLockouts() {
+	lockoutLock.Lock()
+	defer lockoutLock.Unlock()
+	memoryLockouts = &memoryLockoutStore{lockouts: map[string]model.Lockout{}}
+}
+
+func TestLockoutSurvivesRestart(t *testing.T) {
+	tests := []struct {
+		persist    string
+		wantLocked bool
+	}{
+		{"false", false},
+		{"true", true},
+	}
+	for _, tt := range tests {
+		t.Run("persist "+tt.persist, func(t *testing.T) {
+			cleanSettings(t)
+			t.Cleanup(func() {
+				restartLockouts()
+				database.GetDB().Where("1 = 1").Delete(model.Lockout{})
+			})
+			err := (&SettingService{}).saveSetting("lockoutPersist", tt.persist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			const key = "login:203.0.113.60"
+			s := &LockoutService{}
+			for i := 0; i < 3; i++ {
+				_, err = s.AddFailure(key, 3, time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			lockedUntil, err := s.GetLockedUntil(key)
+			if err != nil || lockedUntil.IsZero() {
+				t.Fatalf("GetLockedUntil() before the restart = %v, %v", lockedUntil, err)
+			}
+
+			restartLockouts()
+			s = &LockoutService{}
+			lockedUntil, err = s.GetLockedUntil(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if locked := !lockedUntil.IsZero(); locked != tt.wantLocked {
+				t.Errorf("locked after the restart = %v, want %v", locked, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestLockoutCleanExpired(t *testing.T) {
+	for _, persist := range []string{"false", "true"} {
+		t.Run("persist "+persist, func(t *testing.T) {
+			cleanSettings(t)
+			t.Cleanup(func() {
+				restartLockouts()
+				database.GetDB().Where("1 = 1").Delete(model.Lockout{})
+			})
+			err := (&SettingService{}).saveSetting("lockoutPersist", persist)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := &LockoutService{}
+			now := time.Now().Unix()
+			store := s.getStore()
+			for _, lockout := range []*model.Lockout{
+				{Key: "idle", Count: 1, UpdatedAt: now - 3600},
+				{Key: "recent", Count: 1, UpdatedAt: now - 60},
+				{Key: "locked", UpdatedAt: now - 3600, LockedUntil: now + 600},
+				{Key: "lock ran out", UpdatedAt: now - 3600, LockedUntil: now - 1},
+			} {
+				err = store.save(lockout)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = s.CleanExpired(time.Minute * 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]bool{"idle": false, "recent": true, "locked": true, "lock ran out": false}
+			for key, wantKept := range want {
+				lockout, err := store.get(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if kept := lockout != nil; kept != wantKept {
+					t.Errorf("%v kept = %v, want %v", key, kept, wantKept)
+				}
+			}
+		})
+	}
+}
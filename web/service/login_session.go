@@ -0,0 +1,64 @@
+package service
+
+import (
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// anonymousSessionIdle is how long sessions nobody logged in with, like those of started
+// single sign ons, are kept after their last use
+const anonymousSessionIdle = time.Hour
+
+type LoginSessionService struct {
+}
+
+// GetSessions returns the sessions in force of the user, of every user when userId is 0,
+// the most recently used first
+func (s *LoginSessionService) GetSessions(userId int) ([]*model.LoginSession, error) {
+	db := database.GetDB().Model(model.LoginSession{}).
+		Where("user_id != 0 and expires_at > ?", time.Now().Unix())
+	if userId != 0 {
+		db = db.Where("user_id = ?", userId)
+	}
+	loginSessions := make([]*model.LoginSession, 0)
+	err := db.Order("last_seen desc").Find(&loginSessions).Error
+	return loginSessions, err
+}
+
+// DelSession revokes the session, which must belong to the user unless userId is 0
+func (s *LoginSessionService) DelSession(id int, userId int) error {
+	db := database.GetDB().Where("id = ? and user_id != 0", id)
+	if userId != 0 {
+		db = db.Where("user_id = ?", userId)
+	}
+	result := db.Delete(model.LoginSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewError("session not found:", id)
+	}
+	return nil
+}
+
+// DelOtherSessions revokes every session of the user but the one with sessionId
+func (s *LoginSessionService) DelOtherSessions(userId int, sessionId string) error {
+	return database.GetDB().
+		Where("user_id = ? and session_id != ?", userId, sessionId).
+		Delete(model.LoginSession{}).
+		Error
+}
+
+func (s *LoginSessionService) DelUserSessions(userId int) error {
+	return database.GetDB().Where("user_id = ?", userId).Delete(model.LoginSession{}).Error
+}
+
+func (s *LoginSessionService) DelExpiredSessions() error {
+	now := time.Now()
+	return database.GetDB().
+		Where("expires_at <= ? or (user_id = 0 and last_seen <= ?)", now.Unix(), now.Add(-anonymousSessionIdle).Unix()).
+		Delete(model.LoginSession{}).
+		Error
+}
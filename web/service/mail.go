@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+const mailTimeout = time.Second * 30
+
+// mailAlertChannel is the channel usage alerts sent by mail are remembered under
+const mailAlertChannel = "mail"
+
+// smtpsPort is the port of smtp over tls, other ports start tls when the server offers it
+const smtpsPort = 465
+
+type MailService struct {
+	settingService SettingService
+	alertService   AlertService
+}
+
+// IsEnabled reports whether a smtp server to send mails through is configured
+func (s *MailService) IsEnabled() bool {
+	host, err := s.settingService.GetSmtpHost()
+	if err != nil || host == "" {
+		return false
+	}
+	from, err := s.settingService.GetSmtpFrom()
+	return err == nil && from != ""
+}
+
+func buildMail(from string, to []string, subject string, body string) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", from)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+	return msg.Bytes()
+}
+
+// SendMail sends the mail through the configured smtp server
+func (s *MailService) SendMail(to []string, subject string, body string) error {
+	if len(to) == 0 {
+		return common.NewError("mail has no recipient")
+	}
+	host, err := s.settingService.GetSmtpHost()
+	if err != nil {
+		return err
+	}
+	port, err := s.settingService.GetSmtpPort()
+	if err != nil {
+		return err
+	}
+	username, err := s.settingService.GetSmtpUsername()
+	if err != nil {
+		return err
+	}
+	password, err := s.settingService.GetSmtpPassword()
+	if err != nil {
+		return err
+	}
+	from, err := s.settingService.GetSmtpFrom()
+	if err != nil {
+		return err
+	}
+	if host == "" || from == "" {
+		return common.NewError("smtp server is not configured")
+	}
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), mailTimeout)
+	if err != nil {
+		return err
+	}
+	if port == smtpsPort {
+		conn = tls.Client(conn, &tls.Config{ServerName: host})
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err = client.StartTLS(&tls.Config{ServerName: host})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if username != "" {
+		// PlainAuth refuses to send the password unencrypted to anything but localhost
+		err = client.Auth(smtp.PlainAuth("", username, password, host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(fromAddress.Address)
+	if err != nil {
+		return err
+	}
+	for _, address := range to {
+		err = client.Rcpt(address)
+		if err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(buildMail(from, to, subject, body))
+	if err != nil {
+		return err
+	}
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// SendAdminMail sends the mail to the admins
+func (s *MailService) SendAdminMail(subject string, body string) error {
+	admins, err := s.settingService.GetMailAdmins()
+	if err != nil {
+		return err
+	}
+	return s.SendMail(admins, subject, body)
+}
+
+// NotifyUsageAlerts mails the usage alerts not sent yet to the admins, and the alerts of a
+// client to the client when its email is an address and clients are mailed too
+func (s *MailService) NotifyUsageAlerts() error {
+	if !s.IsEnabled() {
+		return nil
+	}
+	expireDays, err := s.settingService.GetMailExpireDays()
+	if err != nil {
+		return err
+	}
+	mailClients, err := s.settingService.GetMailClients()
+	if err != nil {
+		return err
+	}
+	admins, err := s.settingService.GetMailAdmins()
+	if err != nil {
+		return err
+	}
+	if len(admins) == 0 && !mailClients {
+		return nil
+	}
+	alerts, err := s.alertService.GetUsageAlerts(time.Now(), expireDays)
+	if err != nil {
+		return err
+	}
+	alerts, err = s.alertService.GetNewAlerts(mailAlertChannel, alerts)
+	if err != nil || len(alerts) == 0 {
+		return err
+	}
+
+	if len(admins) > 0 {
+		subject := alerts[0].Subject
+		if len(alerts) > 1 {
+			subject = fmt.Sprintf("x-ui: %v 条流量和到期提醒", len(alerts))
+		}
+		err = s.SendMail(admins, subject, formatAlerts(alerts))
+		if err != nil {
+			return err
+		}
+	}
+	for _, alert := range alerts {
+		if mailClients && alert.ClientEmail != "" {
+			if address, err := mail.ParseAddress(alert.ClientEmail); err == nil {
+				err = s.SendMail([]string{address.Address}, alert.Subject, alert.Body)
+				if err != nil {
+					logger.Warning("mail usage alert to client failed:", err)
+				}
+			}
+		}
+		err = s.alertService.SetAlertSent(mailAlertChannel, alert)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
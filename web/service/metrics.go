@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var panelStartTime = time.Now()
+
+type MetricsService struct {
+	inboundService InboundService
+	xrayService    XrayService
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name string, help string, metricType string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, metricType)
+}
+
+func escapeMetricLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// GetMetrics returns the panel metrics in prometheus text format
+func (s *MetricsService) GetMetrics() (string, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+
+	writeMetricHeader(buf, "xui_inbound_up_bytes", "Uploaded bytes of the inbound.", "counter")
+	for _, inbound := range inbounds {
+		fmt.Fprintf(buf, "xui_inbound_up_bytes{tag=\"%s\",remark=\"%s\"} %d\n",
+			escapeMetricLabel(inbound.Tag), escapeMetricLabel(inbound.Remark), inbound.Up)
+	}
+	writeMetricHeader(buf, "xui_inbound_down_bytes", "Downloaded bytes of the inbound.", "counter")
+	for _, inbound := range inbounds {
+		fmt.Fprintf(buf, "xui_inbound_down_bytes{tag=\"%s\",remark=\"%s\"} %d\n",
+			escapeMetricLabel(inbound.Tag), escapeMetricLabel(inbound.Remark), inbound.Down)
+	}
+
+	enabled := 0
+	for _, inbound := range inbounds {
+		if inbound.Enable {
+			enabled++
+		}
+	}
+	writeMetricHeader(buf, "xui_inbounds", "Number of inbounds by state.", "gauge")
+	fmt.Fprintf(buf, "xui_inbounds{state=\"enabled\"} %d\n", enabled)
+	fmt.Fprintf(buf, "xui_inbounds{state=\"disabled\"} %d\n", len(inbounds)-enabled)
+
+	xrayRunning := 0
+	if s.xrayService.IsXrayRunning() {
+		xrayRunning = 1
+	}
+	writeMetricHeader(buf, "xui_xray_running", "Whether xray is running.", "gauge")
+	fmt.Fprintf(buf, "xui_xray_running %d\n", xrayRunning)
+
+	writeMetricHeader(buf, "xui_uptime_seconds", "Seconds since the panel started.", "gauge")
+	fmt.Fprintf(buf, "xui_uptime_seconds %d\n", int64(time.Since(panelStartTime).Seconds()))
+
+	jobStats := GetJobStats()
+	writeMetricHeader(buf, "xui_job_runs_total", "Runs of the cron job.", "counter")
+	for _, stats := range jobStats {
+		fmt.Fprintf(buf, "xui_job_runs_total{job=\"%s\"} %d\n", escapeMetricLabel(stats.Name), stats.Runs)
+	}
+	writeMetricHeader(buf, "xui_job_failures_total", "Failed runs of the cron job.", "counter")
+	for _, stats := range jobStats {
+		fmt.Fprintf(buf, "xui_job_failures_total{job=\"%s\"} %d\n", escapeMetricLabel(stats.Name), stats.Failures)
+	}
+	writeMetricHeader(buf, "xui_job_duration_seconds_total", "Seconds spent running the cron job.", "counter")
+	for _, stats := range jobStats {
+		fmt.Fprintf(buf, "xui_job_duration_seconds_total{job=\"%s\"} %g\n", escapeMetricLabel(stats.Name), stats.TotalDuration.Seconds())
+	}
+	writeMetricHeader(buf, "xui_job_last_duration_seconds", "Seconds the last run of the cron job took.", "gauge")
+	for _, stats := range jobStats {
+		fmt.Fprintf(buf, "xui_job_last_duration_seconds{job=\"%s\"} %g\n", escapeMetricLabel(stats.Name), stats.LastDuration.Seconds())
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+const (
+	EventInboundCreated  = "inbound.created"
+	EventInboundDisabled = "inbound.disabled"
+	EventClientExpired   = "client.expired"
+	EventXrayCrashed     = "xray.crashed"
+	EventLoginFailed     = "login.failed"
+	EventTest            = "test"
+)
+
+// webhookAlertChannel is the channel client expiry sent to webhooks is remembered under
+const webhookAlertChannel = "webhook"
+
+const webhookTimeout = time.Second * 10
+
+// webhookAttempts is how many times an event is posted before it is given up, waiting
+// twice as long before every next attempt
+const webhookAttempts = 3
+
+const webhookRetryDelay = time.Second * 2
+
+// Notification is the json body posted to webhooks
+type Notification struct {
+	Event string      `json:"event"`
+	Time  int64       `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// InboundEvent is the data of the inbound events, Reason tells why an inbound got disabled
+type InboundEvent struct {
+	Id          int    `json:"id"`
+	Tag         string `json:"tag"`
+	Remark      string `json:"remark"`
+	Port        int    `json:"port"`
+	Reason      string `json:"reason,omitempty"`
+	ClientEmail string `json:"clientEmail,omitempty"`
+}
+
+func NewInboundEvent(inbound *model.Inbound, reason string) *InboundEvent {
+	return &InboundEvent{
+		Id:     inbound.Id,
+		Tag:    inbound.Tag,
+		Remark: inbound.Remark,
+		Port:   inbound.Port,
+		Reason: reason,
+	}
+}
+
+type ClientEvent struct {
+	Email      string `json:"email"`
+	InboundId  int    `json:"inboundId"`
+	ExpiryTime int64  `json:"expiryTime"`
+}
+
+type XrayEvent struct {
+	Error  string `json:"error,omitempty"`
+	Output string `json:"output,omitempty"`
+}
+
+type LoginEvent struct {
+	Username string `json:"username"`
+	Ip       string `json:"ip"`
+}
+
+type NotificationService struct {
+	settingService SettingService
+	inboundService InboundService
+	alertService   AlertService
+}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// isEventEnabled reports whether webhooks want the event, the test event is always wanted
+func (s *NotificationService) isEventEnabled(event string) bool {
+	if event == EventTest {
+		return true
+	}
+	events, err := s.settingService.GetWebhookEvents()
+	if err != nil {
+		return false
+	}
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// discordMessageMax is the most characters discord takes in a message
+const discordMessageMax = 2000
+
+// chatFormatters turn a message into the body the webhooks of a chat service take,
+// by the setting listing the webhooks
+var chatFormatters = map[string]func(msg string) interface{}{
+	"discordWebhooks": formatDiscordMessage,
+	"slackWebhooks":   formatSlackMessage,
+}
+
+func formatDiscordMessage(msg string) interface{} {
+	content := []rune(msg)
+	if len(content) > discordMessageMax {
+		content = content[:discordMessageMax]
+	}
+	return map[string]interface{}{
+		"content": string(content),
+		// names in the remarks must not ping anyone
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+}
+
+// slackEscaper escapes the characters slack reads as markup
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func formatSlackMessage(msg string) interface{} {
+	return map[string]string{"text": slackEscaper.Replace(msg)}
+}
+
+// formatEvent returns the event as a message for people
+func formatEvent(event string, data interface{}) string {
+	switch data := data.(type) {
+	case *InboundEvent:
+		if event == EventInboundCreated {
+			return fmt.Sprintf("新增入站 %v (%v)，端口 %v\r\n", data.Tag, data.Remark, data.Port)
+		}
+		msg := fmt.Sprintf("入站 %v (%v) 已被禁用，原因: %v\r\n", data.Tag, data.Remark, data.Reason)
+		if data.ClientEmail != "" {
+			msg += fmt.Sprintf("用户: %v\r\n", data.ClientEmail)
+		}
+		return msg
+	case *ClientEvent:
+		return fmt.Sprintf("用户 %v 已到期\r\n", data.Email)
+	case *XrayEvent:
+		msg := "xray 已停止运行，正在尝试重启\r\n"
+		if data.Error != "" {
+			msg += fmt.Sprintf("错误: %v\r\n", data.Error)
+		}
+		return msg
+	case *LoginEvent:
+		return fmt.Sprintf("面板登录失败，用户: %v，IP: %v\r\n", data.Username, data.Ip)
+	}
+	if event == EventTest {
+		return "x-ui 测试消息\r\n"
+	}
+	return event + "\r\n"
+}
+
+// signWebhook returns the hex hmac sha256 of the body with the secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(url string, event string, secret string, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "x-ui")
+	if event != "" {
+		request.Header.Set("X-Xui-Event", event)
+	}
+	if secret != "" {
+		request.Header.Set("X-Xui-Signature", "sha256="+signWebhook(secret, body))
+	}
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return common.NewErrorf("webhook %v answered %v", url, response.Status)
+	}
+	return nil
+}
+
+// postWebhookWithRetry posts the body until the webhook takes it or webhookAttempts are used
+func postWebhookWithRetry(url string, event string, secret string, body []byte) error {
+	var err error
+	delay := webhookRetryDelay
+	for i := 0; i < webhookAttempts; i++ {
+		if i > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		err = postWebhook(url, event, secret, body)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// hasTargets reports whether any webhook or chat webhook is configured
+func (s *NotificationService) hasTargets() bool {
+	for _, key := range []string{"webhookUrls", "discordWebhooks", "slackWebhooks"} {
+		urls, err := s.settingService.splitSetting(key)
+		if err == nil && len(urls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts the event as json to every webhook and as a message to every chat webhook,
+// it returns the first failure
+func (s *NotificationService) Send(event string, data interface{}) error {
+	if !s.hasTargets() {
+		return common.NewError("no webhook configured")
+	}
+	urls, err := s.settingService.GetWebhookUrls()
+	if err != nil {
+		return err
+	}
+	secret, err := s.settingService.GetWebhookSecret()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(&Notification{
+		Event: event,
+		Time:  time.Now().Unix(),
+		Data:  data,
+	})
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, url := range urls {
+		err = postWebhookWithRetry(url, event, secret, body)
+		if err != nil {
+			logger.Warningf("post %v to webhook failed: %v", event, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	err = s.sendChats(event, formatEvent(event, data))
+	if firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// Notify sends the event in the background, when any webhook is configured and wants it
+func (s *NotificationService) Notify(event string, data interface{}) {
+	if !s.hasTargets() || !s.isEventEnabled(event) {
+		return
+	}
+	go s.Send(event, data)
+}
+
+// NotifyChats sends an alert of a job which isn't one of the events to the chat webhooks in the background
+func (s *NotificationService) NotifyChats(msg string) {
+	go s.sendChats("", msg)
+}
+
+// sendChats posts the message to every discord and slack webhook and returns the first failure
+func (s *NotificationService) sendChats(event string, msg string) error {
+	var firstErr error
+	for key, format := range chatFormatters {
+		urls, err := s.settingService.splitSetting(key)
+		if err != nil {
+			return err
+		}
+		if len(urls) == 0 {
+			continue
+		}
+		body, err := json.Marshal(format(msg))
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			err = postWebhookWithRetry(url, event, "", body)
+			if err != nil {
+				logger.Warningf("post message to %v failed: %v", key, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	return firstErr
+}
+
+// NotifyExpiredClients posts the clients which expired since the last check
+func (s *NotificationService) NotifyExpiredClients() error {
+	if !s.hasTargets() || !s.isEventEnabled(EventClientExpired) {
+		return nil
+	}
+	alerts, err := s.alertService.GetUsageAlerts(time.Now(), 0)
+	if err != nil {
+		return err
+	}
+	expired := make([]*UsageAlert, 0)
+	for _, alert := range alerts {
+		if alert.ClientEmail != "" && alert.Kind == UsageAlertExpired {
+			expired = append(expired, alert)
+		}
+	}
+	expired, err = s.alertService.GetNewAlerts(webhookAlertChannel, expired)
+	if err != nil {
+		return err
+	}
+	for _, alert := range expired {
+		event := &ClientEvent{Email: alert.ClientEmail}
+		inbound, client, err := s.inboundService.FindClient(alert.ClientEmail)
+		if err == nil && client != nil {
+			event.InboundId = inbound.Id
+			event.ExpiryTime = client.ExpiryTime
+		}
+		s.Notify(EventClientExpired, event)
+		err = s.alertService.SetAlertSent(webhookAlertChannel, alert)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
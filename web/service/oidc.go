@@ -0,0 +1,288 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+const oidcTimeout = time.Second * 10
+
+// oidcDiscoveryTtl is how long the configuration of the provider is kept before it is fetched again
+const oidcDiscoveryTtl = time.Hour
+
+// oidcResponseMax is the most bytes read from an answer of the provider
+const oidcResponseMax = 1 << 20
+
+// OidcProvider is the part of the openid configuration of the provider the login flow uses
+type OidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// OidcLogin is what a login started by the panel has to match when the provider sends the user back
+type OidcLogin struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+type OidcService struct {
+	settingService SettingService
+}
+
+var oidcClient = &http.Client{Timeout: oidcTimeout}
+
+var oidcProvider *OidcProvider
+var oidcProviderTime time.Time
+var oidcProviderLock sync.Mutex
+
+// IsEnabled reports whether single sign on is configured
+func (s *OidcService) IsEnabled() bool {
+	issuer, err := s.settingService.GetOidcIssuer()
+	if err != nil || issuer == "" {
+		return false
+	}
+	clientId, err := s.settingService.GetOidcClientId()
+	return err == nil && clientId != ""
+}
+
+func oidcGetJson(request *http.Request, v interface{}) error {
+	request.Header.Set("Accept", "application/json")
+	response, err := oidcClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, oidcResponseMax))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return common.NewErrorf("%v answered %v: %s", request.URL.Host, response.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// getProvider returns the openid configuration the issuer publishes
+func (s *OidcService) getProvider() (*OidcProvider, error) {
+	issuer, err := s.settingService.GetOidcIssuer()
+	if err != nil {
+		return nil, err
+	}
+	issuer = strings.TrimSuffix(issuer, "/")
+	oidcProviderLock.Lock()
+	defer oidcProviderLock.Unlock()
+	if oidcProvider != nil && strings.TrimSuffix(oidcProvider.Issuer, "/") == issuer &&
+		time.Since(oidcProviderTime) < oidcDiscoveryTtl {
+		return oidcProvider, nil
+	}
+	request, err := http.NewRequest(http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	provider := &OidcProvider{}
+	err = oidcGetJson(request, provider)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, common.NewError("oidc provider claims to be another issuer:", provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" {
+		return nil, common.NewError("oidc provider configuration misses endpoints")
+	}
+	// the id token is trusted for coming from the token endpoint, which only tls makes sure of
+	if !strings.HasPrefix(provider.TokenEndpoint, "https://") {
+		return nil, common.NewError("oidc token endpoint is not https:", provider.TokenEndpoint)
+	}
+	oidcProvider = provider
+	oidcProviderTime = time.Now()
+	return provider, nil
+}
+
+func newOidcToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewLogin starts a login, returning the url of the provider to send the user to and
+// what the answer must match
+func (s *OidcService) NewLogin(redirectUrl string) (string, *OidcLogin, error) {
+	provider, err := s.getProvider()
+	if err != nil {
+		return "", nil, err
+	}
+	clientId, err := s.settingService.GetOidcClientId()
+	if err != nil {
+		return "", nil, err
+	}
+	login := &OidcLogin{}
+	for _, token := range []*string{&login.State, &login.Nonce, &login.CodeVerifier} {
+		*token, err = newOidcToken()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	challenge := sha256.Sum256([]byte(login.CodeVerifier))
+	authUrl, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		return "", nil, err
+	}
+	query := authUrl.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", clientId)
+	query.Set("redirect_uri", redirectUrl)
+	query.Set("scope", "openid profile email")
+	query.Set("state", login.State)
+	query.Set("nonce", login.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	authUrl.RawQuery = query.Encode()
+	return authUrl.String(), login, nil
+}
+
+// parseIdToken returns the claims of the id token. The token comes straight from the token
+// endpoint over tls, which is enough to trust it without checking its signature
+func parseIdToken(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, common.NewError("id token is not a jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// checkIdToken returns an error when the claims of the id token aren't meant for this login
+func checkIdToken(claims map[string]interface{}, issuer string, clientId string, nonce string, now time.Time) error {
+	iss, _ := claims["iss"].(string)
+	if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(issuer, "/") {
+		return common.NewError("id token is from another issuer:", iss)
+	}
+	// the audience is either one client or a list of them
+	found := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		found = aud == clientId
+	case []interface{}:
+		for _, a := range aud {
+			if a == clientId {
+				found = true
+			}
+		}
+	}
+	if !found {
+		return common.NewError("id token is for another client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if int64(exp) <= now.Unix() {
+		return common.NewError("id token has expired")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return common.NewError("id token is for another login")
+	}
+	return nil
+}
+
+// Finish exchanges the code the provider sent the user back with for the id token of the
+// user and returns the panel user the token names
+func (s *OidcService) Finish(redirectUrl string, login *OidcLogin, state string, code string) (*model.User, error) {
+	if login == nil || state == "" || state != login.State {
+		return nil, common.NewError("oidc login state does not match")
+	}
+	if code == "" {
+		return nil, common.NewError("oidc provider sent no code")
+	}
+	provider, err := s.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	clientId, err := s.settingService.GetOidcClientId()
+	if err != nil {
+		return nil, err
+	}
+	clientSecret, err := s.settingService.GetOidcClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectUrl)
+	form.Set("client_id", clientId)
+	form.Set("code_verifier", login.CodeVerifier)
+	request, err := http.NewRequest(http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+	}
+	token := &struct {
+		IdToken string `json:"id_token"`
+	}{}
+	err = oidcGetJson(request, token)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := parseIdToken(token.IdToken)
+	if err != nil {
+		return nil, err
+	}
+	err = checkIdToken(claims, provider.Issuer, clientId, login.Nonce, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.getUser(claims)
+}
+
+// getUser returns the panel user whose username is the configured claim of the id token
+func (s *OidcService) getUser(claims map[string]interface{}) (*model.User, error) {
+	claim, err := s.settingService.GetOidcUsernameClaim()
+	if err != nil {
+		return nil, err
+	}
+	username, _ := claims[claim].(string)
+	if username == "" {
+		return nil, common.NewError("id token has no claim", claim)
+	}
+	// providers may let users set any email, only one the provider verified names a user
+	if claim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return nil, common.NewError("email is not verified:", username)
+		}
+	}
+	user := &model.User{}
+	err = database.GetDB().Model(model.User{}).Where("username = ?", username).First(user).Error
+	if database.IsNotFound(err) {
+		return nil, common.NewError("no panel user named", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// newIdToken returns an unsigned jwt of the claims, the panel doesn't check the signature
+func newIdToken(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+// testOidcProvider answers like an openid provider, the id token it gives has the nonce
+// and the code challenge of the last authorization url it was given
+type testOidcProvider struct {
+	server    *httptest.Server
+	challenge string
+	nonce     string
+}
+
+func newTestOidcProvider(t *testing.T) *testOidcProvider {
+	provider := &testOidcProvider{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&OidcProvider{
+			Issuer:                provider.server.URL,
+			AuthorizationEndpoint: provider.server.URL + "/auth",
+			TokenEndpoint:         provider.server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != provider.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": newIdToken(t, map[string]interface{}{
+			"iss":            provider.server.URL,
+			"aud":            "panel",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"nonce":          provider.nonce,
+			"email":          "sso@example.com",
+			"email_verified": true,
+		})})
+	})
+	provider.server = httptest.NewTLSServer(mux)
+	t.Cleanup(provider.server.Close)
+
+	client := oidcClient
+	oidcClient = provider.server.Client()
+	t.Cleanup(func() {
+		oidcClient = client
+		oidcProvider = nil
+	})
+	cleanSettings(t)
+	s := &SettingService{}
+	for key, value := range map[string]string{"oidcIssuer": provider.server.URL, "oidcClientId": "panel"} {
+		err := s.saveSetting(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return provider
+}
+
+// authorize reads what the provider keeps of the authorization url
+func (p *testOidcProvider) authorize(t *testing.T, authUrl string) {
+	t.Helper()
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("authorization url %v doesn't use S256", authUrl)
+	}
+	p.challenge = u.Query().Get("code_challenge")
+	p.nonce = u.Query().Get("nonce")
+}
+
+func TestOidcStateAndNonce(t *testing.T) {
+	provider := newTestOidcProvider(t)
+	db := database.GetDB()
+	user := &model.User{Username: "sso@example.com", Password: "password", Role: model.RoleAdmin}
+	err := db.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(user)
+
+	tests := []struct {
+		name string
+		// change alters the login before it is finished, the state is what the provider sends back
+		change  func(login *OidcLogin, state *string)
+		wantErr bool
+	}{
+		{"matching", func(login *OidcLogin, state *string) {}, false},
+		{"other state", func(login *OidcLogin, state *string) { *state = "other" }, true},
+		{"no state", func(login *OidcLogin, state *string) { *state = "" }, true},
+		{"no stored state", func(login *OidcLogin, state *string) { login.State = ""; *state = "" }, true},
+		{"other nonce", func(login *OidcLogin, state *string) { provider.nonce = "other" }, true},
+		{"other code verifier", func(login *OidcLogin, state *string) { login.CodeVerifier = "other" }, true},
+	}
+	s := &OidcService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authUrl, login, err := s.NewLogin("https://panel.example.com/oidc/callback")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if login.State == login.Nonce || login.State == login.CodeVerifier || login.Nonce == login.CodeVerifier {
+				t.Errorf("login tokens are not unique: %+v", login)
+			}
+			provider.authorize(t, authUrl)
+			state := login.State
+			tt.change(login, &state)
+			got, err := s.Finish("https://panel.example.com/oidc/callback", login, state, "code")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Finish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Id != user.Id {
+				t.Errorf("Finish() = user %v, want %v", got.Id, user.Id)
+			}
+		})
+	}
+
+	_, err = s.Finish("https://panel.example.com/oidc/callback", nil, "", "code")
+	if err == nil {
+		t.Error("Finish() without a started login succeeded")
+	}
+}
+
+func TestCheckIdToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://id.example.com/",
+			"aud":   "panel",
+			"exp":   float64(now.Unix() + 60),
+			"nonce": "nonce",
+		}
+	}
+	tests := []struct {
+		name    string
+		change  func(claims map[string]interface{})
+		wantErr bool
+	}{
+		{"valid", func(claims map[string]interface{}) {}, false},
+		{"audience list", func(claims map[string]interface{}) { claims["aud"] = []interface{}{"other", "panel"} }, false},
+		{"other issuer", func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" }, true},
+		{"other audience", func(claims map[string]interface{}) { claims["aud"] = "other" }, true},
+		{"expired", func(claims map[string]interface{}) { claims["exp"] = float64(now.Unix()) }, true},
+		{"no expiry", func(claims map[string]interface{}) { delete(claims, "exp") }, true},
+		{"other nonce", func(claims map[string]interface{}) { claims["nonce"] = "other" }, true},
+		{"no nonce", func(claims map[string]interface{}) { delete(claims, "nonce") }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+			err := checkIdToken(claims, "https://id.example.com", "panel", "nonce", now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkIdToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOidcGetUser(t *testing.T) {
+	cleanSettings(t)
+	db := database.GetDB()
+	user := &model.User{Username: "sso@example.com", Password: "password", Role: model.RoleAdmin}
+	err := db.Create(user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Delete(user)
+
+	tests := []struct {
+		name    string
+		claim   string
+		claims  map[string]interface{}
+		wantErr bool
+	}{
+		{"verified email", "email", map[string]interface{}{"email": "sso@example.com", "email_verified": true}, false},
+		{"unverified email", "email", map[string]interface{}{"email": "sso@example.com", "email_verified": false}, true},
+		{"email without email_verified", "email", map[string]interface{}{"email": "sso@example.com"}, true},
+		{"email_verified as a string", "email", map[string]interface{}{"email": "sso@example.com", "email_verified": "true"}, true},
+		{"unknown email", "email", map[string]interface{}{"email": "other@example.com", "email_verified": true}, true},
+		{"no email", "email", map[string]interface{}{"email_verified": true}, true},
+		{"other claim", "preferred_username", map[string]interface{}{"preferred_username": "sso@example.com"}, false},
+	}
+	s := &OidcService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.settingService.saveSetting("oidcUsernameClaim", tt.claim)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.getUser(tt.claims)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Id != user.Id {
+				t.Errorf("getUser() = user %v, want %v", got.Id, user.Id)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+const (
+	dnsOutboundTag = "dns-out"
+	// dnsInboundTag marks queries made by the xray dns module itself so they can be routed
+	dnsInboundTag = "dns-internal"
+)
+
+type RoutingService struct {
+	settingService SettingService
+}
+
+func getTemplateOutbounds(template map[string]interface{}) []interface{} {
+	outbounds, _ := template["outbounds"].([]interface{})
+	return outbounds
+}
+
+func hasOutboundTag(template map[string]interface{}, tag string) bool {
+	for _, o := range getTemplateOutbounds(template) {
+		outbound, ok := o.(map[string]interface{})
+		if ok && outbound["tag"] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func getTemplateRouting(template map[string]interface{}) map[string]interface{} {
+	routing, ok := template["routing"].(map[string]interface{})
+	if !ok {
+		routing = map[string]interface{}{}
+		template["routing"] = routing
+	}
+	return routing
+}
+
+// insertRoutingRule puts the rule after the api rules, rules match in order
+// and the api rule must stay first for the panel to get traffic stats
+func insertRoutingRule(template map[string]interface{}, rule interface{}) {
+	routing := getTemplateRouting(template)
+	rules, _ := routing["rules"].([]interface{})
+	index := 0
+	for ; index < len(rules); index++ {
+		r, ok := rules[index].(map[string]interface{})
+		if !ok || r["outboundTag"] != "api" {
+			break
+		}
+	}
+	newRules := make([]interface{}, 0, len(rules)+1)
+	newRules = append(newRules, rules[:index]...)
+	newRules = append(newRules, rule)
+	newRules = append(newRules, rules[index:]...)
+	routing["rules"] = newRules
+}
+
+func getTemplateBalancers(template map[string]interface{}) []interface{} {
+	balancers, _ := getTemplateRouting(template)["balancers"].([]interface{})
+	return balancers
+}
+
+func hasBalancerTag(template map[string]interface{}, tag string) bool {
+	for _, b := range getTemplateBalancers(template) {
+		balancer, ok := b.(map[string]interface{})
+		if ok && balancer["tag"] == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddClientRoute routes traffic of the client email or the inbound tag to the outbound tag
+func (s *RoutingService) AddClientRoute(email string, inboundTag string, outboundTag string) error {
+	return s.addClientRoute(email, inboundTag, outboundTag, "")
+}
+
+// AddBalancerRoute routes traffic of the client email or the inbound tag to the balancer
+func (s *RoutingService) AddBalancerRoute(email string, inboundTag string, balancerTag string) error {
+	return s.addClientRoute(email, inboundTag, "", balancerTag)
+}
+
+func (s *RoutingService) addClientRoute(email string, inboundTag string, outboundTag string, balancerTag string) error {
+	if email == "" && inboundTag == "" {
+		return common.NewError("email or inbound tag is required")
+	}
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	if balancerTag != "" {
+		if !hasBalancerTag(template, balancerTag) {
+			return common.NewError("balancer tag not exist:", balancerTag)
+		}
+	} else if !hasOutboundTag(template, outboundTag) {
+		return common.NewError("outbound tag not exist:", outboundTag)
+	}
+
+	rule := &xray.RoutingRule{
+		Type:        "field",
+		OutboundTag: outboundTag,
+		BalancerTag: balancerTag,
+	}
+	if email != "" {
+		rule.User = []string{email}
+	}
+	if inboundTag != "" {
+		rule.InboundTag = []string{inboundTag}
+	}
+	insertRoutingRule(template, rule)
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+func hasRoutingRule(template map[string]interface{}, match func(rule map[string]interface{}) bool) bool {
+	rules, _ := getTemplateRouting(template)["rules"].([]interface{})
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if ok && match(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDNSQueryRule(rule map[string]interface{}) bool {
+	return rule["outboundTag"] == dnsOutboundTag && rule["port"] == "53"
+}
+
+func isDNSInternalRule(rule map[string]interface{}) bool {
+	inboundTags, _ := rule["inboundTag"].([]interface{})
+	return len(inboundTags) == 1 && inboundTags[0] == dnsInboundTag
+}
+
+func removeRoutingRules(template map[string]interface{}, match func(rule map[string]interface{}) bool) {
+	routing := getTemplateRouting(template)
+	rules, _ := routing["rules"].([]interface{})
+	newRules := make([]interface{}, 0, len(rules))
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if ok && match(rule) {
+			continue
+		}
+		newRules = append(newRules, r)
+	}
+	routing["rules"] = newRules
+}
+
+// SetDNSRouting sends dns queries of clients to the xray dns module and the queries
+// of the dns module to server through outboundTag, calling it again with the same
+// arguments changes nothing
+func (s *RoutingService) SetDNSRouting(server string, outboundTag string) error {
+	if server == "" {
+		return common.NewError("dns server is required")
+	}
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	if !hasOutboundTag(template, outboundTag) {
+		return common.NewError("outbound tag not exist:", outboundTag)
+	}
+
+	if !hasOutboundTag(template, dnsOutboundTag) {
+		template["outbounds"] = append(getTemplateOutbounds(template), map[string]interface{}{
+			"protocol": "dns",
+			"tag":      dnsOutboundTag,
+		})
+	}
+
+	dns, ok := template["dns"].(map[string]interface{})
+	if !ok {
+		dns = map[string]interface{}{}
+		template["dns"] = dns
+	}
+	dns["tag"] = dnsInboundTag
+	servers := getTemplateDNSServers(template)
+	found := false
+	for _, srv := range servers {
+		if srv == server {
+			found = true
+			break
+		}
+	}
+	if !found {
+		dns["servers"] = append(servers, server)
+	}
+
+	if !hasRoutingRule(template, isDNSQueryRule) {
+		insertRoutingRule(template, &xray.RoutingRule{
+			Type:        "field",
+			Port:        "53",
+			Network:     "udp",
+			OutboundTag: dnsOutboundTag,
+		})
+	}
+	// the dns module rule is replaced, so changing the outbound doesn't leave the old one behind
+	removeRoutingRules(template, isDNSInternalRule)
+	insertRoutingRule(template, &xray.RoutingRule{
+		Type:        "field",
+		InboundTag:  []string{dnsInboundTag},
+		OutboundTag: outboundTag,
+	})
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+// SetBalancer adds the balancer over the outbound tags, or replaces its outbounds if it exists
+func (s *RoutingService) SetBalancer(tag string, outboundTags []string) error {
+	if tag == "" {
+		return common.NewError("balancer tag is required")
+	}
+	if len(outboundTags) == 0 {
+		return common.NewError("balancer needs at least one outbound")
+	}
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	if hasOutboundTag(template, tag) {
+		return common.NewError("balancer tag is used by an outbound:", tag)
+	}
+	for _, outboundTag := range outboundTags {
+		if !hasOutboundTag(template, outboundTag) {
+			return common.NewError("outbound tag not exist:", outboundTag)
+		}
+	}
+
+	balancer := &xray.Balancer{
+		Tag:      tag,
+		Selector: outboundTags,
+	}
+	balancers := getTemplateBalancers(template)
+	newBalancers := make([]interface{}, 0, len(balancers)+1)
+	replaced := false
+	for _, b := range balancers {
+		old, ok := b.(map[string]interface{})
+		if ok && old["tag"] == tag {
+			newBalancers = append(newBalancers, balancer)
+			replaced = true
+			continue
+		}
+		newBalancers = append(newBalancers, b)
+	}
+	if !replaced {
+		newBalancers = append(newBalancers, balancer)
+	}
+	getTemplateRouting(template)["balancers"] = newBalancers
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+// DelBalancer removes the balancer and the rules routing to it
+func (s *RoutingService) DelBalancer(tag string) error {
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	if !hasBalancerTag(template, tag) {
+		return common.NewError("balancer tag not exist:", tag)
+	}
+	balancers := getTemplateBalancers(template)
+	newBalancers := make([]interface{}, 0, len(balancers))
+	for _, b := range balancers {
+		balancer, ok := b.(map[string]interface{})
+		if ok && balancer["tag"] == tag {
+			continue
+		}
+		newBalancers = append(newBalancers, b)
+	}
+	if len(newBalancers) == 0 {
+		delete(getTemplateRouting(template), "balancers")
+	} else {
+		getTemplateRouting(template)["balancers"] = newBalancers
+	}
+	removeRoutingRules(template, func(rule map[string]interface{}) bool {
+		return rule["balancerTag"] == tag
+	})
+	return saveXrayTemplate(&s.settingService, template)
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"x-ui/xray"
+)
+
+const routingTestTemplate = `{
+  "outbounds": [
+    {"protocol": "freedom", "settings": {}},
+    {"protocol": "wireguard", "settings": {}, "tag": "warp"},
+    {"protocol": "blackhole", "settings": {}, "tag": "blocked"}
+  ],
+  "routing": {
+    "rules": [
+      {"type": "field", "inboundTag": ["api"], "outboundTag": "api"},
+      {"type": "field", "ip": ["geoip:private"], "outboundTag": "blocked"}
+    ]
+  }
+}`
+
+// getRoutingRules returns the rules of the xray config the panel generates
+func getRoutingRules(t *testing.T) []xray.RoutingRule {
+	t.Helper()
+	xrayService := &XrayService{}
+	xrayConfig, err := xrayService.GetXrayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routing := struct {
+		Rules []xray.RoutingRule `json:"rules"`
+	}{}
+	err = json.Unmarshal(xrayConfig.RouterConfig, &routing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routing.Rules
+}
+
+func TestAddClientRoute(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       string
+		inboundTag  string
+		outboundTag string
+		wantErr     bool
+		want        xray.RoutingRule
+	}{
+		{"client", "warp-user", "", "warp", false, xray.RoutingRule{Type: "field", User: []string{"warp-user"}, OutboundTag: "warp"}},
+		{"inbound", "", "inbound-443", "warp", false, xray.RoutingRule{Type: "field", InboundTag: []string{"inbound-443"}, OutboundTag: "warp"}},
+		{"client of inbound", "warp-user", "inbound-443", "warp", false, xray.RoutingRule{Type: "field", User: []string{"warp-user"}, InboundTag: []string{"inbound-443"}, OutboundTag: "warp"}},
+		{"unknown outbound", "warp-user", "", "missing", true, xray.RoutingRule{}},
+		{"no client or inbound", "", "", "warp", true, xray.RoutingRule{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanSettings(t)
+			s := &RoutingService{}
+			err := s.settingService.SetXrayConfigTemplate(routingTestTemplate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := getRoutingRules(t)
+
+			err = s.AddClientRoute(tt.email, tt.inboundTag, tt.outboundTag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddClientRoute() = %v, wantErr %v", err, tt.wantErr)
+			}
+			rules := getRoutingRules(t)
+			if tt.wantErr {
+				if !reflect.DeepEqual(rules, before) {
+					t.Errorf("a failed AddClientRoute() changed the rules to %+v", rules)
+				}
+				return
+			}
+			if len(rules) != len(before)+1 {
+				t.Fatalf("rules = %+v, want one more than %+v", rules, before)
+			}
+			// the api rule stays first so the panel keeps getting traffic stats
+			if rules[0].OutboundTag != "api" {
+				t.Errorf("first rule = %+v, want the api rule", rules[0])
+			}
+			if !reflect.DeepEqual(rules[1], tt.want) {
+				t.Errorf("added rule = %+v, want %+v", rules[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDNSRouting(t *testing.T) {
+	cleanSettings(t)
+	s := &RoutingService{}
+	err := s.settingService.SetXrayConfigTemplate(routingTestTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetDNSRouting("1.1.1.1", "missing")
+	if err == nil {
+		t.Error("SetDNSRouting() took an outbound which doesn't exist")
+	}
+	err = s.SetDNSRouting("", "warp")
+	if err == nil {
+		t.Error("SetDNSRouting() took an empty server")
+	}
+
+	// calling it again changes nothing, changing the outbound replaces the rule of the dns module
+	for _, outboundTag := range []string{"warp", "warp", "blocked"} {
+		err = s.SetDNSRouting("1.1.1.1", outboundTag)
+		if err != nil {
+			t.Fatalf("SetDNSRouting() = %v", err)
+		}
+
+		xrayService := &XrayService{}
+		xrayConfig, err := xrayService.GetXrayConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		outbounds := []map[string]interface{}{}
+		json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+		dnsOutbounds := 0
+		for _, outbound := range outbounds {
+			if outbound["tag"] == dnsOutboundTag && outbound["protocol"] == "dns" {
+				dnsOutbounds++
+			}
+		}
+		if dnsOutbounds != 1 {
+			t.Errorf("%v dns outbounds, want 1", dnsOutbounds)
+		}
+
+		dns := struct {
+			Tag     string        `json:"tag"`
+			Servers []interface{} `json:"servers"`
+		}{}
+		json.Unmarshal(xrayConfig.DNSConfig, &dns)
+		if dns.Tag != dnsInboundTag || !reflect.DeepEqual(dns.Servers, []interface{}{"1.1.1.1"}) {
+			t.Errorf("dns = %+v, want the server once with tag %v", dns, dnsInboundTag)
+		}
+
+		queryRules, moduleRules := 0, 0
+		for _, rule := range getRoutingRules(t) {
+			if rule.Port == "53" && rule.Network == "udp" && rule.OutboundTag == dnsOutboundTag {
+				queryRules++
+			}
+			if reflect.DeepEqual(rule.InboundTag, []string{dnsInboundTag}) {
+				moduleRules++
+				if rule.OutboundTag != outboundTag {
+					t.Errorf("dns module is routed to %v, want %v", rule.OutboundTag, outboundTag)
+				}
+			}
+		}
+		if queryRules != 1 || moduleRules != 1 {
+			t.Errorf("%v dns query rules and %v dns module rules, want 1 of each", queryRules, moduleRules)
+		}
+	}
+}
+
+// getRoutingBalancers returns the balancers of the xray config the panel generates
+func getRoutingBalancers(t *testing.T) []xray.Balancer {
+	t.Helper()
+	xrayService := &XrayService{}
+	xrayConfig, err := xrayService.GetXrayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	routing := struct {
+		Balancers []xray.Balancer `json:"balancers"`
+	}{}
+	err = json.Unmarshal(xrayConfig.RouterConfig, &routing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routing.Balancers
+}
+
+func TestSetBalancer(t *testing.T) {
+	cleanSettings(t)
+	s := &RoutingService{}
+	err := s.settingService.SetXrayConfigTemplate(routingTestTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []struct {
+		name         string
+		tag          string
+		outboundTags []string
+	}{
+		{"no tag", "", []string{"warp"}},
+		{"no outbounds", "lb", nil},
+		{"unknown outbound", "lb", []string{"warp", "missing"}},
+		{"tag of an outbound", "warp", []string{"blocked"}},
+	}
+	for _, tt := range invalid {
+		err = s.SetBalancer(tt.tag, tt.outboundTags)
+		if err == nil {
+			t.Errorf("SetBalancer(%q, %v) didn't fail for %v", tt.tag, tt.outboundTags, tt.name)
+		}
+	}
+	if balancers := getRoutingBalancers(t); len(balancers) != 0 {
+		t.Fatalf("failed SetBalancer() calls added %+v", balancers)
+	}
+
+	err = s.SetBalancer("lb", []string{"warp", "blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddBalancerRoute("balanced-user", "", "lb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.AddBalancerRoute("balanced-user", "", "missing")
+	if err == nil {
+		t.Error("AddBalancerRoute() took a balancer which doesn't exist")
+	}
+	want := []xray.Balancer{{Tag: "lb", Selector: []string{"warp", "blocked"}}}
+	if balancers := getRoutingBalancers(t); !reflect.DeepEqual(balancers, want) {
+		t.Errorf("balancers = %+v, want %+v", balancers, want)
+	}
+	wantRule := xray.RoutingRule{Type: "field", User: []string{"balanced-user"}, BalancerTag: "lb"}
+	if rules := getRoutingRules(t); len(rules) != 3 || !reflect.DeepEqual(rules[1], wantRule) {
+		t.Errorf("rules = %+v, want %+v after the api rule", rules, wantRule)
+	}
+
+	// setting it again replaces the outbounds instead of adding another balancer
+	err = s.SetBalancer("lb", []string{"warp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []xray.Balancer{{Tag: "lb", Selector: []string{"warp"}}}
+	if balancers := getRoutingBalancers(t); !reflect.DeepEqual(balancers, want) {
+		t.Errorf("balancers after replacing = %+v, want %+v", balancers, want)
+	}
+
+	err = s.DelBalancer("lb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balancers := getRoutingBalancers(t); len(balancers) != 0 {
+		t.Errorf("balancers after DelBalancer() = %+v, want none", balancers)
+	}
+	for _, rule := range getRoutingRules(t) {
+		if rule.BalancerTag != "" {
+			t.Errorf("rule %+v still routes to a deleted balancer", rule)
+		}
+	}
+	err = s.DelBalancer("lb")
+	if err == nil {
+		t.Error("DelBalancer() of a balancer which doesn't exist didn't fail")
+	}
+}
@@ -46,9 +46,10 @@ type Status struct {
 		Total   uint64 `json:"total"`
 	} `json:"disk"`
 	Xray struct {
-		State    ProcessState `json:"state"`
-		ErrorMsg string       `json:"errorMsg"`
-		Version  string       `json:"version"`
+		State       ProcessState `json:"state"`
+		ErrorMsg    string       `json:"errorMsg"`
+		Version     string       `json:"version"`
+		ConfigError string       `json:"configError"`
 	} `json:"xray"`
 	Uptime   uint64    `json:"uptime"`
 	Loads    []float64 `json:"loads"`
@@ -62,6 +63,10 @@ type Status struct {
 		Sent uint64 `json:"sent"`
 		Recv uint64 `json:"recv"`
 	} `json:"netTraffic"`
+	Update struct {
+		Latest    string `json:"latest"`
+		Available bool   `json:"available"`
+	} `json:"update"`
 }
 
 type Release struct {
@@ -69,7 +74,9 @@ type Release struct {
 }
 
 type ServerService struct {
-	xrayService XrayService
+	xrayService      XrayService
+	updateService    UpdateService
+	accessLogService AccessLogService
 }
 
 func (s *ServerService) GetStatus(lastStatus *Status) *Status {
@@ -166,6 +173,12 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Xray.ErrorMsg = s.xrayService.GetXrayResult()
 	}
 	status.Xray.Version = s.xrayService.GetXrayVersion()
+	status.Xray.ConfigError = ""
+	if err := s.accessLogService.CheckXrayConfig(); err != nil {
+		status.Xray.ConfigError = err.Error()
+	}
+
+	status.Update.Latest, status.Update.Available = s.updateService.GetUpdateInfo()
 
 	return status
 }
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "x-ui-service-test-")
+	if err != nil {
+		panic(err)
+	}
+	err = database.InitDB(filepath.Join(dir, "x-ui.db"))
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// countInbounds returns how many inbounds are stored and how many of them are enabled
+func countInbounds(t *testing.T) (int64, int64) {
+	t.Helper()
+	db := database.GetDB()
+	var total, enabled int64
+	err := db.Model(model.Inbound{}).Count(&total).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Model(model.Inbound{}).Where("enable = ?", true).Count(&enabled).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return total, enabled
+}
+
+func TestWithBatch(t *testing.T) {
+	errBatch := errors.New("batch failed")
+	tests := []struct {
+		name    string
+		fail    error
+		panics  bool
+		wantErr bool
+	}{
+		{"committed", nil, false, false},
+		{"error rolls back", errBatch, false, true},
+		{"panic rolls back", nil, true, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanInbounds(t)
+			inboundService := &InboundService{}
+			existing := newClientInbound(t, 43000+i*10, model.VLESS, nil)
+			err := inboundService.AddInbound(existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var recovered interface{}
+			func() {
+				defer func() { recovered = recover() }()
+				err = inboundService.WithBatch(func(batch *InboundBatch) error {
+					for j := 1; j <= 3; j++ {
+						err := batch.AddInbound(newClientInbound(t, 43000+i*10+j, model.VLESS, nil))
+						if err != nil {
+							return err
+						}
+					}
+					err := batch.SetInboundEnable(existing.Id, false)
+					if err != nil {
+						return err
+					}
+					// nothing of the batch shows before it is committed, a restart now
+					// would still get the old config
+					if total, enabled := countInbounds(t); total != 1 || enabled != 1 {
+						t.Errorf("during the batch there are %v inbounds, %v enabled", total, enabled)
+					}
+					if tt.panics {
+						panic("batch panicked")
+					}
+					return tt.fail
+				})
+			}()
+			if (recovered != nil) != tt.panics {
+				t.Errorf("WithBatch() recovered %v, want panic %v", recovered, tt.panics)
+			}
+			if !tt.panics && (err != nil) != tt.wantErr {
+				t.Errorf("WithBatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			total, enabled := countInbounds(t)
+			wantTotal, wantEnabled := int64(4), int64(3)
+			if tt.wantErr {
+				wantTotal, wantEnabled = 1, 1
+			}
+			if total != wantTotal || enabled != wantEnabled {
+				t.Errorf("after the batch there are %v inbounds, %v enabled, want %v, %v", total, enabled, wantTotal, wantEnabled)
+			}
+		})
+	}
+}
+
+func TestAddInbounds(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	// the second inbound takes the port of the first one, so none of them is added
+	err := inboundService.AddInbounds([]*model.Inbound{
+		newClientInbound(t, 44000, model.VLESS, nil),
+		newClientInbound(t, 44000, model.VMess, nil),
+	})
+	if err == nil {
+		t.Error("AddInbounds() added two inbounds on one port")
+	}
+	if total, _ := countInbounds(t); total != 0 {
+		t.Errorf("a failed AddInbounds() left %v inbounds", total)
+	}
+
+	err = inboundService.AddInbounds([]*model.Inbound{
+		newClientInbound(t, 44000, model.VLESS, []model.Client{{Email: "batch-a"}}),
+		newClientInbound(t, 44001, model.VMess, []model.Client{{Email: "batch-b"}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total, _ := countInbounds(t); total != 2 {
+		t.Errorf("AddInbounds() added %v inbounds, want 2", total)
+	}
+}
+
+func TestAddClients(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	inbound := newClientInbound(t, 46000, model.VLESS, []model.Client{{Email: "existing"}})
+	err := inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = inboundService.AddClients(inbound.Id, []model.Client{{Email: "a"}, {Email: "b", LimitIP: 2}, {Email: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := inboundService.GetInbound(inbound.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := stored.GetClients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 4 || clients[0].Email != "existing" || clients[3].Email != "c" || clients[2].LimitIP != 2 {
+		t.Fatalf("clients after AddClients() = %+v", clients)
+	}
+	ids := map[string]bool{}
+	for _, client := range clients[1:] {
+		if client.ID == "" || client.SubID == "" || ids[client.ID] {
+			t.Errorf("AddClients() didn't generate a unique id and subId: %+v", client)
+		}
+		ids[client.ID] = true
+	}
+
+	tests := []struct {
+		name    string
+		clients []model.Client
+	}{
+		{"existing email", []model.Client{{Email: "d"}, {Email: "a"}}},
+		{"same email twice", []model.Client{{Email: "d"}, {Email: "d"}}},
+		{"empty email", []model.Client{{Email: "d"}, {}}},
+		{"existing id", []model.Client{{Email: "d"}, {Email: "e", ID: clients[1].ID}}},
+		{"existing subId", []model.Client{{Email: "d"}, {Email: "e", SubID: clients[1].SubID}}},
+		{"negative ip limit", []model.Client{{Email: "d"}, {Email: "e", LimitIP: -1}}},
+		{"no clients", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := inboundService.AddClients(inbound.Id, tt.clients)
+			if err == nil {
+				t.Fatal("AddClients() succeeded")
+			}
+			// the valid clients of the batch are rolled back with the invalid one
+			stored, err := inboundService.GetInbound(inbound.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := stored.GetClients()
+			if err != nil || len(got) != len(clients) {
+				t.Errorf("AddClients() left %v clients, want %v", len(got), len(clients))
+			}
+		})
+	}
+
+	err = inboundService.AddClients(0, []model.Client{{Email: "d"}})
+	if err == nil {
+		t.Error("AddClients() of a missing inbound succeeded")
+	}
+}
@@ -4,16 +4,22 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"net"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"x-ui/config"
 	"x-ui/database"
 	"x-ui/database/model"
 	"x-ui/logger"
 	"x-ui/util/common"
+	"x-ui/util/crypto"
 	"x-ui/util/random"
 	"x-ui/util/reflect_util"
+	"x-ui/util/schedule"
 	"x-ui/web/entity"
 )
 
@@ -21,24 +27,216 @@ import (
 var xrayTemplateConfig string
 
 var defaultValueMap = map[string]string{
-	"xrayTemplateConfig": xrayTemplateConfig,
-	"webListen":          "",
-	"webPort":            "54321",
-	"webCertFile":        "",
-	"webKeyFile":         "",
-	"secret":             random.Seq(32),
-	"webBasePath":        "/",
-	"timeLocation":       "Asia/Shanghai",
-	"tgBotEnable":        "false",
-	"tgBotToken":         "",
-	"tgBotChatId":        "0",
-	"tgRunTime":          "",
-	"penalty":            "0",
+	"xrayTemplateConfig":       xrayTemplateConfig,
+	"webListen":                "",
+	"webSocketMode":            "0660",
+	"webPort":                  "54321",
+	"webCertFile":              "",
+	"webKeyFile":               "",
+	"webCertMode":              "manual",
+	"webAcmeDomain":            "",
+	"webAcmeEmail":             "",
+	"webAcmeChallenge":         "http-01",
+	"webAcmeDnsProvider":       "cloudflare",
+	"webAcmeDnsToken":          "",
+	"secret":                   random.Seq(32),
+	"webBasePath":              "/",
+	"webHttpMode":              "redirect",
+	"webHttpRedirectPort":      "0",
+	"webHstsMaxAge":            "0",
+	"webHstsSubdomains":        "false",
+	"webHstsPreload":           "false",
+	"webHttp3":                 "false",
+	"webShutdownTimeout":       "10",
+	"webProxyProtocol":         "false",
+	"timeLocation":             "Asia/Shanghai",
+	"tgBotEnable":              "false",
+	"tgBotToken":               "",
+	"tgBotChatId":              "0",
+	"tgRunTime":                "",
+	"tgNotifyLogin":            "true",
+	"tgNotifyXrayDown":         "true",
+	"tgBotSelfService":         "false",
+	"smtpHost":                 "",
+	"smtpPort":                 "587",
+	"smtpUsername":             "",
+	"smtpPassword":             "",
+	"smtpFrom":                 "",
+	"mailAdmins":               "",
+	"mailClients":              "false",
+	"mailExpireDays":           "3",
+	"webhookUrls":              "",
+	"webhookSecret":            "",
+	"webhookEvents":            "",
+	"discordWebhooks":          "",
+	"slackWebhooks":            "",
+	"penalty":                  "0",
+	"xrayCheckInterval":        "30",
+	"trafficInterval":          "10",
+	"inboundCheckInterval":     "30",
+	"ipLimitIpv4Prefix":        "32",
+	"ipLimitIpv6Prefix":        "128",
+	"clientIpsRetention":       "24",
+	"ipLimitSkipList":          "1.1.1.1",
+	"ipLimitAction":            "inbound",
+	"lockoutPersist":           "false",
+	"loginMaxFailures":         "5",
+	"loginLockDuration":        "5",
+	"loginUserMaxFailures":     "10",
+	"loginBanAfter":            "3",
+	"loginBanDuration":         "24",
+	"oidcIssuer":               "",
+	"oidcClientId":             "",
+	"oidcClientSecret":         "",
+	"oidcRedirectUrl":          "",
+	"oidcUsernameClaim":        "email",
+	"authBackend":              "local",
+	"ldapUrl":                  "",
+	"ldapStartTls":             "false",
+	"ldapBindDn":               "",
+	"ldapBindPassword":         "",
+	"ldapBaseDn":               "",
+	"ldapUserFilter":           "(uid=%s)",
+	"ldapGroupAttribute":       "memberOf",
+	"ldapGroupRoles":           "",
+	"webTrustedProxies":        "127.0.0.1,::1",
+	"corsOrigins":              "",
+	"corsMethods":              "GET,POST",
+	"corsHeaders":              "Content-Type,X-Requested-With",
+	"corsCredentials":          "false",
+	"metricsFile":              "",
+	"metricsFileInterval":      "60",
+	"metricsToken":             "",
+	"apiTokens":                "",
+	"xrayIsolateFailedInbound": "false",
+	"xrayRejectThreshold":      "0",
+	"updateCheckUrl":           "",
+	"updateCheckInterval":      "24",
+	"sessionLimit":             "0",
+	"sessionWindow":            "10",
+	"restartGrace":             "30",
+	"ipLimitDecisionLog":       "false",
+	"ipLimitSchedule":          "",
+	"inboundCheckSchedule":     "",
+	"i18nTrackMissing":         "false",
+	"emptyInboundAction":       "off",
+	"emptyInboundPeriod":       "24",
+	"accessLogEmailRegex":      "",
+	"scanBlockThreshold":       "0",
+	"scanBlockDuration":        "10",
+	"inboundSoftLimit":         "0",
+	"inboundHardLimit":         "0",
+	"panelTitle":               "",
+	"panelLogo":                "",
+	"accessLogOffset":          "0",
+	"accessLogFileId":          "",
+}
+
+// secretSettings are stored encrypted when a master key is configured
+var secretSettings = map[string]bool{
+	"secret":           true,
+	"tgBotToken":       true,
+	"smtpPassword":     true,
+	"webhookSecret":    true,
+	"oidcClientSecret": true,
+	"ldapBindPassword": true,
+	"webAcmeDnsToken":  true,
+	// the urls of chat webhooks are all it takes to post to them
+	"discordWebhooks": true,
+	"slackWebhooks":   true,
+	"metricsToken":    true,
+	"apiTokens":       true,
 }
 
 type SettingService struct {
 }
 
+// encodeSettingValue encrypts the value of a secret setting if there is a master key
+func encodeSettingValue(key string, value string) (string, error) {
+	if !secretSettings[key] {
+		return value, nil
+	}
+	return encryptSecret(value)
+}
+
+// encryptSecret encrypts the value if there is a master key, it is stored as is otherwise
+func encryptSecret(value string) (string, error) {
+	masterKey, err := config.GetMasterKey()
+	if err != nil || masterKey == nil {
+		return value, err
+	}
+	return crypto.Encrypt(masterKey, value)
+}
+
+// decodeSettingValue decrypts the value of a secret setting, other settings are plaintext
+// even if they look encrypted
+func decodeSettingValue(key string, value string) (string, error) {
+	if !secretSettings[key] {
+		return value, nil
+	}
+	return decryptSecret(value)
+}
+
+// decryptSecret decrypts the value if encryptSecret encrypted it
+func decryptSecret(value string) (string, error) {
+	if !crypto.IsEncrypted(value) {
+		return value, nil
+	}
+	masterKey, err := config.GetMasterKey()
+	if err != nil {
+		return "", err
+	}
+	if masterKey == nil {
+		return "", common.NewError("secret is encrypted but no master key is set")
+	}
+	return crypto.Decrypt(masterKey, value)
+}
+
+// CheckSecrets makes sure encrypted settings can be read and encrypts the secrets
+// still stored in plaintext, it fails if secrets are encrypted but the master key is missing
+func (s *SettingService) CheckSecrets() error {
+	masterKey, err := config.GetMasterKey()
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	settings := make([]*model.Setting, 0)
+	err = db.Model(model.Setting{}).Find(&settings).Error
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if !secretSettings[setting.Key] {
+			// the setting was encrypted when it was still a secret
+			if masterKey != nil && crypto.IsEncrypted(setting.Value) {
+				value, err := crypto.Decrypt(masterKey, setting.Value)
+				if err == nil {
+					err = s.saveSetting(setting.Key, value)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		if crypto.IsEncrypted(setting.Value) {
+			if masterKey == nil {
+				return common.NewErrorf("setting %v is encrypted, set XUI_MASTER_KEY or XUI_MASTER_KEY_FILE to start", setting.Key)
+			}
+			_, err = crypto.Decrypt(masterKey, setting.Value)
+			if err != nil {
+				return common.NewErrorf("setting %v: %v", setting.Key, err)
+			}
+		} else if masterKey != nil {
+			err = s.saveSetting(setting.Key, setting.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return checkTotpSecrets(masterKey)
+}
+
 func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 	db := database.GetDB()
 	settings := make([]*model.Setting, 0)
@@ -94,7 +292,11 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 
 	keyMap := map[string]bool{}
 	for _, setting := range settings {
-		err := setSetting(setting.Key, setting.Value)
+		value, err := decodeSettingValue(setting.Key, setting.Value)
+		if err != nil {
+			return nil, err
+		}
+		err = setSetting(setting.Key, value)
 		if err != nil {
 			return nil, err
 		}
@@ -116,6 +318,7 @@ func (s *SettingService) GetAllSetting() (*entity.AllSetting, error) {
 
 func (s *SettingService) ResetSettings() error {
 	db := database.GetDB()
+	defer clearTrustedProxies()
 	return db.Where("1 = 1").Delete(model.Setting{}).Error
 }
 
@@ -130,6 +333,11 @@ func (s *SettingService) getSetting(key string) (*model.Setting, error) {
 }
 
 func (s *SettingService) saveSetting(key string, value string) error {
+	value, err := encodeSettingValue(key, value)
+	if err != nil {
+		return err
+	}
+	defer afterSaveSetting(key)
 	setting, err := s.getSetting(key)
 	db := database.GetDB()
 	if database.IsNotFound(err) {
@@ -145,6 +353,13 @@ func (s *SettingService) saveSetting(key string, value string) error {
 	return db.Save(setting).Error
 }
 
+// afterSaveSetting drops what is cached of the setting, so the saved value is read next time
+func afterSaveSetting(key string) {
+	if key == "webTrustedProxies" {
+		clearTrustedProxies()
+	}
+}
+
 func (s *SettingService) getString(key string) (string, error) {
 	setting, err := s.getSetting(key)
 	if database.IsNotFound(err) {
@@ -156,7 +371,7 @@ func (s *SettingService) getString(key string) (string, error) {
 	} else if err != nil {
 		return "", err
 	}
-	return setting.Value, nil
+	return decodeSettingValue(key, setting.Value)
 }
 
 func (s *SettingService) setString(key string, value string) error {
@@ -191,10 +406,29 @@ func (s *SettingService) GetXrayConfigTemplate() (string, error) {
 	return s.getString("xrayTemplateConfig")
 }
 
+func (s *SettingService) SetXrayConfigTemplate(config string) error {
+	return s.setString("xrayTemplateConfig", config)
+}
+
+// GetListen returns the ip the panel listens on, empty for every ip, or a unix socket path
+// like unix:/run/x-ui.sock, see Server.Start
 func (s *SettingService) GetListen() (string, error) {
 	return s.getString("webListen")
 }
 
+// GetWebSocketMode returns the file mode of the unix socket the panel listens on
+func (s *SettingService) GetWebSocketMode() (os.FileMode, error) {
+	value, err := s.getString("webSocketMode")
+	if err != nil {
+		return 0, err
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(mode), nil
+}
+
 func (s *SettingService) GetTgBotToken() (string, error) {
 	return s.getString("tgBotToken")
 }
@@ -227,6 +461,85 @@ func (s *SettingService) GetTgbotRuntime() (string, error) {
 	return s.getString("tgRunTime")
 }
 
+func (s *SettingService) GetTgNotifyLogin() (bool, error) {
+	return s.getBool("tgNotifyLogin")
+}
+
+func (s *SettingService) GetTgNotifyXrayDown() (bool, error) {
+	return s.getBool("tgNotifyXrayDown")
+}
+
+func (s *SettingService) GetSmtpHost() (string, error) {
+	return s.getString("smtpHost")
+}
+
+func (s *SettingService) GetSmtpPort() (int, error) {
+	return s.getInt("smtpPort")
+}
+
+func (s *SettingService) GetSmtpUsername() (string, error) {
+	return s.getString("smtpUsername")
+}
+
+func (s *SettingService) GetSmtpPassword() (string, error) {
+	return s.getString("smtpPassword")
+}
+
+func (s *SettingService) GetSmtpFrom() (string, error) {
+	return s.getString("smtpFrom")
+}
+
+// GetMailAdmins returns the addresses alerts are mailed to
+func (s *SettingService) GetMailAdmins() ([]string, error) {
+	return s.splitSetting("mailAdmins")
+}
+
+// GetMailClients returns whether clients whose email is an address get their own alerts
+func (s *SettingService) GetMailClients() (bool, error) {
+	return s.getBool("mailClients")
+}
+
+// GetMailExpireDays returns how many days before expiry it is mailed about
+func (s *SettingService) GetMailExpireDays() (int, error) {
+	return s.getInt("mailExpireDays")
+}
+
+// splitSetting returns the trimmed, non empty values of a comma separated setting
+func (s *SettingService) splitSetting(key string) ([]string, error) {
+	value, err := s.getString(key)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+// GetWebhookUrls returns the urls events are posted to, none means webhooks are off
+func (s *SettingService) GetWebhookUrls() ([]string, error) {
+	return s.splitSetting("webhookUrls")
+}
+
+// GetWebhookSecret returns the key webhook bodies are signed with, empty means unsigned
+func (s *SettingService) GetWebhookSecret() (string, error) {
+	return s.getString("webhookSecret")
+}
+
+// GetWebhookEvents returns the events posted to webhooks, none means all of them
+func (s *SettingService) GetWebhookEvents() ([]string, error) {
+	return s.splitSetting("webhookEvents")
+}
+
+// GetTgBotSelfService returns whether users can ask the bot about their own usage
+func (s *SettingService) GetTgBotSelfService() (bool, error) {
+	return s.getBool("tgBotSelfService")
+}
+
 func (s *SettingService) GetPort() (int, error) {
 	return s.getInt("webPort")
 }
@@ -243,6 +556,34 @@ func (s *SettingService) GetKeyFile() (string, error) {
 	return s.getString("webKeyFile")
 }
 
+func (s *SettingService) GetCertMode() (string, error) {
+	return s.getString("webCertMode")
+}
+
+func (s *SettingService) GetAcmeDomain() (string, error) {
+	return s.getString("webAcmeDomain")
+}
+
+func (s *SettingService) GetAcmeEmail() (string, error) {
+	return s.getString("webAcmeEmail")
+}
+
+func (s *SettingService) GetAcmeChallenge() (string, error) {
+	return s.getString("webAcmeChallenge")
+}
+
+func (s *SettingService) GetAcmeDnsProvider() (string, error) {
+	return s.getString("webAcmeDnsProvider")
+}
+
+func (s *SettingService) GetAcmeDnsToken() (string, error) {
+	return s.getString("webAcmeDnsToken")
+}
+
+func (s *SettingService) GetProxyProtocol() (bool, error) {
+	return s.getBool("webProxyProtocol")
+}
+
 func (s *SettingService) GetSecret() ([]byte, error) {
 	secret, err := s.getString("secret")
 	if secret == defaultValueMap["secret"] {
@@ -254,10 +595,403 @@ func (s *SettingService) GetSecret() ([]byte, error) {
 	return []byte(secret), err
 }
 
+// GetJobInterval returns the interval of a cron job, the default when the setting is invalid or too short
+func (s *SettingService) GetJobInterval(key string) time.Duration {
+	defaultInterval, _ := strconv.Atoi(defaultValueMap[key])
+	interval, err := s.getInt(key)
+	if err != nil {
+		logger.Warningf("%v invalid: %v, using default %vs", key, err, defaultInterval)
+		interval = defaultInterval
+	} else if interval < entity.MinJobInterval {
+		logger.Warningf("%v %vs is shorter than %vs, using default %vs", key, interval, entity.MinJobInterval, defaultInterval)
+		interval = defaultInterval
+	}
+	return time.Second * time.Duration(interval)
+}
+
 func (s *SettingService) GetPenalty() (int, error) {
 	return s.getInt("penalty")
 }
 
+func (s *SettingService) GetIpLimitIpv4Prefix() (int, error) {
+	return s.getInt("ipLimitIpv4Prefix")
+}
+
+func (s *SettingService) GetIpLimitIpv6Prefix() (int, error) {
+	return s.getInt("ipLimitIpv6Prefix")
+}
+
+// GetIpLimitAction returns what is taken off when a client breaks its limits, inbound or client
+func (s *SettingService) GetIpLimitAction() (string, error) {
+	return s.getString("ipLimitAction")
+}
+
+// GetIpLimitSkipList returns the networks whose ips are not counted against the ip limit
+func (s *SettingService) GetIpLimitSkipList() ([]*net.IPNet, error) {
+	value, err := s.getString("ipLimitSkipList")
+	if err != nil {
+		return nil, err
+	}
+	return common.ParseNetworks(value)
+}
+
+// GetClientIpsRetention returns how long the ips of a client are kept after it was last seen
+func (s *SettingService) GetClientIpsRetention() (time.Duration, error) {
+	hours, err := s.getInt("clientIpsRetention")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(hours) * time.Hour, nil
+}
+
+func (s *SettingService) GetLockoutPersist() (bool, error) {
+	return s.getBool("lockoutPersist")
+}
+
+func (s *SettingService) GetLoginMaxFailures() (int, error) {
+	return s.getInt("loginMaxFailures")
+}
+
+// GetLoginLockDuration returns how long an ip is locked out after too many failed logins
+func (s *SettingService) GetLoginLockDuration() (time.Duration, error) {
+	minutes, err := s.getInt("loginLockDuration")
+	if err != nil {
+		return 0, err
+	}
+	return time.Minute * time.Duration(minutes), nil
+}
+
+// GetOidcIssuer returns the url of the openid connect provider, empty means single sign on is off
+func (s *SettingService) GetOidcIssuer() (string, error) {
+	return s.getString("oidcIssuer")
+}
+
+func (s *SettingService) GetOidcClientId() (string, error) {
+	return s.getString("oidcClientId")
+}
+
+func (s *SettingService) GetOidcClientSecret() (string, error) {
+	return s.getString("oidcClientSecret")
+}
+
+// GetOidcRedirectUrl returns the url the provider sends users back to, empty means the
+// url is made from the request
+func (s *SettingService) GetOidcRedirectUrl() (string, error) {
+	return s.getString("oidcRedirectUrl")
+}
+
+// GetOidcUsernameClaim returns the claim of the id token which is the panel username
+func (s *SettingService) GetOidcUsernameClaim() (string, error) {
+	return s.getString("oidcUsernameClaim")
+}
+
+// GetAuthBackend returns what passwords of panel logins are checked against, one of local, ldap and both
+func (s *SettingService) GetAuthBackend() (string, error) {
+	return s.getString("authBackend")
+}
+
+func (s *SettingService) GetLdapUrl() (string, error) {
+	return s.getString("ldapUrl")
+}
+
+// GetLdapStartTls returns whether a ldap:// connection is upgraded to tls before binding
+func (s *SettingService) GetLdapStartTls() (bool, error) {
+	return s.getBool("ldapStartTls")
+}
+
+// GetLdapBindDn returns the dn users are searched as, empty means anonymously
+func (s *SettingService) GetLdapBindDn() (string, error) {
+	return s.getString("ldapBindDn")
+}
+
+func (s *SettingService) GetLdapBindPassword() (string, error) {
+	return s.getString("ldapBindPassword")
+}
+
+func (s *SettingService) GetLdapBaseDn() (string, error) {
+	return s.getString("ldapBaseDn")
+}
+
+// GetLdapUserFilter returns the filter finding a user, %s is replaced by the username
+func (s *SettingService) GetLdapUserFilter() (string, error) {
+	return s.getString("ldapUserFilter")
+}
+
+// GetLdapGroupAttribute returns the attribute of users listing the dns of their groups
+func (s *SettingService) GetLdapGroupAttribute() (string, error) {
+	return s.getString("ldapGroupAttribute")
+}
+
+func (s *SettingService) GetLdapGroupRoles() ([]*entity.LdapGroupRole, error) {
+	value, err := s.getString("ldapGroupRoles")
+	if err != nil {
+		return nil, err
+	}
+	return entity.ParseLdapGroupRoles(value)
+}
+
+// GetLoginUserMaxFailures returns how many failed logins of a username lock it, 0 means never
+func (s *SettingService) GetLoginUserMaxFailures() (int, error) {
+	return s.getInt("loginUserMaxFailures")
+}
+
+// GetLoginBanAfter returns how many lockouts of an ip within a day ban it, 0 means never
+func (s *SettingService) GetLoginBanAfter() (int, error) {
+	return s.getInt("loginBanAfter")
+}
+
+// GetLoginBanDuration returns how long an ip stays banned, 0 means until it is unbanned
+func (s *SettingService) GetLoginBanDuration() (time.Duration, error) {
+	hours, err := s.getInt("loginBanDuration")
+	if err != nil {
+		return 0, err
+	}
+	return time.Hour * time.Duration(hours), nil
+}
+
+// trustedProxies caches the parsed webTrustedProxies, every request with a X-Forwarded header
+// header needs them and they only change when the setting is saved
+var trustedProxies struct {
+	sync.RWMutex
+	networks []*net.IPNet
+	loaded   bool
+	// version changes with every save, a value read before a save is not cached after it
+	version int
+}
+
+func clearTrustedProxies() {
+	trustedProxies.Lock()
+	defer trustedProxies.Unlock()
+	trustedProxies.networks = nil
+	trustedProxies.loaded = false
+	trustedProxies.version++
+}
+
+// GetTrustedProxies returns the networks whose X-Forwarded-For header is trusted
+func (s *SettingService) GetTrustedProxies() ([]*net.IPNet, error) {
+	trustedProxies.RLock()
+	networks, loaded, version := trustedProxies.networks, trustedProxies.loaded, trustedProxies.version
+	trustedProxies.RUnlock()
+	if loaded {
+		return networks, nil
+	}
+	value, err := s.getString("webTrustedProxies")
+	if err != nil {
+		return nil, err
+	}
+	networks, err = common.ParseNetworks(value)
+	if err != nil {
+		return nil, err
+	}
+	trustedProxies.Lock()
+	defer trustedProxies.Unlock()
+	if trustedProxies.version == version {
+		trustedProxies.networks = networks
+		trustedProxies.loaded = true
+	}
+	return networks, nil
+}
+
+func (s *SettingService) GetMetricsFile() (string, error) {
+	return s.getString("metricsFile")
+}
+
+func (s *SettingService) GetMetricsFileInterval() (int, error) {
+	return s.getInt("metricsFileInterval")
+}
+
+func (s *SettingService) GetMetricsToken() (string, error) {
+	return s.getString("metricsToken")
+}
+
+func (s *SettingService) GetXrayIsolateFailedInbound() (bool, error) {
+	return s.getBool("xrayIsolateFailedInbound")
+}
+
+func (s *SettingService) GetUpdateCheckUrl() (string, error) {
+	return s.getString("updateCheckUrl")
+}
+
+func (s *SettingService) GetUpdateCheckInterval() (int, error) {
+	return s.getInt("updateCheckInterval")
+}
+
+func (s *SettingService) GetSessionLimit() (int, error) {
+	return s.getInt("sessionLimit")
+}
+
+func (s *SettingService) GetSessionWindow() (int, error) {
+	return s.getInt("sessionWindow")
+}
+
+func (s *SettingService) GetIpLimitDecisionLog() (bool, error) {
+	return s.getBool("ipLimitDecisionLog")
+}
+
+func (s *SettingService) GetXrayRejectThreshold() (int, error) {
+	return s.getInt("xrayRejectThreshold")
+}
+
+func (s *SettingService) GetRestartGrace() (int, error) {
+	return s.getInt("restartGrace")
+}
+
+func (s *SettingService) GetAccessLogEmailRegex() (string, error) {
+	return s.getString("accessLogEmailRegex")
+}
+
+func (s *SettingService) GetEmptyInboundAction() (string, error) {
+	return s.getString("emptyInboundAction")
+}
+
+func (s *SettingService) GetEmptyInboundPeriod() (int, error) {
+	return s.getInt("emptyInboundPeriod")
+}
+
+func (s *SettingService) GetI18nTrackMissing() (bool, error) {
+	return s.getBool("i18nTrackMissing")
+}
+
+func (s *SettingService) getSchedule(key string) (schedule.Windows, error) {
+	value, err := s.getString(key)
+	if err != nil {
+		return nil, err
+	}
+	return schedule.Parse(value)
+}
+
+func (s *SettingService) GetIpLimitSchedule() (schedule.Windows, error) {
+	return s.getSchedule("ipLimitSchedule")
+}
+
+func (s *SettingService) GetInboundCheckSchedule() (schedule.Windows, error) {
+	return s.getSchedule("inboundCheckSchedule")
+}
+
+func (s *SettingService) GetWebHttpMode() (string, error) {
+	return s.getString("webHttpMode")
+}
+
+func (s *SettingService) GetWebHttpRedirectPort() (int, error) {
+	return s.getInt("webHttpRedirectPort")
+}
+
+// GetWebHstsMaxAge returns the max age in seconds of the hsts header, 0 when it's not sent
+func (s *SettingService) GetWebHstsMaxAge() (int, error) {
+	return s.getInt("webHstsMaxAge")
+}
+
+func (s *SettingService) GetWebHstsSubdomains() (bool, error) {
+	return s.getBool("webHstsSubdomains")
+}
+
+func (s *SettingService) GetWebHstsPreload() (bool, error) {
+	return s.getBool("webHstsPreload")
+}
+
+// GetWebHttp3 returns whether the https panel also answers http/3 on the udp port
+func (s *SettingService) GetWebHttp3() (bool, error) {
+	return s.getBool("webHttp3")
+}
+
+func (s *SettingService) GetWebShutdownTimeout() (int, error) {
+	return s.getInt("webShutdownTimeout")
+}
+
+// GetApiTokens returns the tokens the rest api accepts, none means the api is off
+func (s *SettingService) GetApiTokens() ([]string, error) {
+	value, err := s.getString("apiTokens")
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]string, 0)
+	for _, token := range strings.Split(value, ",") {
+		token = strings.TrimSpace(token)
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// GetCorsOrigins returns the origins allowed to call the api from a browser, none means cors is off
+func (s *SettingService) GetCorsOrigins() ([]string, error) {
+	value, err := s.getString("corsOrigins")
+	if err != nil {
+		return nil, err
+	}
+	origins := make([]string, 0)
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins, nil
+}
+
+func (s *SettingService) GetCorsMethods() (string, error) {
+	return s.getString("corsMethods")
+}
+
+func (s *SettingService) GetCorsHeaders() (string, error) {
+	return s.getString("corsHeaders")
+}
+
+func (s *SettingService) GetCorsCredentials() (bool, error) {
+	return s.getBool("corsCredentials")
+}
+
+func (s *SettingService) GetScanBlockThreshold() (int, error) {
+	return s.getInt("scanBlockThreshold")
+}
+
+func (s *SettingService) GetScanBlockDuration() (int, error) {
+	return s.getInt("scanBlockDuration")
+}
+
+func (s *SettingService) GetInboundSoftLimit() (int, error) {
+	return s.getInt("inboundSoftLimit")
+}
+
+func (s *SettingService) GetInboundHardLimit() (int, error) {
+	return s.getInt("inboundHardLimit")
+}
+
+func (s *SettingService) GetPanelTitle() (string, error) {
+	return s.getString("panelTitle")
+}
+
+func (s *SettingService) GetPanelLogo() (string, error) {
+	return s.getString("panelLogo")
+}
+
+func (s *SettingService) SetPanelLogo(logo string) error {
+	return s.setString("panelLogo", logo)
+}
+
+// GetAccessLogOffset returns how far the ip limit job read the access log
+func (s *SettingService) GetAccessLogOffset() (int64, error) {
+	value, err := s.getString("accessLogOffset")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (s *SettingService) SetAccessLogOffset(offset int64) error {
+	return s.setString("accessLogOffset", strconv.FormatInt(offset, 10))
+}
+
+// GetAccessLogFileId returns the device and inode of the access log the offset belongs to
+func (s *SettingService) GetAccessLogFileId() (string, error) {
+	return s.getString("accessLogFileId")
+}
+
+func (s *SettingService) SetAccessLogFileId(fileId string) error {
+	return s.setString("accessLogFileId", fileId)
+}
+
 func (s *SettingService) GetBasePath() (string, error) {
 	basePath, err := s.getString("webBasePath")
 	if err != nil {
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/crypto"
+	"x-ui/web/entity"
+
+	"github.com/op/go-logging"
+)
+
+func cleanSettings(t *testing.T) {
+	t.Cleanup(func() {
+		database.GetDB().Where("1 = 1").Delete(model.Setting{})
+		clearTrustedProxies()
+	})
+}
+
+func getRawSetting(t *testing.T, key string) string {
+	t.Helper()
+	setting := &model.Setting{}
+	err := database.GetDB().Where("key = ?", key).First(setting).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return setting.Value
+}
+
+func TestSecretSettingsAreEncrypted(t *testing.T) {
+	cleanSettings(t)
+	t.Setenv("XUI_MASTER_KEY", "master key")
+	s := &SettingService{}
+	err := s.SetTgBotToken("bot token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SetTgBotChatId(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value := getRawSetting(t, "tgBotToken"); !crypto.IsEncrypted(value) {
+		t.Errorf("secret setting is stored as %q", value)
+	}
+	if value := getRawSetting(t, "tgBotChatId"); value != "42" {
+		t.Errorf("plain setting is stored as %q, want 42", value)
+	}
+	token, err := s.GetTgBotToken()
+	if err != nil || token != "bot token" {
+		t.Errorf("GetTgBotToken() = %q, %v", token, err)
+	}
+}
+
+func TestCheckSecrets(t *testing.T) {
+	tests := []struct {
+		name      string
+		writeKey  string
+		checkKey  string
+		wantErr   bool
+		encrypted bool
+	}{
+		{"no key and plaintext", "", "", false, false},
+		{"key encrypts plaintext", "", "master key", false, true},
+		{"same key", "master key", "master key", false, true},
+		{"missing key", "master key", "", true, true},
+		{"wrong key", "master key", "other key", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanSettings(t)
+			s := &SettingService{}
+			t.Setenv("XUI_MASTER_KEY", tt.writeKey)
+			err := s.SetTgBotToken("bot token")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Setenv("XUI_MASTER_KEY", tt.checkKey)
+			err = s.CheckSecrets()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if encrypted := crypto.IsEncrypted(getRawSetting(t, "tgBotToken")); encrypted != tt.encrypted {
+				t.Errorf("token encrypted = %v, want %v", encrypted, tt.encrypted)
+			}
+		})
+	}
+}
+
+func TestPlainSettingsLookingEncrypted(t *testing.T) {
+	cleanSettings(t)
+	t.Setenv("XUI_MASTER_KEY", "")
+	s := &SettingService{}
+	err := s.setString("panelTitle", "enc:x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CheckSecrets()
+	if err != nil {
+		t.Errorf("CheckSecrets() = %v", err)
+	}
+	title, err := s.GetPanelTitle()
+	if err != nil || title != "enc:x" {
+		t.Errorf("GetPanelTitle() = %q, %v", title, err)
+	}
+	allSetting, err := s.GetAllSetting()
+	if err != nil || allSetting.PanelTitle != "enc:x" {
+		t.Errorf("GetAllSetting() = %v, %v", allSetting, err)
+	}
+	t.Setenv("XUI_MASTER_KEY", "master key")
+	err = s.CheckSecrets()
+	if err != nil || getRawSetting(t, "panelTitle") != "enc:x" {
+		t.Errorf("CheckSecrets() with a master key = %v, panelTitle %q", err, getRawSetting(t, "panelTitle"))
+	}
+}
+
+func TestCheckSecretsDecryptsFormerSecrets(t *testing.T) {
+	cleanSettings(t)
+	t.Setenv("XUI_MASTER_KEY", "master key")
+	// webKeyFile is a path, older versions stored it encrypted
+	value, err := crypto.Encrypt([]byte("master key"), "/root/key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.GetDB().Create(&model.Setting{Key: "webKeyFile", Value: value}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SettingService{}
+	err = s.CheckSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getRawSetting(t, "webKeyFile"); value != "/root/key.pem" {
+		t.Errorf("webKeyFile is stored as %q", value)
+	}
+}
+
+func TestTrustedProxiesAreCached(t *testing.T) {
+	cleanSettings(t)
+	s := &SettingService{}
+	db := database.GetDB()
+	contains := func(ip string) bool {
+		t.Helper()
+		networks, err := s.GetTrustedProxies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, network := range networks {
+			if network.Contains(net.ParseIP(ip)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !contains("127.0.0.1") {
+		t.Fatal("the default trusted proxies miss 127.0.0.1")
+	}
+	// a value written around the service is not read, the cached one is used
+	err := db.Create(&model.Setting{Key: "webTrustedProxies", Value: "10.0.0.0/8"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contains("10.1.2.3") || !contains("127.0.0.1") {
+		t.Error("the trusted proxies were read from the database again")
+	}
+	// saving the setting refreshes them
+	err = s.setString("webTrustedProxies", "192.168.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains("192.168.1.1") || contains("127.0.0.1") {
+		t.Error("the saved trusted proxies are not used")
+	}
+	err = s.ResetSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !contains("127.0.0.1") || contains("192.168.1.1") {
+		t.Error("the trusted proxies are not reset with the settings")
+	}
+}
+
+func TestGetJobInterval(t *testing.T) {
+	cleanSettings(t)
+	logs := &bytes.Buffer{}
+	logger.InitLoggerTo(logging.INFO, logs)
+	t.Cleanup(func() {
+		logger.InitLogger(logging.INFO)
+	})
+	s := &SettingService{}
+
+	tests := []struct {
+		name     string
+		key      string
+		value    string
+		want     time.Duration
+		wantWarn bool
+	}{
+		{"default xray check", "xrayCheckInterval", "", 30 * time.Second, false},
+		{"default traffic", "trafficInterval", "", 10 * time.Second, false},
+		{"default inbound check", "inboundCheckInterval", "", 30 * time.Second, false},
+		{"configured", "trafficInterval", "60", time.Minute, false},
+		{"at the floor", "xrayCheckInterval", strconv.Itoa(entity.MinJobInterval), time.Duration(entity.MinJobInterval) * time.Second, false},
+		{"below the floor", "xrayCheckInterval", strconv.Itoa(entity.MinJobInterval - 1), 30 * time.Second, true},
+		{"negative", "inboundCheckInterval", "-10", 30 * time.Second, true},
+		{"not a number", "trafficInterval", "10s", 10 * time.Second, true},
+		{"blank", "trafficInterval", " ", 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database.GetDB().Where("key = ?", tt.key).Delete(model.Setting{})
+			if tt.value != "" {
+				err := s.saveSetting(tt.key, tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			logs.Reset()
+			got := s.GetJobInterval(tt.key)
+			if got != tt.want {
+				t.Errorf("GetJobInterval(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+			if warned := strings.Contains(logs.String(), tt.key); warned != tt.wantWarn {
+				t.Errorf("GetJobInterval(%q) warned = %v, want %v: %q", tt.key, warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+
+	// saving an interval below the floor is rejected
+	database.GetDB().Where("key = ?", "trafficInterval").Delete(model.Setting{})
+	allSetting, err := s.GetAllSetting()
+	if err != nil {
+		t.Fatal(err)
+	}
+	allSetting.TrafficInterval = entity.MinJobInterval - 1
+	err = s.UpdateAllSetting(allSetting)
+	if err == nil {
+		t.Error("UpdateAllSetting() with a traffic interval below the floor didn't fail")
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"x-ui/database/model"
+	"x-ui/logger"
+)
+
+// ErrSubNotFound means no client has the subscription id, other errors of the sub service are failures
+var ErrSubNotFound = errors.New("subscription not found")
+
+type SubInfo struct {
+	Up     int64 `json:"up"`
+	Down   int64 `json:"down"`
+	Total  int64 `json:"total"`
+	Expire int64 `json:"expire"`
+}
+
+type SubService struct {
+	inboundService InboundService
+}
+
+// GetClientBySubId returns the client owning the subscription and its inbound
+func (s *SubService) GetClientBySubId(subId string) (*model.Inbound, *model.Client, error) {
+	if subId == "" {
+		return nil, nil, fmt.Errorf("%w: subscription id can not be empty", ErrSubNotFound)
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, inbound := range inbounds {
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if clients[i].SubID == subId {
+				return inbound, &clients[i], nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: %v", ErrSubNotFound, subId)
+}
+
+// GetSubInfo returns usage and expiry of the subscription, the client's own
+// traffic, quota and expiry take precedence over the inbound's
+func (s *SubService) GetSubInfo(subId string) (*SubInfo, error) {
+	inbound, client, err := s.GetClientBySubId(subId)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetClientInfo(inbound, client)
+}
+
+// GetClientInfo returns usage and expiry of the client on the inbound
+func (s *SubService) GetClientInfo(inbound *model.Inbound, client *model.Client) (*SubInfo, error) {
+	info := &SubInfo{
+		Up:     inbound.Up,
+		Down:   inbound.Down,
+		Total:  inbound.Total,
+		Expire: inbound.ExpiryTime,
+	}
+	if client.Email != "" {
+		traffic, err := s.inboundService.GetClientTraffic(client.Email)
+		if err != nil {
+			return nil, err
+		}
+		if traffic != nil {
+			info.Up = traffic.Up
+			info.Down = traffic.Down
+		}
+	}
+	if client.TotalGB > 0 {
+		info.Total = client.TotalGB
+	}
+	if client.ExpiryTime > 0 {
+		info.Expire = client.ExpiryTime
+	}
+	return info, nil
+}
+
+// getSubClients returns the clients of the subscription on enabled inbounds, inbounds[i] is the inbound of clients[i]
+func (s *SubService) getSubClients(subId string) ([]*model.Inbound, []*model.Client, error) {
+	if subId == "" {
+		return nil, nil, fmt.Errorf("%w: subscription id can not be empty", ErrSubNotFound)
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, nil, err
+	}
+	subInbounds := make([]*model.Inbound, 0)
+	subClients := make([]*model.Client, 0)
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		clients, err := inbound.GetClients()
+		if err != nil {
+			continue
+		}
+		for i := range clients {
+			if clients[i].SubID == subId {
+				subInbounds = append(subInbounds, inbound)
+				subClients = append(subClients, &clients[i])
+			}
+		}
+	}
+	if len(subClients) == 0 {
+		return nil, nil, fmt.Errorf("%w: %v", ErrSubNotFound, subId)
+	}
+	return subInbounds, subClients, nil
+}
+
+// GetSubLinks returns the share links of the subscription, base64 encoded one per line as v2ray clients expect
+func (s *SubService) GetSubLinks(subId string, address string) (string, error) {
+	inbounds, clients, err := s.getSubClients(subId)
+	if err != nil {
+		return "", err
+	}
+	links := make([]string, 0, len(clients))
+	for i, client := range clients {
+		link, err := GetClientLink(inbounds[i], client, address)
+		if err != nil {
+			logger.Warningf("skip inbound %v of subscription %v: %v", inbounds[i].Tag, subId, err)
+			continue
+		}
+		links = append(links, link)
+	}
+	return base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n"))), nil
+}
+
+// GetSubClash returns the subscription as clash profile, inbounds clash can't use are left out
+func (s *SubService) GetSubClash(subId string, address string) ([]byte, error) {
+	inbounds, clients, err := s.getSubClients(subId)
+	if err != nil {
+		return nil, err
+	}
+	proxies := make([]*clashProxy, 0, len(clients))
+	for i, client := range clients {
+		proxy, err := GetClashProxy(inbounds[i], client, address)
+		if err != nil {
+			logger.Warningf("skip inbound %v of subscription %v: %v", inbounds[i].Tag, subId, err)
+			continue
+		}
+		proxies = append(proxies, proxy)
+	}
+	return genClashProfile(proxies)
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// the bot is kept between messages, creating it asks telegram who the bot is every time
+var tgBot *tgbotapi.BotAPI
+var tgBotLock sync.Mutex
+
+// the bot receiving the messages sent to it, tgBot may be replaced while it receives
+var tgBotReceiving *tgbotapi.BotAPI
+
+// tgXrayResultMax is how much of the xray output goes in a message, the end of it has the error
+const tgXrayResultMax = 1000
+
+type TgBotService struct {
+	settingService SettingService
+	inboundService InboundService
+	xrayService    XrayService
+	subService     SubService
+}
+
+func (s *TgBotService) IsEnabled() bool {
+	enabled, err := s.settingService.GetTgbotenabled()
+	return err == nil && enabled
+}
+
+func (s *TgBotService) getBot() (*tgbotapi.BotAPI, error) {
+	token, err := s.settingService.GetTgBotToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, common.NewError("telegram bot token is not set")
+	}
+	tgBotLock.Lock()
+	defer tgBotLock.Unlock()
+	if tgBot != nil && tgBot.Token == token {
+		return tgBot, nil
+	}
+	bot, err := tgbotapi.NewBotAPI(token)
+	if err != nil {
+		return nil, err
+	}
+	tgBot = bot
+	return bot, nil
+}
+
+// SendMsg sends the message to the configured chat whether the bot is enabled or not
+func (s *TgBotService) SendMsg(msg string) error {
+	chatId, err := s.settingService.GetTgBotChatId()
+	if err != nil {
+		return err
+	}
+	if chatId == 0 {
+		return common.NewError("telegram bot chat id is not set")
+	}
+	bot, err := s.getBot()
+	if err != nil {
+		return err
+	}
+	_, err = bot.Send(tgbotapi.NewMessage(int64(chatId), msg))
+	return err
+}
+
+// Notify sends the message in the background when the bot is enabled, so a slow
+// telegram doesn't hold up the caller
+func (s *TgBotService) Notify(msg string) {
+	if !s.IsEnabled() {
+		return
+	}
+	go func() {
+		err := s.SendMsg(msg)
+		if err != nil {
+			logger.Warning("send message to telegram bot failed:", err)
+		}
+	}()
+}
+
+// getHostInfo returns the hostname and the first non loopback address of the server
+func getHostInfo() (string, string) {
+	name, err := os.Hostname()
+	if err != nil {
+		logger.Warning("get hostname failed:", err)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		logger.Warning("get interface addresses failed:", err)
+		return name, ""
+	}
+	ip := ""
+	for _, address := range addrs {
+		ipnet, ok := address.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return name, ipnet.IP.String()
+		}
+		if ip == "" {
+			ip = ipnet.IP.String()
+		}
+	}
+	return name, ip
+}
+
+// GetTrafficReport returns the traffic and state of every inbound
+func (s *TgBotService) GetTrafficReport() (string, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return "", err
+	}
+	name, ip := getHostInfo()
+	info := fmt.Sprintf("主机名称:%s\r\nIP地址:%s\r\n \r\n", name, ip)
+	if len(inbounds) == 0 {
+		info += "没有入站\r\n"
+	}
+	var up, down int64
+	now := time.Now().Unix() * 1000
+	for _, inbound := range inbounds {
+		up += inbound.Up
+		down += inbound.Down
+		info += fmt.Sprintf("节点名称:%s\r\n端口:%d\r\n上行流量↑:%s\r\n下行流量↓:%s\r\n总流量:%s\r\n", inbound.Remark, inbound.Port, common.FormatTraffic(inbound.Up), common.FormatTraffic(inbound.Down), common.FormatTraffic(inbound.Up+inbound.Down))
+		if inbound.IsExpired(now) {
+			info += "状态:已到期\r\n"
+		} else if inbound.IsExhausted() {
+			info += "状态:流量已用完\r\n"
+		} else if !inbound.Enable {
+			info += "状态:已禁用\r\n"
+		} else {
+			info += "状态:正常\r\n"
+		}
+		if inbound.ExpiryTime == 0 {
+			info += "到期时间:无限期\r\n \r\n"
+		} else {
+			info += fmt.Sprintf("到期时间:%s\r\n \r\n", time.Unix(inbound.ExpiryTime/1000, 0).Format("2006-01-02 15:04:05"))
+		}
+	}
+	info += fmt.Sprintf("全部上行↑:%s\r\n全部下行↓:%s\r\n", common.FormatTraffic(up), common.FormatTraffic(down))
+	if !s.xrayService.IsXrayRunning() {
+		info += "注意: xray 当前没有运行\r\n"
+	}
+	return info, nil
+}
+
+// NotifyLogin tells the chat about a login attempt on the panel
+func (s *TgBotService) NotifyLogin(username string, ip string, success bool) {
+	notify, err := s.settingService.GetTgNotifyLogin()
+	if err != nil || !notify {
+		return
+	}
+	name, _ := getHostInfo()
+	var msg string
+	if success {
+		msg = fmt.Sprintf("面板登录成功提醒\r\n主机名称:%s\r\n", name)
+	} else {
+		msg = fmt.Sprintf("面板登录失败提醒\r\n主机名称:%s\r\n", name)
+	}
+	msg += fmt.Sprintf("时间:%s\r\n", time.Now().Format("2006-01-02 15:04:05"))
+	msg += fmt.Sprintf("用户:%s\r\n", username)
+	msg += fmt.Sprintf("IP:%s\r\n", ip)
+	s.Notify(msg)
+}
+
+// NotifyXrayDown tells the chat xray stopped running, or that it is running again
+func (s *TgBotService) NotifyXrayDown(down bool) {
+	notify, err := s.settingService.GetTgNotifyXrayDown()
+	if err != nil || !notify {
+		return
+	}
+	name, _ := getHostInfo()
+	if !down {
+		s.Notify(fmt.Sprintf("xray 已恢复运行\r\n主机名称:%s\r\n", name))
+		return
+	}
+	msg := fmt.Sprintf("xray 已停止运行，正在尝试重启\r\n主机名称:%s\r\n", name)
+	if err := s.xrayService.GetXrayErr(); err != nil {
+		msg += fmt.Sprintf("错误:%v\r\n", err)
+	}
+	if result := s.xrayService.GetXrayResult(); result != "" {
+		// telegram refuses messages longer than 4096 characters
+		if len(result) > tgXrayResultMax {
+			result = result[len(result)-tgXrayResultMax:]
+		}
+		msg += fmt.Sprintf("输出:%s\r\n", result)
+	}
+	s.Notify(msg)
+}
+
+const tgBotHelp = "发送 /usage 加上你的 UUID、密码或 Email 查询剩余流量和到期时间，例如:\r\n" +
+	"/usage 2a1e3b2c-0000-4000-8000-000000000000\r\n" +
+	"使用 UUID 或密码查询后，该用户会绑定到你的 Telegram 账号，之后直接发送 /usage 即可查询\r\n"
+
+// StartReceiving answers the messages sent to the bot until StopReceiving is called
+func (s *TgBotService) StartReceiving() error {
+	bot, err := s.getBot()
+	if err != nil {
+		return err
+	}
+	tgBotLock.Lock()
+	defer tgBotLock.Unlock()
+	if tgBotReceiving != nil {
+		return nil
+	}
+	tgBotReceiving = bot
+	config := tgbotapi.NewUpdate(0)
+	config.Timeout = 60
+	updates := bot.GetUpdatesChan(config)
+	go func() {
+		for update := range updates {
+			if update.Message == nil || update.Message.From == nil {
+				continue
+			}
+			s.answer(bot, update.Message)
+		}
+	}()
+	return nil
+}
+
+func (s *TgBotService) StopReceiving() {
+	tgBotLock.Lock()
+	defer tgBotLock.Unlock()
+	if tgBotReceiving == nil {
+		return
+	}
+	tgBotReceiving.StopReceivingUpdates()
+	// a stopped bot can't receive again
+	if tgBot == tgBotReceiving {
+		tgBot = nil
+	}
+	tgBotReceiving = nil
+}
+
+func (s *TgBotService) answer(bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	var text string
+	var err error
+	adminChatId, _ := s.settingService.GetTgBotChatId()
+	isAdmin := adminChatId != 0 && message.Chat.ID == int64(adminChatId)
+	switch message.Command() {
+	case "start", "help":
+		text = tgBotHelp
+	case "usage":
+		// usage is private, it is only told in a chat with the user
+		if !message.Chat.IsPrivate() {
+			return
+		}
+		text, err = s.getUsage(message.From.ID, strings.TrimSpace(message.CommandArguments()))
+	case "report":
+		if !isAdmin {
+			return
+		}
+		text, err = s.GetTrafficReport()
+	default:
+		if !message.Chat.IsPrivate() {
+			return
+		}
+		text = tgBotHelp
+	}
+	if err != nil {
+		logger.Warning("answer telegram message failed:", err)
+		text = "查询失败，请稍后再试"
+	}
+	reply := tgbotapi.NewMessage(message.Chat.ID, text)
+	reply.ReplyToMessageID = message.MessageID
+	_, err = bot.Send(reply)
+	if err != nil {
+		logger.Warning("send message to telegram bot failed:", err)
+	}
+}
+
+// getUsage returns the usage of the client the key belongs to, or of the clients bound to the
+// telegram user without a key. Only a secret key binds an unbound client, the email is easy to guess
+func (s *TgBotService) getUsage(tgId int64, key string) (string, error) {
+	if key == "" {
+		inbounds, clients, err := s.inboundService.GetTgClients(tgId)
+		if err != nil {
+			return "", err
+		}
+		if len(clients) == 0 {
+			return "你的 Telegram 账号还没有绑定用户\r\n" + tgBotHelp, nil
+		}
+		info := ""
+		for i := range clients {
+			usage, err := s.getClientUsage(inbounds[i], clients[i])
+			if err != nil {
+				return "", err
+			}
+			info += usage + " \r\n"
+		}
+		return info, nil
+	}
+	inbound, client, err := s.inboundService.FindClient(key)
+	if err != nil {
+		return "", err
+	}
+	if client == nil {
+		return "没有找到该用户\r\n", nil
+	}
+	if client.TgID != 0 && client.TgID != tgId {
+		return "该用户已绑定其他 Telegram 账号\r\n", nil
+	}
+	bound := ""
+	if client.TgID == 0 && client.Email != "" && client.Email != key {
+		err = s.inboundService.SetClientTgId(inbound.Id, client.Email, tgId)
+		if err != nil {
+			return "", err
+		}
+		bound = "已将该用户绑定到你的 Telegram 账号\r\n"
+	}
+	usage, err := s.getClientUsage(inbound, client)
+	if err != nil {
+		return "", err
+	}
+	return bound + usage, nil
+}
+
+func (s *TgBotService) getClientUsage(inbound *model.Inbound, client *model.Client) (string, error) {
+	info, err := s.subService.GetClientInfo(inbound, client)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	days, traffic := info.getRemaining(now)
+	usage := fmt.Sprintf("用户:%s\r\n上行流量↑:%s\r\n下行流量↓:%s\r\n", client.Email, common.FormatTraffic(info.Up), common.FormatTraffic(info.Down))
+	if traffic < 0 {
+		usage += "剩余流量:无限制\r\n"
+	} else {
+		usage += fmt.Sprintf("剩余流量:%s\r\n", common.FormatTraffic(traffic))
+	}
+	if days < 0 {
+		usage += "到期时间:无限期\r\n"
+	} else {
+		usage += fmt.Sprintf("到期时间:%s (剩余 %d 天)\r\n", time.Unix(info.Expire/1000, 0).Format("2006-01-02 15:04:05"), days)
+	}
+	if !inbound.Enable || traffic == 0 || (info.Expire > 0 && info.Expire <= now.Unix()*1000) {
+		usage += "状态:不可用\r\n"
+	} else {
+		usage += "状态:正常\r\n"
+	}
+	return usage, nil
+}
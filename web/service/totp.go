@@ -0,0 +1,246 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/crypto"
+	"x-ui/util/totp"
+)
+
+const totpIssuer = "x-ui"
+
+// totpRecoveryCodes is how many recovery codes a user gets, each works once
+const totpRecoveryCodes = 8
+
+// totpLock keeps a code from being accepted twice by concurrent logins
+var totpLock sync.Mutex
+
+func (s *UserService) getTotp(userId int) (*model.UserTotp, error) {
+	userTotp := &model.UserTotp{}
+	err := database.GetDB().Where("user_id = ?", userId).First(userTotp).Error
+	if database.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userTotp, nil
+}
+
+// IsTotpEnabled reports whether the user must give a totp code to login
+func (s *UserService) IsTotpEnabled(userId int) (bool, error) {
+	userTotp, err := s.getTotp(userId)
+	if err != nil {
+		return false, err
+	}
+	return userTotp != nil && userTotp.Enabled, nil
+}
+
+// NewTotp starts the enrollment of the user with a new secret, returning it and the uri
+// for authenticator apps, two factor authentication stays off until EnableTotp
+func (s *UserService) NewTotp(user *model.User) (string, string, error) {
+	totpLock.Lock()
+	defer totpLock.Unlock()
+	userTotp, err := s.getTotp(user.Id)
+	if err != nil {
+		return "", "", err
+	}
+	if userTotp == nil {
+		userTotp = &model.UserTotp{UserId: user.Id}
+	} else if userTotp.Enabled {
+		return "", "", common.NewError("two factor authentication is already enabled")
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return "", "", err
+	}
+	userTotp.Secret, err = encryptSecret(secret)
+	if err != nil {
+		return "", "", err
+	}
+	err = database.GetDB().Save(userTotp).Error
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.GetUri(totpIssuer, user.Username, secret), nil
+}
+
+// validateTotp returns the step the code of the user is valid at now, 0 if it is not valid
+func validateTotp(userTotp *model.UserTotp, code string) (int64, error) {
+	secret, err := decryptSecret(userTotp.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return totp.Validate(secret, code, time.Now()), nil
+}
+
+// checkTotpSecrets makes sure the encrypted totp secrets can be read and encrypts the
+// ones still stored in plaintext, like CheckSecrets does for the settings
+func checkTotpSecrets(masterKey []byte) error {
+	db := database.GetDB()
+	userTotps := make([]*model.UserTotp, 0)
+	err := db.Model(model.UserTotp{}).Find(&userTotps).Error
+	if err != nil {
+		return err
+	}
+	for _, userTotp := range userTotps {
+		if crypto.IsEncrypted(userTotp.Secret) {
+			if masterKey == nil {
+				return common.NewErrorf("totp secret of user %v is encrypted, set XUI_MASTER_KEY or XUI_MASTER_KEY_FILE to start", userTotp.UserId)
+			}
+			_, err = crypto.Decrypt(masterKey, userTotp.Secret)
+			if err != nil {
+				return common.NewErrorf("totp secret of user %v: %v", userTotp.UserId, err)
+			}
+		} else if masterKey != nil && userTotp.Secret != "" {
+			secret, err := crypto.Encrypt(masterKey, userTotp.Secret)
+			if err != nil {
+				return err
+			}
+			err = db.Model(userTotp).Update("secret", secret).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, totpRecoveryCodes)
+	hashes := make([]string, 0, totpRecoveryCodes)
+	for i := 0; i < totpRecoveryCodes; i++ {
+		code := make([]byte, 5)
+		_, err := rand.Read(code)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, hex.EncodeToString(code))
+		hashes = append(hashes, hashRecoveryCode(codes[i]))
+	}
+	return codes, hashes, nil
+}
+
+// EnableTotp finishes the enrollment with a code of the new secret and returns the recovery codes
+func (s *UserService) EnableTotp(userId int, code string) ([]string, error) {
+	totpLock.Lock()
+	defer totpLock.Unlock()
+	userTotp, err := s.getTotp(userId)
+	if err != nil {
+		return nil, err
+	}
+	if userTotp == nil || userTotp.Secret == "" {
+		return nil, common.NewError("two factor authentication is not being set up")
+	}
+	if userTotp.Enabled {
+		return nil, common.NewError("two factor authentication is already enabled")
+	}
+	step, err := validateTotp(userTotp, code)
+	if err != nil {
+		return nil, err
+	}
+	if step == 0 {
+		return nil, common.NewError("wrong two factor code")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	userTotp.Enabled = true
+	userTotp.LastStep = step
+	userTotp.RecoveryCodes = strings.Join(hashes, ",")
+	err = database.GetDB().Save(userTotp).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkTotp reports whether the code is a new totp code or an unused recovery code of
+// the user, the code is used up when it is
+func (s *UserService) checkTotp(userTotp *model.UserTotp, code string) (bool, error) {
+	step, err := validateTotp(userTotp, code)
+	if err != nil {
+		return false, err
+	}
+	if step > userTotp.LastStep {
+		userTotp.LastStep = step
+		return true, database.GetDB().Save(userTotp).Error
+	}
+	if step != 0 {
+		return false, nil
+	}
+	hash := hashRecoveryCode(code)
+	hashes := strings.Split(userTotp.RecoveryCodes, ",")
+	for i := range hashes {
+		if hashes[i] == hash {
+			hashes = append(hashes[:i], hashes[i+1:]...)
+			userTotp.RecoveryCodes = strings.Join(hashes, ",")
+			return true, database.GetDB().Save(userTotp).Error
+		}
+	}
+	return false, nil
+}
+
+// CheckTotp reports whether the code lets the user in, it always does when two factor
+// authentication is off
+func (s *UserService) CheckTotp(userId int, code string) (bool, error) {
+	totpLock.Lock()
+	defer totpLock.Unlock()
+	userTotp, err := s.getTotp(userId)
+	if err != nil {
+		return false, err
+	}
+	if userTotp == nil || !userTotp.Enabled {
+		return true, nil
+	}
+	return s.checkTotp(userTotp, code)
+}
+
+// DisableTotp turns two factor authentication off, it takes a code like a login does
+func (s *UserService) DisableTotp(userId int, code string) error {
+	totpLock.Lock()
+	defer totpLock.Unlock()
+	userTotp, err := s.getTotp(userId)
+	if err != nil {
+		return err
+	}
+	if userTotp == nil || !userTotp.Enabled {
+		return common.NewError("two factor authentication is not enabled")
+	}
+	ok, err := s.checkTotp(userTotp, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.NewError("wrong two factor code")
+	}
+	return database.GetDB().Delete(userTotp).Error
+}
+
+// ResetTotp turns two factor authentication off for every user, for admins locked out of it
+func (s *UserService) ResetTotp() error {
+	return database.GetDB().Where("1 = 1").Delete(model.UserTotp{}).Error
+}
+
+// ResetAdmin sets the login of the first admin and turns two factor authentication off,
+// it is what reset-admin of the command line does for admins locked out of the panel
+func (s *UserService) ResetAdmin(username string, password string) error {
+	err := s.UpdateFirstUser(username, password)
+	if err != nil {
+		return err
+	}
+	return s.ResetTotp()
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/crypto"
+	"x-ui/util/totp"
+)
+
+func getRawTotpSecret(t *testing.T, userId int) string {
+	t.Helper()
+	userTotp := &model.UserTotp{}
+	err := database.GetDB().Where("user_id = ?", userId).First(userTotp).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userTotp.Secret
+}
+
+func TestTotpSecretIsEncrypted(t *testing.T) {
+	t.Cleanup(func() { database.GetDB().Where("1 = 1").Delete(model.UserTotp{}) })
+	t.Setenv("XUI_MASTER_KEY", "master key")
+	s := &UserService{}
+	user := &model.User{Id: 1, Username: "admin"}
+	secret, _, err := s.NewTotp(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getRawTotpSecret(t, user.Id); !crypto.IsEncrypted(value) || value == secret {
+		t.Errorf("totp secret is stored as %q", value)
+	}
+
+	code, err := totp.GenerateCode(secret, totp.GetStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.EnableTotp(user.Id, code)
+	if err != nil {
+		t.Fatalf("EnableTotp() = %v", err)
+	}
+	// a code of the next period still works when the clock of the phone is ahead
+	code, err = totp.GenerateCode(secret, totp.GetStep(time.Now())+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := s.CheckTotp(user.Id, code)
+	if err != nil || !ok {
+		t.Errorf("CheckTotp() = %v, %v", ok, err)
+	}
+
+	t.Setenv("XUI_MASTER_KEY", "")
+	_, err = s.CheckTotp(user.Id, "000000")
+	if err == nil {
+		t.Error("CheckTotp() read the encrypted secret without the master key")
+	}
+}
+
+func TestCheckSecretsEncryptsTotp(t *testing.T) {
+	t.Cleanup(func() { database.GetDB().Where("1 = 1").Delete(model.UserTotp{}) })
+	cleanSettings(t)
+	t.Setenv("XUI_MASTER_KEY", "")
+	s := &UserService{}
+	user := &model.User{Id: 1, Username: "admin"}
+	secret, _, err := s.NewTotp(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := getRawTotpSecret(t, user.Id); value != secret {
+		t.Fatalf("totp secret without a master key is stored as %q", value)
+	}
+
+	t.Setenv("XUI_MASTER_KEY", "master key")
+	settingService := &SettingService{}
+	err = settingService.CheckSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := getRawTotpSecret(t, user.Id)
+	if !crypto.IsEncrypted(value) {
+		t.Fatalf("CheckSecrets() left the totp secret as %q", value)
+	}
+	if decrypted, err := crypto.Decrypt([]byte("master key"), value); err != nil || decrypted != secret {
+		t.Errorf("decrypted totp secret = %q, %v", decrypted, err)
+	}
+
+	t.Setenv("XUI_MASTER_KEY", "other key")
+	err = settingService.CheckSecrets()
+	if err == nil {
+		t.Error("CheckSecrets() accepted a totp secret of another master key")
+	}
+}
+
+func TestResetAdmin(t *testing.T) {
+	db := database.GetDB()
+	admin := &model.User{}
+	err := db.Where("role = ?", model.RoleAdmin).Order("id").First(admin).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator := &model.User{Username: "reset-operator", Password: "operator", Role: model.RoleOperator}
+	err = db.Create(operator).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Save(admin)
+		db.Delete(operator)
+		db.Where("1 = 1").Delete(model.UserTotp{})
+	})
+	for _, userId := range []int{admin.Id, operator.Id} {
+		err = db.Create(&model.UserTotp{UserId: userId, Secret: "secret", Enabled: true}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &UserService{}
+	err = s.ResetAdmin("", "new password")
+	if err == nil {
+		t.Error("ResetAdmin() took an empty username")
+	}
+	if enabled, _ := s.IsTotpEnabled(admin.Id); !enabled {
+		t.Error("a failed ResetAdmin() turned two factor authentication off")
+	}
+
+	err = s.ResetAdmin("new admin", "new password")
+	if err != nil {
+		t.Fatalf("ResetAdmin() = %v", err)
+	}
+	user := s.CheckUser("new admin", "new password")
+	if user == nil || user.Id != admin.Id || user.Role != model.RoleAdmin {
+		t.Errorf("CheckUser() with the new login = %+v, want user %v", user, admin.Id)
+	}
+	if s.CheckUser(admin.Username, admin.Password) != nil {
+		t.Error("the old login still works")
+	}
+	if s.CheckUser(operator.Username, operator.Password) == nil {
+		t.Error("ResetAdmin() changed the login of another user")
+	}
+	var count int64
+	db.Model(model.UserTotp{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%v users still have two factor authentication", count)
+	}
+}
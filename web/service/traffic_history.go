@@ -0,0 +1,99 @@
+package service
+
+import (
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+
+	"gorm.io/gorm"
+)
+
+// traffic history is kept per hour, so the table grows by one row per inbound or client an hour
+const trafficHistoryBucket = time.Hour
+
+type TopTalker struct {
+	Name  string `json:"name"`
+	Up    int64  `json:"up"`
+	Down  int64  `json:"down"`
+	Total int64  `json:"total"`
+}
+
+type TrafficHistoryService struct {
+}
+
+func getTrafficHistoryTime(t time.Time) int64 {
+	return t.Truncate(trafficHistoryBucket).Unix() * 1000
+}
+
+// addTrafficHistory adds traffic to the current hour of the inbound tag or client email
+func addTrafficHistory(tx *gorm.DB, tag string, email string, up int64, down int64) error {
+	if up == 0 && down == 0 {
+		return nil
+	}
+	historyTime := getTrafficHistoryTime(time.Now())
+	result := tx.Model(model.TrafficHistory{}).
+		Where("tag = ? and email = ? and time = ?", tag, email, historyTime).
+		Updates(map[string]interface{}{
+			"up":   gorm.Expr("up + ?", up),
+			"down": gorm.Expr("down + ?", down),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return tx.Create(&model.TrafficHistory{
+		Tag:   tag,
+		Email: email,
+		Up:    up,
+		Down:  down,
+		Time:  historyTime,
+	}).Error
+}
+
+// GetTopTalkers returns who used the most traffic between since and until (unix ms),
+// by is inbound or client, order is total, up or down
+func (s *TrafficHistoryService) GetTopTalkers(by string, order string, since int64, until int64, limit int) ([]*TopTalker, error) {
+	var column string
+	db := database.GetDB().Model(model.TrafficHistory{})
+	switch by {
+	case "inbound":
+		column = "tag"
+		db = db.Where("email = ''")
+	case "client":
+		column = "email"
+		db = db.Where("email != ''")
+	default:
+		return nil, common.NewError("unknown top talker type:", by)
+	}
+	switch order {
+	case "total", "up", "down":
+	default:
+		return nil, common.NewError("unknown top talker order:", order)
+	}
+	if since > 0 {
+		db = db.Where("time >= ?", since)
+	}
+	if until > 0 {
+		db = db.Where("time < ?", until)
+	}
+	talkers := make([]*TopTalker, 0)
+	err := db.Select(column + " as name, sum(up) as up, sum(down) as down, sum(up + down) as total").
+		Group(column).
+		Order(order + " desc").
+		Limit(limit).
+		Scan(&talkers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return talkers, nil
+}
+
+// DelTrafficHistoryBefore deletes the history older than t
+func (s *TrafficHistoryService) DelTrafficHistoryBefore(t time.Time) error {
+	db := database.GetDB()
+	return db.Where("time < ?", t.Unix()*1000).Delete(model.TrafficHistory{}).Error
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+func TestGetTopTalkers(t *testing.T) {
+	db := database.GetDB()
+	t.Cleanup(func() {
+		db.Where("1 = 1").Delete(model.TrafficHistory{})
+	})
+	// inbounds have rows without an email, their clients rows with one
+	histories := []*model.TrafficHistory{
+		{Tag: "inbound-a", Up: 100, Down: 900, Time: 1000},
+		{Tag: "inbound-a", Up: 50, Down: 50, Time: 2000},
+		{Tag: "inbound-b", Up: 800, Down: 100, Time: 1000},
+		{Tag: "inbound-c", Up: 10, Down: 10, Time: 3000},
+		{Tag: "inbound-a", Email: "alice", Up: 300, Down: 300, Time: 1000},
+		{Tag: "inbound-a", Email: "alice", Up: 0, Down: 600, Time: 3000},
+		{Tag: "inbound-a", Email: "bob", Up: 1000, Down: 0, Time: 1000},
+		{Tag: "inbound-b", Email: "carol", Up: 100, Down: 100, Time: 2000},
+	}
+	err := db.Create(histories).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		by      string
+		order   string
+		since   int64
+		until   int64
+		limit   int
+		wantErr bool
+		want    []*TopTalker
+	}{
+		{"clients by total", "client", "total", 0, 0, 10, false, []*TopTalker{
+			{"alice", 300, 900, 1200}, {"bob", 1000, 0, 1000}, {"carol", 100, 100, 200},
+		}},
+		{"clients by upload", "client", "up", 0, 0, 10, false, []*TopTalker{
+			{"bob", 1000, 0, 1000}, {"alice", 300, 900, 1200}, {"carol", 100, 100, 200},
+		}},
+		{"clients by download", "client", "down", 0, 0, 10, false, []*TopTalker{
+			{"alice", 300, 900, 1200}, {"carol", 100, 100, 200}, {"bob", 1000, 0, 1000},
+		}},
+		{"limit", "client", "total", 0, 0, 2, false, []*TopTalker{
+			{"alice", 300, 900, 1200}, {"bob", 1000, 0, 1000},
+		}},
+		{"since", "client", "total", 2000, 0, 10, false, []*TopTalker{
+			{"alice", 0, 600, 600}, {"carol", 100, 100, 200},
+		}},
+		{"until", "client", "total", 0, 2000, 10, false, []*TopTalker{
+			{"bob", 1000, 0, 1000}, {"alice", 300, 300, 600},
+		}},
+		{"inbounds by total", "inbound", "total", 0, 0, 10, false, []*TopTalker{
+			{"inbound-a", 150, 950, 1100}, {"inbound-b", 800, 100, 900}, {"inbound-c", 10, 10, 20},
+		}},
+		{"inbounds by upload", "inbound", "up", 0, 0, 10, false, []*TopTalker{
+			{"inbound-b", 800, 100, 900}, {"inbound-a", 150, 950, 1100}, {"inbound-c", 10, 10, 20},
+		}},
+		{"nothing in range", "inbound", "total", 5000, 0, 10, false, []*TopTalker{}},
+		{"unknown type", "user", "total", 0, 0, 10, true, nil},
+		{"unknown order", "client", "name", 0, 0, 10, true, nil},
+	}
+	s := &TrafficHistoryService{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetTopTalkers(tt.by, tt.order, tt.since, tt.until, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetTopTalkers() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetTopTalkers() = %v, want %v", topTalkerValues(got), topTalkerValues(tt.want))
+			}
+		})
+	}
+}
+
+func topTalkerValues(talkers []*TopTalker) []TopTalker {
+	values := make([]TopTalker, 0, len(talkers))
+	for _, talker := range talkers {
+		values = append(values, *talker)
+	}
+	return values
+}
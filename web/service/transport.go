@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+type TransportService struct {
+	settingService SettingService
+	inboundService InboundService
+}
+
+// GetTransport returns the global transport config of the template, nil if not set
+func (s *TransportService) GetTransport() (*xray.TransportConfig, error) {
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := template["transport"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	transport := &xray.TransportConfig{}
+	err = json.Unmarshal(data, transport)
+	if err != nil {
+		return nil, err
+	}
+	return transport, nil
+}
+
+// SetTransport replaces the global transport config, nil removes it
+func (s *TransportService) SetTransport(transport *xray.TransportConfig) error {
+	if transport != nil {
+		err := transport.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		return err
+	}
+	if transport == nil {
+		delete(template, "transport")
+	} else {
+		template["transport"] = transport
+	}
+	return saveXrayTemplate(&s.settingService, template)
+}
+
+// SetInboundSockopt sets the socket options of the inbound stream, nil removes them,
+// xray only reads sockopt from streamSettings so it can't be set globally
+func (s *TransportService) SetInboundSockopt(inboundId int, sockopt *xray.SockoptConfig) error {
+	inbound, err := s.inboundService.GetInbound(inboundId)
+	if err != nil {
+		return err
+	}
+	streamSettings, err := xray.SetStreamSockopt([]byte(inbound.StreamSettings), sockopt)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	return db.Model(model.Inbound{}).
+		Where("id = ?", inboundId).
+		Update("stream_settings", string(streamSettings)).
+		Error
+}
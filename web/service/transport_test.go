@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+func TestSetTransport(t *testing.T) {
+	cleanSettings(t)
+	s := &TransportService{}
+	err := s.settingService.SetXrayConfigTemplate(`{"transport": {"tcpSettings": {"header": {"type": "none"}}, "future": true}, "outbounds": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := s.GetTransport()
+	if err != nil || transport == nil {
+		t.Fatalf("GetTransport() = %+v, %v", transport, err)
+	}
+	transport.WSSettings = []byte(`{"path": "/ws"}`)
+	err = s.SetTransport(transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := getXrayTemplate(&s.settingService)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := template["transport"].(map[string]interface{})
+	if stored["future"] != true || stored["tcpSettings"] == nil || stored["wsSettings"] == nil {
+		t.Errorf("stored transport = %v", stored)
+	}
+
+	err = s.SetTransport(&xray.TransportConfig{WSSettings: []byte(`"/ws"`)})
+	if err == nil {
+		t.Error("SetTransport() took invalid ws settings")
+	}
+	err = s.SetTransport(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport, _ := s.GetTransport(); transport != nil {
+		t.Errorf("GetTransport() after removing it = %+v", transport)
+	}
+}
+
+func TestSetInboundSockopt(t *testing.T) {
+	cleanInbounds(t)
+	inboundService := &InboundService{}
+	inbound := newClientInbound(t, 41200, model.VLESS, nil)
+	inbound.StreamSettings = `{"network": "tcp", "security": "none"}`
+	err := inboundService.AddInbound(inbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &TransportService{}
+	err = s.SetInboundSockopt(inbound.Id, &xray.SockoptConfig{Mark: 255, TProxy: "tproxy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := inboundService.GetInbound(inbound.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamSettings := struct {
+		Network string             `json:"network"`
+		Sockopt xray.SockoptConfig `json:"sockopt"`
+	}{}
+	err = json.Unmarshal([]byte(stored.StreamSettings), &streamSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if streamSettings.Network != "tcp" || streamSettings.Sockopt.Mark != 255 || streamSettings.Sockopt.TProxy != "tproxy" {
+		t.Errorf("stream settings = %v", stored.StreamSettings)
+	}
+
+	err = s.SetInboundSockopt(inbound.Id, &xray.SockoptConfig{Mark: -1})
+	if err == nil {
+		t.Error("SetInboundSockopt() took a negative mark")
+	}
+}
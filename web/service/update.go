@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"x-ui/config"
+	"x-ui/util/common"
+)
+
+var latestVersion string
+var latestVersionLock sync.RWMutex
+
+type UpdateService struct {
+}
+
+// compareVersions compares dotted versions like 0.3.2 or v1.2, returning -1, 0 or 1
+func compareVersions(a string, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(strings.TrimSpace(a), "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(strings.TrimSpace(b), "v"), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+		if numA < numB {
+			return -1
+		} else if numA > numB {
+			return 1
+		}
+	}
+	return 0
+}
+
+// CheckUpdate fetches the latest release from the feed, the feed is expected
+// to return a github style release with a tag_name
+func (s *UpdateService) CheckUpdate(url string) (string, error) {
+	client := &http.Client{
+		Timeout: time.Second * 30,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", common.NewError("release feed returned status:", resp.Status)
+	}
+
+	release := &Release{}
+	err = json.NewDecoder(resp.Body).Decode(release)
+	if err != nil {
+		return "", err
+	}
+	if release.TagName == "" {
+		return "", common.NewError("release feed returned no version")
+	}
+
+	latestVersionLock.Lock()
+	latestVersion = release.TagName
+	latestVersionLock.Unlock()
+	return release.TagName, nil
+}
+
+// GetUpdateInfo returns the latest known version and whether it's newer than the running one
+func (s *UpdateService) GetUpdateInfo() (string, bool) {
+	latestVersionLock.RLock()
+	defer latestVersionLock.RUnlock()
+	if latestVersion == "" {
+		return "", false
+	}
+	return latestVersion, compareVersions(latestVersion, config.GetVersion()) > 0
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"x-ui/config"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{"0.3.2", "0.3.2", 0},
+		{"v0.3.2", "0.3.2", 0},
+		{"0.3.3", "0.3.2", 1},
+		{"0.3.2", "0.3.10", -1},
+		{"1.0", "0.9.9", 1},
+		{"0.4", "0.4.0", 0},
+		{"0.4", "0.4.1", -1},
+		{" v1.2.0 ", "1.1.9", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// setLatestVersion sets the latest known version for the test
+func setLatestVersion(t *testing.T, version string) {
+	t.Helper()
+	latestVersionLock.Lock()
+	old := latestVersion
+	latestVersion = version
+	latestVersionLock.Unlock()
+	t.Cleanup(func() {
+		latestVersionLock.Lock()
+		latestVersion = old
+		latestVersionLock.Unlock()
+	})
+}
+
+func TestCheckUpdate(t *testing.T) {
+	current := config.GetVersion()
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantErr       bool
+		wantLatest    string
+		wantAvailable bool
+	}{
+		{"newer", http.StatusOK, `{"tag_name": "v99.0.0"}`, false, "v99.0.0", true},
+		{"same", http.StatusOK, `{"tag_name": "` + current + `"}`, false, current, false},
+		{"older", http.StatusOK, `{"tag_name": "0.0.1"}`, false, "0.0.1", false},
+		// a failed check keeps what the last check found
+		{"bad status", http.StatusInternalServerError, `{"tag_name": "v99.0.0"}`, true, "", false},
+		{"no version", http.StatusOK, `{}`, true, "", false},
+		{"invalid", http.StatusOK, `<html>`, true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLatestVersion(t, "")
+			feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer feed.Close()
+
+			s := &UpdateService{}
+			_, err := s.CheckUpdate(feed.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckUpdate() = %v, wantErr %v", err, tt.wantErr)
+			}
+			latest, available := s.GetUpdateInfo()
+			if latest != tt.wantLatest || available != tt.wantAvailable {
+				t.Errorf("GetUpdateInfo() = %q, %v, want %q, %v", latest, available, tt.wantLatest, tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestCheckUpdateWithoutNetwork(t *testing.T) {
+	setLatestVersion(t, "v99.0.0")
+	// nothing listens on the port once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/releases/latest"
+	listener.Close()
+
+	s := &UpdateService{}
+	_, err = s.CheckUpdate(url)
+	if err == nil {
+		t.Fatal("CheckUpdate() of an unreachable feed succeeded")
+	}
+	latest, available := s.GetUpdateInfo()
+	if latest != "v99.0.0" || !available {
+		t.Errorf("GetUpdateInfo() = %q, %v, want the version of the last check", latest, available)
+	}
+}
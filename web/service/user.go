@@ -5,11 +5,13 @@ import (
 	"x-ui/database"
 	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/common"
 
 	"gorm.io/gorm"
 )
 
 type UserService struct {
+	settingService SettingService
 }
 
 func (s *UserService) GetFirstUser() (*model.User, error) {
@@ -25,6 +27,131 @@ func (s *UserService) GetFirstUser() (*model.User, error) {
 	return user, nil
 }
 
+func (s *UserService) GetUser(id int) (*model.User, error) {
+	db := database.GetDB()
+	user := &model.User{}
+	err := db.Model(model.User{}).Where("id = ?", id).First(user).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsers returns every panel user without its password
+func (s *UserService) GetUsers() ([]*model.User, error) {
+	db := database.GetDB()
+	var users []*model.User
+	err := db.Model(model.User{}).Order("id").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		user.Password = ""
+	}
+	return users, nil
+}
+
+// checkUsername returns an error when the username is empty or taken by a user other than exceptId
+func (s *UserService) checkUsername(username string, exceptId int) error {
+	if username == "" {
+		return errors.New("username can not be empty")
+	}
+	var count int64
+	err := database.GetDB().Model(model.User{}).
+		Where("username = ? and id != ?", username, exceptId).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("username already exists:", username)
+	}
+	return nil
+}
+
+// checkLastAdmin returns an error when the user is the last admin, the panel always keeps one
+func (s *UserService) checkLastAdmin(id int) error {
+	var count int64
+	err := database.GetDB().Model(model.User{}).
+		Where("role = ? and id != ?", model.RoleAdmin, id).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("the panel needs at least one admin")
+	}
+	return nil
+}
+
+func (s *UserService) AddUser(user *model.User) error {
+	err := s.checkUsername(user.Username, 0)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" {
+		return errors.New("password can not be empty")
+	}
+	if !model.IsValidRole(user.Role) {
+		return common.NewError("unknown role:", user.Role)
+	}
+	user.Id = 0
+	return database.GetDB().Create(user).Error
+}
+
+// SetUser changes the username and role of another user, and its password when not empty
+func (s *UserService) SetUser(id int, username string, password string, role string) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	err = s.checkUsername(username, id)
+	if err != nil {
+		return err
+	}
+	if !model.IsValidRole(role) {
+		return common.NewError("unknown role:", role)
+	}
+	if user.Role == model.RoleAdmin && role != model.RoleAdmin {
+		err = s.checkLastAdmin(id)
+		if err != nil {
+			return err
+		}
+	}
+	user.Username = username
+	user.Role = role
+	if password != "" {
+		user.Password = password
+	}
+	return database.GetDB().Save(user).Error
+}
+
+// DelUser deletes the user along with its two factor authentication
+func (s *UserService) DelUser(id int) error {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if user.Role == model.RoleAdmin {
+		err = s.checkLastAdmin(id)
+		if err != nil {
+			return err
+		}
+	}
+	db := database.GetDB()
+	err = db.Where("user_id = ?", id).Delete(model.UserTotp{}).Error
+	if err != nil {
+		return err
+	}
+	err = db.Where("user_id = ?", id).Delete(model.LoginSession{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Delete(user).Error
+}
+
 func (s *UserService) CheckUser(username string, password string) *model.User {
 	db := database.GetDB()
 
@@ -39,10 +166,18 @@ func (s *UserService) CheckUser(username string, password string) *model.User {
 		logger.Warning("check user err:", err)
 		return nil
 	}
+	// the password of ldap users is checked by ldap
+	if user.Source == model.UserSourceLdap {
+		return nil
+	}
 	return user
 }
 
 func (s *UserService) UpdateUser(id int, username string, password string) error {
+	err := s.checkUsername(username, id)
+	if err != nil {
+		return err
+	}
 	db := database.GetDB()
 	return db.Model(model.User{}).
 		Where("id = ?", id).
@@ -51,6 +186,8 @@ func (s *UserService) UpdateUser(id int, username string, password string) error
 		Error
 }
 
+// UpdateFirstUser sets the username and password of the first admin, making the first user
+// the admin when there is none
 func (s *UserService) UpdateFirstUser(username string, password string) error {
 	if username == "" {
 		return errors.New("username can not be empty")
@@ -59,15 +196,24 @@ func (s *UserService) UpdateFirstUser(username string, password string) error {
 	}
 	db := database.GetDB()
 	user := &model.User{}
-	err := db.Model(model.User{}).First(user).Error
+	err := db.Model(model.User{}).Where("role = ?", model.RoleAdmin).Order("id").First(user).Error
+	if database.IsNotFound(err) {
+		err = db.Model(model.User{}).Order("id").First(user).Error
+	}
 	if database.IsNotFound(err) {
 		user.Username = username
 		user.Password = password
+		user.Role = model.RoleAdmin
 		return db.Model(model.User{}).Create(user).Error
 	} else if err != nil {
 		return err
 	}
+	err = s.checkUsername(username, user.Id)
+	if err != nil {
+		return err
+	}
 	user.Username = username
 	user.Password = password
+	user.Role = model.RoleAdmin
 	return db.Save(user).Error
 }
@@ -3,8 +3,14 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"regexp"
+	"strconv"
 	"sync"
+	"time"
+	"x-ui/database/model"
 	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
 	"x-ui/xray"
 
 	"go.uber.org/atomic"
@@ -14,16 +20,44 @@ var p *xray.Process
 var lock sync.Mutex
 var isNeedXrayRestart atomic.Bool
 var result string
+var lastRestartTime atomic.Int64
+
+// checkConfig runs the config through xray, tests replace it as they have no xray binary
+var checkConfig = xray.CheckConfig
+
+const (
+	// maxIsolateAttempts bounds how many inbounds get disabled in a single restart
+	maxIsolateAttempts  = 5
+	xrayStartCheckDelay = time.Second * 2
+)
+
+// failedInboundTagRegexes find the tag of the failed inbound in the errors of xray and of xray.Config.Validate
+var failedInboundTagRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`inbound config with tag (\S+)`),
+	regexp.MustCompile(`duplicate inbound tag: (\S+)`),
+	regexp.MustCompile(`inbounds \S+ and (\S+) both listen on port`),
+	regexp.MustCompile(`inbound (\S+) has an invalid`),
+}
+var failedListenPortRegex = regexp.MustCompile(`failed to listen (?:TCP|UDP) on (\d+)`)
 
 type XrayService struct {
-	inboundService InboundService
-	settingService SettingService
+	inboundService      InboundService
+	settingService      SettingService
+	notificationService NotificationService
 }
 
 func (s *XrayService) IsXrayRunning() bool {
 	return p != nil && p.IsRunning()
 }
 
+// IsXrayExpected reports whether the panel started xray, so it should be running.
+// It takes the lock, so it must not be called by the functions holding it
+func (s *XrayService) IsXrayExpected() bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return p != nil
+}
+
 func (s *XrayService) GetXrayErr() error {
 	if p == nil {
 		return nil
@@ -63,24 +97,163 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the traffic of the clients is only counted with the stats of the user levels on
+	xrayConfig.Policy, err = enableUserStats(xrayConfig.Policy)
+	if err != nil {
+		return nil, common.NewError("invalid policy in the xray template:", err)
+	}
 
 	inbounds, err := s.inboundService.GetAllInbounds()
 	if err != nil {
 		return nil, err
 	}
+	penalizedEmails, err := s.inboundService.getPenalizedEmails()
+	if err != nil {
+		return nil, err
+	}
+	depletedEmails, err := s.inboundService.getDepletedEmails(inbounds, time.Now().Unix()*1000)
+	if err != nil {
+		return nil, err
+	}
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
 			continue
 		}
 		inboundConfig := inbound.GenXrayInboundConfig()
+		// clients serving a penalty or past their limits stay off when xray restarts
+		emails := map[string]bool{}
+		for email := range penalizedEmails[inbound.Id] {
+			emails[email] = true
+		}
+		for email := range depletedEmails[inbound.Id] {
+			emails[email] = true
+		}
+		if len(emails) > 0 {
+			settings, err := removeSettingsClients(inbound.Settings, emails)
+			if err != nil {
+				return nil, err
+			}
+			inboundConfig.Settings = json_util.RawMessage(settings)
+		}
 		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
 	}
 	return xrayConfig, nil
 }
 
-func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, error) {
+// enableUserStats turns the uplink and downlink stats on for every user level of the policy
+func enableUserStats(policy json_util.RawMessage) (json_util.RawMessage, error) {
+	config := map[string]interface{}{}
+	if len(policy) > 0 && string(policy) != "null" {
+		err := json.Unmarshal(policy, &config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	levels, ok := config["levels"].(map[string]interface{})
+	if !ok {
+		levels = map[string]interface{}{}
+		config["levels"] = levels
+	}
+	if _, ok := levels["0"]; !ok {
+		levels["0"] = map[string]interface{}{}
+	}
+	for key, value := range levels {
+		level, ok := value.(map[string]interface{})
+		if !ok {
+			level = map[string]interface{}{}
+			levels[key] = level
+		}
+		level["statsUserUplink"] = true
+		level["statsUserDownlink"] = true
+	}
+	return json.Marshal(config)
+}
+
+// HasDepletedClients reports whether the running xray still serves clients which used up
+// their traffic or expired, they go away with the next restart
+func (s *XrayService) HasDepletedClients() (bool, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return false, err
+	}
+	depletedEmails, err := s.inboundService.getDepletedEmails(inbounds, time.Now().Unix()*1000)
+	if err != nil || len(depletedEmails) == 0 {
+		return false, err
+	}
+	tagEmails := map[string]map[string]bool{}
+	for _, inbound := range inbounds {
+		if emails := depletedEmails[inbound.Id]; inbound.Enable && len(emails) > 0 {
+			tagEmails[inbound.Tag] = emails
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return false, nil
+	}
+	for _, inboundConfig := range p.GetConfig().InboundConfigs {
+		emails := tagEmails[inboundConfig.Tag]
+		if len(emails) == 0 {
+			continue
+		}
+		clients, err := model.ParseClients(string(inboundConfig.Settings))
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if emails[client.Email] {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// removeSettingsClients returns the inbound settings without the clients of the emails
+func removeSettingsClients(settings string, emails map[string]bool) (string, error) {
+	clients, err := model.ParseClients(settings)
+	if err != nil || clients == nil {
+		return settings, err
+	}
+	kept := make([]model.Client, 0, len(clients))
+	for _, client := range clients {
+		if !emails[client.Email] {
+			kept = append(kept, client)
+		}
+	}
+	return model.SetClients(settings, kept)
+}
+
+// RemoveClient takes the client off the running xray, it stays off after a restart
+// only while it has a ClientPenalty
+func (s *XrayService) RemoveClient(inbound *model.Inbound, email string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return errors.New("xray is not running")
+	}
+	return p.RemoveUser(inbound.Tag, email)
+}
+
+// AddClient puts the client back on the running xray
+func (s *XrayService) AddClient(inbound *model.Inbound, client *model.Client) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return errors.New("xray is not running")
+	}
+	return p.AddUser(inbound.Tag, string(inbound.Protocol), client.Email, &xray.UserAccount{
+		Id:       client.ID,
+		AlterId:  client.AlterId,
+		Flow:     client.Flow,
+		Password: client.Password,
+	})
+}
+
+func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic, error) {
 	if !s.IsXrayRunning() {
-		return nil, errors.New("xray is not running")
+		return nil, nil, errors.New("xray is not running")
 	}
 	return p.GetTraffic(true)
 }
@@ -95,17 +268,171 @@ func (s *XrayService) RestartXray(isForce bool) error {
 		return err
 	}
 
-	if p != nil && p.IsRunning() {
-		if !isForce && p.GetConfig().Equals(xrayConfig) {
-			logger.Debug("not need to restart xray")
-			return nil
+	running := p != nil && p.IsRunning()
+	if running && !isForce && p.GetConfig().Equals(xrayConfig) {
+		logger.Debug("not need to restart xray")
+		return nil
+	}
+
+	isolate, err := s.settingService.GetXrayIsolateFailedInbound()
+	isolate = err == nil && isolate
+	// stopping a healthy xray for a config it can't load would leave every inbound down
+	xrayConfig, err = s.validateConfig(xrayConfig, isolate)
+	if err != nil {
+		if running {
+			logger.Warning("xray config is invalid, keep the running xray:", err)
 		}
+		return err
+	}
+	if running {
 		p.Stop()
 	}
 
 	p = xray.NewProcess(xrayConfig)
 	result = ""
-	return p.Start()
+	err = p.Start()
+	lastRestartTime.Store(time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+
+	if !isolate {
+		return nil
+	}
+	return s.isolateFailedInbounds()
+}
+
+// ValidateConfig returns why xray can't load the config, nil if it can
+func (s *XrayService) ValidateConfig(xrayConfig *xray.Config) error {
+	err := xrayConfig.Validate()
+	if err != nil {
+		return err
+	}
+	return checkConfig(xrayConfig)
+}
+
+// validateConfig returns the config xray is started with. With isolate the inbounds the errors
+// point at are disabled one by one until xray can load the config, like isolateFailedInbounds
+// does for inbounds xray fails to start
+func (s *XrayService) validateConfig(xrayConfig *xray.Config, isolate bool) (*xray.Config, error) {
+	for i := 0; ; i++ {
+		err := s.ValidateConfig(xrayConfig)
+		if err == nil || !isolate || i >= maxIsolateAttempts {
+			return xrayConfig, err
+		}
+		inbound, findErr := s.findFailedInbound(err.Error())
+		if findErr != nil {
+			return nil, findErr
+		}
+		if inbound == nil {
+			return nil, err
+		}
+		err = s.disableFailedInbound(inbound)
+		if err != nil {
+			return nil, err
+		}
+		xrayConfig, err = s.GetXrayConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// disableFailedInbound disables the inbound xray can't run with and lets the admins know
+func (s *XrayService) disableFailedInbound(inbound *model.Inbound) error {
+	err := s.inboundService.AutoDisableInbound(inbound.Id)
+	if err != nil {
+		return err
+	}
+	logger.Warningf("xray failed to start because of inbound %v (%v), disabled it", inbound.Tag, inbound.Remark)
+	s.notificationService.Notify(EventInboundDisabled, NewInboundEvent(inbound, "failed"))
+	return nil
+}
+
+// isolateFailedInbounds disables the inbound xray failed to start with and
+// starts xray again, so one bad inbound doesn't take every other one down.
+// It is called with lock held and releases it while xray starts up
+func (s *XrayService) isolateFailedInbounds() error {
+	for i := 0; i < maxIsolateAttempts; i++ {
+		started := p
+		lock.Unlock()
+		time.Sleep(xrayStartCheckDelay)
+		lock.Lock()
+		if p != started {
+			// xray got restarted meanwhile, that restart checks its own process
+			return nil
+		}
+		if p.IsRunning() {
+			return nil
+		}
+		result = p.GetResult()
+		inbound, err := s.findFailedInbound(result)
+		if err != nil {
+			return err
+		}
+		if inbound == nil {
+			return nil
+		}
+		err = s.disableFailedInbound(inbound)
+		if err != nil {
+			return err
+		}
+
+		xrayConfig, err := s.GetXrayConfig()
+		if err != nil {
+			return err
+		}
+		p = xray.NewProcess(xrayConfig)
+		result = ""
+		err = p.Start()
+		lastRestartTime.Store(time.Now().UnixNano())
+		if err != nil {
+			return err
+		}
+	}
+	logger.Warning("xray still failed to start after disabling", maxIsolateAttempts, "inbounds")
+	return nil
+}
+
+func (s *XrayService) findFailedInbound(output string) (*model.Inbound, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	tag := ""
+	for _, regex := range failedInboundTagRegexes {
+		if matches := regex.FindStringSubmatch(output); len(matches) > 1 {
+			tag = matches[1]
+			break
+		}
+	}
+	port := 0
+	if matches := failedListenPortRegex.FindStringSubmatch(output); len(matches) > 1 {
+		port, _ = strconv.Atoi(matches[1])
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			continue
+		}
+		if (tag != "" && inbound.Tag == tag) || (port != 0 && inbound.Port == port) {
+			return inbound, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetFailedInbound returns the inbound xray exited because of, nil if xray is running or the cause is unknown
+func (s *XrayService) GetFailedInbound() (*model.Inbound, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || p.IsRunning() {
+		return nil, nil
+	}
+	return s.findFailedInbound(p.GetResult())
+}
+
+func (s *XrayService) GetLastRestartTime() int64 {
+	return lastRestartTime.Load()
 }
 
 func (s *XrayService) StopXray() error {
@@ -118,6 +445,17 @@ func (s *XrayService) StopXray() error {
 	return errors.New("xray is not running")
 }
 
+// IsInRestartGrace reports whether xray restarted recently, the access log is
+// empty right after a restart so enforcement based on it would misfire
+func (s *XrayService) IsInRestartGrace() bool {
+	grace, err := s.settingService.GetRestartGrace()
+	if err != nil || grace <= 0 {
+		return false
+	}
+	restartTime := time.Unix(0, lastRestartTime.Load())
+	return time.Since(restartTime) < time.Second*time.Duration(grace)
+}
+
 func (s *XrayService) SetToNeedRestart() {
 	isNeedXrayRestart.Store(true)
 }
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"encoding/json"
+)
+
+// getXrayTemplate returns the xray template config as a map, so fields the
+// caller doesn't know about are written back untouched
+func getXrayTemplate(settingService *SettingService) (map[string]interface{}, error) {
+	templateConfig, err := settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	template := map[string]interface{}{}
+	err = json.Unmarshal([]byte(templateConfig), &template)
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+func saveXrayTemplate(settingService *SettingService, template map[string]interface{}) error {
+	data, err := json.MarshalIndent(template, "", "  ")
+	if err != nil {
+		return err
+	}
+	return settingService.SetXrayConfigTemplate(string(data))
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/json_util"
+	"x-ui/xray"
+)
+
+func TestValidateConfigIsolation(t *testing.T) {
+	// xray fails to load inbounds whose settings say so
+	checkConfig = func(config *xray.Config) error {
+		for _, inbound := range config.InboundConfigs {
+			if strings.Contains(string(inbound.Settings), "broken") {
+				return errors.New("xray config test failed: exit status 23 infra/conf: failed to build inbound config with tag " + inbound.Tag)
+			}
+		}
+		return nil
+	}
+	defer func() { checkConfig = xray.CheckConfig }()
+
+	// the port of the api inbound of the default xray template
+	const apiPort = 62789
+	tests := []struct {
+		name     string
+		isolate  bool
+		inbounds []*model.Inbound
+		wantErr  bool
+		// disabled are the ports of the inbounds validation takes out
+		disabled []int
+	}{
+		{"valid", true, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[]}`},
+			{Port: 41101, Protocol: model.VMess, Settings: `{"clients":[]}`},
+		}, false, nil},
+		{"port collision isolated", true, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[]}`},
+			{Port: apiPort, Protocol: model.VMess, Settings: `{"clients":[]}`},
+		}, false, []int{1}},
+		{"rejected by xray isolated", true, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41101, Protocol: model.VMess, Settings: `{"clients":[]}`},
+		}, false, []int{0}},
+		{"several isolated", true, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41101, Protocol: model.VMess, Settings: `{"clients":[]}`},
+			{Port: apiPort, Protocol: model.VMess, Settings: `{"clients":[]}`},
+		}, false, []int{0, 2}},
+		// every inbound is broken, isolation gives up instead of disabling all of them
+		{"isolation is bounded", true, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41101, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41102, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41103, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41104, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41105, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+			{Port: 41106, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+		}, true, []int{0, 1, 2, 3, 4}},
+		{"port collision without isolation", false, []*model.Inbound{
+			{Port: apiPort, Protocol: model.VMess, Settings: `{"clients":[]}`},
+		}, true, nil},
+		{"rejected by xray without isolation", false, []*model.Inbound{
+			{Port: 41100, Protocol: model.VMess, Settings: `{"clients":[],"broken":true}`},
+		}, true, nil},
+	}
+	db := database.GetDB()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanInbounds(t)
+			for i, inbound := range tt.inbounds {
+				inbound.Enable = true
+				inbound.Tag = fmt.Sprintf("inbound-%v-%v", inbound.Port, i)
+				err := db.Create(inbound).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := &XrayService{}
+			xrayConfig, err := s.GetXrayConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			xrayConfig, err = s.validateConfig(xrayConfig, tt.isolate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			disabled := map[int]bool{}
+			for _, i := range tt.disabled {
+				disabled[i] = true
+			}
+			for i, inbound := range tt.inbounds {
+				stored := &model.Inbound{}
+				err := db.First(stored, inbound.Id).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.Enable == disabled[i] || stored.AutoDisabled != disabled[i] {
+					t.Errorf("inbound %v enable = %v autoDisabled = %v, want disabled %v", i, stored.Enable, stored.AutoDisabled, disabled[i])
+				}
+			}
+			if err == nil {
+				err = s.ValidateConfig(xrayConfig)
+				if err != nil {
+					t.Errorf("the returned config is invalid: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGetXrayConfigLeavesOutDepletedClients(t *testing.T) {
+	cleanInbounds(t)
+	db := database.GetDB()
+	now := time.Now().Unix() * 1000
+	inbound := newClientInbound(t, 41200, model.VLESS, []model.Client{
+		{ID: "1", Email: "active", TotalGB: 1000, ExpiryTime: now + 3600*1000},
+		{ID: "2", Email: "used-up", TotalGB: 1000},
+		{ID: "3", Email: "expired", ExpiryTime: now - 1000},
+		{ID: "4", Email: "unlimited"},
+	})
+	err := db.Create(inbound).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	traffics := []*model.ClientTraffic{
+		{InboundId: inbound.Id, Email: "active", Up: 100, Down: 100},
+		{InboundId: inbound.Id, Email: "used-up", Up: 600, Down: 400},
+		{InboundId: inbound.Id, Email: "unlimited", Up: 5000, Down: 5000},
+	}
+	err = db.Create(traffics).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Where("1 = 1").Delete(model.ClientTraffic{})
+
+	xrayService := &XrayService{}
+	config, err := xrayService.GetXrayConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emails []string
+	for _, inboundConfig := range config.InboundConfigs {
+		if inboundConfig.Tag != inbound.Tag {
+			continue
+		}
+		clients, err := model.ParseClients(string(inboundConfig.Settings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, client := range clients {
+			emails = append(emails, client.Email)
+		}
+	}
+	if want := []string{"active", "unlimited"}; fmt.Sprint(emails) != fmt.Sprint(want) {
+		t.Errorf("clients in the config = %v, want %v", emails, want)
+	}
+}
+
+func TestEnableUserStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{"no policy", ``, `{"levels":{"0":{"statsUserDownlink":true,"statsUserUplink":true}}}`},
+		{"null policy", `null`, `{"levels":{"0":{"statsUserDownlink":true,"statsUserUplink":true}}}`},
+		{"system only", `{"system":{"statsInboundUplink":true}}`,
+			`{"levels":{"0":{"statsUserDownlink":true,"statsUserUplink":true}},"system":{"statsInboundUplink":true}}`},
+		{"stats turned off", `{"levels":{"0":{"handshake":4,"statsUserUplink":false}}}`,
+			`{"levels":{"0":{"handshake":4,"statsUserDownlink":true,"statsUserUplink":true}}}`},
+		{"other levels", `{"levels":{"1":{"bufferSize":4}}}`,
+			`{"levels":{"0":{"statsUserDownlink":true,"statsUserUplink":true},"1":{"bufferSize":4,"statsUserDownlink":true,"statsUserUplink":true}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := enableUserStats(json_util.RawMessage(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("enableUserStats(%v) = %s, want %s", tt.policy, got, tt.want)
+			}
+		})
+	}
+	_, err := enableUserStats(json_util.RawMessage(`[]`))
+	if err == nil {
+		t.Error("enableUserStats() accepted a policy which is not an object")
+	}
+}
+
+func TestIsInRestartGrace(t *testing.T) {
+	old := lastRestartTime.Load()
+	defer lastRestartTime.Store(old)
+	tests := []struct {
+		name    string
+		grace   string
+		restart time.Duration
+		want    bool
+	}{
+		{"just restarted", "30", time.Second * 10, true},
+		{"grace is over", "30", time.Minute, false},
+		{"grace is off", "0", time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanSettings(t)
+			err := database.GetDB().Create(&model.Setting{Key: "restartGrace", Value: tt.grace}).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			lastRestartTime.Store(time.Now().Add(-tt.restart).UnixNano())
+			s := &XrayService{}
+			if got := s.IsInRestartGrace(); got != tt.want {
+				t.Errorf("IsInRestartGrace() %v after a restart = %v, want %v", tt.restart, got, tt.want)
+			}
+		})
+	}
+}
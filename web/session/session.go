@@ -1,7 +1,10 @@
 package session
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/gob"
+	"encoding/hex"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"x-ui/database/model"
@@ -9,6 +12,17 @@ import (
 
 const (
 	loginUser = "LOGIN_USER"
+	csrfToken = "CSRF_TOKEN"
+)
+
+// the cookies of visitors who aren't logged in, they carry what would be in their session
+// so nothing is stored for them before a login
+const (
+	oidcCookie = "oidc_login"
+	csrfCookie = "csrf_token"
+	// oidcCookieMaxAge is how long a single sign on may take at the provider
+	oidcCookieMaxAge = 600
+	csrfCookieMaxAge = 86400
 )
 
 func init() {
@@ -17,7 +31,11 @@ func init() {
 
 func SetLoginUser(c *gin.Context, user *model.User) error {
 	s := sessions.Default(c)
-	s.Set(loginUser, user)
+	// a new login gets a new csrf token, like it gets a new session id
+	if old := GetLoginUser(c); old == nil || old.Id != user.Id {
+		s.Delete(csrfToken)
+	}
+	s.Set(loginUser, *user)
 	return s.Save()
 }
 
@@ -31,6 +49,84 @@ func GetLoginUser(c *gin.Context) *model.User {
 	return &user
 }
 
+// SetOidcLogin keeps what a single sign on started by the panel must match in a signed
+// cookie until the provider sends the user back
+func SetOidcLogin(c *gin.Context, state string, nonce string, codeVerifier string) error {
+	return getStore(c).setCookie(c, oidcCookie, []string{state, nonce, codeVerifier}, oidcCookieMaxAge)
+}
+
+// PopOidcLogin returns the state, nonce and code verifier of the started single sign on
+// and forgets them, a login can only be finished once
+func PopOidcLogin(c *gin.Context) (string, string, string) {
+	store := getStore(c)
+	var login []string
+	err := store.getCookie(c, oidcCookie, &login)
+	if err != nil || len(login) != 3 {
+		return "", "", ""
+	}
+	store.setCookie(c, oidcCookie, nil, -1)
+	return login[0], login[1], login[2]
+}
+
+// GetSessionId returns the id of the stored session, empty before it is saved
+func GetSessionId(c *gin.Context) string {
+	s := sessions.Default(c)
+	id, _ := s.Get(sessionIdKey).(string)
+	return id
+}
+
+func newCsrfToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCsrfToken returns the csrf token of the session, making one the first time. Visitors
+// who aren't logged in get theirs in a signed cookie instead, the token of the page must
+// match the cookie, so pages like the login don't store a session
+func GetCsrfToken(c *gin.Context) (string, error) {
+	if !IsLogin(c) {
+		store := getStore(c)
+		var token string
+		if store.getCookie(c, csrfCookie, &token) == nil && token != "" {
+			return token, nil
+		}
+		token, err := newCsrfToken()
+		if err != nil {
+			return "", err
+		}
+		return token, store.setCookie(c, csrfCookie, token, csrfCookieMaxAge)
+	}
+	s := sessions.Default(c)
+	if token, ok := s.Get(csrfToken).(string); ok && token != "" {
+		return token, nil
+	}
+	token, err := newCsrfToken()
+	if err != nil {
+		return "", err
+	}
+	s.Set(csrfToken, token)
+	return token, s.Save()
+}
+
+// CheckCsrfToken reports whether the token is the csrf token of the session, or the one of
+// the cookie for visitors who aren't logged in
+func CheckCsrfToken(c *gin.Context, token string) bool {
+	var expected string
+	if IsLogin(c) {
+		expected, _ = sessions.Default(c).Get(csrfToken).(string)
+	} else if getStore(c).getCookie(c, csrfCookie, &expected) != nil {
+		return false
+	}
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
 func IsLogin(c *gin.Context) bool {
 	return GetLoginUser(c) != nil
 }
@@ -0,0 +1,217 @@
+package session
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"gorm.io/gorm/clause"
+)
+
+// sessionIdKey holds the id of a stored session among its values, so the panel can tell
+// which of the sessions of a user is the current one
+const sessionIdKey = "SESSION_ID"
+
+const defaultMaxAge = 86400 * 30
+
+// storeKey holds the store in the context, the cookies of visitors who aren't logged in
+// are signed with its keys
+const storeKey = "session_store"
+
+// lastSeenInterval is how often the last seen time of a session in use is written
+const lastSeenInterval = time.Minute
+
+// Store keeps the sessions in the database, so they can be listed and revoked, the cookie
+// only holds the signed session id
+type Store struct {
+	codecs  []securecookie.Codec
+	options *gsessions.Options
+	getIp   func(r *http.Request) string
+}
+
+// NewStore returns a store signing the session ids with the key pairs, getIp tells the ip
+// sessions are used from
+func NewStore(getIp func(r *http.Request) string, keyPairs ...[]byte) *Store {
+	s := &Store{
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+		getIp:  getIp,
+	}
+	s.Options(sessions.Options{Path: "/", MaxAge: defaultMaxAge})
+	return s
+}
+
+// Sessions returns the middleware giving the requests their session from the store
+func Sessions(name string, store *Store) gin.HandlerFunc {
+	handler := sessions.Sessions(name, store)
+	return func(c *gin.Context) {
+		c.Set(storeKey, store)
+		handler(c)
+	}
+}
+
+func getStore(c *gin.Context) *Store {
+	store, _ := c.MustGet(storeKey).(*Store)
+	return store
+}
+
+// setCookie signs the value into the cookie, a max age of 0 or less deletes it
+func (s *Store) setCookie(c *gin.Context, name string, value interface{}, maxAge int) error {
+	options := *s.options
+	options.MaxAge = maxAge
+	options.HttpOnly = true
+	encoded := ""
+	if maxAge > 0 {
+		var err error
+		encoded, err = securecookie.EncodeMulti(name, value, s.codecs...)
+		if err != nil {
+			return err
+		}
+	}
+	http.SetCookie(c.Writer, gsessions.NewCookie(name, encoded, &options))
+	return nil
+}
+
+// getCookie reads the value signed into the cookie, it fails when the cookie is missing or forged
+func (s *Store) getCookie(c *gin.Context, name string, value interface{}) error {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return err
+	}
+	return securecookie.DecodeMulti(name, cookie.Value, value, s.codecs...)
+}
+
+func (s *Store) Options(options sessions.Options) {
+	s.options = options.ToGorillaOptions()
+	for _, codec := range s.codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(options.MaxAge)
+		}
+	}
+}
+
+func (s *Store) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns the stored session of the cookie, or a new session when there is none, a
+// revoked or expired session gives a new session too
+func (s *Store) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	err = securecookie.DecodeMulti(name, cookie.Value, &session.ID, s.codecs...)
+	if err != nil {
+		return session, err
+	}
+	now := time.Now().Unix()
+	db := database.GetDB()
+	loginSession := &model.LoginSession{}
+	err = db.Where("session_id = ? and expires_at > ?", session.ID, now).First(loginSession).Error
+	if database.IsNotFound(err) {
+		session.ID = ""
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	err = securecookie.DecodeMulti(name, loginSession.Data, &session.Values, s.codecs...)
+	if err != nil {
+		return session, err
+	}
+	session.IsNew = false
+	session.Values[sessionIdKey] = session.ID
+	if now-loginSession.LastSeen >= int64(lastSeenInterval/time.Second) {
+		err = db.Model(loginSession).Updates(map[string]interface{}{
+			"ip":        s.getIp(r),
+			"last_seen": now,
+		}).Error
+		if err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+// Save stores the session and sets its cookie, a max age of 0 or less deletes it, a session
+// that gets another user is stored under a new id, so ids known before a login don't work
+// after it. Only sessions of logged in users are stored, saving one without a user deletes it
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	db := database.GetDB()
+	userId := 0
+	if user, ok := session.Values[loginUser].(model.User); ok {
+		userId = user.Id
+	}
+	if session.Options.MaxAge <= 0 || userId == 0 {
+		if session.ID != "" {
+			err := db.Where("session_id = ?", session.ID).Delete(model.LoginSession{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		options := *session.Options
+		options.MaxAge = -1
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", &options))
+		session.ID = ""
+		return nil
+	}
+
+	if session.ID != "" {
+		loginSession := &model.LoginSession{}
+		err := db.Where("session_id = ?", session.ID).First(loginSession).Error
+		if err != nil && !database.IsNotFound(err) {
+			return err
+		}
+		if err == nil && loginSession.UserId != userId {
+			err = db.Delete(loginSession).Error
+			if err != nil {
+				return err
+			}
+			session.ID = ""
+		}
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+
+	delete(session.Values, sessionIdKey)
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.codecs...)
+	session.Values[sessionIdKey] = session.ID
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "data", "ip", "user_agent", "last_seen", "expires_at"}),
+	}).Create(&model.LoginSession{
+		SessionId: session.ID,
+		UserId:    userId,
+		Data:      data,
+		Ip:        s.getIp(r),
+		UserAgent: r.UserAgent(),
+		CreatedAt: now,
+		LastSeen:  now,
+		ExpiresAt: now + int64(session.Options.MaxAge),
+	}).Error
+	if err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"crypto/tls"
 	"embed"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
 	"io/fs"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -20,13 +23,13 @@ import (
 	"x-ui/web/job"
 	"x-ui/web/network"
 	"x-ui/web/service"
+	"x-ui/web/session"
 
-	"github.com/BurntSushi/toml"
-	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/text/language"
 )
 
@@ -80,16 +83,32 @@ func (f *wrapAssetsFileInfo) ModTime() time.Time {
 type Server struct {
 	httpServer *http.Server
 	listener   net.Listener
-
-	index  *controller.IndexController
-	server *controller.ServerController
-	xui    *controller.XUIController
+	// plainServers answer plain http next to the https panel, e.g. to redirect to it
+	plainServers []*http.Server
+	// socketPath is the unix socket the panel listens on, empty for tcp
+	socketPath string
+	// http3Server answers http/3 on http3Conn, the udp port of the https panel
+	http3Server *http3.Server
+	http3Conn   net.PacketConn
+
+	index   *controller.IndexController
+	server  *controller.ServerController
+	xray    *controller.XrayController
+	sub     *controller.SubController
+	xui     *controller.XUIController
+	metrics *controller.MetricsController
+	health  *controller.HealthController
+	api     *controller.ApiController
+	openApi *controller.OpenApiController
 
 	xrayService    service.XrayService
 	settingService service.SettingService
 	inboundService service.InboundService
+	tgBotService   service.TgBotService
+	acmeService    service.AcmeService
 
-	cron *cron.Cron
+	cron        *cron.Cron
+	xrayStarted bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -154,7 +173,8 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	engine := gin.Default()
+	engine := gin.New()
+	engine.Use(gin.Logger(), controller.RequestId(), controller.Recovery())
 
 	secret, err := s.settingService.GetSecret()
 	if err != nil {
@@ -167,8 +187,9 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	}
 	assetsBasePath := basePath + "assets/"
 
-	store := cookie.NewStore(secret)
-	engine.Use(sessions.Sessions("session", store))
+	// sessions are kept in the database so they can be listed and revoked
+	store := session.NewStore(controller.GetRequestIp, secret)
+	engine.Use(session.Sessions("session", store))
 	engine.Use(func(c *gin.Context) {
 		c.Set("base_path", basePath)
 	})
@@ -178,10 +199,52 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 			c.Header("Cache-Control", "max-age=31536000")
 		}
 	})
+	corsConfig, err := s.getCorsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(corsConfig.Origins) > 0 {
+		// 只有接口允许跨域，页面和静态资源不允许
+		engine.Use(controller.Cors(corsConfig, basePath+"xui/inbound/", basePath+"xui/setting/", basePath+"server/", basePath+"xray/", basePath+"api/"))
+	}
+	hstsMaxAge, err := s.settingService.GetWebHstsMaxAge()
+	if err != nil {
+		return nil, err
+	}
+	if hstsMaxAge > 0 {
+		hstsSubdomains, err := s.settingService.GetWebHstsSubdomains()
+		if err != nil {
+			return nil, err
+		}
+		hstsPreload, err := s.settingService.GetWebHstsPreload()
+		if err != nil {
+			return nil, err
+		}
+		engine.Use(controller.Hsts(hstsMaxAge, hstsSubdomains, hstsPreload))
+	}
+	// tells browsers on the https panel that they can switch to http/3
+	engine.Use(func(c *gin.Context) {
+		if s.http3Server != nil && c.Request.TLS != nil && c.Request.ProtoMajor < 3 {
+			s.http3Server.SetQUICHeaders(c.Writer.Header())
+		}
+	})
+	scanBlockThreshold, err := s.settingService.GetScanBlockThreshold()
+	if err != nil {
+		return nil, err
+	}
+	if scanBlockThreshold > 0 {
+		scanBlockDuration, err := s.settingService.GetScanBlockDuration()
+		if err != nil {
+			return nil, err
+		}
+		engine.Use(controller.ScanBlock(scanBlockThreshold, time.Minute*time.Duration(scanBlockDuration),
+			assetsBasePath, "/favicon.ico", "/robots.txt"))
+	}
 	err = s.initI18n(engine)
 	if err != nil {
 		return nil, err
 	}
+	s.initBranding(engine, basePath)
 
 	if config.IsDebug() {
 		// for develop
@@ -205,28 +268,49 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 
 	s.index = controller.NewIndexController(g)
 	s.server = controller.NewServerController(g)
+	s.xray = controller.NewXrayController(g)
+	s.sub = controller.NewSubController(g)
 	s.xui = controller.NewXUIController(g)
+	s.metrics = controller.NewMetricsController(g)
+	s.health = controller.NewHealthController(g)
+	s.api = controller.NewApiController(g)
+	s.openApi = controller.NewOpenApiController(g, engine)
 
 	return engine, nil
 }
 
+func (s *Server) getCorsConfig() (*controller.CorsConfig, error) {
+	origins, err := s.settingService.GetCorsOrigins()
+	if err != nil {
+		return nil, err
+	}
+	methods, err := s.settingService.GetCorsMethods()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := s.settingService.GetCorsHeaders()
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.settingService.GetCorsCredentials()
+	if err != nil {
+		return nil, err
+	}
+	return &controller.CorsConfig{
+		Origins:     origins,
+		Methods:     methods,
+		Headers:     headers,
+		Credentials: credentials,
+	}, nil
+}
+
 func (s *Server) initI18n(engine *gin.Engine) error {
-	bundle := i18n.NewBundle(language.SimplifiedChinese)
-	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	err := fs.WalkDir(i18nFS, "translation", func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		data, err := i18nFS.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		_, err = bundle.ParseMessageFileBytes(data, path)
-		return err
-	})
+	var translationFS fs.FS = i18nFS
+	if config.IsDebug() {
+		// for develop, translations are read from disk and reloaded when they change
+		translationFS = os.DirFS("web")
+	}
+	translations, err := newTranslationBundle(translationFS, "translation")
 	if err != nil {
 		return err
 	}
@@ -252,9 +336,19 @@ func (s *Server) initI18n(engine *gin.Engine) error {
 		return names
 	}
 
-	var localizer *i18n.Localizer
+	trackMissing, err := s.settingService.GetI18nTrackMissing()
+	if err != nil {
+		logger.Warning("get i18n track missing setting failed:", err)
+	}
 
-	engine.FuncMap["i18n"] = func(key string, params ...string) (string, error) {
+	// localize translates the key with the localizer of the request the template data comes from,
+	// pluralCount picks the plural form and is nil for plain messages
+	localize := func(data gin.H, key string, pluralCount interface{}, params []string) (string, error) {
+		localizer, _ := data["localizer"].(*i18n.Localizer)
+		if localizer == nil {
+			return key, nil
+		}
+		lang, _ := data["lang"].(string)
 		names := findI18nParamNames(key)
 		if len(names) != len(params) {
 			return "", common.NewError("find names:", names, "---------- params:", params, "---------- num not equal")
@@ -263,45 +357,152 @@ func (s *Server) initI18n(engine *gin.Engine) error {
 		for i := range names {
 			templateData[names[i]] = params[i]
 		}
-		return localizer.Localize(&i18n.LocalizeConfig{
+		if pluralCount != nil {
+			templateData["Count"] = pluralCount
+		}
+		msg, err := localizer.Localize(&i18n.LocalizeConfig{
 			MessageID:    key,
 			TemplateData: templateData,
+			PluralCount:  pluralCount,
 		})
+		if _, ok := err.(*i18n.MessageNotFoundErr); ok {
+			if trackMissing {
+				service.AddMissingTranslation(lang, key)
+			}
+			// msg is the text of the default language, the key is only shown if that is missing too
+			if msg == "" {
+				return key, nil
+			}
+			return msg, nil
+		}
+		return msg, err
+	}
+
+	engine.FuncMap["i18n"] = func(data gin.H, key string, params ...string) (string, error) {
+		return localize(data, key, nil, params)
+	}
+
+	// i18nPlural translates a key with plural forms, the count is available as {{.Count}}
+	engine.FuncMap["i18nPlural"] = func(data gin.H, key string, count int, params ...string) (string, error) {
+		return localize(data, key, count, params)
 	}
 
 	engine.Use(func(c *gin.Context) {
-		accept := c.GetHeader("Accept-Language")
-		localizer = i18n.NewLocalizer(bundle, accept)
-		c.Set("localizer", localizer)
+		if config.IsDebug() {
+			translations.ReloadIfChanged()
+		}
+		bundle, langMatcher := translations.Get()
+		// tags are sorted by their q-value, when none of them is supported the matcher may
+		// still guess a language, so the default one which comes first in the bundle is used
+		tags, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+		if err != nil {
+			tags = nil
+		}
+		_, index, confidence := langMatcher.Match(tags...)
+		if confidence == language.No {
+			index = 0
+		}
+		lang := bundle.LanguageTags()[index].String()
+		c.Set("localizer", i18n.NewLocalizer(bundle, lang))
+		c.Set("lang", lang)
 		c.Next()
 	})
 
 	return nil
 }
 
+// initBranding lets templates show the custom panel title and logo, they are read
+// on every render so changes show up without restarting the panel
+func (s *Server) initBranding(engine *gin.Engine, basePath string) {
+	engine.FuncMap["panelTitle"] = func() string {
+		title, err := s.settingService.GetPanelTitle()
+		if err != nil {
+			return ""
+		}
+		return title
+	}
+	engine.FuncMap["panelLogo"] = func() string {
+		logo, err := s.settingService.GetPanelLogo()
+		if err != nil || logo == "" {
+			return ""
+		}
+		return basePath + "logo"
+	}
+}
+
 func (s *Server) startTask() {
 	err := s.xrayService.RestartXray(true)
 	if err != nil {
 		logger.Warning("start xray failed:", err)
 	}
-	// 每 30 秒检查一次 xray 是否在运行
-	s.cron.AddJob("@every 30s", job.NewCheckXrayRunningJob())
+	// 默认每 30 秒检查一次 xray 是否在运行
+	xrayCheckInterval := s.settingService.GetJobInterval("xrayCheckInterval")
+	s.cron.AddJob(fmt.Sprintf("@every %v", xrayCheckInterval), job.NewTimedJob("check_xray_running", job.NewCheckXrayRunningJob()))
 
+	trafficInterval := s.settingService.GetJobInterval("trafficInterval")
 	go func() {
 		time.Sleep(time.Second * 5)
-		// 每 10 秒统计一次流量，首次启动延迟 5 秒，与重启 xray 的时间错开
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		// 默认每 10 秒统计一次流量，首次启动延迟 5 秒，与重启 xray 的时间错开
+		s.cron.AddJob(fmt.Sprintf("@every %v", trafficInterval), job.NewTimedJob("xray_traffic", job.NewXrayTrafficJob()))
 	}()
 
-	// 每 30 秒检查一次 inbound 流量超出和到期的情况
-	s.cron.AddJob("@every 30s", job.NewCheckInboundJob())
+	// 默认每 30 秒检查一次 inbound 流量超出和到期的情况
+	inboundCheckInterval := s.settingService.GetJobInterval("inboundCheckInterval")
+	s.cron.AddJob(fmt.Sprintf("@every %v", inboundCheckInterval), job.NewTimedJob("check_inbound", job.NewCheckInboundJob()))
+
+	// 每 10 分钟清理一次过期的登录锁定记录
+	s.cron.AddJob("@every 10m", job.NewTimedJob("clean_lockout", job.NewCleanLockoutJob()))
+
+	// 每 10 分钟清理一次过期的登录会话
+	s.cron.AddJob("@every 10m", job.NewTimedJob("clean_session", job.NewCleanSessionJob()))
+
+	// 每分钟删除一次过期的临时用户
+	s.cron.AddJob("@every 1m", job.NewTimedJob("clean_ephemeral_client", job.NewCleanEphemeralClientJob()))
+
+	// 每分钟检查一次没有用户的入站
+	s.cron.AddJob("@every 1m", job.NewTimedJob("check_empty_inbound", job.NewCheckEmptyInboundJob()))
+
+	// 每天清理一次 90 天前的流量记录
+	s.cron.AddJob("@daily", job.NewTimedJob("clean_traffic_history", job.NewCleanTrafficHistoryJob()))
+
+	// 每天清理一次 180 天前的审计日志
+	s.cron.AddJob("@daily", job.NewTimedJob("clean_audit_log", job.NewCleanAuditLogJob()))
+
+	// dns-01 证书每天检查一次，30 天内到期时续期，新证书在文件更新后自动加载
+	if s.acmeService.IsDnsMode() {
+		s.cron.AddJob("@daily", job.NewTimedJob("renew_acme_cert", job.NewRenewAcmeCertJob()))
+	}
+
+	// 每 10 分钟清理一次长时间未出现的用户 IP
+	s.cron.AddJob("@every 10m", job.NewTimedJob("cleanup_client_ips", job.NewCleanupClientIpsJob()))
+
+	metricsFile, err := s.settingService.GetMetricsFile()
+	if err == nil && metricsFile != "" {
+		interval, err := s.settingService.GetMetricsFileInterval()
+		if err != nil || interval <= 0 {
+			logger.Warningf("metrics file interval invalid: %v, using default 60s", err)
+			interval = 60
+		}
+		s.cron.AddJob(fmt.Sprintf("@every %ds", interval), job.NewTimedJob("write_metrics_file", job.NewWriteMetricsFileJob(metricsFile)))
+	}
+
+	updateCheckUrl, err := s.settingService.GetUpdateCheckUrl()
+	if err == nil && updateCheckUrl != "" {
+		interval, err := s.settingService.GetUpdateCheckInterval()
+		if err != nil || interval < 1 {
+			logger.Warningf("update check interval invalid: %v, using default 24h", err)
+			interval = 24
+		}
+		checkUpdateJob := job.NewCheckUpdateJob(updateCheckUrl)
+		s.cron.AddJob(fmt.Sprintf("@every %dh", interval), job.NewTimedJob("check_update", checkUpdateJob))
+		go checkUpdateJob.Run()
+	}
 
 	penalty, _ := s.settingService.GetPenalty()
 	// check client ips from log file every 30 seconds (changing `30s` affects penalty system)
-	s.cron.AddJob("@every 30s", job.NewCheckClientIpJob(penalty))
+	s.cron.AddJob("@every 30s", job.NewTimedJob("check_client_ip", job.NewCheckClientIpJob(penalty)))
 
 	// 每一天提示一次流量情况,上海时间8点30
-	var entry cron.EntryID
 	isTgbotenabled, err := s.settingService.GetTgbotenabled()
 	if (err == nil) && (isTgbotenabled) {
 		runtime, err := s.settingService.GetTgbotRuntime()
@@ -310,13 +511,24 @@ func (s *Server) startTask() {
 			runtime = "@daily"
 		}
 		logger.Infof("Tg notify enabled,run at %s", runtime)
-		_, err = s.cron.AddJob(runtime, job.NewStatsNotifyJob())
+		statsNotifyJob := job.NewTimedJob("stats_notify", job.NewStatsNotifyJob())
+		_, err = s.cron.AddJob(runtime, statsNotifyJob)
 		if err != nil {
-			logger.Warning("Add NewStatsNotifyJob error", err)
-			return
+			logger.Warningf("Add NewStatsNotifyJob error[%s],Runtime[%s] invalid,wil run default", err, runtime)
+			_, err = s.cron.AddJob("@daily", statsNotifyJob)
+			if err != nil {
+				logger.Warning("Add NewStatsNotifyJob error", err)
+			}
+		}
+
+		// 用户可以向机器人查询自己的流量
+		selfService, err := s.settingService.GetTgBotSelfService()
+		if err == nil && selfService {
+			err = s.tgBotService.StartReceiving()
+			if err != nil {
+				logger.Warning("start receiving telegram bot messages failed:", err)
+			}
 		}
-	} else {
-		s.cron.Remove(entry)
 	}
 }
 
@@ -332,13 +544,6 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
-	s.cron = cron.New(cron.WithLocation(loc), cron.WithSeconds())
-	s.cron.Start()
-
-	engine, err := s.initRouter()
-	if err != nil {
-		return err
-	}
 
 	certFile, err := s.settingService.GetCertFile()
 	if err != nil {
@@ -356,32 +561,104 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
-	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	proxyProtocol, err := s.settingService.GetProxyProtocol()
+	if err != nil {
+		return err
+	}
+	httpMode, err := s.settingService.GetWebHttpMode()
+	if err != nil {
+		return err
+	}
+	enableHttp3, err := s.settingService.GetWebHttp3()
 	if err != nil {
 		return err
 	}
-	if certFile != "" || keyFile != "" {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	certMode, err := s.settingService.GetCertMode()
+	if err != nil {
+		return err
+	}
+	// 证书加载失败时尽早返回，此时还没有启动任何定时任务和 xray
+	var tlsConfig *tls.Config
+	var acmeManager *autocert.Manager
+	if certMode == "acme" && s.acmeService.IsDnsMode() {
+		tlsConfig, err = s.newAcmeDnsTlsConfig()
 		if err != nil {
-			listener.Close()
 			return err
 		}
-		c := &tls.Config{
-			Certificates: []tls.Certificate{cert},
+	} else if certMode == "acme" {
+		acmeManager, err = s.newAcmeManager()
+		if err != nil {
+			return err
 		}
-		listener = network.NewAutoHttpsListener(listener)
-		listener = tls.NewListener(listener, c)
+		tlsConfig = acmeManager.TLSConfig()
+	} else if certFile != "" || keyFile != "" {
+		// 后台定时检查证书文件，更新后自动加载，无需重启面板
+		certReloader, err := network.NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		go certReloader.Watch(s.ctx, certWatchInterval)
+		tlsConfig = &tls.Config{
+			GetCertificate: certReloader.GetCertificate,
+			NextProtos:     panelNextProtos,
+		}
+	}
+
+	// 控制器初始化时会注册定时任务，所以 cron 需要在路由之前创建，但在最后才启动
+	s.cron = cron.New(cron.WithLocation(loc), cron.WithSeconds())
+
+	engine, err := s.initRouter()
+	if err != nil {
+		return err
+	}
+
+	var listener net.Listener
+	if strings.HasPrefix(listen, unixListenPrefix) {
+		listener, err = s.listenUnix(strings.TrimPrefix(listen, unixListenPrefix))
+	} else {
+		listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
+		listener, err = net.Listen("tcp", listenAddr)
+	}
+	if err != nil {
+		return err
+	}
+	if proxyProtocol {
+		listener = network.NewProxyProtocolListener(listener)
+	}
+	if tlsConfig != nil {
+		listener = network.NewAutoHttpsListener(listener, network.AutoHttpsMode(httpMode))
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 
-	if certFile != "" || keyFile != "" {
+	if tlsConfig != nil {
 		logger.Info("web server run https on", listener.Addr())
 	} else {
 		logger.Info("web server run http on", listener.Addr())
 	}
 	s.listener = listener
 
+	if tlsConfig != nil && s.socketPath == "" {
+		s.startHttpsRedirect(listen, port, acmeManager)
+	} else if acmeManager != nil {
+		// a unix socket has no https port to redirect to, the proxy in front of it
+		// does that, but the http-01 challenges still need port 80
+		s.startAcmeChallenge("", acmeManager, http.NotFoundHandler())
+	}
+
+	if enableHttp3 && tlsConfig != nil {
+		if s.socketPath != "" || proxyProtocol {
+			logger.Warning("http/3 is not served on a unix socket or behind the PROXY protocol")
+		} else {
+			err = s.startHttp3(listen, listener.Addr().(*net.TCPAddr).Port, tlsConfig, engine)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.cron.Start()
 	s.startTask()
+	s.xrayStarted = true
 
 	s.httpServer = &http.Server{
 		Handler: engine,
@@ -394,19 +671,239 @@ func (s *Server) Start() (err error) {
 	return nil
 }
 
+// newAcmeManager returns a manager which gets and renews the certificate of the
+// configured domain from Let's Encrypt, certificates are cached in the data dir
+func (s *Server) newAcmeManager() (*autocert.Manager, error) {
+	domain, err := s.settingService.GetAcmeDomain()
+	if err != nil {
+		return nil, err
+	}
+	if domain == "" {
+		return nil, common.NewError("acme cert mode needs a domain")
+	}
+	email, err := s.settingService.GetAcmeEmail()
+	if err != nil {
+		return nil, err
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domain),
+		Cache:      autocert.DirCache(filepath.Join(config.GetDataDir(), "acme")),
+		Email:      email,
+	}, nil
+}
+
+// panelNextProtos lets clients negotiate http/2 with the https panel, net/http serves it on
+// tls connections that agreed on h2, autocert configs offer it already
+var panelNextProtos = []string{"h2", "http/1.1"}
+
+// certWatchInterval is how often the certificate files are checked for changes
+const certWatchInterval = time.Second * 10
+
+// newAcmeDnsTlsConfig serves the certificate the dns-01 challenge got, a missing one is
+// requested in the background so the panel starts without waiting for dns changes
+func (s *Server) newAcmeDnsTlsConfig() (*tls.Config, error) {
+	domain, err := s.settingService.GetAcmeDomain()
+	if err != nil {
+		return nil, err
+	}
+	if domain == "" {
+		return nil, common.NewError("acme cert mode needs a domain")
+	}
+	certFile, keyFile := s.acmeService.GetDnsCertFiles(domain)
+	certReloader, err := network.NewCertReloader(certFile, keyFile)
+	if err != nil {
+		certReloader = network.NewPendingCertReloader(certFile, keyFile)
+	}
+	go certReloader.Watch(s.ctx, certWatchInterval)
+	go func() {
+		err := s.acmeService.RenewDnsCert()
+		if err != nil {
+			logger.Warning("request certificate with dns-01 failed:", err)
+		}
+	}()
+	return &tls.Config{
+		GetCertificate: certReloader.GetCertificate,
+		NextProtos:     panelNextProtos,
+	}, nil
+}
+
+// unixListenPrefix marks a listen address as a unix socket path, e.g. unix:/run/x-ui.sock
+const unixListenPrefix = "unix:"
+
+// listenUnix listens on the unix socket at path, a socket left by an unclean exit is removed first
+func (s *Server) listenUnix(path string) (net.Listener, error) {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, common.NewError("listen path exists and is not a socket:", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	socketMode, err := s.settingService.GetWebSocketMode()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s.socketPath = path
+	err = os.Chmod(path, socketMode)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// startHttp3 serves handler over http/3 on the udp port of the https panel with its certificate,
+// browsers find it through the Alt-Svc header of the https responses
+func (s *Server) startHttp3(listen string, port int, tlsConfig *tls.Config, handler http.Handler) error {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(listen, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	s.http3Conn = conn
+	s.http3Server = &http3.Server{
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	logger.Info("web server run http/3 on", conn.LocalAddr())
+	go func() {
+		s.http3Server.Serve(conn)
+	}()
+	return nil
+}
+
+// startPlainServer serves handler over plain http on port
+func (s *Server) startPlainServer(listen string, port int, handler http.Handler) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler: handler,
+	}
+	s.plainServers = append(s.plainServers, server)
+	go func() {
+		server.Serve(listener)
+	}()
+	return nil
+}
+
+// startHttpsRedirect starts the plain http listener which redirects to the https panel port.
+// In acme mode port 80 also answers http-01 challenges, without it certificates can
+// still be issued with tls-alpn-01 on the panel port if that is 443
+func (s *Server) startHttpsRedirect(listen string, httpsPort int, acmeManager *autocert.Manager) {
+	redirectPort, err := s.settingService.GetWebHttpRedirectPort()
+	if err != nil {
+		logger.Warning("get http redirect port failed:", err)
+	}
+	redirectHandler := network.NewHttpsRedirectHandler(httpsPort)
+	if acmeManager != nil {
+		s.startAcmeChallenge(listen, acmeManager, redirectHandler)
+		if redirectPort == 80 {
+			return
+		}
+	}
+	if redirectPort > 0 {
+		err = s.startPlainServer(listen, redirectPort, redirectHandler)
+		if err != nil {
+			logger.Warning("listen on http redirect port failed:", err)
+		} else {
+			logger.Info("http redirect server run on port", redirectPort)
+		}
+	}
+}
+
+// startAcmeChallenge answers the acme http-01 challenges on port 80, other requests go to fallback
+func (s *Server) startAcmeChallenge(listen string, acmeManager *autocert.Manager, fallback http.Handler) {
+	err := s.startPlainServer(listen, 80, acmeManager.HTTPHandler(fallback))
+	if err != nil {
+		logger.Warning("listen on port 80 for acme challenges failed:", err)
+	} else {
+		logger.Info("acme challenge server run on port 80")
+	}
+}
+
+// ErrForcedShutdown is returned by Stop when requests didn't finish within the shutdown timeout
+var ErrForcedShutdown = errors.New("http server shutdown timed out, connections were closed")
+
+// shutdownHttpServer waits for running requests up to the shutdown timeout,
+// connections still open after it are closed so the listener is always released
+func (s *Server) shutdownHttpServer() error {
+	timeout, err := s.settingService.GetWebShutdownTimeout()
+	if err != nil || timeout <= 0 {
+		logger.Warningf("shutdown timeout invalid: %v, using default 10s", err)
+		timeout = 10
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(timeout))
+	defer cancel()
+	err = s.httpServer.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		return err
+	}
+	logger.Warningf("requests still running after %vs, closing them", timeout)
+	err = s.httpServer.Close()
+	if err != nil {
+		logger.Warning("close http server failed:", err)
+	}
+	return ErrForcedShutdown
+}
+
+// Stop releases whatever Start managed to set up, it's safe to call after a partial Start
 func (s *Server) Stop() error {
-	s.cancel()
-	s.xrayService.StopXray()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.xrayStarted {
+		s.xrayService.StopXray()
+		s.xrayStarted = false
+	}
 	if s.cron != nil {
 		s.cron.Stop()
 	}
+	s.tgBotService.StopReceiving()
 	var err1 error
 	var err2 error
 	if s.httpServer != nil {
-		err1 = s.httpServer.Shutdown(s.ctx)
+		err1 = s.shutdownHttpServer()
+	}
+	for _, server := range s.plainServers {
+		server.Close()
+	}
+	s.plainServers = nil
+	if s.http3Server != nil {
+		s.http3Server.Close()
+	}
+	if s.http3Conn != nil {
+		// the http/3 server doesn't close the connection it was given
+		s.http3Conn.Close()
+		s.http3Conn = nil
 	}
 	if s.listener != nil {
 		err2 = s.listener.Close()
+		s.listener = nil
+		if errors.Is(err2, net.ErrClosed) {
+			// the http server already closed it
+			err2 = nil
+		}
+	}
+	if s.socketPath != "" {
+		// closing a unix listener usually removes the socket already
+		err := os.Remove(s.socketPath)
+		if err != nil && !os.IsNotExist(err) && err2 == nil {
+			err2 = err
+		}
+		s.socketPath = ""
+	}
+	if err2 == nil {
+		// keeps ErrForcedShutdown comparable
+		return err1
 	}
 	return common.Combine(err1, err2)
 }
@@ -0,0 +1,552 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/global"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "x-ui-web-test-")
+	if err != nil {
+		panic(err)
+	}
+	err = database.InitDB(filepath.Join(dir, "x-ui.db"))
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setSettings stores the settings for the test and removes them when it ends
+func setSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	db := database.GetDB()
+	for key, value := range settings {
+		err := db.Create(&model.Setting{Key: key, Value: value}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for key := range settings {
+			db.Where("key = ?", key).Delete(model.Setting{})
+		}
+	})
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	s := NewServer()
+	err := s.Stop()
+	if err != nil {
+		t.Fatalf("Stop() = %v", err)
+	}
+	// a second Stop must not panic either
+	err = s.Stop()
+	if err != nil {
+		t.Fatalf("second Stop() = %v", err)
+	}
+}
+
+func TestStartFailureCleansUp(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+
+	notSocket := filepath.Join(t.TempDir(), "panel.sock")
+	err = os.WriteFile(notSocket, nil, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings map[string]string
+	}{
+		{"missing certificate", map[string]string{
+			"webListen":   "127.0.0.1",
+			"webPort":     "0",
+			"webCertFile": filepath.Join(t.TempDir(), "missing.crt"),
+			"webKeyFile":  filepath.Join(t.TempDir(), "missing.key"),
+		}},
+		{"acme without domain", map[string]string{
+			"webListen":   "127.0.0.1",
+			"webPort":     "0",
+			"webCertMode": "acme",
+		}},
+		{"port in use", map[string]string{
+			"webListen": "127.0.0.1",
+			"webPort":   busyPort,
+		}},
+		{"listen path is not a socket", map[string]string{
+			"webListen": unixListenPrefix + notSocket,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSettings(t, tt.settings)
+			s := NewServer()
+			global.SetWebServer(s)
+			err := s.Start()
+			if err == nil {
+				s.Stop()
+				t.Fatal("Start() succeeded")
+			}
+			if s.listener != nil || s.xrayStarted || len(s.plainServers) > 0 {
+				t.Errorf("Start() left listener=%v xrayStarted=%v plainServers=%v", s.listener, s.xrayStarted, len(s.plainServers))
+			}
+			if s.ctx.Err() == nil {
+				t.Error("Start() didn't cancel the server context")
+			}
+			// Stop after a failed Start must not panic
+			s.Stop()
+		})
+	}
+
+	info, err := os.Stat(notSocket)
+	if err != nil || info.Mode()&os.ModeSocket != 0 {
+		t.Errorf("the file at the listen path was replaced: %v", err)
+	}
+}
+
+func TestI18nPerRequest(t *testing.T) {
+	engine := gin.New()
+	s := NewServer()
+	err := s.initI18n(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.SetHTMLTemplate(template.Must(template.New("page").Funcs(engine.FuncMap).Parse(`{{ i18n . "close" }}`)))
+	engine.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "page", gin.H{"localizer": c.MustGet("localizer"), "lang": c.GetString("lang")})
+	})
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{"en-US", "close"},
+		{"zh-CN,zh;q=0.9", "关闭"},
+		{"zh-TW", "關閉"},
+	}
+	// concurrent requests in other languages must not change each other's translations
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		tt := tests[i%len(tests)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("%v: body = %q, want %q", tt.acceptLanguage, got, tt.want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	engine := newTestRouter(t)
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		wantLang       string
+	}{
+		{"exact", "en-US", "en-US"},
+		{"unsupported first", "fa-IR,fa;q=0.9,en;q=0.8", "en-US"},
+		{"weights out of order", "en;q=0.5,zh-TW;q=0.9", "zh-Hant"},
+		{"weight of zero", "zh-TW;q=0,en-GB", "en-US"},
+		{"only unsupported", "fa-IR,de;q=0.8", "zh-Hans"},
+		{"unsupported latin script", "fr-FR,fr;q=0.9", "zh-Hans"},
+		{"empty", "", "zh-Hans"},
+		{"malformed", "en-US;q=x;;", "zh-Hans"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET / = %v, want %v", w.Code, http.StatusOK)
+			}
+			want := fmt.Sprintf(`<html lang="%v">`, tt.wantLang)
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("Accept-Language %q: login page doesn't have %v", tt.acceptLanguage, want)
+			}
+		})
+	}
+}
+
+func TestStopShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   bool
+		wantErr error
+	}{
+		{"finished requests", false, nil},
+		{"blocked request", true, ErrForcedShutdown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSettings(t, map[string]string{"webShutdownTimeout": "1"})
+			started := make(chan struct{})
+			release := make(chan struct{})
+			defer close(release)
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewServer()
+			s.listener = listener
+			s.httpServer = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				close(started)
+				<-release
+			})}
+			go s.httpServer.Serve(listener)
+
+			if tt.block {
+				go http.Get("http://" + listener.Addr().String())
+				select {
+				case <-started:
+				case <-time.After(5 * time.Second):
+					t.Fatal("the request didn't reach the handler")
+				}
+			}
+			start := time.Now()
+			err = s.Stop()
+			if err != tt.wantErr {
+				t.Errorf("Stop() = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Stop() took %v with a 1s timeout", elapsed)
+			}
+			_, err = net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+			if err == nil {
+				t.Error("the listener is still open after Stop()")
+			}
+		})
+	}
+}
+
+// writeTestCert writes a self signed certificate for 127.0.0.1 and returns its files
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "panel.crt")
+	keyFile := filepath.Join(dir, "panel.key")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHttpsProtocols(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	setSettings(t, map[string]string{
+		"webListen":   "127.0.0.1",
+		"webPort":     "0",
+		"webCertFile": certFile,
+		"webKeyFile":  keyFile,
+		"webHttp3":    "true",
+	})
+	s := NewServer()
+	global.SetWebServer(s)
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	addr := s.listener.Addr().String()
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	// the tls handshake agrees on http/2
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2", "http/1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if protocol := conn.ConnectionState().NegotiatedProtocol; protocol != "h2" {
+		t.Errorf("negotiated protocol = %q, want h2", protocol)
+	}
+	conn.Close()
+
+	// http/2 responses announce http/3 once its listener is up
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}}
+	defer client.CloseIdleConnections()
+	http3Port := s.http3Conn.LocalAddr().(*net.UDPAddr).Port
+	wantAltSvc := fmt.Sprintf(`h3=":%v"`, http3Port)
+	var altSvc string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		resp, err := client.Get("https://" + addr + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+			t.Fatalf("https answered %v over %v", resp.StatusCode, resp.Proto)
+		}
+		altSvc = resp.Header.Get("Alt-Svc")
+		if strings.Contains(altSvc, wantAltSvc) {
+			break
+		}
+	}
+	if !strings.Contains(altSvc, wantAltSvc) {
+		t.Fatalf("Alt-Svc = %q, want %v", altSvc, wantAltSvc)
+	}
+
+	transport := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer transport.Close()
+	resp, err := (&http.Client{Transport: transport}).Get(fmt.Sprintf("https://127.0.0.1:%v/", http3Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 3 || resp.StatusCode != http.StatusOK {
+		t.Errorf("http/3 answered %v over %v", resp.StatusCode, resp.Proto)
+	}
+	if resp.Header.Get("Alt-Svc") != "" {
+		t.Error("http/3 responses announce http/3 again")
+	}
+}
+
+func TestBranding(t *testing.T) {
+	engine := newTestRouter(t)
+	tests := []struct {
+		name      string
+		settings  map[string]string
+		wantTitle string
+		wantLogo  bool
+	}{
+		{"default", map[string]string{}, "<h1>登录</h1>", false},
+		{"custom title", map[string]string{"panelTitle": "Reseller <VPN>"}, "<h1>Reseller &lt;VPN&gt;</h1>", false},
+		{"custom logo", map[string]string{"panelLogo": "logo.png"}, "<h1>登录</h1>", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setSettings(t, tt.settings)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Language", "en-US")
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET / = %v, want %v", w.Code, http.StatusOK)
+			}
+			if !strings.Contains(body, tt.wantTitle) {
+				t.Errorf("login page doesn't have %q", tt.wantTitle)
+			}
+			if got := strings.Contains(body, `<img src="/logo"`); got != tt.wantLogo {
+				t.Errorf("login page shows the logo = %v, want %v", got, tt.wantLogo)
+			}
+		})
+	}
+}
+
+// freePort returns a tcp port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestHttpsRedirectServer(t *testing.T) {
+	// the redirect points at the configured port, so both need one
+	httpsPort := freePort(t)
+	redirectPort := freePort(t)
+	certFile, keyFile := writeTestCert(t)
+	setSettings(t, map[string]string{
+		"webListen":           "127.0.0.1",
+		"webPort":             strconv.Itoa(httpsPort),
+		"webCertFile":         certFile,
+		"webKeyFile":          keyFile,
+		"webHttpRedirectPort": strconv.Itoa(redirectPort),
+	})
+	s := NewServer()
+	global.SetWebServer(s)
+	err := s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped := false
+	defer func() {
+		if !stopped {
+			s.Stop()
+		}
+	}()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%v/xui/inbounds?page=2", redirectPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want := fmt.Sprintf("https://127.0.0.1:%v/xui/inbounds?page=2", httpsPort)
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+		t.Errorf("redirect = %v %q, want %v %q", resp.StatusCode, resp.Header.Get("Location"), http.StatusMovedPermanently, want)
+	}
+
+	// the redirect listener goes away with the panel
+	stopped = true
+	err = s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%v", redirectPort), time.Second)
+	if err == nil {
+		conn.Close()
+		t.Error("the redirect port still accepts connections after Stop()")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+	tests := []struct {
+		name       string
+		settings   map[string]string
+		wantScheme string
+		wantMode   os.FileMode
+	}{
+		{"plain", map[string]string{}, "http", 0660},
+		{"tls", map[string]string{"webCertFile": certFile, "webKeyFile": keyFile}, "https", 0660},
+		{"custom mode", map[string]string{"webSocketMode": "0600"}, "http", 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a socket path is limited to about a hundred bytes, too few for t.TempDir
+			dir, err := os.MkdirTemp("", "x-ui-sock-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			socketPath := filepath.Join(dir, "panel.sock")
+			// a socket left by an unclean exit is replaced
+			stale, err := net.Listen("unix", socketPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stale.(*net.UnixListener).SetUnlinkOnClose(false)
+			stale.Close()
+
+			settings := map[string]string{"webListen": unixListenPrefix + socketPath}
+			for key, value := range tt.settings {
+				settings[key] = value
+			}
+			setSettings(t, settings)
+			s := NewServer()
+			global.SetWebServer(s)
+			err = s.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stopped := false
+			defer func() {
+				if !stopped {
+					s.Stop()
+				}
+			}()
+
+			info, err := os.Stat(socketPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != tt.wantMode {
+				t.Errorf("socket mode = %v, want %v", mode, tt.wantMode)
+			}
+
+			client := &http.Client{
+				Timeout: 5 * time.Second,
+				Transport: &http.Transport{
+					DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+					},
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				},
+			}
+			defer client.CloseIdleConnections()
+			resp, err := client.Get(tt.wantScheme + "://panel/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET / over the socket = %v, want %v", resp.StatusCode, http.StatusOK)
+			}
+
+			stopped = true
+			err = s.Stop()
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = os.Stat(socketPath)
+			if !os.IsNotExist(err) {
+				t.Errorf("the socket file is still there after Stop(): %v", err)
+			}
+		})
+	}
+}
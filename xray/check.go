@@ -0,0 +1,34 @@
+package xray
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"x-ui/util/common"
+)
+
+// CheckConfig runs xray on the config in test mode, it only loads the config without serving it
+func CheckConfig(config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp("", "x-ui-check-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	output, err := exec.Command(GetBinaryPath(), "-test", "-c", file.Name()).CombinedOutput()
+	if err != nil {
+		return common.NewErrorf("xray config test failed: %v %v", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 package xray
 
 import (
-	"bytes"
+	"x-ui/util/common"
 	"x-ui/util/json_util"
 )
 
@@ -28,35 +28,69 @@ func (c *Config) Equals(other *Config) bool {
 			return false
 		}
 	}
-	if !bytes.Equal(c.LogConfig, other.LogConfig) {
+	if !c.LogConfig.Equals(other.LogConfig) {
 		return false
 	}
-	if !bytes.Equal(c.RouterConfig, other.RouterConfig) {
+	if !c.RouterConfig.Equals(other.RouterConfig) {
 		return false
 	}
-	if !bytes.Equal(c.DNSConfig, other.DNSConfig) {
+	if !c.DNSConfig.Equals(other.DNSConfig) {
 		return false
 	}
-	if !bytes.Equal(c.OutboundConfigs, other.OutboundConfigs) {
+	if !c.OutboundConfigs.Equals(other.OutboundConfigs) {
 		return false
 	}
-	if !bytes.Equal(c.Transport, other.Transport) {
+	if !c.Transport.Equals(other.Transport) {
 		return false
 	}
-	if !bytes.Equal(c.Policy, other.Policy) {
+	if !c.Policy.Equals(other.Policy) {
 		return false
 	}
-	if !bytes.Equal(c.API, other.API) {
+	if !c.API.Equals(other.API) {
 		return false
 	}
-	if !bytes.Equal(c.Stats, other.Stats) {
+	if !c.Stats.Equals(other.Stats) {
 		return false
 	}
-	if !bytes.Equal(c.Reverse, other.Reverse) {
+	if !c.Reverse.Equals(other.Reverse) {
 		return false
 	}
-	if !bytes.Equal(c.FakeDNS, other.FakeDNS) {
+	if !c.FakeDNS.Equals(other.FakeDNS) {
 		return false
 	}
 	return true
 }
+
+// Validate returns the first obvious mistake in the inbounds that would keep xray from starting,
+// an empty listen, a port outside of 1-65535, two inbounds on the same port or a duplicate tag
+func (c *Config) Validate() error {
+	tags := map[string]bool{}
+	listens := make([]string, len(c.InboundConfigs))
+	for i := range c.InboundConfigs {
+		inbound := &c.InboundConfigs[i]
+		listen, err := inbound.getListen()
+		if err != nil {
+			return common.NewErrorf("inbound %v has an invalid listen: %v", inbound.Tag, err)
+		}
+		listens[i] = listen
+		if inbound.Tag != "" {
+			if tags[inbound.Tag] {
+				return common.NewError("duplicate inbound tag:", inbound.Tag)
+			}
+			tags[inbound.Tag] = true
+		}
+		if isUnixListen(listen) {
+			continue
+		}
+		if inbound.Port <= 0 || inbound.Port > 65535 {
+			return common.NewErrorf("inbound %v has an invalid port: %v", inbound.Tag, inbound.Port)
+		}
+		for j := 0; j < i; j++ {
+			other := &c.InboundConfigs[j]
+			if other.Port == inbound.Port && !isUnixListen(listens[j]) && listensOverlap(listen, listens[j]) {
+				return common.NewErrorf("inbounds %v and %v both listen on port %v", other.Tag, inbound.Tag, inbound.Port)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package xray
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func parseConfig(t *testing.T, data string) *Config {
+	t.Helper()
+	config := &Config{}
+	err := json.Unmarshal([]byte(data), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestConfigEquals(t *testing.T) {
+	base := `{
+		"log": {"loglevel": "warning", "access": "./access.log"},
+		"inbounds": [{"listen": "0.0.0.0", "port": 443, "protocol": "vless", "tag": "inbound-443",
+			"settings": {"clients": [{"id": "a", "email": "bob"}], "decryption": "none"},
+			"streamSettings": {"network": "tcp", "security": "tls"}}],
+		"outbounds": [{"protocol": "freedom", "settings": {}}],
+		"routing": {"domainStrategy": "AsIs", "rules": [{"type": "field", "outboundTag": "blocked", "ip": ["geoip:private"]}]}
+	}`
+	tests := []struct {
+		name  string
+		other string
+		equal bool
+	}{
+		{"same", base, true},
+		{"reordered keys and whitespace", `{"routing":{"rules":[{"ip":["geoip:private"],"outboundTag":"blocked","type":"field"}],"domainStrategy":"AsIs"},
+			"outbounds":[{"settings":{},"protocol":"freedom"}],
+			"inbounds":[{"streamSettings":{"security":"tls","network":"tcp"},"settings":{"decryption":"none","clients":[{"email":"bob","id":"a"}]},
+				"tag":"inbound-443","protocol":"vless","port":443,"listen":"0.0.0.0"}],
+			"log":{"access":"./access.log","loglevel":"warning"}}`, true},
+		{"changed client", `{
+			"log": {"loglevel": "warning", "access": "./access.log"},
+			"inbounds": [{"listen": "0.0.0.0", "port": 443, "protocol": "vless", "tag": "inbound-443",
+				"settings": {"clients": [{"id": "b", "email": "bob"}], "decryption": "none"},
+				"streamSettings": {"network": "tcp", "security": "tls"}}],
+			"outbounds": [{"protocol": "freedom", "settings": {}}],
+			"routing": {"domainStrategy": "AsIs", "rules": [{"type": "field", "outboundTag": "blocked", "ip": ["geoip:private"]}]}
+		}`, false},
+		{"changed port", `{
+			"log": {"loglevel": "warning", "access": "./access.log"},
+			"inbounds": [{"listen": "0.0.0.0", "port": 8443, "protocol": "vless", "tag": "inbound-443",
+				"settings": {"clients": [{"id": "a", "email": "bob"}], "decryption": "none"},
+				"streamSettings": {"network": "tcp", "security": "tls"}}],
+			"outbounds": [{"protocol": "freedom", "settings": {}}],
+			"routing": {"domainStrategy": "AsIs", "rules": [{"type": "field", "outboundTag": "blocked", "ip": ["geoip:private"]}]}
+		}`, false},
+		{"missing inbound", `{
+			"log": {"loglevel": "warning", "access": "./access.log"},
+			"outbounds": [{"protocol": "freedom", "settings": {}}],
+			"routing": {"domainStrategy": "AsIs", "rules": [{"type": "field", "outboundTag": "blocked", "ip": ["geoip:private"]}]}
+		}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parseConfig(t, base), parseConfig(t, tt.other)
+			if got := a.Equals(b); got != tt.equal {
+				t.Errorf("Equals() = %v, want %v", got, tt.equal)
+			}
+			if got := b.Equals(a); got != tt.equal {
+				t.Errorf("reversed Equals() = %v, want %v", got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		inbounds string
+		wantErr  string
+	}{
+		{"valid", `[{"listen":"0.0.0.0","port":443,"tag":"a"},{"listen":"0.0.0.0","port":8443,"tag":"b"}]`, ""},
+		{"same port on other addresses", `[{"listen":"127.0.0.1","port":443,"tag":"a"},{"listen":"192.0.2.1","port":443,"tag":"b"}]`, ""},
+		{"unix sockets have no port", `[{"listen":"/run/a.sock","port":0,"tag":"a"},{"listen":"@abstract","port":0,"tag":"b"}]`, ""},
+		{"port collision", `[{"listen":"0.0.0.0","port":443,"tag":"a"},{"listen":"0.0.0.0","port":443,"tag":"b"}]`, "inbounds a and b both listen on port 443"},
+		{"port collision with any address", `[{"listen":"127.0.0.1","port":443,"tag":"a"},{"port":443,"tag":"b"}]`, "inbounds a and b both listen on port 443"},
+		{"duplicate tag", `[{"listen":"0.0.0.0","port":443,"tag":"a"},{"listen":"0.0.0.0","port":8443,"tag":"a"}]`, "duplicate inbound tag: a"},
+		{"invalid port", `[{"listen":"0.0.0.0","port":70000,"tag":"a"}]`, "inbound a has an invalid port: 70000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := parseConfig(t, `{"inbounds":`+tt.inbounds+`}`)
+			err := config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package xray
+
+import (
+	"encoding/json"
+	"net"
+	"x-ui/util/common"
+)
+
+type FakeDNSConfig struct {
+	IPPool   string `json:"ipPool"`
+	PoolSize int64  `json:"poolSize"`
+
+	// fields not known here, kept so they survive a round trip
+	extra map[string]json.RawMessage
+}
+
+func (c *FakeDNSConfig) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	if ipPool, ok := fields["ipPool"]; ok {
+		err = json.Unmarshal(ipPool, &c.IPPool)
+		if err != nil {
+			return err
+		}
+		delete(fields, "ipPool")
+	}
+	if poolSize, ok := fields["poolSize"]; ok {
+		err = json.Unmarshal(poolSize, &c.PoolSize)
+		if err != nil {
+			return err
+		}
+		delete(fields, "poolSize")
+	}
+	c.extra = fields
+	return nil
+}
+
+func (c *FakeDNSConfig) MarshalJSON() ([]byte, error) {
+	fields := map[string]interface{}{}
+	for key, value := range c.extra {
+		fields[key] = value
+	}
+	fields["ipPool"] = c.IPPool
+	fields["poolSize"] = c.PoolSize
+	return json.Marshal(fields)
+}
+
+// Validate checks the pool is a valid cidr big enough for poolSize
+func (c *FakeDNSConfig) Validate() error {
+	_, ipNet, err := net.ParseCIDR(c.IPPool)
+	if err != nil {
+		return common.NewError("fakedns ip pool is not a valid cidr:", c.IPPool)
+	}
+	if c.PoolSize <= 0 {
+		return common.NewError("fakedns pool size must be positive:", c.PoolSize)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones < 63 && c.PoolSize > int64(1)<<uint(bits-ones) {
+		return common.NewErrorf("fakedns pool size %v is larger than ip pool %v", c.PoolSize, c.IPPool)
+	}
+	return nil
+}
+
+// SniffingHasFakeDNS reports whether the inbound sniffing settings override destinations with fakedns,
+// xray only answers with fake ips to inbounds which do
+func SniffingHasFakeDNS(sniffing []byte) bool {
+	settings := struct {
+		Enabled      bool     `json:"enabled"`
+		DestOverride []string `json:"destOverride"`
+	}{}
+	if json.Unmarshal(sniffing, &settings) != nil || !settings.Enabled {
+		return false
+	}
+	for _, dest := range settings.DestOverride {
+		if dest == "fakedns" || dest == "fakedns+others" {
+			return true
+		}
+	}
+	return false
+}
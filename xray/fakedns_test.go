@@ -0,0 +1,78 @@
+package xray
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFakeDNSConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		ipPool   string
+		poolSize int64
+		wantErr  bool
+	}{
+		{"ipv4", "198.18.0.0/15", 65535, false},
+		{"ipv6", "fc00::/18", 65535, false},
+		{"pool as big as the cidr", "198.18.0.0/24", 256, false},
+		{"pool larger than the cidr", "198.18.0.0/24", 257, true},
+		{"not a cidr", "198.18.0.0", 65535, true},
+		{"invalid cidr", "198.18.0.0/33", 65535, true},
+		{"empty", "", 65535, true},
+		{"zero pool size", "198.18.0.0/15", 0, true},
+		{"negative pool size", "198.18.0.0/15", -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &FakeDNSConfig{IPPool: tt.ipPool, PoolSize: tt.poolSize}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFakeDNSConfigRoundTrip(t *testing.T) {
+	c := &FakeDNSConfig{}
+	err := json.Unmarshal([]byte(`{"ipPool": "198.18.0.0/15", "poolSize": 65535, "future": {"a": 1}}`), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IPPool != "198.18.0.0/15" || c.PoolSize != 65535 {
+		t.Errorf("FakeDNSConfig = %+v", c)
+	}
+	c.PoolSize = 1024
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["poolSize"] != float64(1024) || fields["ipPool"] != "198.18.0.0/15" {
+		t.Errorf("marshaled = %s", data)
+	}
+	if future, ok := fields["future"].(map[string]interface{}); !ok || future["a"] != float64(1) {
+		t.Errorf("unknown field is lost: %s", data)
+	}
+}
+
+func TestSniffingHasFakeDNS(t *testing.T) {
+	tests := []struct {
+		sniffing string
+		want     bool
+	}{
+		{`{"enabled": true, "destOverride": ["http", "tls", "fakedns"]}`, true},
+		{`{"enabled": true, "destOverride": ["fakedns+others"]}`, true},
+		{`{"enabled": false, "destOverride": ["fakedns"]}`, false},
+		{`{"enabled": true, "destOverride": ["http", "tls"]}`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := SniffingHasFakeDNS([]byte(tt.sniffing)); got != tt.want {
+			t.Errorf("SniffingHasFakeDNS(%q) = %v, want %v", tt.sniffing, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package xray
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"x-ui/util/common"
+
+	"github.com/golang/protobuf/proto"
+	handlerservice "github.com/xtls/xray-core/app/proxyman/command"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/proxy/trojan"
+	"github.com/xtls/xray-core/proxy/vless"
+	"github.com/xtls/xray-core/proxy/vmess"
+	"google.golang.org/grpc"
+)
+
+// UserAccount is what a running inbound needs to know of a client, which fields
+// are used depends on the protocol of the inbound
+type UserAccount struct {
+	Id       string
+	AlterId  int
+	Flow     string
+	Password string
+}
+
+func (p *process) alterInbound(tag string, operation proto.Message) error {
+	if p.apiPort == 0 {
+		return common.NewError("xray api port wrong:", p.apiPort)
+	}
+	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%v", p.apiPort), grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := handlerservice.NewHandlerServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	_, err = client.AlterInbound(ctx, &handlerservice.AlterInboundRequest{
+		Tag:       tag,
+		Operation: serial.ToTypedMessage(operation),
+	})
+	return err
+}
+
+// RemoveUser takes the client off the running inbound without restarting xray,
+// the config is left as it is, so the client comes back when xray restarts
+func (p *process) RemoveUser(inboundTag string, email string) error {
+	return p.alterInbound(inboundTag, &handlerservice.RemoveUserOperation{Email: email})
+}
+
+// AddUser puts the client on the running inbound without restarting xray
+func (p *process) AddUser(inboundTag string, inboundProtocol string, email string, account *UserAccount) error {
+	var typedAccount proto.Message
+	switch inboundProtocol {
+	case "vmess":
+		typedAccount = &vmess.Account{
+			Id:      account.Id,
+			AlterId: uint32(account.AlterId),
+			SecuritySettings: &protocol.SecurityConfig{
+				Type: protocol.SecurityType_AUTO,
+			},
+		}
+	case "vless":
+		typedAccount = &vless.Account{
+			Id:         account.Id,
+			Flow:       account.Flow,
+			Encryption: "none",
+		}
+	case "trojan":
+		typedAccount = &trojan.Account{
+			Password: account.Password,
+			Flow:     account.Flow,
+		}
+	default:
+		return common.NewError("protocol has no users to add:", inboundProtocol)
+	}
+	return p.alterInbound(inboundTag, &handlerservice.AddUserOperation{
+		User: &protocol.User{
+			Email:   email,
+			Account: serial.ToTypedMessage(typedAccount),
+		},
+	})
+}
@@ -1,7 +1,10 @@
 package xray
 
 import (
-	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"x-ui/util/common"
 	"x-ui/util/json_util"
 )
 
@@ -16,7 +19,7 @@ type InboundConfig struct {
 }
 
 func (c *InboundConfig) Equals(other *InboundConfig) bool {
-	if !bytes.Equal(c.Listen, other.Listen) {
+	if !c.Listen.Equals(other.Listen) {
 		return false
 	}
 	if c.Port != other.Port {
@@ -25,17 +28,54 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if c.Protocol != other.Protocol {
 		return false
 	}
-	if !bytes.Equal(c.Settings, other.Settings) {
+	if !c.Settings.Equals(other.Settings) {
 		return false
 	}
-	if !bytes.Equal(c.StreamSettings, other.StreamSettings) {
+	if !c.StreamSettings.Equals(other.StreamSettings) {
 		return false
 	}
 	if c.Tag != other.Tag {
 		return false
 	}
-	if !bytes.Equal(c.Sniffing, other.Sniffing) {
+	if !c.Sniffing.Equals(other.Sniffing) {
 		return false
 	}
 	return true
 }
+
+// getListen returns the listen address of the inbound, empty if it listens on every address
+func (c *InboundConfig) getListen() (string, error) {
+	if len(c.Listen) == 0 {
+		return "", nil
+	}
+	var listen string
+	err := json.Unmarshal(c.Listen, &listen)
+	if err != nil {
+		return "", err
+	}
+	if listen == "" {
+		return "", common.NewError("listen can not be an empty string")
+	}
+	return listen, nil
+}
+
+// isUnixListen reports whether the listen address is a unix domain socket, which has no port
+func isUnixListen(listen string) bool {
+	return strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "@")
+}
+
+// listensOverlap reports whether inbounds on the two addresses would fight over the same port
+func listensOverlap(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, listen := range []string{a, b} {
+		if listen == "" {
+			return true
+		}
+		if ip := net.ParseIP(listen); ip != nil && ip.IsUnspecified() {
+			return true
+		}
+	}
+	return false
+}
@@ -22,6 +22,7 @@ import (
 )
 
 var trafficRegex = regexp.MustCompile("(inbound|outbound)>>>([^>]+)>>>traffic>>>(downlink|uplink)")
+var clientTrafficRegex = regexp.MustCompile("user>>>([^>]+)>>>traffic>>>(downlink|uplink)")
 
 func GetBinaryName() string {
 	return fmt.Sprintf("xray-%s-%s", runtime.GOOS, runtime.GOARCH)
@@ -229,13 +230,14 @@ func (p *process) Stop() error {
 	return p.cmd.Process.Kill()
 }
 
-func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
+// GetTraffic returns the traffic of inbounds and outbounds and of clients since the last reset
+func (p *process) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 	if p.apiPort == 0 {
-		return nil, common.NewError("xray api port wrong:", p.apiPort)
+		return nil, nil, common.NewError("xray api port wrong:", p.apiPort)
 	}
 	conn, err := grpc.Dial(fmt.Sprintf("127.0.0.1:%v", p.apiPort), grpc.WithInsecure())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer conn.Close()
 
@@ -247,12 +249,32 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
 	}
 	resp, err := client.QueryStats(ctx, request)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	tagTrafficMap := map[string]*Traffic{}
 	traffics := make([]*Traffic, 0)
+	emailTrafficMap := map[string]*ClientTraffic{}
+	clientTraffics := make([]*ClientTraffic, 0)
 	for _, stat := range resp.GetStat() {
+		if matchs := clientTrafficRegex.FindStringSubmatch(stat.Name); len(matchs) == 3 {
+			email := matchs[1]
+			clientTraffic, ok := emailTrafficMap[email]
+			if !ok {
+				clientTraffic = &ClientTraffic{Email: email}
+				emailTrafficMap[email] = clientTraffic
+				clientTraffics = append(clientTraffics, clientTraffic)
+			}
+			if matchs[2] == "downlink" {
+				clientTraffic.Down = stat.Value
+			} else {
+				clientTraffic.Up = stat.Value
+			}
+			continue
+		}
 		matchs := trafficRegex.FindStringSubmatch(stat.Name)
+		if len(matchs) < 4 {
+			continue
+		}
 		isInbound := matchs[1] == "inbound"
 		tag := matchs[2]
 		isDown := matchs[3] == "downlink"
@@ -275,5 +297,5 @@ func (p *process) GetTraffic(reset bool) ([]*Traffic, error) {
 		}
 	}
 
-	return traffics, nil
+	return traffics, clientTraffics, nil
 }
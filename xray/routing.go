@@ -0,0 +1,20 @@
+package xray
+
+type RoutingRule struct {
+	Type        string   `json:"type"`
+	Domain      []string `json:"domain,omitempty"`
+	IP          []string `json:"ip,omitempty"`
+	Port        string   `json:"port,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	Protocol    []string `json:"protocol,omitempty"`
+	User        []string `json:"user,omitempty"`
+	InboundTag  []string `json:"inboundTag,omitempty"`
+	OutboundTag string   `json:"outboundTag,omitempty"`
+	BalancerTag string   `json:"balancerTag,omitempty"`
+}
+
+// Balancer picks one of the outbounds whose tag starts with a selector entry for each connection
+type Balancer struct {
+	Tag      string   `json:"tag"`
+	Selector []string `json:"selector"`
+}
@@ -6,3 +6,11 @@ type Traffic struct {
 	Up        int64
 	Down      int64
 }
+
+// ClientTraffic is the traffic of a client, xray only counts it for clients with an email
+// on a level with statsUserUplink and statsUserDownlink on
+type ClientTraffic struct {
+	Email string
+	Up    int64
+	Down  int64
+}
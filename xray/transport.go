@@ -0,0 +1,114 @@
+package xray
+
+import (
+	"encoding/json"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
+)
+
+// TransportConfig is the global transport block, it holds the default settings of each transport
+type TransportConfig struct {
+	TCPSettings  json_util.RawMessage `json:"tcpSettings,omitempty"`
+	KCPSettings  json_util.RawMessage `json:"kcpSettings,omitempty"`
+	WSSettings   json_util.RawMessage `json:"wsSettings,omitempty"`
+	HTTPSettings json_util.RawMessage `json:"httpSettings,omitempty"`
+	DSSettings   json_util.RawMessage `json:"dsSettings,omitempty"`
+	QUICSettings json_util.RawMessage `json:"quicSettings,omitempty"`
+	GRPCSettings json_util.RawMessage `json:"grpcSettings,omitempty"`
+
+	// fields not known here, kept so they survive a round trip
+	extra map[string]json.RawMessage
+}
+
+var transportFields = []string{
+	"tcpSettings", "kcpSettings", "wsSettings", "httpSettings", "dsSettings", "quicSettings", "grpcSettings",
+}
+
+func (c *TransportConfig) fields() []*json_util.RawMessage {
+	return []*json_util.RawMessage{
+		&c.TCPSettings, &c.KCPSettings, &c.WSSettings, &c.HTTPSettings, &c.DSSettings, &c.QUICSettings, &c.GRPCSettings,
+	}
+}
+
+func (c *TransportConfig) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	for i, field := range c.fields() {
+		if value, ok := fields[transportFields[i]]; ok {
+			*field = json_util.RawMessage(value)
+			delete(fields, transportFields[i])
+		}
+	}
+	c.extra = fields
+	return nil
+}
+
+func (c *TransportConfig) MarshalJSON() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	for key, value := range c.extra {
+		fields[key] = value
+	}
+	for i, field := range c.fields() {
+		if len(*field) > 0 {
+			fields[transportFields[i]] = json.RawMessage(*field)
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Validate checks every transport block is a json object
+func (c *TransportConfig) Validate() error {
+	for i, field := range c.fields() {
+		if len(*field) == 0 {
+			continue
+		}
+		settings := map[string]interface{}{}
+		if err := json.Unmarshal(*field, &settings); err != nil {
+			return common.NewErrorf("transport %v is not a valid object: %v", transportFields[i], err)
+		}
+	}
+	return nil
+}
+
+// SockoptConfig is the socket options of a stream, used by transparent proxy setups
+type SockoptConfig struct {
+	Mark        int    `json:"mark,omitempty"`
+	TCPFastOpen bool   `json:"tcpFastOpen,omitempty"`
+	TProxy      string `json:"tproxy,omitempty"`
+}
+
+func (c *SockoptConfig) Validate() error {
+	if c.Mark < 0 {
+		return common.NewError("sockopt mark can not be negative:", c.Mark)
+	}
+	switch c.TProxy {
+	case "", "off", "redirect", "tproxy":
+	default:
+		return common.NewError("sockopt tproxy must be one of off, redirect or tproxy:", c.TProxy)
+	}
+	return nil
+}
+
+// SetStreamSockopt returns streamSettings with its sockopt replaced, other fields are kept
+func SetStreamSockopt(streamSettings []byte, sockopt *SockoptConfig) ([]byte, error) {
+	settings := map[string]interface{}{}
+	if len(streamSettings) > 0 {
+		err := json.Unmarshal(streamSettings, &settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if sockopt == nil {
+		delete(settings, "sockopt")
+	} else {
+		err := sockopt.Validate()
+		if err != nil {
+			return nil, err
+		}
+		settings["sockopt"] = sockopt
+	}
+	return json.MarshalIndent(settings, "", "  ")
+}
@@ -0,0 +1,100 @@
+package xray
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTransportConfigRoundTrip(t *testing.T) {
+	data := `{
+		"tcpSettings": {"header": {"type": "none"}},
+		"grpcSettings": {"idle_timeout": 60},
+		"future": {"a": 1}
+	}`
+	c := &TransportConfig{}
+	err := json.Unmarshal([]byte(data), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.TCPSettings) == 0 || len(c.GRPCSettings) == 0 || len(c.WSSettings) != 0 {
+		t.Errorf("TransportConfig = %+v", c)
+	}
+	err = c.Validate()
+	if err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	marshaled, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(marshaled, &got)
+	json.Unmarshal([]byte(data), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %s, want %s", marshaled, data)
+	}
+}
+
+func TestTransportConfigValidate(t *testing.T) {
+	tests := []struct {
+		data    string
+		wantErr bool
+	}{
+		{`{}`, false},
+		{`{"wsSettings": {"path": "/"}}`, false},
+		{`{"wsSettings": "/"}`, true},
+		{`{"kcpSettings": [1]}`, true},
+	}
+	for _, tt := range tests {
+		c := &TransportConfig{}
+		err := json.Unmarshal([]byte(tt.data), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate() of %v = %v, wantErr %v", tt.data, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetStreamSockopt(t *testing.T) {
+	tests := []struct {
+		name           string
+		streamSettings string
+		sockopt        *SockoptConfig
+		wantErr        bool
+		want           string
+	}{
+		{"mark", `{"network": "tcp", "security": "none"}`, &SockoptConfig{Mark: 255}, false,
+			`{"network": "tcp", "security": "none", "sockopt": {"mark": 255}}`},
+		{"tproxy replaces the old sockopt", `{"network": "tcp", "sockopt": {"mark": 1}}`, &SockoptConfig{TProxy: "tproxy"}, false,
+			`{"network": "tcp", "sockopt": {"tproxy": "tproxy"}}`},
+		{"empty stream settings", ``, &SockoptConfig{Mark: 2, TCPFastOpen: true}, false,
+			`{"sockopt": {"mark": 2, "tcpFastOpen": true}}`},
+		{"removed", `{"network": "ws", "sockopt": {"mark": 1}}`, nil, false, `{"network": "ws"}`},
+		{"negative mark", `{"network": "tcp"}`, &SockoptConfig{Mark: -1}, true, ``},
+		{"unknown tproxy", `{"network": "tcp"}`, &SockoptConfig{TProxy: "on"}, true, ``},
+		{"invalid stream settings", `{`, &SockoptConfig{Mark: 1}, true, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := SetStreamSockopt([]byte(tt.streamSettings), tt.sockopt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetStreamSockopt() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got, want interface{}
+			err = json.Unmarshal(data, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("SetStreamSockopt() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}